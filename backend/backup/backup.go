@@ -0,0 +1,448 @@
+// Package backup implements a deduplicating encrypted backup
+// repository on top of another remote
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+var errorReadOnly = errors.New("backup snapshots are read only - use the backup command to make a new one")
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "backup",
+		Description: "Deduplicating encrypted backups of other remotes",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name:     "remote",
+			Help:     "Remote to store the backup repository in.\n\nNormally should contain a ':' and a path, e.g. \"myremote:path/to/dir\".",
+			Required: true,
+		}, {
+			Name:       "password",
+			Help:       "Password for the backup repository.",
+			IsPassword: true,
+			Required:   true,
+		}, {
+			Name: "chunk_size",
+			Help: `Average size of the chunks files are split into.
+
+Files are split into chunks at places determined by their contents so
+that unchanged parts of modified files don't need storing again. This
+is rounded down to a power of 2 and only used when the repository is
+created.`,
+			Default:  fs.SizeSuffix(1024 * 1024),
+			Advanced: true,
+		}, {
+			Name: "pack_size",
+			Help: `Size of the pack files the encrypted chunks are stored in.
+
+Chunks are gathered into packs before uploading so there are fewer
+files in the repository.`,
+			Default:  fs.SizeSuffix(16 * 1024 * 1024),
+			Advanced: true,
+		}, {
+			Name:     "keep_last",
+			Help:     "Number of most recent snapshots of each source to keep when forgetting snapshots.",
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name:     "keep_hourly",
+			Help:     "Number of hourly snapshots of each source to keep when forgetting snapshots.",
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name:     "keep_daily",
+			Help:     "Number of daily snapshots of each source to keep when forgetting snapshots.",
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name:     "keep_weekly",
+			Help:     "Number of weekly snapshots of each source to keep when forgetting snapshots.",
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name:     "keep_monthly",
+			Help:     "Number of monthly snapshots of each source to keep when forgetting snapshots.",
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name:     "keep_yearly",
+			Help:     "Number of yearly snapshots of each source to keep when forgetting snapshots.",
+			Default:  0,
+			Advanced: true,
+		}, {
+			Name:     "keep_within",
+			Help:     "Keep all the snapshots of each source newer than this when forgetting snapshots.",
+			Default:  fs.Duration(0),
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Remote      string        `config:"remote"`
+	Password    string        `config:"password"`
+	ChunkSize   fs.SizeSuffix `config:"chunk_size"`
+	PackSize    fs.SizeSuffix `config:"pack_size"`
+	KeepLast    int           `config:"keep_last"`
+	KeepHourly  int           `config:"keep_hourly"`
+	KeepDaily   int           `config:"keep_daily"`
+	KeepWeekly  int           `config:"keep_weekly"`
+	KeepMonthly int           `config:"keep_monthly"`
+	KeepYearly  int           `config:"keep_yearly"`
+	KeepWithin  fs.Duration   `config:"keep_within"`
+}
+
+// Fs represents a backup repository
+type Fs struct {
+	name     string
+	root     string
+	opt      Options
+	password string
+	base     fs.Fs // the remote the repository is stored in
+	features *fs.Features
+	keys     *keys // nil if the repository isn't initialised
+
+	mu        sync.Mutex
+	index     map[string]blob      // where each chunk is stored, nil until loaded
+	snapshots map[string]*snapshot // snapshots loaded so far
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(opt.Remote, name+":") {
+		return nil, errors.New("can't point backup remote at itself - check the value of the remote setting")
+	}
+	password, err := obscure.Reveal(opt.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt password: %w", err)
+	}
+	if password == "" {
+		return nil, errors.New("password not set in config file")
+	}
+	if opt.ChunkSize < 1024 {
+		return nil, errors.New("chunk_size must be at least 1 KiB")
+	}
+	base, err := cache.Get(ctx, opt.Remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make remote %q to store backups in: %w", opt.Remote, err)
+	}
+	root = strings.Trim(path.Clean("/"+root), "/")
+	f := &Fs{
+		name:      name,
+		root:      root,
+		opt:       *opt,
+		password:  password,
+		base:      base,
+		snapshots: map[string]*snapshot{},
+	}
+	cache.PinUntilFinalized(f.base, f)
+	f.features = (&fs.Features{
+		CanHaveEmptyDirectories: true,
+	}).Fill(ctx, f)
+	err = f.openRepo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check to see if the root is a file
+	if name, rest := splitSnapshot(root); rest != "" {
+		s, err := f.getSnapshot(ctx, name)
+		if err == nil && s.files[rest] != nil {
+			f.root = parentDir(root)
+			return f, fs.ErrorIsFile
+		}
+	}
+	return f, nil
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("Backup repository '%s:%s'", f.name, f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision of the ModTimes in this Fs
+func (f *Fs) Precision() time.Duration {
+	return time.Nanosecond
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() hash.Set {
+	return hash.Set(hash.MD5)
+}
+
+// fullPath returns the path of remote within the repository
+func (f *Fs) fullPath(remote string) string {
+	return strings.Trim(path.Join(f.root, remote), "/")
+}
+
+// List the objects and directories in dir into entries. The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	full := f.fullPath(dir)
+	if full == "" {
+		names, err := f.snapshotNames(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			t, err := parseSnapshotName(name)
+			if err != nil {
+				continue
+			}
+			entries = append(entries, fs.NewDir(path.Join(dir, name), t))
+		}
+		return entries, nil
+	}
+	name, rest := splitSnapshot(full)
+	s, err := f.getSnapshot(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if _, found := s.dirs[rest]; !found {
+		return nil, fs.ErrorDirNotFound
+	}
+	for _, leaf := range s.tree[rest] {
+		remote := path.Join(dir, leaf)
+		p := path.Join(rest, leaf)
+		if file, ok := s.files[p]; ok {
+			entries = append(entries, &Object{fs: f, remote: remote, file: file})
+		} else {
+			entries = append(entries, fs.NewDir(remote, s.dirs[p].ModTime))
+		}
+	}
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error fs.ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	name, rest := splitSnapshot(f.fullPath(remote))
+	if rest == "" {
+		return nil, fs.ErrorIsDir
+	}
+	s, err := f.getSnapshot(ctx, name)
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, fs.ErrorObjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	file, ok := s.files[rest]
+	if !ok {
+		if _, isDir := s.dirs[rest]; isDir {
+			return nil, fs.ErrorIsDir
+		}
+		return nil, fs.ErrorObjectNotFound
+	}
+	return &Object{fs: f, remote: remote, file: file}, nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return nil, errorReadOnly
+}
+
+// Mkdir makes the directory (container, bucket)
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return errorReadOnly
+}
+
+// Rmdir removes the directory (container, bucket) if empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	return errorReadOnly
+}
+
+// Object describes a file in a snapshot
+type Object struct {
+	fs     *Fs
+	remote string
+	file   *snapshotFile
+}
+
+// Fs returns the parent Fs
+func (o *Object) Fs() fs.Info {
+	return o.fs
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Hash returns the MD5 of the file
+func (o *Object) Hash(ctx context.Context, t hash.Type) (string, error) {
+	if t != hash.MD5 {
+		return "", hash.ErrUnsupported
+	}
+	return o.file.MD5, nil
+}
+
+// Size returns the size of the file
+func (o *Object) Size() int64 {
+	return o.file.Size
+}
+
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	return o.file.ModTime
+}
+
+// SetModTime sets the modification time of the file
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	return errorReadOnly
+}
+
+// Storable returns a boolean showing whether this object storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// Open an object for read
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.file.Size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	if limit < 0 || offset+limit > o.file.Size {
+		limit = o.file.Size - offset
+	}
+	r := &chunkReader{
+		ctx:       ctx,
+		f:         o.fs,
+		chunks:    o.file.Chunks,
+		remaining: max(limit, 0),
+		packs:     map[string]fs.Object{},
+	}
+	// Find the chunk the offset is in
+	for r.i < len(r.chunks) {
+		b, err := o.fs.lookup(ctx, r.chunks[r.i])
+		if err != nil {
+			return nil, err
+		}
+		if offset < b.Size {
+			break
+		}
+		offset -= b.Size
+		r.i++
+	}
+	r.skip = offset
+	return r, nil
+}
+
+// Update the object with the contents of the io.Reader
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	return errorReadOnly
+}
+
+// Remove an object
+func (o *Object) Remove(ctx context.Context) error {
+	return errorReadOnly
+}
+
+// chunkReader reads a file from its chunks
+type chunkReader struct {
+	ctx       context.Context
+	f         *Fs
+	chunks    []string             // IDs of the chunks in the file
+	i         int                  // index of the next chunk to read
+	skip      int64                // bytes to skip in the next chunk
+	remaining int64                // bytes left to read
+	buf       []byte               // unread data from the current chunk
+	packs     map[string]fs.Object // pack objects found so far
+}
+
+// Read from the file
+func (r *chunkReader) Read(p []byte) (n int, err error) {
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if len(r.buf) == 0 {
+		if r.i >= len(r.chunks) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		data, err := r.f.readChunk(r.ctx, r.chunks[r.i], r.packs)
+		if err != nil {
+			return 0, err
+		}
+		r.i++
+		r.buf = data[min(r.skip, int64(len(data))):]
+		r.skip = 0
+	}
+	n = copy(p, r.buf[:min(int64(len(r.buf)), r.remaining)])
+	r.buf = r.buf[n:]
+	r.remaining -= int64(n)
+	return n, nil
+}
+
+// Close the reader
+func (r *chunkReader) Close() error {
+	return nil
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs        = &Fs{}
+	_ fs.Commander = &Fs{}
+	_ fs.Object    = &Object{}
+)
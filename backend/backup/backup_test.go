@@ -0,0 +1,320 @@
+package backup
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readObject reads remote from f
+func readObject(t *testing.T, ctx context.Context, f fs.Fs, remote string, options ...fs.OpenOption) string {
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	in, err := o.Open(ctx, options...)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+func TestBackup(t *testing.T) {
+	fstest.Initialise()
+	ctx := context.Background()
+	srcDir := t.TempDir()
+	repoDir := t.TempDir()
+	write := func(name string, contents []byte) {
+		p := filepath.Join(srcDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0777))
+		require.NoError(t, os.WriteFile(p, contents, 0666))
+	}
+	small := []byte(random.String(1000))
+	big := []byte(random.String(1 << 20))
+	write("small.txt", small)
+	write("dir/big.bin", big)
+	require.NoError(t, os.Mkdir(filepath.Join(srcDir, "empty"), 0777))
+
+	m := configmap.Simple{
+		"type":       "backup",
+		"remote":     repoDir,
+		"password":   obscure.MustObscure("potato"),
+		"chunk_size": "16k",
+		"pack_size":  "64k",
+	}
+	newFs := func(root string) (fs.Fs, error) {
+		return NewFs(ctx, "TestBackup", root, m)
+	}
+	f, err := newFs("")
+	require.NoError(t, err)
+	b := f.(*Fs)
+
+	// No snapshots until a backup is made
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, entries, 0)
+	_, err = b.prune(ctx)
+	assert.ErrorIs(t, err, errorNotInitialised)
+
+	fsrc, err := fs.NewFs(ctx, srcDir)
+	require.NoError(t, err)
+	stats, err := b.backup(ctx, fsrc)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Files)
+	assert.Equal(t, 2, stats.Dirs)
+	assert.Equal(t, int64(len(small)+len(big)), stats.Bytes)
+	first := stats.Snapshot
+
+	// The snapshot can be read in a new Fs
+	f, err = newFs("")
+	require.NoError(t, err)
+	entries, err = f.List(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, first, entries[0].Remote())
+	entries, err = f.List(ctx, first)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Remote())
+	}
+	assert.Equal(t, []string{first + "/dir", first + "/empty", first + "/small.txt"}, names)
+	assert.Equal(t, string(big), readObject(t, ctx, f, first+"/dir/big.bin"))
+	assert.Equal(t, string(big[50000:70000]), readObject(t, ctx, f, first+"/dir/big.bin", &fs.RangeOption{Start: 50000, End: 69999}))
+	o, err := f.NewObject(ctx, first+"/small.txt")
+	require.NoError(t, err)
+	sum := md5.Sum(small)
+	gotSum, err := o.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(sum[:]), gotSum)
+	_, err = f.NewObject(ctx, first+"/dir")
+	assert.ErrorIs(t, err, fs.ErrorIsDir)
+	_, err = f.List(ctx, "2001-01-01-000000")
+	assert.ErrorIs(t, err, fs.ErrorDirNotFound)
+	assert.Error(t, o.Remove(ctx))
+
+	// Pointing at a file gives its directory
+	ffile, err := newFs(first + "/dir/big.bin")
+	assert.Equal(t, fs.ErrorIsFile, err)
+	assert.Equal(t, first+"/dir", ffile.Root())
+
+	// The wrong password is rejected
+	m.Set("password", obscure.MustObscure("wrong"))
+	_, err = newFs("")
+	assert.ErrorContains(t, err, "wrong password")
+	m.Set("password", obscure.MustObscure("potato"))
+
+	// Change the middle of the big file and back up again - the
+	// unchanged file and most of the big one shouldn't be stored again
+	modified := append([]byte{}, big...)
+	copy(modified[500000:], "modified")
+	write("dir/big.bin", modified)
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(srcDir, "dir/big.bin"), later, later))
+	b = f.(*Fs)
+	stats, err = b.backup(ctx, fsrc)
+	require.NoError(t, err)
+	second := stats.Snapshot
+	assert.Equal(t, first, stats.Parent)
+	assert.Equal(t, 1, stats.Unchanged)
+	assert.Less(t, stats.Added, int64(len(big)/4))
+	assert.Equal(t, string(modified), readObject(t, ctx, f, path.Join(second, "dir/big.bin")))
+	assert.Equal(t, string(big), readObject(t, ctx, f, path.Join(first, "dir/big.bin")))
+
+	infos, err := b.listSnapshots(ctx)
+	require.NoError(t, err)
+	require.Len(t, infos, 2)
+	assert.Equal(t, fs.ConfigString(fsrc), infos[0].Source)
+
+	// Remove the big file and back up again
+	require.NoError(t, os.Remove(filepath.Join(srcDir, "dir/big.bin")))
+	stats, err = b.backup(ctx, fsrc)
+	require.NoError(t, err)
+	third := stats.Snapshot
+	assert.Equal(t, 1, stats.Files)
+
+	// Forget all but the last snapshot and prune the big file's data
+	_, err = b.retention(nil)
+	assert.Error(t, err)
+	policy, err := b.retention(map[string]string{"keep-last": "1"})
+	require.NoError(t, err)
+	fstats, err := b.forget(ctx, policy, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{third}, fstats.Kept)
+	assert.Equal(t, []string{first, second}, fstats.Removed)
+	require.NotNil(t, fstats.Prune)
+	assert.Greater(t, fstats.Prune.BytesRemoved, int64(len(big)))
+
+	// The remaining snapshot can still be read after the prune
+	f, err = newFs("")
+	require.NoError(t, err)
+	entries, err = f.List(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, string(small), readObject(t, ctx, f, path.Join(third, "small.txt")))
+	entries, err = f.List(ctx, path.Join(third, "dir"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 0)
+}
+
+func TestRetentionPolicy(t *testing.T) {
+	now := time.Date(2025, 6, 15, 12, 0, 0, 0, time.Local)
+	var infos []snapshotInfo
+	for i := range 60 {
+		when := now.Add(-time.Duration(i) * 12 * time.Hour)
+		infos = append(infos, snapshotInfo{Name: when.UTC().Format(snapshotTime), Time: when})
+	}
+	name := func(i int) string {
+		return infos[i].Name
+	}
+	for _, test := range []struct {
+		policy retentionPolicy
+		want   []int
+	}{
+		{retentionPolicy{Last: 3}, []int{0, 1, 2}},
+		{retentionPolicy{Daily: 3}, []int{0, 2, 4}},
+		{retentionPolicy{Last: 1, Daily: 2}, []int{0, 2}},
+		{retentionPolicy{Within: 36 * time.Hour}, []int{0, 1, 2, 3}},
+		{retentionPolicy{Monthly: 2}, []int{0, 30}},
+	} {
+		keep := test.policy.keep(infos, now)
+		var want = map[string]bool{}
+		for _, i := range test.want {
+			want[name(i)] = true
+		}
+		assert.Equal(t, want, keep, "%+v", test.policy)
+	}
+}
+
+func TestLock(t *testing.T) {
+	fstest.Initialise()
+	ctx := context.Background()
+	srcDir := t.TempDir()
+	repoDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(srcDir, "file.txt"), []byte("hello"), 0666))
+	f, err := NewFs(ctx, "TestBackup", "", configmap.Simple{
+		"type":       "backup",
+		"remote":     repoDir,
+		"password":   obscure.MustObscure("potato"),
+		"chunk_size": "16k",
+		"pack_size":  "64k",
+	})
+	require.NoError(t, err)
+	b := f.(*Fs)
+	fsrc, err := fs.NewFs(ctx, srcDir)
+	require.NoError(t, err)
+	_, err = b.backup(ctx, fsrc)
+	require.NoError(t, err)
+	lockNames := func() []string {
+		names, err := b.listNames(ctx, locksDir)
+		require.NoError(t, err)
+		return names
+	}
+	assert.Len(t, lockNames(), 0)
+
+	// A backup in progress stops prune and forget but not another backup
+	l, err := b.lock(ctx, false)
+	require.NoError(t, err)
+	assert.Len(t, lockNames(), 1)
+	_, err = b.prune(ctx)
+	assert.ErrorContains(t, err, "repository is locked: shared lock")
+	_, err = b.forget(ctx, retentionPolicy{Last: 1}, true)
+	assert.ErrorContains(t, err, "repository is locked")
+	_, err = b.backup(ctx, fsrc)
+	require.NoError(t, err)
+	assert.Len(t, lockNames(), 1)
+	l.unlock(ctx)
+	assert.Len(t, lockNames(), 0)
+
+	// A prune in progress stops a backup
+	l, err = b.lock(ctx, true)
+	require.NoError(t, err)
+	_, err = b.backup(ctx, fsrc)
+	assert.ErrorContains(t, err, "repository is locked: exclusive lock")
+	l.unlock(ctx)
+	_, err = b.prune(ctx)
+	require.NoError(t, err)
+
+	// Stale locks are ignored
+	stale := &lockFile{Time: time.Now().Add(-2 * lockStale), Exclusive: true}
+	require.NoError(t, b.writeEncrypted(ctx, path.Join(locksDir, randomID()), stale))
+	_, err = b.prune(ctx)
+	require.NoError(t, err)
+	_, err = b.backup(ctx, fsrc)
+	require.NoError(t, err)
+}
+
+// Backups of different sources made in the same second mustn't
+// overwrite each other
+func TestBackupSameSecond(t *testing.T) {
+	fstest.Initialise()
+	ctx := context.Background()
+	repoDir := t.TempDir()
+	f, err := NewFs(ctx, "TestBackup", "", configmap.Simple{
+		"type":       "backup",
+		"remote":     repoDir,
+		"password":   obscure.MustObscure("potato"),
+		"chunk_size": "16k",
+		"pack_size":  "64k",
+	})
+	require.NoError(t, err)
+	b := f.(*Fs)
+	var names []string
+	for i := range 2 {
+		srcDir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(srcDir, "file.txt"), []byte(fmt.Sprint("hello ", i)), 0666))
+		fsrc, err := fs.NewFs(ctx, srcDir)
+		require.NoError(t, err)
+		stats, err := b.backup(ctx, fsrc)
+		require.NoError(t, err)
+		names = append(names, stats.Snapshot)
+	}
+	assert.NotEqual(t, names[0], names[1])
+	entries, err := f.List(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	for i, name := range names {
+		assert.Equal(t, fmt.Sprint("hello ", i), readObject(t, ctx, f, name+"/file.txt"))
+	}
+}
+
+func TestParseSnapshotName(t *testing.T) {
+	when := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	name := snapshotName(when)
+	assert.Regexp(t, `^2025-06-01-120000-[0-9a-f]{8}$`, name)
+	for _, test := range []struct {
+		name    string
+		wantErr bool
+	}{
+		{name, false},
+		{"2025-06-01-120000", false},
+		{"2025-06-01-120000-", true},
+		{"2025-06-01-120000-potatoes", true},
+		{"2025-06-01-120000-0123456789", true},
+		{"potato", true},
+	} {
+		got, err := parseSnapshotName(test.name)
+		if test.wantErr {
+			assert.Error(t, err, test.name)
+		} else {
+			require.NoError(t, err, test.name)
+			assert.Equal(t, when, got, test.name)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package backup
+
+import (
+	"bufio"
+	"io"
+	"math/bits"
+)
+
+// chunker splits a stream into content defined chunks.
+//
+// It uses a gear hash, as in FastCDC, so that inserting or removing
+// data in a file only changes the chunks around the change and the
+// rest can be deduplicated.
+type chunker struct {
+	in    *bufio.Reader
+	gear  *[256]uint64
+	min   int    // minimum chunk size
+	avg   int    // average chunk size
+	max   int    // maximum chunk size
+	maskS uint64 // mask used below the average size - harder to match
+	maskL uint64 // mask used above the average size - easier to match
+	buf   []byte
+}
+
+// newChunker makes a chunker reading from in which makes chunks of
+// about avg bytes, which should be a power of 2
+func newChunker(in io.Reader, gear *[256]uint64, avg int) *chunker {
+	n := bits.Len(uint(avg)) - 1
+	return &chunker{
+		in:    bufio.NewReaderSize(in, 1<<20),
+		gear:  gear,
+		min:   avg / 4,
+		avg:   avg,
+		max:   avg * 4,
+		maskS: ^uint64(0) << (64 - n - 1),
+		maskL: ^uint64(0) << (64 - n + 1),
+		buf:   make([]byte, 0, avg*4),
+	}
+}
+
+// next returns the next chunk or io.EOF if there are no more.
+//
+// The chunk is only valid until the next call.
+func (c *chunker) next() ([]byte, error) {
+	c.buf = c.buf[:0]
+	var h uint64
+	for {
+		b, err := c.in.ReadByte()
+		if err == io.EOF {
+			if len(c.buf) == 0 {
+				return nil, io.EOF
+			}
+			return c.buf, nil
+		} else if err != nil {
+			return nil, err
+		}
+		c.buf = append(c.buf, b)
+		n := len(c.buf)
+		if n < c.min {
+			continue
+		}
+		h = (h << 1) + c.gear[b]
+		mask := c.maskS
+		if n >= c.avg {
+			mask = c.maskL
+		}
+		if h&mask == 0 || n >= c.max {
+			return c.buf, nil
+		}
+	}
+}
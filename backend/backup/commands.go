@@ -0,0 +1,727 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "backup",
+	Short: "Make a new snapshot of a source.",
+	Long: `Reads all the files in the source and stores the ones which have
+changed since the last snapshot of the same source as a new snapshot.
+The repository is created if it doesn't exist.
+
+Usage Example:
+
+    rclone backend backup backup: /home/user
+
+The filter flags can be used to choose which files are backed up.
+`,
+}, {
+	Name:  "snapshots",
+	Short: "List the snapshots.",
+	Long: `List the snapshots in the repository with the source they were
+made from, the number of files and their total size.
+
+Usage Example:
+
+    rclone backend snapshots backup:
+`,
+}, {
+	Name:  "forget",
+	Short: "Remove snapshots according to the retention policy.",
+	Long: `Removes the snapshots of each source which aren't kept by the
+retention policy then prunes the data they used.
+
+The retention policy is set with the keep_* options in the config and
+can be overridden with the same options here, eg
+
+    rclone backend forget backup: -o keep-daily=7 -o keep-weekly=4
+
+Use --dry-run to see what would be removed.
+`,
+	Opts: map[string]string{
+		"keep-last":    "Number of most recent snapshots to keep",
+		"keep-hourly":  "Number of hourly snapshots to keep",
+		"keep-daily":   "Number of daily snapshots to keep",
+		"keep-weekly":  "Number of weekly snapshots to keep",
+		"keep-monthly": "Number of monthly snapshots to keep",
+		"keep-yearly":  "Number of yearly snapshots to keep",
+		"keep-within":  "Keep all snapshots newer than this duration",
+		"no-prune":     "Don't prune the data after forgetting snapshots",
+	},
+}, {
+	Name:  "prune",
+	Short: "Remove data no longer used by any snapshot.",
+	Long: `Removes packs which aren't used by any snapshot and rewrites packs
+which are mostly unused.
+
+This fails if a backup is running on the repository.
+
+Usage Example:
+
+    rclone backend prune backup:
+`,
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out any, err error) {
+	switch name {
+	case "backup":
+		if len(arg) != 1 {
+			return nil, errors.New("need exactly one source to back up")
+		}
+		fsrc, err := cache.Get(ctx, arg[0])
+		if err != nil {
+			return nil, err
+		}
+		return f.backup(ctx, fsrc)
+	case "snapshots":
+		return f.listSnapshots(ctx)
+	case "forget":
+		policy, err := f.retention(opt)
+		if err != nil {
+			return nil, err
+		}
+		_, noPrune := opt["no-prune"]
+		return f.forget(ctx, policy, !noPrune)
+	case "prune":
+		return f.prune(ctx)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// packer gathers encrypted chunks into packs
+type packer struct {
+	f     *Fs
+	id    string          // ID of the pack being filled
+	buf   bytes.Buffer    // contents of the pack
+	blobs map[string]blob // chunks in the pack being filled
+	added map[string]blob // chunks in the packs written so far
+	bytes int64           // bytes written
+}
+
+func newPacker(f *Fs) *packer {
+	return &packer{
+		f:     f,
+		blobs: map[string]blob{},
+		added: map[string]blob{},
+	}
+}
+
+// has returns true if the chunk with id is stored already
+func (p *packer) has(id string) bool {
+	if _, found := p.blobs[id]; found {
+		return true
+	}
+	if _, found := p.added[id]; found {
+		return true
+	}
+	p.f.mu.Lock()
+	defer p.f.mu.Unlock()
+	_, found := p.f.index[id]
+	return found
+}
+
+// add the chunk with id to the pack, writing it if it is full
+func (p *packer) add(ctx context.Context, id string, data []byte) error {
+	if p.has(id) {
+		return nil
+	}
+	if p.id == "" {
+		p.id = randomID()
+	}
+	sealed := p.f.keys.seal(data)
+	p.blobs[id] = blob{
+		Pack:   p.id,
+		Offset: int64(p.buf.Len()),
+		Length: int64(len(sealed)),
+		Size:   int64(len(data)),
+	}
+	p.buf.Write(sealed)
+	if p.buf.Len() >= int(p.f.opt.PackSize) {
+		return p.flush(ctx)
+	}
+	return nil
+}
+
+// flush writes the pack being filled
+func (p *packer) flush(ctx context.Context) error {
+	if p.buf.Len() == 0 {
+		return nil
+	}
+	err := p.f.writeFile(ctx, packPath(p.id), p.buf.Bytes())
+	if err != nil {
+		return err
+	}
+	p.bytes += int64(p.buf.Len())
+	p.f.mu.Lock()
+	for id, b := range p.blobs {
+		p.added[id] = b
+		p.f.index[id] = b
+	}
+	p.f.mu.Unlock()
+	p.id = ""
+	p.buf.Reset()
+	p.blobs = map[string]blob{}
+	return nil
+}
+
+// finish writes the last pack and an index of all the packs written
+func (p *packer) finish(ctx context.Context) error {
+	err := p.flush(ctx)
+	if err != nil || len(p.added) == 0 {
+		return err
+	}
+	return p.f.writeEncrypted(ctx, path.Join(indexDir, randomID()), &indexFile{Blobs: p.added})
+}
+
+// backupStats is the result of the backup command
+type backupStats struct {
+	Snapshot  string `json:"snapshot"`
+	Parent    string `json:"parent,omitempty"`
+	Files     int    `json:"files"`
+	Dirs      int    `json:"dirs"`
+	Unchanged int    `json:"unchanged"`
+	Bytes     int64  `json:"bytes"`
+	Added     int64  `json:"added"`
+}
+
+// latestSnapshot returns the most recent snapshot of source or nil
+func (f *Fs) latestSnapshot(ctx context.Context, source string) (*snapshot, error) {
+	names, err := f.snapshotNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range slices.Backward(names) {
+		s, err := f.getSnapshot(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if s.Source == source {
+			return s, nil
+		}
+	}
+	return nil, nil
+}
+
+// backupFile reads o into chunks, returning the entry for the snapshot
+func (f *Fs) backupFile(ctx context.Context, o fs.Object, p *packer) (file *snapshotFile, err error) {
+	tr := accounting.Stats(ctx).NewTransfer(o, f)
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+	in, err := o.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	acc := tr.Account(ctx, in)
+	defer fs.CheckClose(acc, &err)
+	file = &snapshotFile{
+		Path:    o.Remote(),
+		ModTime: o.ModTime(ctx),
+		Chunks:  []string{},
+	}
+	md5sum := md5.New()
+	c := newChunker(io.TeeReader(acc, md5sum), &f.keys.gear, f.keys.avg)
+	for {
+		data, err := c.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		id := f.keys.id(data)
+		err = p.add(ctx, id, data)
+		if err != nil {
+			return nil, err
+		}
+		file.Chunks = append(file.Chunks, id)
+		file.Size += int64(len(data))
+	}
+	file.MD5 = hex.EncodeToString(md5sum.Sum(nil))
+	return file, nil
+}
+
+// backup makes a new snapshot of fsrc
+func (f *Fs) backup(ctx context.Context, fsrc fs.Fs) (*backupStats, error) {
+	err := f.initRepo(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l, err := f.lock(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	defer l.unlock(ctx)
+	_, err = f.getIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	source := fs.ConfigString(fsrc)
+	parent, err := f.latestSnapshot(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	s := &snapshot{
+		Time:   time.Now().UTC().Truncate(time.Second),
+		Source: source,
+		Files:  []*snapshotFile{},
+		Dirs:   []*snapshotDir{},
+	}
+	s.Host, _ = os.Hostname()
+	stats := &backupStats{}
+	if parent != nil {
+		s.Parent = parent.Name
+		stats.Parent = parent.Name
+		// Make sure the snapshot sorts after its parent
+		if parentTime, err := parseSnapshotName(parent.Name); err == nil && !s.Time.After(parentTime) {
+			s.Time = parentTime.Add(time.Second)
+		}
+	}
+
+	var (
+		mu      sync.Mutex
+		objects []fs.Object
+	)
+	err = walk.ListR(ctx, fsrc, "", false, -1, walk.ListAll, func(entries fs.DirEntries) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, entry := range entries {
+			switch x := entry.(type) {
+			case fs.Object:
+				objects = append(objects, x)
+			case fs.Directory:
+				s.Dirs = append(s.Dirs, &snapshotDir{Path: x.Remote(), ModTime: x.ModTime(ctx)})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list source: %w", err)
+	}
+	slices.SortFunc(objects, func(a, b fs.Object) int {
+		return strings.Compare(a.Remote(), b.Remote())
+	})
+
+	var lastErr error
+	p := newPacker(f)
+	for _, o := range objects {
+		if parent != nil {
+			old := parent.files[o.Remote()]
+			if old != nil && old.Size == o.Size() && old.ModTime.Equal(o.ModTime(ctx)) {
+				s.Files = append(s.Files, old)
+				stats.Unchanged++
+				stats.Bytes += old.Size
+				continue
+			}
+		}
+		file, err := f.backupFile(ctx, o, p)
+		if err != nil {
+			fs.Errorf(o, "Failed to back up: %v", err)
+			lastErr = fs.CountError(ctx, err)
+			continue
+		}
+		s.Files = append(s.Files, file)
+		stats.Bytes += file.Size
+	}
+	err = p.finish(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Name = snapshotName(s.Time)
+	err = f.writeEncrypted(ctx, path.Join(snapshotsDir, s.Name), s)
+	if err != nil {
+		return nil, err
+	}
+	s.build()
+	f.mu.Lock()
+	f.snapshots[s.Name] = s
+	f.mu.Unlock()
+	stats.Snapshot = s.Name
+	stats.Files = len(s.Files)
+	stats.Dirs = len(s.Dirs)
+	stats.Added = p.bytes
+	fs.Infof(f, "Made snapshot %s of %d files (%v) adding %v", s.Name, stats.Files, fs.SizeSuffix(stats.Bytes), fs.SizeSuffix(stats.Added))
+	if lastErr != nil {
+		return stats, fmt.Errorf("snapshot %s is missing files which failed to back up: %w", s.Name, lastErr)
+	}
+	return stats, nil
+}
+
+// snapshotInfo describes a snapshot for the snapshots and forget commands
+type snapshotInfo struct {
+	Name   string    `json:"name"`
+	Time   time.Time `json:"time"`
+	Source string    `json:"source"`
+	Host   string    `json:"host"`
+	Files  int       `json:"files"`
+	Size   int64     `json:"size"`
+}
+
+// listSnapshots returns info about all the snapshots in time order
+func (f *Fs) listSnapshots(ctx context.Context) ([]snapshotInfo, error) {
+	names, err := f.snapshotNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	infos := []snapshotInfo{}
+	for _, name := range names {
+		s, err := f.getSnapshot(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, snapshotInfo{
+			Name:   s.Name,
+			Time:   s.Time,
+			Source: s.Source,
+			Host:   s.Host,
+			Files:  len(s.Files),
+			Size:   s.size(),
+		})
+	}
+	return infos, nil
+}
+
+// retentionPolicy says which snapshots to keep
+type retentionPolicy struct {
+	Last    int
+	Hourly  int
+	Daily   int
+	Weekly  int
+	Monthly int
+	Yearly  int
+	Within  time.Duration
+}
+
+// retention returns the retention policy from the config overridden
+// by opt
+func (f *Fs) retention(opt map[string]string) (policy retentionPolicy, err error) {
+	policy = retentionPolicy{
+		Last:    f.opt.KeepLast,
+		Hourly:  f.opt.KeepHourly,
+		Daily:   f.opt.KeepDaily,
+		Weekly:  f.opt.KeepWeekly,
+		Monthly: f.opt.KeepMonthly,
+		Yearly:  f.opt.KeepYearly,
+		Within:  time.Duration(f.opt.KeepWithin),
+	}
+	for key, p := range map[string]*int{
+		"keep-last":    &policy.Last,
+		"keep-hourly":  &policy.Hourly,
+		"keep-daily":   &policy.Daily,
+		"keep-weekly":  &policy.Weekly,
+		"keep-monthly": &policy.Monthly,
+		"keep-yearly":  &policy.Yearly,
+	} {
+		if value, found := opt[key]; found {
+			*p, err = strconv.Atoi(value)
+			if err != nil {
+				return policy, fmt.Errorf("bad %s: %w", key, err)
+			}
+		}
+	}
+	if value, found := opt["keep-within"]; found {
+		d, err := fs.ParseDuration(value)
+		if err != nil {
+			return policy, fmt.Errorf("bad keep-within: %w", err)
+		}
+		policy.Within = d
+	}
+	if policy == (retentionPolicy{}) {
+		return policy, errors.New("no retention policy set - use the keep options")
+	}
+	return policy, nil
+}
+
+// keep returns the names of the snapshots to keep out of infos, which
+// should all be of the same source
+func (policy *retentionPolicy) keep(infos []snapshotInfo, now time.Time) map[string]bool {
+	infos = slices.Clone(infos)
+	slices.SortFunc(infos, func(a, b snapshotInfo) int {
+		return b.Time.Compare(a.Time)
+	})
+	keep := map[string]bool{}
+	bucket := func(n int, key func(t time.Time) string) {
+		last := ""
+		for _, info := range infos {
+			if n <= 0 {
+				return
+			}
+			k := key(info.Time.Local())
+			if k != last {
+				keep[info.Name] = true
+				last = k
+				n--
+			}
+		}
+	}
+	bucket(policy.Last, func(t time.Time) string { return t.String() })
+	bucket(policy.Hourly, func(t time.Time) string { return t.Format("2006-01-02 15") })
+	bucket(policy.Daily, func(t time.Time) string { return t.Format("2006-01-02") })
+	bucket(policy.Weekly, func(t time.Time) string {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-%d", year, week)
+	})
+	bucket(policy.Monthly, func(t time.Time) string { return t.Format("2006-01") })
+	bucket(policy.Yearly, func(t time.Time) string { return t.Format("2006") })
+	if policy.Within > 0 {
+		for _, info := range infos {
+			if now.Sub(info.Time) <= policy.Within {
+				keep[info.Name] = true
+			}
+		}
+	}
+	return keep
+}
+
+// forgetStats is the result of the forget command
+type forgetStats struct {
+	Kept    []string    `json:"kept"`
+	Removed []string    `json:"removed"`
+	Prune   *pruneStats `json:"prune,omitempty"`
+}
+
+// forget removes the snapshots not kept by policy
+func (f *Fs) forget(ctx context.Context, policy retentionPolicy, prune bool) (*forgetStats, error) {
+	if f.keys == nil {
+		return nil, errorNotInitialised
+	}
+	l, err := f.lock(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer l.unlock(ctx)
+	infos, err := f.listSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	bySource := map[string][]snapshotInfo{}
+	for _, info := range infos {
+		bySource[info.Source] = append(bySource[info.Source], info)
+	}
+	keep := map[string]bool{}
+	now := time.Now()
+	for _, group := range bySource {
+		for name := range policy.keep(group, now) {
+			keep[name] = true
+		}
+	}
+	stats := &forgetStats{Kept: []string{}, Removed: []string{}}
+	dryRun := fs.GetConfig(ctx).DryRun
+	for _, info := range infos {
+		if keep[info.Name] {
+			stats.Kept = append(stats.Kept, info.Name)
+			continue
+		}
+		stats.Removed = append(stats.Removed, info.Name)
+		if dryRun {
+			fs.Logf(f, "Not removing snapshot %s as --dry-run", info.Name)
+			continue
+		}
+		err = f.removeFile(ctx, path.Join(snapshotsDir, info.Name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove snapshot %s: %w", info.Name, err)
+		}
+		f.mu.Lock()
+		delete(f.snapshots, info.Name)
+		f.mu.Unlock()
+		fs.Infof(f, "Removed snapshot %s", info.Name)
+	}
+	if prune && len(stats.Removed) > 0 {
+		stats.Prune, err = f.pruneLocked(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// pruneStats is the result of the prune command
+type pruneStats struct {
+	PacksRemoved   int   `json:"packsRemoved"`
+	PacksRewritten int   `json:"packsRewritten"`
+	BytesRemoved   int64 `json:"bytesRemoved"`
+}
+
+// prune removes the data not used by any snapshot
+//
+// It refuses to run while any other lock is held on the repository
+// as the packs of a backup in progress aren't used by a snapshot yet.
+func (f *Fs) prune(ctx context.Context) (*pruneStats, error) {
+	if f.keys == nil {
+		return nil, errorNotInitialised
+	}
+	l, err := f.lock(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	defer l.unlock(ctx)
+	return f.pruneLocked(ctx)
+}
+
+// pruneLocked does the work of prune with the repository locked
+//
+// Packs with no used chunks are removed and packs which are mostly
+// unused have their used chunks copied to new packs first.
+func (f *Fs) pruneLocked(ctx context.Context) (*pruneStats, error) {
+	index, indexNames, err := f.loadIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	f.index = index
+	f.mu.Unlock()
+
+	// Find the chunks in use
+	used := map[string]bool{}
+	names, err := f.snapshotNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		s, err := f.getSnapshot(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range s.Files {
+			for _, id := range file.Chunks {
+				if _, found := index[id]; !found {
+					return nil, fmt.Errorf("snapshot %s: chunk %s of %q missing from index - not pruning", name, id, file.Path)
+				}
+				used[id] = true
+			}
+		}
+	}
+
+	// Work out how much of each pack is used
+	type packUsage struct {
+		used, unused int64
+		chunks       []string // used chunks
+	}
+	packs := map[string]*packUsage{}
+	err = walk.ListR(ctx, f.base, packsDir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			if o, ok := entry.(fs.Object); ok {
+				packs[path.Base(o.Remote())] = &packUsage{unused: o.Size()}
+			}
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, fmt.Errorf("failed to list packs: %w", err)
+	}
+	for id, b := range index {
+		usage := packs[b.Pack]
+		if usage == nil || !used[id] {
+			continue
+		}
+		usage.used += b.Length
+		usage.unused -= b.Length
+		usage.chunks = append(usage.chunks, id)
+	}
+
+	stats := &pruneStats{}
+	var remove []string
+	for id, usage := range packs {
+		if usage.unused > usage.used {
+			remove = append(remove, id)
+			stats.BytesRemoved += usage.unused
+			if usage.used > 0 {
+				stats.PacksRewritten++
+			} else {
+				stats.PacksRemoved++
+			}
+		}
+	}
+	slices.Sort(remove)
+	if fs.GetConfig(ctx).DryRun {
+		fs.Logf(f, "Not pruning %d packs (%v) as --dry-run", len(remove), fs.SizeSuffix(stats.BytesRemoved))
+		return stats, nil
+	}
+
+	// Copy the used chunks out of the packs to be removed
+	f.mu.Lock()
+	newIndex := map[string]blob{}
+	for id, b := range index {
+		if used[id] {
+			if usage := packs[b.Pack]; usage != nil && usage.unused <= usage.used {
+				newIndex[id] = b
+			}
+		}
+	}
+	f.index = newIndex
+	f.mu.Unlock()
+	p := newPacker(f)
+	cache := map[string]fs.Object{}
+	for _, packID := range remove {
+		for _, id := range packs[packID].chunks {
+			data, err := f.readBlob(ctx, id, index[id], cache)
+			if err != nil {
+				return nil, err
+			}
+			err = p.add(ctx, id, data)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	err = p.flush(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace the index then remove the packs
+	f.mu.Lock()
+	full := make(map[string]blob, len(f.index))
+	for id, b := range f.index {
+		full[id] = b
+	}
+	f.mu.Unlock()
+	err = f.writeEncrypted(ctx, path.Join(indexDir, randomID()), &indexFile{Blobs: full})
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range indexNames {
+		err = f.removeFile(ctx, path.Join(indexDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove old index: %w", err)
+		}
+	}
+	for _, packID := range remove {
+		err = f.removeFile(ctx, packPath(packID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to remove pack: %w", err)
+		}
+	}
+	fs.Infof(f, "Pruned %d packs and rewrote %d freeing %v", stats.PacksRemoved, stats.PacksRewritten, fs.SizeSuffix(stats.BytesRemoved))
+	return stats, nil
+}
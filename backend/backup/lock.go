@@ -0,0 +1,159 @@
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+)
+
+// Locks stop prune removing the packs of a backup which is still
+// running. The backup command takes a shared lock and forget and prune
+// take an exclusive lock by writing a file to locksDir, then checking
+// no conflicting locks exist. Locks are refreshed while they are held
+// and ignored once they haven't been refreshed for lockStale, so a
+// crashed process doesn't lock the repository forever.
+const (
+	lockRefresh = 5 * time.Minute
+	lockStale   = 30 * time.Minute
+)
+
+// lockFile is the contents of a file in locksDir
+type lockFile struct {
+	Time      time.Time `json:"time"`      // when the lock was last refreshed
+	Exclusive bool      `json:"exclusive"` // set for forget and prune
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+}
+
+// String describes the lock for error messages
+func (lf *lockFile) String() string {
+	kind := "shared"
+	if lf.Exclusive {
+		kind = "exclusive"
+	}
+	return fmt.Sprintf("%s lock held by PID %d on %q since %v", kind, lf.PID, lf.Host, lf.Time.Local().Format(time.DateTime))
+}
+
+// repoLock is a lock held on the repository
+type repoLock struct {
+	f    *Fs
+	name string // name of the lock file or "" if not written
+	mu   sync.Mutex
+	info lockFile
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// lock locks the repository, exclusively if exclusive is set
+//
+// It returns an error if a conflicting lock is held. With --dry-run
+// the lock isn't written but conflicting locks are still checked.
+func (f *Fs) lock(ctx context.Context, exclusive bool) (*repoLock, error) {
+	l := &repoLock{
+		f: f,
+		info: lockFile{
+			Time:      time.Now(),
+			Exclusive: exclusive,
+			PID:       os.Getpid(),
+		},
+		done: make(chan struct{}),
+	}
+	l.info.Host, _ = os.Hostname()
+	if !fs.GetConfig(ctx).DryRun {
+		// Write our lock before checking for others so two processes
+		// locking at once can't both succeed
+		l.name = randomID()
+		err := f.writeEncrypted(ctx, path.Join(locksDir, l.name), &l.info)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lock repository: %w", err)
+		}
+	}
+	err := f.checkLocks(ctx, l.name, exclusive)
+	if err != nil {
+		_ = l.remove(ctx)
+		return nil, err
+	}
+	if l.name != "" {
+		l.wg.Add(1)
+		go l.refresh(ctx)
+	}
+	return l, nil
+}
+
+// checkLocks returns an error if a lock other than ours conflicts
+// with a lock of the kind given
+func (f *Fs) checkLocks(ctx context.Context, ours string, exclusive bool) error {
+	names, err := f.listNames(ctx, locksDir)
+	if err != nil {
+		return fmt.Errorf("failed to list locks: %w", err)
+	}
+	for _, name := range names {
+		if name == ours {
+			continue
+		}
+		var lf lockFile
+		err = f.readEncrypted(ctx, path.Join(locksDir, name), &lf)
+		if errors.Is(err, fs.ErrorObjectNotFound) {
+			continue // unlocked since listed
+		} else if err != nil {
+			return fmt.Errorf("failed to read lock: %w", err)
+		}
+		if time.Since(lf.Time) > lockStale {
+			fs.Logf(f, "Ignoring stale %v", &lf)
+			continue
+		}
+		if exclusive || lf.Exclusive {
+			return fmt.Errorf("repository is locked: %v", &lf)
+		}
+	}
+	return nil
+}
+
+// refresh rewrites the lock file until the lock is released
+func (l *repoLock) refresh(ctx context.Context) {
+	defer l.wg.Done()
+	ticker := time.NewTicker(lockRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		l.mu.Lock()
+		l.info.Time = time.Now()
+		err := l.f.writeEncrypted(ctx, path.Join(locksDir, l.name), &l.info)
+		l.mu.Unlock()
+		if err != nil {
+			fs.Errorf(l.f, "Failed to refresh repository lock: %v", err)
+		}
+	}
+}
+
+// remove the lock file if it was written
+func (l *repoLock) remove(ctx context.Context) error {
+	if l.name == "" {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.removeFile(ctx, path.Join(locksDir, l.name))
+}
+
+// unlock releases the lock
+func (l *repoLock) unlock(ctx context.Context) {
+	close(l.done)
+	l.wg.Wait()
+	err := l.remove(ctx)
+	if err != nil {
+		fs.Errorf(l.f, "Failed to remove repository lock: %v", err)
+	}
+}
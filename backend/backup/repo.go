@@ -0,0 +1,530 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/object"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Layout of the repository in the wrapped remote
+const (
+	configName   = "config"    // repository config - not encrypted
+	packsDir     = "packs"     // packs of encrypted chunks
+	indexDir     = "index"     // which pack each chunk is in
+	snapshotsDir = "snapshots" // one file per snapshot
+	locksDir     = "locks"     // one file per lock held
+	repoVersion  = 1
+	checkText    = "rclone backup repository"
+	snapshotTime = "2006-01-02-150405" // format of the time snapshot names start with
+	snapshotID   = 8                   // hex digits in the random suffix of snapshot names
+)
+
+var errorNotInitialised = errors.New("backup repository not initialised - run the backup command first")
+
+// repoConfig is stored unencrypted at the root of the repository
+type repoConfig struct {
+	Version   int    `json:"version"`
+	Salt      []byte `json:"salt"`      // salt for the key derivation
+	ChunkSize int    `json:"chunkSize"` // average chunk size
+	Check     []byte `json:"check"`     // checkText sealed with the key to check the password
+}
+
+// keys used to encrypt and identify the data in a repository
+type keys struct {
+	enc  [32]byte    // key for secretbox
+	mac  [32]byte    // key for the chunk IDs
+	gear [256]uint64 // gear table for the chunker
+	avg  int         // average chunk size
+}
+
+// newKeys derives the keys for the repository from the password
+func newKeys(password string, cfg *repoConfig) (*keys, error) {
+	key, err := scrypt.Key([]byte(password), cfg.Salt, 16384, 8, 1, 64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+	k := &keys{avg: cfg.ChunkSize}
+	copy(k.enc[:], key[:32])
+	copy(k.mac[:], key[32:])
+	for i := range k.gear {
+		sum := hmac.New(sha256.New, k.mac[:])
+		_, _ = sum.Write([]byte{'g', byte(i)})
+		k.gear[i] = binary.LittleEndian.Uint64(sum.Sum(nil))
+	}
+	return k, nil
+}
+
+// seal encrypts and authenticates plain
+func (k *keys) seal(plain []byte) []byte {
+	var nonce [24]byte
+	_, err := rand.Read(nonce[:])
+	if err != nil {
+		panic(fmt.Sprintf("backup: failed to read random nonce: %v", err))
+	}
+	return secretbox.Seal(nonce[:], plain, &nonce, &k.enc)
+}
+
+// open decrypts and checks data sealed with seal
+func (k *keys) open(sealed []byte) ([]byte, error) {
+	if len(sealed) < 24+secretbox.Overhead {
+		return nil, errors.New("encrypted data too short")
+	}
+	var nonce [24]byte
+	copy(nonce[:], sealed)
+	plain, ok := secretbox.Open(nil, sealed[24:], &nonce, &k.enc)
+	if !ok {
+		return nil, errors.New("failed to authenticate encrypted data")
+	}
+	return plain, nil
+}
+
+// id returns the ID of a chunk of data
+func (k *keys) id(data []byte) string {
+	sum := hmac.New(sha256.New, k.mac[:])
+	_, _ = sum.Write(data)
+	return hex.EncodeToString(sum.Sum(nil))
+}
+
+// randomID returns a new random ID for a pack or index file
+func randomID() string {
+	var id [16]byte
+	_, err := rand.Read(id[:])
+	if err != nil {
+		panic(fmt.Sprintf("backup: failed to read random ID: %v", err))
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// packPath returns the path of the pack with id
+func packPath(id string) string {
+	return path.Join(packsDir, id[:2], id)
+}
+
+// blob says where a chunk is stored
+type blob struct {
+	Pack   string `json:"pack"`   // ID of the pack
+	Offset int64  `json:"offset"` // offset of the encrypted chunk in the pack
+	Length int64  `json:"length"` // length of the encrypted chunk
+	Size   int64  `json:"size"`   // size of the chunk
+}
+
+// indexFile is the contents of a file in indexDir
+type indexFile struct {
+	Blobs map[string]blob `json:"blobs"`
+}
+
+// snapshotFile is a file in a snapshot
+type snapshotFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+	MD5     string    `json:"md5"`
+	Chunks  []string  `json:"chunks"` // IDs of the chunks making up the file
+}
+
+// snapshotDir is a directory in a snapshot
+type snapshotDir struct {
+	Path    string    `json:"path"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// snapshot is a point in time copy of a source
+type snapshot struct {
+	Name   string          `json:"-"`
+	Time   time.Time       `json:"time"`
+	Source string          `json:"source"`
+	Host   string          `json:"host"`
+	Parent string          `json:"parent,omitempty"`
+	Files  []*snapshotFile `json:"files"`
+	Dirs   []*snapshotDir  `json:"dirs"`
+
+	files map[string]*snapshotFile // files by path
+	dirs  map[string]*snapshotDir  // directories by path
+	tree  map[string][]string      // leaf names in each directory
+}
+
+// build the lookup tables for the snapshot
+func (s *snapshot) build() {
+	s.files = make(map[string]*snapshotFile, len(s.Files))
+	s.dirs = make(map[string]*snapshotDir, len(s.Dirs)+1)
+	s.tree = map[string][]string{}
+	s.dirs[""] = &snapshotDir{ModTime: s.Time}
+	var addDir func(dir string)
+	addDir = func(dir string) {
+		if _, found := s.dirs[dir]; found {
+			return
+		}
+		s.dirs[dir] = &snapshotDir{Path: dir, ModTime: s.Time}
+		parent := parentDir(dir)
+		addDir(parent)
+		s.tree[parent] = append(s.tree[parent], path.Base(dir))
+	}
+	for _, d := range s.Dirs {
+		if d.Path == "" {
+			continue
+		}
+		addDir(d.Path)
+		s.dirs[d.Path].ModTime = d.ModTime
+	}
+	for _, file := range s.Files {
+		s.files[file.Path] = file
+		dir := parentDir(file.Path)
+		addDir(dir)
+		s.tree[dir] = append(s.tree[dir], path.Base(file.Path))
+	}
+	for _, names := range s.tree {
+		slices.Sort(names)
+	}
+}
+
+// size returns the total size of the files in the snapshot
+func (s *snapshot) size() (size int64) {
+	for _, file := range s.Files {
+		size += file.Size
+	}
+	return size
+}
+
+// parentDir returns the parent directory of p with "" for the root
+func parentDir(p string) string {
+	dir := path.Dir(p)
+	if dir == "." || dir == "/" {
+		return ""
+	}
+	return dir
+}
+
+// splitSnapshot splits p into the snapshot name and the path within it
+func splitSnapshot(p string) (name, rest string) {
+	name, rest, _ = strings.Cut(p, "/")
+	return name, rest
+}
+
+// readFile reads the whole of remote from the wrapped remote
+func (f *Fs) readFile(ctx context.Context, remote string) (data []byte, err error) {
+	o, err := f.base.NewObject(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+	in, err := o.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(in, &err)
+	return io.ReadAll(in)
+}
+
+// writeFile writes data to remote on the wrapped remote
+func (f *Fs) writeFile(ctx context.Context, remote string, data []byte) error {
+	src := object.NewStaticObjectInfo(remote, time.Now(), int64(len(data)), true, nil, nil)
+	_, err := f.base.Put(ctx, bytes.NewReader(data), src)
+	if err != nil {
+		return fmt.Errorf("failed to write %q: %w", remote, err)
+	}
+	return nil
+}
+
+// removeFile removes remote from the wrapped remote
+func (f *Fs) removeFile(ctx context.Context, remote string) error {
+	o, err := f.base.NewObject(ctx, remote)
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return o.Remove(ctx)
+}
+
+// listNames lists the names of the files in dir in the wrapped remote
+func (f *Fs) listNames(ctx context.Context, dir string) (names []string, err error) {
+	entries, err := f.base.List(ctx, dir)
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if _, ok := entry.(fs.Object); ok {
+			names = append(names, path.Base(entry.Remote()))
+		}
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// writeEncrypted writes v as compressed encrypted JSON to remote
+func (f *Fs) writeEncrypted(ctx context.Context, remote string, v any) error {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	err := json.NewEncoder(zw).Encode(v)
+	if err != nil {
+		return err
+	}
+	err = zw.Close()
+	if err != nil {
+		return err
+	}
+	return f.writeFile(ctx, remote, f.keys.seal(buf.Bytes()))
+}
+
+// readEncrypted reads v from compressed encrypted JSON in remote
+func (f *Fs) readEncrypted(ctx context.Context, remote string, v any) error {
+	data, err := f.readFile(ctx, remote)
+	if err != nil {
+		return err
+	}
+	data, err = f.keys.open(data)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt %q: %w", remote, err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decompress %q: %w", remote, err)
+	}
+	err = json.NewDecoder(zr).Decode(v)
+	if err != nil {
+		return fmt.Errorf("failed to decode %q: %w", remote, err)
+	}
+	return nil
+}
+
+// openRepo reads the repository config and checks the password,
+// leaving f.keys nil if the repository hasn't been initialised
+func (f *Fs) openRepo(ctx context.Context) error {
+	data, err := f.readFile(ctx, configName)
+	if errors.Is(err, fs.ErrorObjectNotFound) || errors.Is(err, fs.ErrorDirNotFound) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read backup repository config: %w", err)
+	}
+	var cfg repoConfig
+	err = json.Unmarshal(data, &cfg)
+	if err != nil {
+		return fmt.Errorf("failed to decode backup repository config: %w", err)
+	}
+	if cfg.Version != repoVersion {
+		return fmt.Errorf("unsupported backup repository version %d", cfg.Version)
+	}
+	if cfg.ChunkSize <= 0 {
+		return errors.New("invalid chunk size in backup repository config")
+	}
+	k, err := newKeys(f.password, &cfg)
+	if err != nil {
+		return err
+	}
+	check, err := k.open(cfg.Check)
+	if err != nil || string(check) != checkText {
+		return errors.New("wrong password for backup repository")
+	}
+	f.keys = k
+	return nil
+}
+
+// initRepo creates the repository if it doesn't exist
+func (f *Fs) initRepo(ctx context.Context) error {
+	if f.keys != nil {
+		return nil
+	}
+	cfg := &repoConfig{
+		Version:   repoVersion,
+		Salt:      make([]byte, 32),
+		ChunkSize: 1 << (bits.Len64(uint64(f.opt.ChunkSize)) - 1),
+	}
+	_, err := rand.Read(cfg.Salt)
+	if err != nil {
+		return err
+	}
+	k, err := newKeys(f.password, cfg)
+	if err != nil {
+		return err
+	}
+	cfg.Check = k.seal([]byte(checkText))
+	data, err := json.MarshalIndent(cfg, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = f.writeFile(ctx, configName, data)
+	if err != nil {
+		return err
+	}
+	fs.Infof(f, "Initialised backup repository")
+	f.keys = k
+	return nil
+}
+
+// loadIndex reads all the index files, returning the blobs and the
+// names of the index files read
+func (f *Fs) loadIndex(ctx context.Context) (index map[string]blob, names []string, err error) {
+	names, err = f.listNames(ctx, indexDir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list index: %w", err)
+	}
+	index = map[string]blob{}
+	for _, name := range names {
+		var ix indexFile
+		err = f.readEncrypted(ctx, path.Join(indexDir, name), &ix)
+		if err != nil {
+			return nil, nil, err
+		}
+		for id, b := range ix.Blobs {
+			index[id] = b
+		}
+	}
+	return index, names, nil
+}
+
+// getIndex returns the index, loading it if necessary
+func (f *Fs) getIndex(ctx context.Context) (map[string]blob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.index != nil {
+		return f.index, nil
+	}
+	index, _, err := f.loadIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.index = index
+	return index, nil
+}
+
+// lookup returns where the chunk with id is stored
+func (f *Fs) lookup(ctx context.Context, id string) (blob, error) {
+	index, err := f.getIndex(ctx)
+	if err != nil {
+		return blob{}, err
+	}
+	f.mu.Lock()
+	b, ok := index[id]
+	f.mu.Unlock()
+	if !ok {
+		return blob{}, fmt.Errorf("chunk %s not found in index", id)
+	}
+	return b, nil
+}
+
+// snapshotName makes the name for a new snapshot taken at t
+//
+// The random suffix stops snapshots of different sources taken in the
+// same second having the same name.
+func snapshotName(t time.Time) string {
+	return t.Format(snapshotTime) + "-" + randomID()[:snapshotID]
+}
+
+// parseSnapshotName returns the time of the snapshot called name or
+// an error if name isn't a snapshot name
+func parseSnapshotName(name string) (time.Time, error) {
+	timePart, suffix := name, ""
+	if len(name) > len(snapshotTime) {
+		timePart, suffix = name[:len(snapshotTime)], name[len(snapshotTime):]
+	}
+	if suffix != "" {
+		if len(suffix) != 1+snapshotID || suffix[0] != '-' {
+			return time.Time{}, fmt.Errorf("bad snapshot name %q", name)
+		}
+		if _, err := hex.DecodeString(suffix[1:]); err != nil {
+			return time.Time{}, fmt.Errorf("bad snapshot name %q", name)
+		}
+	}
+	return time.Parse(snapshotTime, timePart)
+}
+
+// snapshotNames lists the names of the snapshots in time order
+func (f *Fs) snapshotNames(ctx context.Context) ([]string, error) {
+	if f.keys == nil {
+		return nil, nil
+	}
+	names, err := f.listNames(ctx, snapshotsDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots: %w", err)
+	}
+	return names, nil
+}
+
+// getSnapshot reads the snapshot called name
+func (f *Fs) getSnapshot(ctx context.Context, name string) (*snapshot, error) {
+	f.mu.Lock()
+	s, found := f.snapshots[name]
+	f.mu.Unlock()
+	if found {
+		return s, nil
+	}
+	if f.keys == nil {
+		return nil, fs.ErrorDirNotFound
+	}
+	if _, err := parseSnapshotName(name); err != nil {
+		return nil, fs.ErrorDirNotFound
+	}
+	s = new(snapshot)
+	err := f.readEncrypted(ctx, path.Join(snapshotsDir, name), s)
+	if errors.Is(err, fs.ErrorObjectNotFound) || errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, fs.ErrorDirNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	s.Name = name
+	s.build()
+	f.mu.Lock()
+	f.snapshots[name] = s
+	f.mu.Unlock()
+	return s, nil
+}
+
+// readChunk reads and decrypts the chunk with id, using packs to cache
+// the pack objects
+func (f *Fs) readChunk(ctx context.Context, id string, packs map[string]fs.Object) (data []byte, err error) {
+	b, err := f.lookup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return f.readBlob(ctx, id, b, packs)
+}
+
+// readBlob reads and decrypts the chunk with id stored at b
+func (f *Fs) readBlob(ctx context.Context, id string, b blob, packs map[string]fs.Object) (data []byte, err error) {
+	o, ok := packs[b.Pack]
+	if !ok {
+		o, err = f.base.NewObject(ctx, packPath(b.Pack))
+		if err != nil {
+			return nil, fmt.Errorf("failed to find pack %s: %w", b.Pack, err)
+		}
+		packs[b.Pack] = o
+	}
+	in, err := o.Open(ctx, &fs.RangeOption{Start: b.Offset, End: b.Offset + b.Length - 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pack %s: %w", b.Pack, err)
+	}
+	defer fs.CheckClose(in, &err)
+	sealed := make([]byte, b.Length)
+	_, err = io.ReadFull(in, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pack %s: %w", b.Pack, err)
+	}
+	data, err = f.keys.open(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s: %w", id, err)
+	}
+	if int64(len(data)) != b.Size {
+		return nil, fmt.Errorf("chunk %s: wrong size %d expecting %d", id, len(data), b.Size)
+	}
+	return data, nil
+}
@@ -78,6 +78,9 @@ import (
 // Metadata format v1 does not define any control chunk types,
 // they are currently ignored aka reserved.
 // In future they can be used to implement resumable uploads etc.
+//
+// Metadata format v3 defines the "index" control chunk which lists
+// the chunks of a file split by content (see content.go).
 const (
 	ctrlTypeRegStr   = `[a-z][a-z0-9]{2,6}`
 	tempSuffixFormat = `_%04s`
@@ -108,7 +111,7 @@ const (
 )
 
 // Current/highest supported metadata format.
-const metadataVersion = 2
+const metadataVersion = 3
 
 // optimizeFirstChunk enables the following optimization in the Put:
 // If a single chunk is expected, put the first chunk using the
@@ -178,6 +181,34 @@ Possible chunk files are ignored if their name does not match given format.`,
 			Help: `Minimum valid chunk number. Usually 0 or 1.
 
 By default chunk numbers start from 1.`,
+		}, {
+			Name:     "chunk_mode",
+			Advanced: true,
+			Default:  chunkModeFixed,
+			Help:     `Choose how chunker splits files in chunks.`,
+			Examples: []fs.OptionExample{{
+				Value: chunkModeFixed,
+				Help:  `Split files in chunks of chunk size.`,
+			}, {
+				Value: chunkModeContent,
+				Help: `Split files at boundaries defined by their content.
+
+Chunks are named by hash of their content and stored once in the
+".rclone_chunks" directory at the root of the wrapped remote, so
+unchanged parts of updated files and data shared by several files
+are not uploaded again. The chunk size is not used in this mode,
+see content_chunk_size instead.
+Requires metadata. Run "rclone cleanup" to remove unused chunks.`,
+			}},
+		}, {
+			Name:     "content_chunk_size",
+			Advanced: true,
+			Default:  fs.SizeSuffix(4 * fs.Mebi),
+			Help: `Average chunk size in the content chunk mode.
+
+Chunks are between a quarter and four times this size and are kept
+in memory while uploading. Smaller chunks find more duplicate data
+but need more transactions and a bigger index.`,
 		}, {
 			Name:     "meta_format",
 			Advanced: true,
@@ -303,10 +334,12 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 	}
 
 	f := &Fs{
-		base: baseFs,
-		name: name,
-		root: rpath,
-		opt:  *opt,
+		base:        baseFs,
+		name:        name,
+		root:        rpath,
+		opt:         *opt,
+		contentRoot: baseName + basePath,
+		storePath:   baseName + fspath.JoinRootPath(basePath, contentStoreDir),
 	}
 	f.dirSort = true // processEntries requires that meta Objects prerun data chunks atm.
 
@@ -336,6 +369,9 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 			f.root = ""
 		}
 	}
+	if f.root == "" {
+		f.storeDir = contentStoreDir
+	}
 
 	// Note 1: the features here are ones we could support, and they are
 	// ANDed with the ones from wrappedFs.
@@ -358,20 +394,25 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 
 	f.features.ListR = nil // Recursive listing may cause chunker skip files
 	f.features.ListP = nil // ListP not supported yet
+	if f.useContent {
+		f.features.CleanUp = f.CleanUp // needed to remove unused chunks
+	}
 
 	return f, err
 }
 
 // Options defines the configuration for this backend
 type Options struct {
-	Remote       string        `config:"remote"`
-	ChunkSize    fs.SizeSuffix `config:"chunk_size"`
-	NameFormat   string        `config:"name_format"`
-	StartFrom    int           `config:"start_from"`
-	MetaFormat   string        `config:"meta_format"`
-	HashType     string        `config:"hash_type"`
-	FailHard     bool          `config:"fail_hard"`
-	Transactions string        `config:"transactions"`
+	Remote           string        `config:"remote"`
+	ChunkSize        fs.SizeSuffix `config:"chunk_size"`
+	NameFormat       string        `config:"name_format"`
+	StartFrom        int           `config:"start_from"`
+	MetaFormat       string        `config:"meta_format"`
+	HashType         string        `config:"hash_type"`
+	FailHard         bool          `config:"fail_hard"`
+	Transactions     string        `config:"transactions"`
+	ChunkMode        string        `config:"chunk_mode"`
+	ContentChunkSize fs.SizeSuffix `config:"content_chunk_size"`
 }
 
 // Fs represents a wrapped fs.Fs
@@ -394,6 +435,12 @@ type Fs struct {
 	features     *fs.Features   // optional features
 	dirSort      bool           // reserved for future, ignored
 	useNoRename  bool           // can be set with the transactions option
+	useContent   bool           // split files by content, set by the chunk mode option
+	contentRoot  string         // wrapped remote the content store is shared under
+	storePath    string         // wrapped remote holding content-defined chunks
+	storeDir     string         // directory of content store to hide when listing root or ""
+	storeMu      sync.Mutex     // protects store
+	store        *pinnedFs      // content store, made on first use
 }
 
 // configure sets up chunker for given name format, meta format and hash type.
@@ -412,6 +459,9 @@ func (f *Fs) configure(nameFormat, metaFormat, hashType, transactionMode string)
 	if err := f.setTransactionMode(transactionMode); err != nil {
 		return err
 	}
+	if err := f.setChunkMode(f.opt.ChunkMode); err != nil {
+		return err
+	}
 
 	randomSeed := time.Now().UnixNano()
 	f.xactIDRand = rand.New(rand.NewSource(randomSeed))
@@ -492,6 +542,26 @@ func (f *Fs) setTransactionMode(transactionMode string) error {
 	return nil
 }
 
+// setChunkMode
+// must be called *after* setMetaFormat.
+func (f *Fs) setChunkMode(chunkMode string) error {
+	switch chunkMode {
+	case "", chunkModeFixed:
+		f.useContent = false
+	case chunkModeContent:
+		if !f.useMeta {
+			return errors.New("content chunk mode requires metadata")
+		}
+		if f.opt.ContentChunkSize < minContentSize {
+			return fmt.Errorf("content chunk size must be at least %d", minContentSize)
+		}
+		f.useContent = true
+	default:
+		return fmt.Errorf("unsupported chunk mode '%s'", chunkMode)
+	}
+	return nil
+}
+
 // setChunkNameFormat converts pattern based chunk name format
 // into Printf format and Regular expressions for data and
 // control chunks.
@@ -796,6 +866,13 @@ func (f *Fs) processEntries(ctx context.Context, origEntries fs.DirEntries, dirP
 			// this is some kind of chunk
 			// metobject should have been created above if present
 			mainObject := byRemote[mainRemote]
+			if ctrlType == ctrlTypeIndex && xactID == "" && mainObject != nil && f.useMeta && mainObject.size <= maxMetadataSize {
+				// the chunks are listed by the index so
+				// metadata must be read to find the size
+				mainObject.index = entry
+				mainObject.unsure = true
+				break
+			}
 			isSpecial := xactID != txnByRemote[mainRemote] || ctrlType != ""
 			if mainObject == nil && f.useMeta && !isSpecial {
 				fs.Debugf(f, "skip orphan data chunk %q", remote)
@@ -830,6 +907,9 @@ func (f *Fs) processEntries(ctx context.Context, origEntries fs.DirEntries, dirP
 				badEntry[mainRemote] = true
 			}
 		case fs.Directory:
+			if entry.Remote() == f.storeDir {
+				break // hide the content store
+			}
 			isSubdir[entry.Remote()] = true
 			wrapDir := fs.NewDirWrapper(entry.Remote(), entry)
 			tempEntries = append(tempEntries, wrapDir)
@@ -861,6 +941,15 @@ func (f *Fs) processEntries(ctx context.Context, origEntries fs.DirEntries, dirP
 				fs.Debugf(f, "invalid chunks in object %q", remote)
 				continue
 			}
+			if object.index != nil {
+				if err := object.readMetadata(ctx); err != nil {
+					if f.opt.FailHard {
+						return nil, err
+					}
+					fs.Debugf(f, "invalid metadata in object %q: %v", remote, err)
+					continue
+				}
+			}
 		}
 		newEntries = append(newEntries, entry)
 	}
@@ -975,6 +1064,12 @@ func (f *Fs) scanObject(ctx context.Context, remote string, quickScan bool) (fs.
 		if !sameMain {
 			continue // skip alien chunks
 		}
+		if ctrlType == ctrlTypeIndex && xactID == "" && f.useMeta {
+			// content-defined chunks are listed by the index
+			o.index = entry
+			o.unsure = true
+			continue
+		}
 		if ctrlType != "" || xactID != currentXactID {
 			if f.useMeta {
 				// temporary/control chunk calls for lazy metadata read
@@ -1017,6 +1112,13 @@ func (f *Fs) scanObject(ctx context.Context, remote string, quickScan bool) (fs.
 		if err := o.validate(); err != nil {
 			return nil, err
 		}
+		// Except the size of a file split by content is only known
+		// from its metadata.
+		if o.index != nil {
+			if err := o.readMetadata(ctx); err != nil {
+				return nil, err
+			}
+		}
 	}
 	return o, nil
 }
@@ -1048,6 +1150,7 @@ func (o *Object) readMetadata(ctx context.Context) error {
 			// this is not metadata but a foreign object
 			o.unsure = false
 			o.chunks = nil  // make isComposite return false
+			o.index = nil   // ditto
 			o.isFull = true // cache results
 			return nil
 		}
@@ -1073,6 +1176,7 @@ func (o *Object) readMetadata(ctx context.Context) error {
 			if !madeByChunker {
 				// this is not metadata but a foreign object
 				o.chunks = nil  // make isComposite return false
+				o.index = nil   // ditto
 				o.isFull = true // cache results
 				return nil
 			}
@@ -1085,7 +1189,15 @@ func (o *Object) readMetadata(ctx context.Context) error {
 		default:
 			return fmt.Errorf("invalid metadata: %w", err)
 		}
-		if o.size != metaInfo.Size() || len(o.chunks) != metaInfo.nChunks {
+		switch {
+		case metaInfo.chunkMode == chunkModeContent:
+			if o.index == nil {
+				return errors.New("index of content chunks is missing")
+			}
+			o.content = true
+			o.size = metaInfo.Size()
+			o.nChunks = metaInfo.nChunks
+		case o.size != metaInfo.Size() || len(o.chunks) != metaInfo.nChunks:
 			return errors.New("metadata doesn't match file size")
 		}
 		o.md5 = metaInfo.md5
@@ -1166,6 +1278,10 @@ func (f *Fs) put(
 		}
 	}
 
+	if f.useContent {
+		return f.putContent(ctx, in, src, remote, options, basePut)
+	}
+
 	// Prepare to upload
 	c := f.newChunkingReader(src)
 	wrapIn := c.wrapStream(ctx, in, src)
@@ -1320,7 +1436,7 @@ func (f *Fs) put(
 	switch f.opt.MetaFormat {
 	case "simplejson":
 		c.updateHashes()
-		metadata, err = marshalSimpleJSON(ctx, sizeTotal, len(c.chunks), c.md5, c.sha1, xactID)
+		metadata, err = marshalSimpleJSON(ctx, sizeTotal, len(c.chunks), c.md5, c.sha1, xactID, "")
 	}
 	if err == nil {
 		metaInfo := f.wrapInfo(src, baseRemote, int64(len(metadata)))
@@ -1505,6 +1621,11 @@ func (f *Fs) removeOldChunks(ctx context.Context, remote string) {
 				fs.Errorf(chunk, "Failed to remove old chunk: %v", err)
 			}
 		}
+		if oldObject.index != nil {
+			if err := oldObject.index.Remove(ctx); err != nil {
+				fs.Errorf(oldObject.index, "Failed to remove old index: %v", err)
+			}
+		}
 	}
 }
 
@@ -1670,7 +1791,14 @@ func (o *Object) Remove(ctx context.Context) (err error) {
 		}
 	}
 
-	// There are no known control chunks to remove atm.
+	// Content-defined chunks may be shared with other files so
+	// only remove the index, CleanUp removes unused chunks.
+	if o.index != nil {
+		indexErr := o.index.Remove(ctx)
+		if err == nil {
+			err = indexErr
+		}
+	}
 	return err
 }
 
@@ -1693,6 +1821,11 @@ func (f *Fs) copyOrMove(ctx context.Context, o *Object, remote string, do copyMo
 		return f.newObject("", oResult, nil), nil
 	}
 
+	if o.content {
+		fs.Debugf(o, "%s index of %d content chunks...", opName, o.nChunks)
+		return f.copyOrMoveContent(ctx, o, remote, do)
+	}
+
 	fs.Debugf(o, "%s %d data chunks...", opName, len(o.chunks))
 	mainRemote := o.remote
 	var newChunks []fs.Object
@@ -1739,7 +1872,7 @@ func (f *Fs) copyOrMove(ctx context.Context, o *Object, remote string, do copyMo
 	var metadata []byte
 	switch f.opt.MetaFormat {
 	case "simplejson":
-		metadata, err = marshalSimpleJSON(ctx, newObj.size, len(newChunks), md5, sha1, o.xactID)
+		metadata, err = marshalSimpleJSON(ctx, newObj.size, len(newChunks), md5, sha1, o.xactID, "")
 		if err == nil {
 			metaInfo := f.wrapInfo(metaObject, "", int64(len(metadata)))
 			err = newObj.main.Update(ctx, bytes.NewReader(metadata), metaInfo)
@@ -1777,6 +1910,8 @@ func (f *Fs) okForServerSide(ctx context.Context, src fs.Object, opName string)
 		diff = "chunk numbering"
 	case f.opt.MetaFormat != obj.f.opt.MetaFormat:
 		diff = "meta formats"
+	case obj.index != nil && f.storePath != obj.f.storePath:
+		diff = "content stores"
 	}
 	if diff != "" {
 		fs.Debugf(src, "Can't %s - different %s", opName, diff)
@@ -1918,9 +2053,20 @@ func (f *Fs) DirSetModTime(ctx context.Context, dir string, modTime time.Time) e
 //
 // Implement this if you have a way of emptying the trash or
 // otherwise cleaning up old versions of files.
+//
+// In the content chunk mode this also removes the chunks which are
+// no longer used by any file.
 func (f *Fs) CleanUp(ctx context.Context) error {
+	if f.useContent {
+		if err := f.cleanUpContent(ctx); err != nil {
+			return err
+		}
+	}
 	do := f.base.Features().CleanUp
 	if do == nil {
+		if f.useContent {
+			return nil
+		}
 		return errors.New("not supported by underlying remote")
 	}
 	return do(ctx)
@@ -2003,6 +2149,11 @@ type Object struct {
 	md5       string
 	sha1      string
 	f         *Fs
+
+	index         fs.Object       // index control chunk if present
+	content       bool            // true if data is in content-defined chunks listed by index
+	nChunks       int             // number of content-defined chunks
+	contentChunks []*contentChunk // cached index, nil if not read yet
 }
 
 func (o *Object) addChunk(chunk fs.Object, chunkNo int) error {
@@ -2042,6 +2193,10 @@ func (o *Object) validate() error {
 		return fmt.Errorf("%q metadata is too large", o.remote)
 	}
 
+	if o.index != nil && len(o.chunks) == 0 {
+		return nil // size of content-defined chunks is set by readMetadata
+	}
+
 	var totalSize int64
 	for _, chunk := range o.chunks {
 		if chunk == nil {
@@ -2087,7 +2242,7 @@ func (o *Object) mainChunk() fs.Object {
 }
 
 func (o *Object) isComposite() bool {
-	return o.chunks != nil
+	return o.chunks != nil || o.index != nil
 }
 
 // Fs returns read only access to the Fs that this object is part of
@@ -2219,10 +2374,17 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 	return o.newLinearReader(ctx, offset, limit, openOptions)
 }
 
+// dataChunk is a data chunk of a composite file,
+// either a wrapped object or a content-defined chunk
+type dataChunk interface {
+	Size() int64
+	Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error)
+}
+
 // linearReader opens and reads file chunks sequentially, without read-ahead
 type linearReader struct {
 	ctx     context.Context
-	chunks  []fs.Object
+	chunks  []dataChunk
 	options []fs.OpenOption
 	limit   int64
 	count   int64
@@ -2232,9 +2394,23 @@ type linearReader struct {
 }
 
 func (o *Object) newLinearReader(ctx context.Context, offset, limit int64, options []fs.OpenOption) (io.ReadCloser, error) {
+	var chunks []dataChunk
+	if o.content {
+		contentChunks, err := o.contentIndex(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, chunk := range contentChunks {
+			chunks = append(chunks, chunk)
+		}
+	} else {
+		for _, chunk := range o.chunks {
+			chunks = append(chunks, chunk)
+		}
+	}
 	r := &linearReader{
 		ctx:     ctx,
-		chunks:  o.chunks,
+		chunks:  chunks,
 		options: options,
 		limit:   limit,
 	}
@@ -2326,14 +2502,15 @@ func (r *linearReader) Close() (err error) {
 
 // ObjectInfo describes a wrapped fs.ObjectInfo for being the source
 type ObjectInfo struct {
-	src     fs.ObjectInfo
-	fs      *Fs
-	nChunks int    // number of data chunks
-	xactID  string // transaction ID for "norename" or empty string for "renamed" chunks
-	size    int64  // overrides source size by the total size of data chunks
-	remote  string // overrides remote name
-	md5     string // overrides MD5 checksum
-	sha1    string // overrides SHA1 checksum
+	src       fs.ObjectInfo
+	fs        *Fs
+	nChunks   int    // number of data chunks
+	xactID    string // transaction ID for "norename" or empty string for "renamed" chunks
+	chunkMode string // chunk mode if not fixed
+	size      int64  // overrides source size by the total size of data chunks
+	remote    string // overrides remote name
+	md5       string // overrides MD5 checksum
+	sha1      string // overrides SHA1 checksum
 }
 
 func (f *Fs) wrapInfo(src fs.ObjectInfo, newRemote string, totalSize int64) *ObjectInfo {
@@ -2428,9 +2605,10 @@ type metaSimpleJSON struct {
 	Size     *int64 `json:"size"`    // total size of data chunks
 	ChunkNum *int   `json:"nchunks"` // number of data chunks
 	// optional extra fields
-	MD5    string `json:"md5,omitempty"`
-	SHA1   string `json:"sha1,omitempty"`
-	XactID string `json:"txn,omitempty"` // transaction ID for norename transactions
+	MD5       string `json:"md5,omitempty"`
+	SHA1      string `json:"sha1,omitempty"`
+	XactID    string `json:"txn,omitempty"`    // transaction ID for norename transactions
+	ChunkMode string `json:"chunks,omitempty"` // "content" if split by content, since version 3
 }
 
 // marshalSimpleJSON
@@ -2439,10 +2617,16 @@ type metaSimpleJSON struct {
 // - for files larger than chunk size
 // - if file contents can be mistaken as meta object
 // - if consistent hashing is On but wrapped remote can't provide given hash
-func marshalSimpleJSON(ctx context.Context, size int64, nChunks int, md5, sha1, xactID string) ([]byte, error) {
+//
+// The lowest version supporting the given fields is written so that
+// older rclone versions can still read the file.
+func marshalSimpleJSON(ctx context.Context, size int64, nChunks int, md5, sha1, xactID, chunkMode string) ([]byte, error) {
 	version := metadataVersion
-	if xactID == "" && version == 2 {
+	switch {
+	case chunkMode == "" && xactID == "":
 		version = 1
+	case chunkMode == "":
+		version = 2
 	}
 	metadata := metaSimpleJSON{
 		// required core fields
@@ -2450,9 +2634,10 @@ func marshalSimpleJSON(ctx context.Context, size int64, nChunks int, md5, sha1,
 		Size:     &size,
 		ChunkNum: &nChunks,
 		// optional extra fields
-		MD5:    md5,
-		SHA1:   sha1,
-		XactID: xactID,
+		MD5:       md5,
+		SHA1:      sha1,
+		XactID:    xactID,
+		ChunkMode: chunkMode,
 	}
 	data, err := json.Marshal(&metadata)
 	if err == nil && data != nil && len(data) >= maxMetadataSizeWritten {
@@ -2523,6 +2708,9 @@ func unmarshalSimpleJSON(ctx context.Context, metaObject fs.Object, data []byte)
 	if *metadata.Version > metadataVersion {
 		return nil, true, ErrMetaUnknown // produced by incompatible version of rclone
 	}
+	if metadata.ChunkMode != "" && metadata.ChunkMode != chunkModeContent {
+		return nil, true, ErrMetaUnknown // produced by incompatible version of rclone
+	}
 
 	var nilFs *Fs // nil object triggers appropriate type method
 	info = nilFs.wrapInfo(metaObject, "", *metadata.Size)
@@ -2530,6 +2718,7 @@ func unmarshalSimpleJSON(ctx context.Context, metaObject fs.Object, data []byte)
 	info.md5 = metadata.MD5
 	info.sha1 = metadata.SHA1
 	info.xactID = metadata.XactID
+	info.chunkMode = metadata.ChunkMode
 	return info, true, nil
 }
 
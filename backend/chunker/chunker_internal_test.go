@@ -10,6 +10,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configmap"
@@ -679,7 +680,7 @@ func testMetadataInput(t *testing.T, f *Fs) {
 		}
 	}
 
-	metaData, err := marshalSimpleJSON(ctx, 3, 1, "", "", "")
+	metaData, err := marshalSimpleJSON(ctx, 3, 1, "", "", "", "")
 	require.NoError(t, err)
 	todaysMeta := string(metaData)
 	runSubtest(todaysMeta, "today")
@@ -866,6 +867,7 @@ func testMD5AllSlow(t *testing.T, f *Fs) {
 	ctx := context.Background()
 	fsResult := deriveFs(ctx, t, f, "md5all", settings{
 		"chunk_size":   "1P",
+		"chunk_mode":   "fixed",
 		"name_format":  "*.#",
 		"hash_type":    "md5all",
 		"transactions": "rename",
@@ -899,6 +901,198 @@ func testMD5AllSlow(t *testing.T, f *Fs) {
 	require.NoError(t, operations.Purge(ctx, baseFs, ""))
 }
 
+// Test splitting files by content
+func testContentChunking(t *testing.T, f *Fs) {
+	ctx := context.Background()
+	fsResult := deriveFs(ctx, t, f, "content", settings{
+		"chunk_mode":         "content",
+		"content_chunk_size": "1k",
+		"name_format":        "*.rclone_chunk.###",
+		"hash_type":          "md5",
+		"transactions":       "rename",
+		"meta_format":        "simplejson",
+	})
+	chunkFs, ok := fsResult.(*Fs)
+	require.True(t, ok, "fs must be a chunker remote")
+	baseFs := chunkFs.base
+	store, err := chunkFs.contentStore(ctx)
+	require.NoError(t, err)
+	defer func() {
+		_ = operations.Purge(ctx, baseFs, "")
+	}()
+
+	contentHashes := func(o fs.Object) map[string]bool {
+		obj, ok := o.(*Object)
+		require.True(t, ok)
+		require.True(t, obj.content, "must be split by content")
+		chunks, err := obj.contentIndex(ctx)
+		require.NoError(t, err)
+		hashes := map[string]bool{}
+		for _, chunk := range chunks {
+			hashes[chunk.hash] = true
+		}
+		return hashes
+	}
+	readAll := func(o fs.Object, options ...fs.OpenOption) string {
+		r, err := o.Open(ctx, options...)
+		require.NoError(t, err)
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+		return string(data)
+	}
+
+	// Small files are stored as is
+	_ = testPutFile(ctx, t, chunkFs, "small", "tiny", "", true)
+	small, err := baseFs.NewObject(ctx, "small")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), small.Size())
+
+	// Large files are split by content into the store
+	data := random.String(64 * 1024)
+	_ = testPutFile(ctx, t, chunkFs, "file", data, "", true)
+	obj, err := chunkFs.NewObject(ctx, "file")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), obj.Size())
+	hashes := contentHashes(obj)
+	assert.Greater(t, len(hashes), 4)
+	for hash := range hashes {
+		_, err := store.NewObject(ctx, contentChunkPath(hash))
+		assert.NoError(t, err, "chunk must be in the store")
+	}
+	_, err = baseFs.NewObject(ctx, "file.rclone_chunk._index")
+	assert.NoError(t, err, "index must be created")
+	_, err = baseFs.NewObject(ctx, "file.rclone_chunk.001")
+	assert.Error(t, err, "fixed chunks must not be created")
+	assert.Equal(t, data, readAll(obj))
+	assert.Equal(t, data[5000:6000], readAll(obj, &fs.RangeOption{Start: 5000, End: 5999}))
+
+	entries, err := chunkFs.List(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(entries))
+	assert.Equal(t, "file", entries[0].Remote())
+	assert.Equal(t, int64(len(data)), entries[0].Size())
+
+	// Updates only store the changed chunks
+	data2 := data[:1000] + "x" + data[1000:]
+	_ = testPutFile(ctx, t, chunkFs, "file", data2, "", true)
+	obj2, err := chunkFs.NewObject(ctx, "file")
+	require.NoError(t, err)
+	hashes2 := contentHashes(obj2)
+	changed := 0
+	for hash := range hashes2 {
+		if !hashes[hash] {
+			changed++
+		}
+	}
+	assert.LessOrEqual(t, changed, 2)
+	assert.Equal(t, data2, readAll(obj2))
+
+	// Copies share the chunks
+	copied, err := operations.Copy(ctx, chunkFs, nil, "copy", obj2)
+	require.NoError(t, err)
+	assert.Equal(t, hashes2, contentHashes(copied))
+	assert.Equal(t, data2, readAll(copied))
+	moved, err := operations.Move(ctx, chunkFs, nil, "moved", copied)
+	require.NoError(t, err)
+	assert.Equal(t, data2, readAll(moved))
+	_, err = baseFs.NewObject(ctx, "copy.rclone_chunk._index")
+	assert.Error(t, err, "index must be moved")
+
+	// The files can be read in fixed chunk mode too
+	fixedFs := deriveFs(ctx, t, f, "content", settings{
+		"chunk_mode":   "fixed",
+		"name_format":  "*.rclone_chunk.###",
+		"hash_type":    "md5",
+		"transactions": "rename",
+		"meta_format":  "simplejson",
+	})
+	fixedObj, err := fixedFs.NewObject(ctx, "moved")
+	require.NoError(t, err)
+	assert.Equal(t, data2, readAll(fixedObj))
+
+	// Storing a chunk again refreshes its modtime so CleanUp keeps it
+	var oldHash string
+	for hash := range hashes2 {
+		oldHash = hash
+		break
+	}
+	oldChunk, err := store.NewObject(ctx, contentChunkPath(oldHash))
+	require.NoError(t, err)
+	oldTime := time.Now().Add(-2 * contentGCGrace)
+	require.NoError(t, oldChunk.SetModTime(ctx, oldTime))
+	_ = testPutFile(ctx, t, chunkFs, "again", data2, "", true)
+	oldChunk, err = store.NewObject(ctx, contentChunkPath(oldHash))
+	require.NoError(t, err)
+	assert.Less(t, time.Since(oldChunk.ModTime(ctx)), contentGCGrace, "modtime must be refreshed")
+	againObj, err := chunkFs.NewObject(ctx, "again")
+	require.NoError(t, err)
+	require.NoError(t, againObj.Remove(ctx))
+
+	// CleanUp removes unused chunks only
+	saveGrace := contentGCGrace
+	defer func() {
+		contentGCGrace = saveGrace
+	}()
+	contentGCGrace = 0
+	require.NoError(t, obj2.Remove(ctx))
+	_, err = baseFs.NewObject(ctx, "file.rclone_chunk._index")
+	assert.Error(t, err, "index must be removed")
+	require.NoError(t, chunkFs.CleanUp(ctx))
+	for hash := range hashes {
+		_, err := store.NewObject(ctx, contentChunkPath(hash))
+		if hashes2[hash] {
+			assert.NoError(t, err, "used chunk must be kept")
+		} else {
+			assert.Error(t, err, "unused chunk must be removed")
+		}
+	}
+	assert.Equal(t, data2, readAll(moved))
+
+	require.NoError(t, moved.Remove(ctx))
+	require.NoError(t, chunkFs.CleanUp(ctx))
+	for hash := range hashes2 {
+		_, err := store.NewObject(ctx, contentChunkPath(hash))
+		assert.Error(t, err, "unused chunk must be removed")
+	}
+
+	// CleanUp during a long upload keeps the chunks stored so far
+	saveInterval := contentIndexInterval
+	defer func() {
+		contentIndexInterval = saveInterval
+	}()
+	contentIndexInterval = 0
+	data3 := random.String(64 * 1024)
+	cleanedUp := false
+	in := &hookReader{Reader: strings.NewReader(data3), after: len(data3) / 2, hook: func() {
+		require.NoError(t, chunkFs.CleanUp(ctx))
+		cleanedUp = true
+	}}
+	src := object.NewStaticObjectInfo("long", time.Now(), int64(len(data3)), true, nil, nil)
+	long, err := chunkFs.Put(ctx, in, src)
+	require.NoError(t, err)
+	assert.True(t, cleanedUp)
+	assert.Equal(t, data3, readAll(long))
+	require.NoError(t, long.Remove(ctx))
+}
+
+// hookReader calls hook once after reading the given number of bytes
+type hookReader struct {
+	io.Reader
+	after int
+	hook  func()
+}
+
+func (r *hookReader) Read(p []byte) (n int, err error) {
+	n, err = r.Reader.Read(p)
+	r.after -= n
+	if r.after <= 0 && r.hook != nil {
+		r.hook()
+		r.hook = nil
+	}
+	return n, err
+}
+
 // InternalTest dispatches all internal tests
 func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("PutLarge", func(t *testing.T) {
@@ -934,6 +1128,9 @@ func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("MD5AllSlow", func(t *testing.T) {
 		testMD5AllSlow(t, f)
 	})
+	t.Run("ContentChunking", func(t *testing.T) {
+		testContentChunking(t, f)
+	})
 }
 
 var _ fstests.InternalTester = (*Fs)(nil)
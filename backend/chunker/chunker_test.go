@@ -47,6 +47,7 @@ func TestIntegration(t *testing.T) {
 			"UserInfo",
 			"Disconnect",
 			"ListP",
+			"Link",
 		},
 	}
 	if *fstest.RemoteName == "" {
@@ -61,3 +62,44 @@ func TestIntegration(t *testing.T) {
 	}
 	fstests.Run(t, &opt)
 }
+
+// TestIntegrationContent runs integration tests with files split
+// by content in a chunker overlay wrapping a local temporary directory.
+func TestIntegrationContent(t *testing.T) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	name := "TestChunkerContent"
+	tempDir := filepath.Join(os.TempDir(), "rclone-chunker-test-content")
+	opt := fstests.Opt{
+		RemoteName:               name + ":",
+		NilObject:                (*chunker.Object)(nil),
+		SkipBadWindowsCharacters: !*UseBadChars,
+		UnimplementableObjectMethods: []string{
+			"MimeType",
+			"GetTier",
+			"SetTier",
+			"Metadata",
+			"SetMetadata",
+		},
+		UnimplementableFsMethods: []string{
+			"PublicLink",
+			"OpenWriterAt",
+			"OpenChunkWriter",
+			"MergeDirs",
+			"DirCacheFlush",
+			"UserInfo",
+			"Disconnect",
+			"ListP",
+			"Link",
+		},
+		ExtraConfig: []fstests.ExtraConfigItem{
+			{Name: name, Key: "type", Value: "chunker"},
+			{Name: name, Key: "remote", Value: tempDir},
+			{Name: name, Key: "chunk_mode", Value: "content"},
+			{Name: name, Key: "content_chunk_size", Value: "256"},
+		},
+		QuickTestOK: true,
+	}
+	fstests.Run(t, &opt)
+}
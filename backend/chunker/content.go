@@ -0,0 +1,574 @@
+package chunker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// Content-defined chunking
+//
+// In the "content" chunk mode files are split at boundaries found by
+// a rolling hash of the data rather than at multiples of the chunk
+// size. Inserting or removing bytes only changes the chunks around
+// the edit, the boundaries further on are found again at the same data.
+//
+// Chunks are stored once in the content store, a directory at the root
+// of the wrapped remote, named by the SHA-256 of their content. So an
+// updated file only uploads the chunks which have changed and identical
+// chunks in different files are stored once.
+//
+// The list of chunks of a file is kept in the "index" control chunk
+// next to the meta object. Metadata format v3 marks such files, the
+// metadata object keeps the total size and number of chunks as usual.
+//
+// As chunks are shared between files, removing a file only removes its
+// meta object and index. Chunks no longer referenced by any index are
+// removed by CleanUp.
+const (
+	chunkModeFixed   = "fixed"
+	chunkModeContent = "content"
+	ctrlTypeIndex    = "index"
+	contentStoreDir  = ".rclone_chunks"
+	minContentSize   = 256
+)
+
+// contentGCGrace is how old an unreferenced chunk must be before
+// CleanUp removes it. This protects the chunks of uploads which are
+// still running and haven't written their index yet.
+var contentGCGrace = time.Hour
+
+// contentIndexInterval is how often an upload in progress writes its
+// temporary index listing the chunks stored so far. CleanUp keeps the
+// chunks in temporary indexes so only the chunks stored since the
+// last one rely on contentGCGrace. It must be well under that.
+var contentIndexInterval = 15 * time.Minute
+
+// contentHashRegexp matches the names of chunks in the content store
+var contentHashRegexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// gearTable holds the random values for the gear rolling hash.
+//
+// It is generated from a fixed seed and must never change as
+// that would move the boundaries of all chunks and defeat
+// deduplication against existing chunks.
+var gearTable [256]uint64
+
+func init() {
+	// splitmix64
+	seed := uint64(0x72636c6f6e65) // "rclone"
+	for i := range gearTable {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		gearTable[i] = z ^ (z >> 31)
+	}
+}
+
+// contentSplitter splits a stream into content-defined chunks using
+// the gear rolling hash as in FastCDC.
+//
+// Chunks are between a quarter and four times the average size.
+type contentSplitter struct {
+	in      io.Reader
+	buf     []byte // holds up to a maximum size chunk
+	start   int    // start of data not returned yet
+	end     int    // end of data in buf
+	eof     bool
+	minSize int
+	mask    uint64
+}
+
+func newContentSplitter(in io.Reader, avgSize int) *contentSplitter {
+	minSize := avgSize / 4
+	// A boundary is found with probability 2^-n per byte past the
+	// minimum size, making the chunks about the average size.
+	n := bits.Len(uint(avgSize-minSize)) - 1
+	return &contentSplitter{
+		in:      in,
+		buf:     make([]byte, avgSize*4),
+		minSize: minSize,
+		mask:    ^uint64(0) << (64 - n), // use the high bits which depend on the last 64 bytes
+	}
+}
+
+// Next returns the next chunk or io.EOF if there is no more data.
+//
+// The chunk is only valid until the next call.
+func (s *contentSplitter) Next() ([]byte, error) {
+	if s.start > 0 {
+		s.end = copy(s.buf, s.buf[s.start:s.end])
+		s.start = 0
+	}
+	for !s.eof && s.end < len(s.buf) {
+		n, err := s.in.Read(s.buf[s.end:])
+		s.end += n
+		if err == io.EOF {
+			s.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if s.end == 0 {
+		return nil, io.EOF
+	}
+	s.start = s.boundary(s.buf[:s.end])
+	return s.buf[:s.start], nil
+}
+
+// Done returns true if all the data has been returned by Next
+func (s *contentSplitter) Done() bool {
+	return s.eof && s.start == s.end
+}
+
+// boundary returns the length of the chunk at the start of data
+func (s *contentSplitter) boundary(data []byte) int {
+	if len(data) <= s.minSize {
+		return len(data)
+	}
+	// warm up the hash on the 64 bytes before the minimum size
+	var h uint64
+	i := max(s.minSize-64, 0)
+	for ; i < s.minSize; i++ {
+		h = h<<1 + gearTable[data[i]]
+	}
+	for ; i < len(data); i++ {
+		h = h<<1 + gearTable[data[i]]
+		if h&s.mask == 0 {
+			return i + 1
+		}
+	}
+	return len(data)
+}
+
+// contentChunk is a chunk in the content store
+type contentChunk struct {
+	f    *Fs
+	hash string // hex SHA-256 of the content
+	size int64
+}
+
+// contentChunkPath returns the path of the chunk in the content store
+func contentChunkPath(hash string) string {
+	return hash[:2] + "/" + hash
+}
+
+// Size returns the size of the chunk
+func (c *contentChunk) Size() int64 {
+	return c.size
+}
+
+// Open opens the chunk for read
+func (c *contentChunk) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	store, err := c.f.contentStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := store.NewObject(ctx, contentChunkPath(c.hash))
+	if err != nil {
+		return nil, fmt.Errorf("content chunk %s: %w", c.hash, err)
+	}
+	if obj.Size() != c.size {
+		return nil, fmt.Errorf("content chunk %s has size %d, expecting %d", c.hash, obj.Size(), c.size)
+	}
+	return obj.Open(ctx, options...)
+}
+
+// contentStore returns the Fs holding content-defined chunks.
+// It is made on first use as files with fixed chunks don't need it.
+func (f *Fs) contentStore(ctx context.Context) (fs.Fs, error) {
+	f.storeMu.Lock()
+	defer f.storeMu.Unlock()
+	if f.store != nil {
+		return f.store.Fs, nil
+	}
+	store, err := cache.Get(ctx, f.storePath)
+	if err == fs.ErrorIsFile {
+		return nil, fmt.Errorf("content store %q is a file", f.storePath)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to make content store %q: %w", f.storePath, err)
+	}
+	// f has a finalizer already so pin the store with its own holder
+	f.store = &pinnedFs{Fs: store}
+	cache.PinUntilFinalized(store, f.store)
+	return store, nil
+}
+
+// pinnedFs holds an Fs pinned in the cache until it is garbage collected
+type pinnedFs struct {
+	fs.Fs
+}
+
+// putContentChunk stores data in the content store unless a chunk
+// with the same content is there already
+//
+// An existing chunk has its modtime refreshed if it is getting near
+// the end of contentGCGrace so CleanUp doesn't remove it before the
+// index using it is written. It is uploaded again if that fails.
+func (f *Fs) putContentChunk(ctx context.Context, store fs.Fs, data []byte) (*contentChunk, error) {
+	sum := sha256.Sum256(data)
+	chunk := &contentChunk{
+		f:    f,
+		hash: hex.EncodeToString(sum[:]),
+		size: int64(len(data)),
+	}
+	chunkRemote := contentChunkPath(chunk.hash)
+	if obj, err := store.NewObject(ctx, chunkRemote); err == nil && obj.Size() == chunk.size {
+		if time.Since(obj.ModTime(ctx)) < contentGCGrace/2 {
+			fs.Debugf(f, "content chunk %s is already stored", chunk.hash)
+			return chunk, nil
+		}
+		err = obj.SetModTime(ctx, time.Now())
+		if err == nil {
+			fs.Debugf(f, "content chunk %s is already stored - refreshed its modtime", chunk.hash)
+			return chunk, nil
+		}
+		fs.Debugf(f, "content chunk %s is already stored but failed to refresh its modtime so uploading again: %v", chunk.hash, err)
+	}
+	// The upload time is used by CleanUp so don't use the source modtime
+	info := object.NewStaticObjectInfo(chunkRemote, time.Now(), chunk.size, true, nil, store)
+	if _, err := store.Put(ctx, bytes.NewReader(data), info); err != nil {
+		return nil, fmt.Errorf("failed to store content chunk: %w", err)
+	}
+	return chunk, nil
+}
+
+// putContent implements put in the content chunk mode
+func (f *Fs) putContent(
+	ctx context.Context, in io.Reader, src fs.ObjectInfo, remote string, options []fs.OpenOption,
+	basePut putFn,
+) (obj fs.Object, err error) {
+	store, err := f.contentStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use chunkingReader for accounting and hashsums only,
+	// the boundaries are found by the splitter.
+	c := f.newChunkingReader(src)
+	c.chunkSize = math.MaxInt64
+	c.chunkLimit = c.chunkSize
+	c.expectSingle = false
+	wrapIn := c.wrapStream(ctx, in, src)
+	splitter := newContentSplitter(wrapIn, int(f.opt.ContentChunkSize))
+
+	var indexObject fs.Object
+	defer func() {
+		if err != nil {
+			c.rollback(ctx, indexObject)
+		}
+	}()
+
+	data, err := splitter.Next()
+	if err == io.EOF {
+		data, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Finalize small object as non-chunked unless its content looks
+	// like metadata or consistent hashing requires metadata.
+	if splitter.Done() && !f.hashAll {
+		needMeta := false
+		if len(data) <= maxMetadataSize {
+			_, needMeta, _ = unmarshalSimpleJSON(ctx, nil, data)
+		}
+		if !needMeta {
+			if c.sizeTotal != -1 && c.readCount != c.sizeTotal {
+				return nil, fmt.Errorf("incorrect upload size %d != %d", c.readCount, c.sizeTotal)
+			}
+			f.removeOldChunks(ctx, remote)
+			info := f.wrapInfo(src, remote, int64(len(data)))
+			baseObj, err := basePut(ctx, bytes.NewReader(data), info, options...)
+			if err != nil {
+				return nil, err
+			}
+			return f.newObject("", baseObj, nil), nil
+		}
+	}
+
+	xactID, err := f.newXactID(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	// Transfer chunks data
+	var chunks []*contentChunk
+	indexTime := time.Now()
+	for {
+		if len(chunks) > maxSafeChunkNumber {
+			return nil, ErrChunkOverflow
+		}
+		chunk, err := f.putContentChunk(ctx, store, data)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+		if splitter.Done() {
+			break
+		}
+		// Write the chunks so far to the temporary index so
+		// CleanUp doesn't remove them from a long upload
+		if time.Since(indexTime) >= contentIndexInterval {
+			indexObject, err = f.putContentIndex(ctx, src, remote, xactID, chunks, indexObject, basePut)
+			if err != nil {
+				return nil, fmt.Errorf("failed to write temporary index: %w", err)
+			}
+			indexTime = time.Now()
+		}
+		if data, err = splitter.Next(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Validate uploaded size
+	if c.sizeTotal != -1 && c.readCount != c.sizeTotal {
+		return nil, fmt.Errorf("incorrect upload size %d != %d", c.readCount, c.sizeTotal)
+	}
+
+	// Upload the index under a temporary name then activate it
+	indexObject, err = f.putContentIndex(ctx, src, remote, xactID, chunks, indexObject, basePut)
+	if err != nil {
+		return nil, err
+	}
+	f.removeOldChunks(ctx, remote)
+	indexMoved, err := f.baseMove(ctx, indexObject, f.makeChunkName(remote, -1, ctrlTypeIndex, ""), delFailed)
+	if err != nil {
+		return nil, err
+	}
+	indexObject = indexMoved
+
+	// Update meta object
+	c.updateHashes()
+	metadata, err := marshalSimpleJSON(ctx, c.readCount, len(chunks), c.md5, c.sha1, "", chunkModeContent)
+	if err != nil {
+		return nil, err
+	}
+	metaInfo := f.wrapInfo(src, remote, int64(len(metadata)))
+	metaObject, err := basePut(ctx, bytes.NewReader(metadata), metaInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	o := f.newObject("", metaObject, nil)
+	o.index = indexObject
+	o.content = true
+	o.contentChunks = chunks
+	o.nChunks = len(chunks)
+	o.size = c.readCount
+	o.md5 = c.md5
+	o.sha1 = c.sha1
+	o.isFull = true
+	o.xIDCached = true
+	return o, nil
+}
+
+// putContentIndex uploads the index of chunks under the temporary
+// name for xactID, updating indexObject if it has been uploaded
+// already, and returns the index object.
+func (f *Fs) putContentIndex(ctx context.Context, src fs.ObjectInfo, remote, xactID string, chunks []*contentChunk, indexObject fs.Object, basePut putFn) (fs.Object, error) {
+	index := formatIndex(chunks)
+	indexInfo := f.wrapInfo(src, f.makeChunkName(remote, -1, ctrlTypeIndex, xactID), int64(len(index)))
+	if indexObject != nil {
+		err := indexObject.Update(ctx, bytes.NewReader(index), indexInfo)
+		return indexObject, err
+	}
+	return basePut(ctx, bytes.NewReader(index), indexInfo)
+}
+
+// formatIndex makes the index of content-defined chunks.
+// It has a line per chunk with its hash and size.
+func formatIndex(chunks []*contentChunk) []byte {
+	var buf bytes.Buffer
+	for _, chunk := range chunks {
+		_, _ = fmt.Fprintf(&buf, "%s %d\n", chunk.hash, chunk.size)
+	}
+	return buf.Bytes()
+}
+
+// readIndex reads the chunks listed in the index object
+func (f *Fs) readIndex(ctx context.Context, indexObject fs.Object) (chunks []*contentChunk, err error) {
+	reader, err := indexObject.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = reader.Close() // ensure file handle is freed on windows
+	}()
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		hash, sizeStr, ok := strings.Cut(scanner.Text(), " ")
+		if !ok || !contentHashRegexp.MatchString(hash) {
+			return nil, fmt.Errorf("invalid index line %q", scanner.Text())
+		}
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid chunk size in index line %q", scanner.Text())
+		}
+		if len(chunks) > maxSafeChunkNumber {
+			return nil, ErrChunkOverflow
+		}
+		chunks = append(chunks, &contentChunk{f: f, hash: hash, size: size})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return chunks, nil
+}
+
+// contentIndex returns the content-defined chunks of the object
+// checking them against the metadata
+func (o *Object) contentIndex(ctx context.Context) ([]*contentChunk, error) {
+	if o.contentChunks != nil {
+		return o.contentChunks, nil
+	}
+	chunks, err := o.f.readIndex(ctx, o.index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+	var size int64
+	for _, chunk := range chunks {
+		size += chunk.size
+	}
+	if size != o.size || len(chunks) != o.nChunks {
+		return nil, errors.New("index doesn't match metadata")
+	}
+	o.contentChunks = chunks
+	return chunks, nil
+}
+
+// copyOrMoveContent copies or moves a file with content-defined
+// chunks. The chunks are shared so only the index and meta object
+// are transferred.
+func (f *Fs) copyOrMoveContent(ctx context.Context, o *Object, remote string, do copyMoveFn) (fs.Object, error) {
+	index, err := do(ctx, o.index, f.makeChunkName(remote, -1, ctrlTypeIndex, ""))
+	if err != nil {
+		return nil, err
+	}
+	metaObject, err := do(ctx, o.main, remote)
+	if err != nil {
+		silentlyRemove(ctx, index)
+		return nil, err
+	}
+	newObj := f.newObject(remote, metaObject, nil)
+	newObj.index = index
+	newObj.content = true
+	newObj.contentChunks = o.contentChunks
+	newObj.nChunks = o.nChunks
+	newObj.size = o.size
+	newObj.md5 = o.md5
+	newObj.sha1 = o.sha1
+	newObj.isFull = true
+	newObj.xIDCached = true
+	return newObj, nil
+}
+
+// cleanUpContent removes the chunks in the content store which
+// aren't listed in any index under the root of the wrapped remote.
+//
+// Index chunks of other chunker remotes using the same store are only
+// recognised if they use the same name format.
+func (f *Fs) cleanUpContent(ctx context.Context) error {
+	rootFs, err := cache.Get(ctx, f.contentRoot)
+	if err != nil && err != fs.ErrorIsFile {
+		return fmt.Errorf("failed to make remote %q to clean up: %w", f.contentRoot, err)
+	}
+	store, err := f.contentStore(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Find the chunks in use, including by uploads in progress
+	used := make(map[string]bool)
+	err = walk.Walk(ctx, rootFs, "", true, -1, func(dir string, entries fs.DirEntries, err error) error {
+		if err != nil {
+			return err
+		}
+		if dir == contentStoreDir {
+			return walk.ErrorSkipDir
+		}
+		for _, entry := range entries {
+			indexObject, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			if _, _, ctrlType, _ := f.parseChunkName(indexObject.Remote()); ctrlType != ctrlTypeIndex {
+				continue
+			}
+			chunks, err := f.readIndex(ctx, indexObject)
+			if err != nil {
+				return fmt.Errorf("failed to read index %q: %w", indexObject.Remote(), err)
+			}
+			for _, chunk := range chunks {
+				used[chunk.hash] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to find chunks in use: %w", err)
+	}
+
+	// Remove the others
+	var removed int
+	err = walk.ListR(ctx, store, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			chunk, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			hash := path.Base(chunk.Remote())
+			if used[hash] || !contentHashRegexp.MatchString(hash) {
+				continue
+			}
+			if time.Since(chunk.ModTime(ctx)) < contentGCGrace {
+				fs.Debugf(chunk, "Keeping recent unreferenced content chunk")
+				continue
+			}
+			// Check again in case an upload has just refreshed it
+			current, err := store.NewObject(ctx, chunk.Remote())
+			if err != nil {
+				fs.Debugf(chunk, "Not removing content chunk: %v", err)
+				continue
+			}
+			if time.Since(current.ModTime(ctx)) < contentGCGrace {
+				fs.Debugf(chunk, "Keeping content chunk refreshed since listing")
+				continue
+			}
+			if err := operations.DeleteFile(ctx, chunk); err != nil {
+				return err
+			}
+			removed++
+		}
+		return nil
+	})
+	if err == fs.ErrorDirNotFound {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove unreferenced chunks: %w", err)
+	}
+	fs.Infof(f, "Removed %d unreferenced content chunks", removed)
+	return nil
+}
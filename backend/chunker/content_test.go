@@ -0,0 +1,96 @@
+package chunker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// split data into content-defined chunks returning their hashes
+func splitContent(t *testing.T, data []byte, avgSize int) (hashes [][32]byte) {
+	splitter := newContentSplitter(bytes.NewReader(data), avgSize)
+	var joined []byte
+	for !splitter.Done() {
+		chunk, err := splitter.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if !splitter.Done() {
+			assert.GreaterOrEqual(t, len(chunk), avgSize/4)
+		}
+		assert.LessOrEqual(t, len(chunk), avgSize*4)
+		joined = append(joined, chunk...)
+		hashes = append(hashes, sha256.Sum256(chunk))
+	}
+	assert.Equal(t, data, joined)
+	return hashes
+}
+
+func TestContentSplitter(t *testing.T) {
+	const avgSize = 4096
+	data := make([]byte, 1024*1024)
+	_, _ = rand.New(rand.NewSource(1)).Read(data)
+
+	hashes := splitContent(t, data, avgSize)
+	avg := len(data) / len(hashes)
+	assert.Greater(t, avg, avgSize/2)
+	assert.Less(t, avg, avgSize*2)
+
+	// Same data gives the same chunks
+	assert.Equal(t, hashes, splitContent(t, data, avgSize))
+
+	// Inserting a byte only changes the chunks around it
+	edited := append(append(append([]byte{}, data[:100000]...), 'x'), data[100000:]...)
+	editedHashes := splitContent(t, edited, avgSize)
+	seen := make(map[[32]byte]bool)
+	for _, hash := range hashes {
+		seen[hash] = true
+	}
+	changed := 0
+	for _, hash := range editedHashes {
+		if !seen[hash] {
+			changed++
+		}
+	}
+	assert.LessOrEqual(t, changed, 2)
+
+	// Short and empty input
+	assert.Len(t, splitContent(t, data[:10], avgSize), 1)
+	assert.Len(t, splitContent(t, nil, avgSize), 0)
+}
+
+func TestContentIndex(t *testing.T) {
+	f := &Fs{}
+	chunks := []*contentChunk{
+		{f: f, hash: "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", size: 1},
+		{f: f, hash: "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210", size: 1234},
+	}
+	index := formatIndex(chunks)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef 1\n"+
+		"fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210 1234\n", string(index))
+	assert.Equal(t, "01/0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", contentChunkPath(chunks[0].hash))
+
+	ctx := context.Background()
+	got, err := f.readIndex(ctx, object.NewMemoryObject("file.rclone_chunk._index", time.Now(), index))
+	require.NoError(t, err)
+	assert.Equal(t, chunks, got)
+
+	for _, bad := range []string{
+		"0123 1\n",
+		"0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef\n",
+		"0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef -1\n",
+		"0123456789ABCDEF0123456789abcdef0123456789abcdef0123456789abcdef 1\n",
+	} {
+		_, err := f.readIndex(ctx, object.NewMemoryObject("bad", time.Now(), []byte(bad)))
+		assert.Error(t, err, bad)
+	}
+}
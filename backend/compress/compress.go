@@ -46,6 +46,9 @@ const (
 	minCompressionRatio = 1.1
 
 	gzFileExt           = ".gz"
+	zstdFileExt         = ".zst"
+	xzFileExt           = ".xz"
+	brotliFileExt       = ".br"
 	metaFileExt         = ".json"
 	uncompressedFileExt = ".bin"
 )
@@ -54,8 +57,27 @@ const (
 const (
 	Uncompressed = 0
 	Gzip         = 2
+	Zstd         = 3
+	Xz           = 4
+	Brotli       = 5
 )
 
+// compressionModes maps the mode names to the compression modes
+var compressionModes = map[string]int{
+	"gzip":   Gzip,
+	"zstd":   Zstd,
+	"xz":     Xz,
+	"brotli": Brotli,
+}
+
+// compressedFileExts maps the compression modes to their file extensions
+var compressedFileExts = map[int]string{
+	Gzip:   gzFileExt,
+	Zstd:   zstdFileExt,
+	Xz:     xzFileExt,
+	Brotli: brotliFileExt,
+}
+
 var nameRegexp = regexp.MustCompile(`^(.+?)\.([A-Za-z0-9-_]{11})$`)
 
 // Register with Fs
@@ -65,6 +87,15 @@ func init() {
 		{ // Default compression mode options {
 			Value: "gzip",
 			Help:  "Standard gzip compression with fastest parameters.",
+		}, {
+			Value: "zstd",
+			Help:  "Zstandard compression - fast with a good compression ratio.",
+		}, {
+			Value: "xz",
+			Help:  "XZ (LZMA2) compression - slow but strong, good for cold data.",
+		}, {
+			Value: "brotli",
+			Help:  "Brotli compression - slow to compress but fast to decompress.",
 		},
 	}
 
@@ -87,15 +118,22 @@ func init() {
 			Examples: compressionModeOptions,
 		}, {
 			Name: "level",
-			Help: `GZIP compression level (-2 to 9).
+			Help: `Compression level.
+
+The meaning depends on the compression mode. For all modes -1 (the
+default) selects the recommended level for the algorithm.
+
+For gzip the level can be -2 to 9. Levels 1 to 9 increase compression
+at the cost of speed. Going past 6 generally offers very little
+return. Level -2 uses Huffman encoding only. Only use if you know what
+you are doing. Level 0 turns off compression.
 
-Generally -1 (default, equivalent to 5) is recommended.
-Levels 1 to 9 increase compression at the cost of speed. Going past 6 
-generally offers very little return.
+For zstd the level can be 1 to 22 and is mapped onto the nearest
+speed setting of the encoder.
 
-Level -2 uses Huffman encoding only. Only use if you know what you
-are doing.
-Level 0 turns off compression.`,
+For brotli the level can be 0 to 11.
+
+For xz the level is ignored.`,
 			Default:  sgzip.DefaultCompression,
 			Advanced: true,
 		}, {
@@ -130,6 +168,7 @@ type Fs struct {
 	root     string
 	opt      Options
 	mode     int          // compression mode id
+	codec    blockCodec   // codec for writing the seekable block modes
 	features *fs.Features // optional features
 }
 
@@ -182,6 +221,13 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 			f.root = ""
 		}
 	}
+	if f.mode != Uncompressed && f.mode != Gzip {
+		var codecErr error
+		f.codec, codecErr = newBlockCodec(f.mode, opt.CompressionLevel)
+		if codecErr != nil {
+			return nil, codecErr
+		}
+	}
 	// the features here are ones we could support, and they are
 	// ANDed with the ones from wrappedFs
 	f.features = (&fs.Features{
@@ -216,12 +262,11 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 }
 
 func compressionModeFromName(name string) int {
-	switch name {
-	case "gzip":
-		return Gzip
-	default:
+	mode, ok := compressionModes[name]
+	if !ok {
 		return Uncompressed
 	}
+	return mode
 }
 
 // Converts an int64 to base64
@@ -261,7 +306,7 @@ func processFileName(compressedFileName string) (origFileName string, extension
 	if err != nil {
 		return "", "", 0, errors.New("could not decode size")
 	}
-	return match[1], gzFileExt, size, nil
+	return match[1], extension, size, nil
 }
 
 // Generates the file name for a metadata file
@@ -287,7 +332,11 @@ func unwrapMetadataFile(filename string) (string, bool) {
 // makeDataName generates the file name for a data file with specified compression mode
 func makeDataName(remote string, size int64, mode int) (newRemote string) {
 	if mode != Uncompressed {
-		newRemote = remote + "." + int64ToBase64(size) + gzFileExt
+		ext, ok := compressedFileExts[mode]
+		if !ok {
+			ext = gzFileExt
+		}
+		newRemote = remote + "." + int64ToBase64(size) + ext
 	} else {
 		newRemote = remote + uncompressedFileExt
 	}
@@ -496,7 +545,38 @@ type putFn func(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ..
 
 type compressionResult struct {
 	err  error
-	meta sgzip.GzipMetadata
+	meta CompressionMetadata
+}
+
+// compressWriter is the interface the compressors used by putCompress satisfy
+type compressWriter interface {
+	io.WriteCloser
+	MetaData() CompressionMetadata
+}
+
+// gzipWriter adapts a sgzip.Writer to a compressWriter
+type gzipWriter struct {
+	*sgzip.Writer
+}
+
+// MetaData returns the gzip metadata as CompressionMetadata
+func (w gzipWriter) MetaData() CompressionMetadata {
+	return CompressionMetadata(w.Writer.MetaData())
+}
+
+// newCompressWriter returns a compressWriter for the configured mode
+func (f *Fs) newCompressWriter(w io.Writer) (compressWriter, error) {
+	if f.mode == Gzip {
+		gz, err := sgzip.NewWriterLevel(w, f.opt.CompressionLevel)
+		if err != nil {
+			return nil, err
+		}
+		return gzipWriter{gz}, nil
+	}
+	if f.codec == nil {
+		return nil, fmt.Errorf("no compressor for compression mode %d", f.mode)
+	}
+	return newBlockWriter(w, f.codec), nil
 }
 
 // replicating some of operations.Rcat functionality because we want to support remotes without streaming
@@ -559,9 +639,10 @@ func (f *Fs) putCompress(ctx context.Context, in io.Reader, src fs.ObjectInfo, o
 	pipeReader, pipeWriter := io.Pipe()
 	results := make(chan compressionResult)
 	go func() {
-		gz, err := sgzip.NewWriterLevel(pipeWriter, f.opt.CompressionLevel)
+		gz, err := f.newCompressWriter(pipeWriter)
 		if err != nil {
-			results <- compressionResult{err: err, meta: sgzip.GzipMetadata{}}
+			_ = pipeWriter.CloseWithError(err)
+			results <- compressionResult{err: err, meta: CompressionMetadata{}}
 			return
 		}
 		_, err = io.Copy(gz, in)
@@ -680,7 +761,7 @@ func (f *Fs) putUncompress(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 	if err != nil {
 		return nil, nil, err
 	}
-	return o, newMetadata(o.Size(), Uncompressed, sgzip.GzipMetadata{}, hex.EncodeToString(sum), mimeType), nil
+	return o, newMetadata(o.Size(), Uncompressed, CompressionMetadata{}, hex.EncodeToString(sum), mimeType), nil
 }
 
 // This function will write a metadata struct to a metadata Object for an src. Returns a wrappable metadata object.
@@ -1094,7 +1175,7 @@ type ObjectMetadata struct {
 	Size                int64  // Size of the object.
 	MD5                 string // MD5 hash of the file.
 	MimeType            string // Mime type of the file
-	CompressionMetadata sgzip.GzipMetadata
+	CompressionMetadata CompressionMetadata
 }
 
 // Object with external metadata
@@ -1108,7 +1189,7 @@ type Object struct {
 }
 
 // This function generates a metadata object
-func newMetadata(size int64, mode int, cmeta sgzip.GzipMetadata, md5 string, mimeType string) *ObjectMetadata {
+func newMetadata(size int64, mode int, cmeta CompressionMetadata, md5 string, mimeType string) *ObjectMetadata {
 	meta := new(ObjectMetadata)
 	meta.Size = size
 	meta.Mode = mode
@@ -1393,16 +1474,29 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 			openOptions = append(openOptions, option)
 		}
 	}
+	// Find the block codec if not gzip
+	var codec blockCodec
+	if o.meta.Mode != Gzip {
+		codec, err = newBlockCodec(o.meta.Mode, -1)
+		if err != nil {
+			return nil, fmt.Errorf("can't read %q: %w", o.Remote(), err)
+		}
+	}
 	// Get a chunkedreader for the wrapped object
 	chunkedReader := chunkedreader.New(ctx, o.Object, initialChunkSize, maxChunkSize, chunkStreams)
 	// Get file handle
 	var file io.Reader
-	if offset != 0 {
-		file, err = sgzip.NewReaderAt(chunkedReader, &o.meta.CompressionMetadata, offset)
-	} else {
+	switch {
+	case codec != nil:
+		file, err = newBlockReader(chunkedReader, codec, &o.meta.CompressionMetadata, offset)
+	case offset != 0:
+		gzMeta := sgzip.GzipMetadata(o.meta.CompressionMetadata)
+		file, err = sgzip.NewReaderAt(chunkedReader, &gzMeta, offset)
+	default:
 		file, err = sgzip.NewReader(chunkedReader)
 	}
 	if err != nil {
+		_ = chunkedReader.Close()
 		return nil, err
 	}
 
@@ -4,6 +4,7 @@ package compress
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	_ "github.com/rclone/rclone/backend/drive"
@@ -26,6 +27,7 @@ var defaultOpt = fstests.Opt{
 		"PutStream",
 		"UserInfo",
 		"Disconnect",
+		"Link",
 	},
 	TiersToTest:                  []string{"STANDARD", "STANDARD_IA"},
 	UnimplementableObjectMethods: []string{},
@@ -53,3 +55,36 @@ func TestRemoteGzip(t *testing.T) {
 	opt.QuickTestOK = true
 	fstests.Run(t, &opt)
 }
+
+// testRemoteMode runs the integration tests with the compression mode passed in
+func testRemoteMode(t *testing.T, mode string) {
+	if *fstest.RemoteName != "" {
+		t.Skip("Skipping as -remote set")
+	}
+	tempdir := filepath.Join(os.TempDir(), "rclone-compress-test-"+mode)
+	name := "TestCompress" + strings.ToUpper(mode[:1]) + mode[1:]
+	opt := defaultOpt
+	opt.RemoteName = name + ":"
+	opt.ExtraConfig = []fstests.ExtraConfigItem{
+		{Name: name, Key: "type", Value: "compress"},
+		{Name: name, Key: "remote", Value: tempdir},
+		{Name: name, Key: "mode", Value: mode},
+	}
+	opt.QuickTestOK = true
+	fstests.Run(t, &opt)
+}
+
+// TestRemoteZstd tests zstd compression
+func TestRemoteZstd(t *testing.T) {
+	testRemoteMode(t, "zstd")
+}
+
+// TestRemoteXz tests xz compression
+func TestRemoteXz(t *testing.T) {
+	testRemoteMode(t, "xz")
+}
+
+// TestRemoteBrotli tests brotli compression
+func TestRemoteBrotli(t *testing.T) {
+	testRemoteMode(t, "brotli")
+}
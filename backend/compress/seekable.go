@@ -0,0 +1,342 @@
+package compress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// seekableBlockSize is the amount of uncompressed data stored in each
+// independently compressed block of the seekable formats.
+//
+// Smaller blocks make seeking cheaper but reduce the compression ratio.
+const seekableBlockSize = 1024 * 1024
+
+// CompressionMetadata describes the block layout of a compressed file
+// so that it can be read from an arbitrary offset.
+//
+// It is JSON compatible with sgzip.GzipMetadata which is what older
+// versions of this backend stored. For gzip BlockData[0] is the size
+// of the gzip header followed by the compressed size of each block,
+// for the other modes BlockData is just the compressed size of each
+// block.
+type CompressionMetadata struct {
+	BlockSize int      // Size of each uncompressed block
+	Size      int64    // Uncompressed size of the file
+	BlockData []uint32 // Compressed block sizes
+}
+
+// blockCodec compresses and decompresses single blocks of a seekable
+// compressed file.
+//
+// Implementations must be safe for concurrent use.
+type blockCodec interface {
+	// compress appends the compressed form of src to dst
+	compress(dst *bytes.Buffer, src []byte) error
+	// decompress decompresses src into dst (which may be reused) and
+	// returns the result
+	decompress(dst []byte, src []byte) ([]byte, error)
+}
+
+// newBlockCodec returns the codec for the compression mode passed in
+// using the level supplied for compression. A level of -1 selects the
+// default level for the algorithm.
+func newBlockCodec(mode int, level int) (blockCodec, error) {
+	switch mode {
+	case Zstd:
+		return newZstdCodec(level), nil
+	case Xz:
+		return xzCodec{}, nil
+	case Brotli:
+		return newBrotliCodec(level), nil
+	}
+	return nil, fmt.Errorf("compression mode %d is not a seekable block format", mode)
+}
+
+// zstdCodec implements blockCodec for zstd
+type zstdCodec struct {
+	level zstd.EncoderLevel
+	once  sync.Once // for making enc
+	enc   *zstd.Encoder
+	err   error
+}
+
+var (
+	zstdDecoderOnce sync.Once
+	zstdDecoder     *zstd.Decoder
+	zstdDecoderErr  error
+)
+
+// getZstdDecoder returns a shared zstd decoder - DecodeAll may be
+// called concurrently on it.
+func getZstdDecoder() (*zstd.Decoder, error) {
+	zstdDecoderOnce.Do(func() {
+		zstdDecoder, zstdDecoderErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	})
+	return zstdDecoder, zstdDecoderErr
+}
+
+func newZstdCodec(level int) *zstdCodec {
+	encLevel := zstd.SpeedDefault
+	if level >= 0 {
+		encLevel = zstd.EncoderLevelFromZstd(level)
+	}
+	return &zstdCodec{level: encLevel}
+}
+
+// getEncoder makes the encoder on first use so codecs only used for
+// reading are cheap.
+func (c *zstdCodec) getEncoder() (*zstd.Encoder, error) {
+	c.once.Do(func() {
+		c.enc, c.err = zstd.NewWriter(nil, zstd.WithEncoderLevel(c.level), zstd.WithEncoderConcurrency(1))
+		if c.err != nil {
+			c.err = fmt.Errorf("failed to make zstd encoder: %w", c.err)
+		}
+	})
+	return c.enc, c.err
+}
+
+func (c *zstdCodec) compress(dst *bytes.Buffer, src []byte) error {
+	enc, err := c.getEncoder()
+	if err != nil {
+		return err
+	}
+	_, err = dst.Write(enc.EncodeAll(src, nil))
+	return err
+}
+
+func (c *zstdCodec) decompress(dst []byte, src []byte) ([]byte, error) {
+	dec, err := getZstdDecoder()
+	if err != nil {
+		return nil, err
+	}
+	return dec.DecodeAll(src, dst[:0])
+}
+
+// xzCodec implements blockCodec for xz
+type xzCodec struct{}
+
+func (xzCodec) compress(dst *bytes.Buffer, src []byte) error {
+	// No need for a dictionary bigger than the block
+	w, err := xz.WriterConfig{DictCap: seekableBlockSize}.NewWriter(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (xzCodec) decompress(dst []byte, src []byte) ([]byte, error) {
+	r, err := xz.NewReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	return readAllInto(dst, r)
+}
+
+// brotliCodec implements blockCodec for brotli
+type brotliCodec struct {
+	level int
+}
+
+func newBrotliCodec(level int) brotliCodec {
+	if level < 0 {
+		level = brotli.DefaultCompression
+	} else if level > brotli.BestCompression {
+		level = brotli.BestCompression
+	}
+	return brotliCodec{level: level}
+}
+
+func (c brotliCodec) compress(dst *bytes.Buffer, src []byte) error {
+	w := brotli.NewWriterLevel(dst, c.level)
+	if _, err := w.Write(src); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+func (c brotliCodec) decompress(dst []byte, src []byte) ([]byte, error) {
+	return readAllInto(dst, brotli.NewReader(bytes.NewReader(src)))
+}
+
+// readAllInto reads all of r into dst reusing its storage
+func readAllInto(dst []byte, r io.Reader) ([]byte, error) {
+	buf := bytes.NewBuffer(dst[:0])
+	_, err := buf.ReadFrom(r)
+	return buf.Bytes(), err
+}
+
+// blockWriter compresses data written to it into independently
+// compressed blocks of seekableBlockSize bytes.
+type blockWriter struct {
+	w     io.Writer
+	codec blockCodec
+	buf   []byte       // uncompressed data for the current block
+	out   bytes.Buffer // compressed data for the current block
+	meta  CompressionMetadata
+}
+
+func newBlockWriter(w io.Writer, codec blockCodec) *blockWriter {
+	return &blockWriter{
+		w:     w,
+		codec: codec,
+		buf:   make([]byte, 0, seekableBlockSize),
+		meta: CompressionMetadata{
+			BlockSize: seekableBlockSize,
+			BlockData: []uint32{},
+		},
+	}
+}
+
+// Write compresses p to the underlying writer
+func (w *blockWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := min(len(p), seekableBlockSize-len(w.buf))
+		w.buf = append(w.buf, p[:chunk]...)
+		p = p[chunk:]
+		n += chunk
+		if len(w.buf) == seekableBlockSize {
+			if err = w.flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// flush compresses and writes out the current block
+func (w *blockWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	w.out.Reset()
+	if err := w.codec.compress(&w.out, w.buf); err != nil {
+		return fmt.Errorf("failed to compress block: %w", err)
+	}
+	n, err := w.w.Write(w.out.Bytes())
+	if err != nil {
+		return err
+	}
+	w.meta.BlockData = append(w.meta.BlockData, uint32(n))
+	w.meta.Size += int64(len(w.buf))
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close writes out any remaining data. It doesn't close the
+// underlying writer.
+func (w *blockWriter) Close() error {
+	return w.flush()
+}
+
+// MetaData returns the block layout of the data written so far
+func (w *blockWriter) MetaData() CompressionMetadata {
+	return w.meta
+}
+
+// blockReader reads a file written by blockWriter starting from an
+// arbitrary offset.
+type blockReader struct {
+	r      io.Reader
+	codec  blockCodec
+	meta   *CompressionMetadata
+	block  int    // index of the next block to read
+	cbuf   []byte // compressed data
+	buf    []byte // uncompressed data for the current block
+	offset int    // read position in buf
+}
+
+// newBlockReader returns a reader which decompresses from offset.
+//
+// r should be positioned at the start of the compressed file and is
+// seeked to the block containing offset.
+func newBlockReader(r io.ReadSeeker, codec blockCodec, meta *CompressionMetadata, offset int64) (*blockReader, error) {
+	br := &blockReader{
+		r:     r,
+		codec: codec,
+		meta:  meta,
+	}
+	if offset < 0 {
+		return nil, errors.New("can't read from negative offset")
+	}
+	if offset >= meta.Size {
+		br.block = len(meta.BlockData)
+		return br, nil
+	}
+	if meta.BlockSize <= 0 {
+		return nil, fmt.Errorf("invalid block size %d", meta.BlockSize)
+	}
+	block := int(offset / int64(meta.BlockSize))
+	if block >= len(meta.BlockData) {
+		return nil, fmt.Errorf("offset %d is beyond the last block", offset)
+	}
+	var start int64
+	for _, size := range meta.BlockData[:block] {
+		start += int64(size)
+	}
+	if start != 0 {
+		if _, err := r.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	br.block = block
+	if err := br.readBlock(); err != nil {
+		return nil, err
+	}
+	br.offset = int(offset % int64(meta.BlockSize))
+	return br, nil
+}
+
+// readBlock reads and decompresses the next block
+func (br *blockReader) readBlock() error {
+	size := int(br.meta.BlockData[br.block])
+	if cap(br.cbuf) < size {
+		br.cbuf = make([]byte, size)
+	}
+	br.cbuf = br.cbuf[:size]
+	if _, err := io.ReadFull(br.r, br.cbuf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("failed to read block %d: %w", br.block, err)
+	}
+	buf, err := br.codec.decompress(br.buf, br.cbuf)
+	if err != nil {
+		return fmt.Errorf("failed to decompress block %d: %w", br.block, err)
+	}
+	want := int64(br.meta.BlockSize)
+	if remaining := br.meta.Size - int64(br.block)*want; remaining < want {
+		want = remaining
+	}
+	if int64(len(buf)) != want {
+		return fmt.Errorf("block %d: decompressed to %d bytes but expecting %d", br.block, len(buf), want)
+	}
+	br.buf = buf
+	br.offset = 0
+	br.block++
+	return nil
+}
+
+// Read decompressed data into p
+func (br *blockReader) Read(p []byte) (n int, err error) {
+	for br.offset >= len(br.buf) {
+		if br.block >= len(br.meta.BlockData) {
+			return 0, io.EOF
+		}
+		if err = br.readBlock(); err != nil {
+			return 0, err
+		}
+	}
+	n = copy(p, br.buf[br.offset:])
+	br.offset += n
+	return n, nil
+}
@@ -0,0 +1,94 @@
+package compress
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeTestData makes compressible test data of the size given
+func makeTestData(size int) []byte {
+	r := rand.New(rand.NewSource(42))
+	words := []string{"rclone ", "compress ", "seekable ", "block ", "zstd ", "xz ", "brotli "}
+	data := make([]byte, 0, size+16)
+	for len(data) < size {
+		data = append(data, words[r.Intn(len(words))]...)
+	}
+	return data[:size]
+}
+
+func TestBlockCodecs(t *testing.T) {
+	for _, mode := range []int{Zstd, Xz, Brotli} {
+		codec, err := newBlockCodec(mode, -1)
+		require.NoError(t, err)
+		for _, size := range []int{0, 1, seekableBlockSize - 1, seekableBlockSize, 2*seekableBlockSize + 12345} {
+			t.Run(fmt.Sprintf("mode=%d,size=%d", mode, size), func(t *testing.T) {
+				data := makeTestData(size)
+
+				var compressed bytes.Buffer
+				w := newBlockWriter(&compressed, codec)
+				n, err := w.Write(data)
+				require.NoError(t, err)
+				assert.Equal(t, size, n)
+				require.NoError(t, w.Close())
+
+				meta := w.MetaData()
+				assert.Equal(t, int64(size), meta.Size)
+				assert.Equal(t, seekableBlockSize, meta.BlockSize)
+				assert.Equal(t, (size+seekableBlockSize-1)/seekableBlockSize, len(meta.BlockData))
+				var total int64
+				for _, blockSize := range meta.BlockData {
+					total += int64(blockSize)
+				}
+				assert.Equal(t, int64(compressed.Len()), total)
+				if size > 1000 {
+					assert.Less(t, compressed.Len(), size)
+				}
+
+				for _, offset := range []int{0, 1, size / 2, seekableBlockSize, size - 1, size} {
+					if offset < 0 || offset > size {
+						continue
+					}
+					r, err := newBlockReader(bytes.NewReader(compressed.Bytes()), codec, &meta, int64(offset))
+					require.NoError(t, err)
+					got, err := io.ReadAll(r)
+					require.NoError(t, err)
+					assert.Equal(t, data[offset:], got, "offset %d", offset)
+				}
+			})
+		}
+	}
+}
+
+func TestBlockReaderCorrupt(t *testing.T) {
+	codec, err := newBlockCodec(Zstd, -1)
+	require.NoError(t, err)
+	var compressed bytes.Buffer
+	w := newBlockWriter(&compressed, codec)
+	_, err = w.Write(makeTestData(1000))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	meta := w.MetaData()
+
+	// Truncated data
+	r, err := newBlockReader(bytes.NewReader(compressed.Bytes()[:10]), codec, &meta, 0)
+	assert.Nil(t, r)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Wrong size in the metadata
+	meta.Size++
+	_, err = newBlockReader(bytes.NewReader(compressed.Bytes()), codec, &meta, 0)
+	assert.ErrorContains(t, err, "decompressed to 1000 bytes but expecting 1001")
+}
+
+func TestNewBlockCodecUnknown(t *testing.T) {
+	_, err := newBlockCodec(Gzip, -1)
+	assert.Error(t, err)
+	_, err = newBlockCodec(99, -1)
+	assert.Error(t, err)
+}
@@ -6,8 +6,10 @@ import (
 	"crypto/aes"
 	gocipher "crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base32"
 	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -33,11 +35,16 @@ const (
 	nameCipherBlockSize = aes.BlockSize
 	fileMagic           = "RCLONE\x00\x00"
 	fileMagicSize       = len(fileMagic)
+	fileMagicPrefixSize = 6 // the rest of the magic is the ID of the data key
 	fileNonceSize       = 24
 	fileHeaderSize      = fileMagicSize + fileNonceSize
 	blockHeaderSize     = secretbox.Overhead
 	blockDataSize       = 64 * 1024
 	blockSize           = blockHeaderSize + blockDataSize
+	keyIDMask           = 0x7fff // bits of the key ID in the header
+	keyIDTrailer        = 0x8000 // set in the key ID if the file has a trailer
+	trailerDataSize     = 4096   // size of the plaintext of the metadata trailer
+	trailerSize         = blockHeaderSize + trailerDataSize
 )
 
 // Errors returned by cipher
@@ -51,6 +58,8 @@ var (
 	ErrorEncryptedFileBadHeader  = errors.New("file has truncated block header")
 	ErrorEncryptedBadMagic       = errors.New("not an encrypted file - bad magic string")
 	ErrorEncryptedBadBlock       = errors.New("failed to authenticate decrypted block - bad password?")
+	ErrorEncryptedUnknownKey     = errors.New("file encrypted with a key not in the config - missing data password?")
+	ErrorEncryptedMetadata       = errors.New("file has encrypted metadata - set encrypt_metadata to read it")
 	ErrorBadBase32Encoding       = errors.New("bad base32 filename encoding")
 	ErrorFileClosed              = errors.New("file already closed")
 	ErrorNotAnEncryptedFile      = errors.New("not an encrypted file - does not match suffix")
@@ -171,6 +180,8 @@ func NewNameEncoding(s string) (enc fileNameEncoding, err error) {
 // Cipher defines an encoding and decoding cipher for the crypt backend
 type Cipher struct {
 	dataKey         [32]byte                  // Key for secretbox
+	dataKeys        map[uint16]*[32]byte      // Keys for secretbox by key ID
+	dataKeyID       uint16                    // ID of the key to encrypt new files with
 	nameKey         [32]byte                  // 16,24 or 32 bytes
 	nameTweak       [nameCipherBlockSize]byte // used to tweak the name crypto
 	block           gocipher.Block
@@ -180,6 +191,7 @@ type Cipher struct {
 	cryptoRand      io.Reader // read crypto random numbers from here
 	dirNameEncrypt  bool
 	passBadBlocks   bool // if set passed bad blocks as zeroed blocks
+	encryptMetadata bool // if set files with metadata trailers can be read
 	encryptedSuffix string
 }
 
@@ -220,6 +232,11 @@ func (c *Cipher) setPassBadBlocks(passBadBlocks bool) {
 	c.passBadBlocks = passBadBlocks
 }
 
+// Call to allow reading files with metadata trailers
+func (c *Cipher) setEncryptMetadata(encryptMetadata bool) {
+	c.encryptMetadata = encryptMetadata
+}
+
 // Key creates all the internal keys from the password passed in using
 // scrypt.
 //
@@ -228,29 +245,86 @@ func (c *Cipher) setPassBadBlocks(passBadBlocks bool) {
 //
 // Note that empty password makes all 0x00 keys which is used in the
 // tests.
+//
+// This data key has ID 0 and is used to encrypt new files. Any keys
+// added with addDataKey are removed.
 func (c *Cipher) Key(password, salt string) (err error) {
 	const keySize = len(c.dataKey) + len(c.nameKey) + len(c.nameTweak)
-	var saltBytes = defaultSalt
-	if salt != "" {
-		saltBytes = []byte(salt)
-	}
-	var key []byte
-	if password == "" {
-		key = make([]byte, keySize)
-	} else {
-		key, err = scrypt.Key([]byte(password), saltBytes, 16384, 8, 1, keySize)
-		if err != nil {
-			return err
-		}
+	key, err := deriveKey(password, salt, keySize)
+	if err != nil {
+		return err
 	}
 	copy(c.dataKey[:], key)
 	copy(c.nameKey[:], key[len(c.dataKey):])
 	copy(c.nameTweak[:], key[len(c.dataKey)+len(c.nameKey):])
+	c.dataKeys = map[uint16]*[32]byte{0: &c.dataKey}
+	c.dataKeyID = 0
 	// Key the name cipher
 	c.block, err = aes.NewCipher(c.nameKey[:])
 	return err
 }
 
+// deriveKey makes keySize bytes of key from the password and salt
+// using scrypt.
+func deriveKey(password, salt string, keySize int) ([]byte, error) {
+	var saltBytes = defaultSalt
+	if salt != "" {
+		saltBytes = []byte(salt)
+	}
+	if password == "" {
+		return make([]byte, keySize), nil
+	}
+	return scrypt.Key([]byte(password), saltBytes, 16384, 8, 1, keySize)
+}
+
+// dataKeyID returns the ID of a data key added with addDataKey which
+// is stored in the file header.
+//
+// The ID is made from a hash of the key so the order the keys are
+// configured in doesn't matter. ID 0 is reserved for the key made
+// from the main password and the top bit is reserved to flag files
+// with a trailer so it is never set.
+func dataKeyID(key *[32]byte) uint16 {
+	sum := sha256.Sum256(append([]byte("rclone crypt data key"), key[:]...))
+	id := binary.BigEndian.Uint16(sum[:]) & keyIDMask
+	if id == 0 {
+		id = 1
+	}
+	return id
+}
+
+// addDataKey makes a data key from the password and salt in the same
+// way as Key. The key can then be used to decrypt files and is used
+// to encrypt new files.
+//
+// It returns the ID of the key.
+func (c *Cipher) addDataKey(password, salt string) (id uint16, err error) {
+	key, err := deriveKey(password, salt, len(c.dataKey))
+	if err != nil {
+		return 0, err
+	}
+	dataKey := new([32]byte)
+	copy(dataKey[:], key)
+	id = dataKeyID(dataKey)
+	if oldKey, found := c.dataKeys[id]; found && *oldKey != *dataKey {
+		return 0, fmt.Errorf("two data passwords have the same key ID %04x - change one of them", id)
+	}
+	c.dataKeys[id] = dataKey
+	c.dataKeyID = id
+	return id, nil
+}
+
+// parseKeyID checks the magic at the start of the file header in buf
+// and returns the ID of the data key the file was encrypted with and
+// whether the file has a metadata trailer.
+func parseKeyID(buf []byte) (keyID uint16, hasTrailer bool, err error) {
+	if !bytes.Equal(buf[:fileMagicPrefixSize], fileMagicBytes[:fileMagicPrefixSize]) {
+		return 0, false, ErrorEncryptedBadMagic
+	}
+	keyID = binary.BigEndian.Uint16(buf[fileMagicPrefixSize:fileMagicSize])
+	return keyID & keyIDMask, keyID&keyIDTrailer != 0, nil
+}
+
 // getBlock gets a block from the pool of size blockSize
 func (c *Cipher) getBlock() *[blockSize]byte {
 	return c.buffers.Get().(*[blockSize]byte)
@@ -677,24 +751,89 @@ func (n *nonce) add(x uint64) {
 	}
 }
 
+// trailer describes the padding and the metadata block written
+// after the data of a file
+//
+// The plaintext of the trailer is sealed as a block of its own with
+// the nonce following the one of the last data block.
+type trailer struct {
+	pad   func(size int64) int64           // returns the size to pad a file of size bytes to
+	block func(size int64) ([]byte, error) // returns trailerDataSize bytes of plaintext for a file of size bytes
+}
+
+// paddedReader reads in then zeros up to the padded size of the data
+type paddedReader struct {
+	in     io.Reader
+	pad    func(size int64) int64
+	size   int64 // bytes read from in
+	padded int64 // size to pad to, set at EOF of in
+	read   int64 // bytes returned including the padding
+	eof    bool  // set when in has returned io.EOF
+}
+
+// Read as per io.Reader
+func (p *paddedReader) Read(buf []byte) (n int, err error) {
+	if !p.eof {
+		n, err = p.in.Read(buf)
+		p.size += int64(n)
+		p.read += int64(n)
+		if err != io.EOF {
+			return n, err
+		}
+		p.eof = true
+		p.padded = max(p.pad(p.size), p.size)
+		if n > 0 {
+			return n, nil
+		}
+	}
+	remaining := p.padded - p.read
+	if remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(buf)) > remaining {
+		buf = buf[:remaining]
+	}
+	clear(buf)
+	p.read += int64(len(buf))
+	return len(buf), nil
+}
+
 // encrypter encrypts an io.Reader on the fly
 type encrypter struct {
-	mu       sync.Mutex
-	in       io.Reader
-	c        *Cipher
-	nonce    nonce
-	buf      *[blockSize]byte
-	readBuf  *[blockSize]byte
-	bufIndex int
-	bufSize  int
-	err      error
-}
-
-// newEncrypter creates a new file handle encrypting on the fly
+	mu           sync.Mutex
+	in           io.Reader
+	c            *Cipher
+	keyID        uint16
+	key          *[32]byte
+	nonce        nonce
+	buf          *[blockSize]byte
+	readBuf      *[blockSize]byte
+	bufIndex     int
+	bufSize      int
+	err          error
+	trailer      *trailer      // trailer to write after the data if set
+	padder       *paddedReader // reads the data and padding if trailer is set
+	trailerBlock []byte        // plaintext of the trailer once written
+}
+
+// newEncrypter creates a new file handle encrypting on the fly with
+// the current data key
 func (c *Cipher) newEncrypter(in io.Reader, nonce *nonce) (*encrypter, error) {
+	return c.newEncrypterKey(in, nonce, c.dataKeyID)
+}
+
+// newEncrypterKey creates a new file handle encrypting on the fly
+// with the data key with keyID
+func (c *Cipher) newEncrypterKey(in io.Reader, nonce *nonce, keyID uint16) (*encrypter, error) {
+	key := c.dataKeys[keyID]
+	if key == nil {
+		return nil, fmt.Errorf("%w: key ID %04x", ErrorEncryptedUnknownKey, keyID)
+	}
 	fh := &encrypter{
 		in:      in,
 		c:       c,
+		keyID:   keyID,
+		key:     key,
 		buf:     c.getBlock(),
 		readBuf: c.getBlock(),
 		bufSize: fileHeaderSize,
@@ -708,13 +847,47 @@ func (c *Cipher) newEncrypter(in io.Reader, nonce *nonce) (*encrypter, error) {
 			return nil, err
 		}
 	}
-	// Copy magic into buffer
+	// Copy magic and key ID into buffer
 	copy((*fh.buf)[:], fileMagicBytes)
+	binary.BigEndian.PutUint16((*fh.buf)[fileMagicPrefixSize:], keyID)
 	// Copy nonce into buffer
 	copy((*fh.buf)[fileMagicSize:], fh.nonce[:])
 	return fh, nil
 }
 
+// setTrailer pads the data and writes the trailer t after it. This
+// must be called before the first Read.
+func (fh *encrypter) setTrailer(t *trailer) {
+	fh.trailer = t
+	fh.padder = &paddedReader{in: fh.in, pad: t.pad}
+	fh.in = fh.padder
+	binary.BigEndian.PutUint16((*fh.buf)[fileMagicPrefixSize:], fh.keyID|keyIDTrailer)
+}
+
+// sealTrailer encrypts the trailer into the buffer - call with fh.mu
+// held
+func (fh *encrypter) sealTrailer() error {
+	block, err := fh.trailer.block(fh.padder.size)
+	if err != nil {
+		return err
+	}
+	if len(block) != trailerDataSize {
+		return fmt.Errorf("trailer is %d bytes not %d", len(block), trailerDataSize)
+	}
+	fh.trailerBlock = block
+	secretbox.Seal((*fh.buf)[:0], block, fh.nonce.pointer(), fh.key)
+	fh.bufIndex = 0
+	fh.bufSize = trailerSize
+	fh.nonce.increment()
+	return nil
+}
+
+// padded returns the size of the data with its padding once it has
+// all been read
+func (fh *encrypter) padded() int64 {
+	return fh.padder.padded
+}
+
 // Read as per io.Reader
 func (fh *encrypter) Read(p []byte) (n int, err error) {
 	fh.mu.Lock()
@@ -728,16 +901,24 @@ func (fh *encrypter) Read(p []byte) (n int, err error) {
 		// FIXME should overlap the reads with a go-routine and 2 buffers?
 		readBuf := (*fh.readBuf)[:blockDataSize]
 		n, err = readers.ReadFill(fh.in, readBuf)
-		if n == 0 {
+		switch {
+		case n > 0:
+			// possibly err != nil here, but we will process the
+			// data and the next call to ReadFill will return 0, err
+			// Encrypt the block using the nonce
+			secretbox.Seal((*fh.buf)[:0], readBuf[:n], fh.nonce.pointer(), fh.key)
+			fh.bufIndex = 0
+			fh.bufSize = blockHeaderSize + n
+			fh.nonce.increment()
+		case err == io.EOF && fh.trailer != nil && fh.trailerBlock == nil:
+			// Write the trailer after the data
+			err = fh.sealTrailer()
+			if err != nil {
+				return fh.finish(err)
+			}
+		default:
 			return fh.finish(err)
 		}
-		// possibly err != nil here, but we will process the
-		// data and the next call to ReadFill will return 0, err
-		// Encrypt the block using the nonce
-		secretbox.Seal((*fh.buf)[:0], readBuf[:n], fh.nonce.pointer(), &fh.c.dataKey)
-		fh.bufIndex = 0
-		fh.bufSize = blockHeaderSize + n
-		fh.nonce.increment()
 	}
 	n = copy(p, (*fh.buf)[fh.bufIndex:fh.bufSize])
 	fh.bufIndex += n
@@ -757,19 +938,23 @@ func (fh *encrypter) finish(err error) (int, error) {
 	return 0, err
 }
 
-// Encrypt data encrypts the data stream
-func (c *Cipher) encryptData(in io.Reader) (io.Reader, *encrypter, error) {
+// Encrypt data encrypts the data stream followed by the trailer t if
+// it is set
+func (c *Cipher) encryptData(in io.Reader, t *trailer) (io.Reader, *encrypter, error) {
 	in, wrap := accounting.UnWrap(in) // unwrap the accounting off the Reader
 	out, err := c.newEncrypter(in, nil)
 	if err != nil {
 		return nil, nil, err
 	}
+	if t != nil {
+		out.setTrailer(t)
+	}
 	return wrap(out), out, nil // and wrap the accounting back on
 }
 
 // EncryptData encrypts the data stream
 func (c *Cipher) EncryptData(in io.Reader) (io.Reader, error) {
-	out, _, err := c.encryptData(in)
+	out, _, err := c.encryptData(in, nil)
 	return out, err
 }
 
@@ -780,6 +965,9 @@ type decrypter struct {
 	nonce        nonce
 	initialNonce nonce
 	c            *Cipher
+	keyID        uint16
+	hasTrailer   bool // set if the file has a metadata trailer
+	key          *[32]byte
 	buf          *[blockSize]byte
 	readBuf      *[blockSize]byte
 	bufIndex     int
@@ -807,9 +995,17 @@ func (c *Cipher) newDecrypter(rc io.ReadCloser) (*decrypter, error) {
 	} else if err != io.EOF && err != nil {
 		return nil, fh.finishAndClose(err)
 	}
-	// check the magic
-	if !bytes.Equal(readBuf[:fileMagicSize], fileMagicBytes) {
-		return nil, fh.finishAndClose(ErrorEncryptedBadMagic)
+	// check the magic and find the key
+	fh.keyID, fh.hasTrailer, err = parseKeyID(readBuf)
+	if err != nil {
+		return nil, fh.finishAndClose(err)
+	}
+	fh.key = c.dataKeys[fh.keyID]
+	if fh.key == nil {
+		return nil, fh.finishAndClose(fmt.Errorf("%w: key ID %04x", ErrorEncryptedUnknownKey, fh.keyID))
+	}
+	if fh.hasTrailer && !c.encryptMetadata {
+		return nil, fh.finishAndClose(ErrorEncryptedMetadata)
 	}
 	// retrieve the nonce
 	fh.nonce.fromBuf(readBuf[fileMagicSize:])
@@ -877,7 +1073,7 @@ func (fh *decrypter) fillBuffer() (err error) {
 		return ErrorEncryptedFileBadHeader
 	}
 	// Decrypt the block using the nonce
-	_, ok := secretbox.Open((*fh.buf)[:0], (*readBuf)[:n], fh.nonce.pointer(), &fh.c.dataKey)
+	_, ok := secretbox.Open((*fh.buf)[:0], (*readBuf)[:n], fh.nonce.pointer(), fh.key)
 	if !ok {
 		if err != nil && err != io.EOF {
 			return err // return pending error as it is likely more accurate
@@ -1127,6 +1323,41 @@ func (c *Cipher) EncryptedSize(size int64) int64 {
 	return encryptedSize
 }
 
+// decryptTrailer decrypts the trailer in buf of a file of
+// underlyingSize bytes with the file header given
+//
+// It returns the plaintext of the trailer and the size of the padded
+// data before it.
+func (c *Cipher) decryptTrailer(header, buf []byte, underlyingSize int64) (plaintext []byte, padded int64, err error) {
+	keyID, hasTrailer, err := parseKeyID(header)
+	if err != nil {
+		return nil, 0, err
+	}
+	if !hasTrailer {
+		return nil, 0, errors.New("file has no metadata trailer")
+	}
+	key := c.dataKeys[keyID]
+	if key == nil {
+		return nil, 0, fmt.Errorf("%w: key ID %04x", ErrorEncryptedUnknownKey, keyID)
+	}
+	if len(buf) != trailerSize {
+		return nil, 0, ErrorEncryptedFileBadHeader
+	}
+	padded, err = c.DecryptedSize(underlyingSize - trailerSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	// The trailer nonce follows the nonce of the last data block
+	var trailerNonce nonce
+	trailerNonce.fromBuf(header[fileMagicSize:fileHeaderSize])
+	trailerNonce.add(uint64((padded + blockDataSize - 1) / blockDataSize))
+	plaintext, ok := secretbox.Open(nil, buf, trailerNonce.pointer(), key)
+	if !ok {
+		return nil, 0, ErrorEncryptedBadBlock
+	}
+	return plaintext, padded, nil
+}
+
 // DecryptedSize calculates the size of the data when decrypted
 func (c *Cipher) DecryptedSize(size int64) (int64, error) {
 	size -= int64(fileHeaderSize)
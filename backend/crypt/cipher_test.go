@@ -5,14 +5,17 @@ import (
 	"context"
 	"encoding/base32"
 	"encoding/base64"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Max-Sum/base32768"
 	"github.com/rclone/rclone/backend/crypt/pkcs7"
+	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/lib/readers"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -1256,7 +1259,11 @@ func TestNewDecrypter(t *testing.T) {
 		cd := newCloseDetector(bytes.NewBuffer(file0copy))
 		fh, err := c.newDecrypter(cd)
 		assert.Nil(t, fh)
-		assert.EqualError(t, err, ErrorEncryptedBadMagic.Error())
+		if i < fileMagicPrefixSize {
+			assert.EqualError(t, err, ErrorEncryptedBadMagic.Error())
+		} else {
+			assert.ErrorIs(t, err, ErrorEncryptedUnknownKey)
+		}
 		file0copy[i] ^= 0x1
 		assert.Equal(t, 1, cd.closed)
 	}
@@ -1536,9 +1543,12 @@ func TestDecrypterRead(t *testing.T) {
 	for i := range file16copy {
 		file16copy[i] ^= 0xFF
 		fh, err := c.newDecrypter(io.NopCloser(bytes.NewBuffer(file16copy)))
-		if i < fileMagicSize {
+		if i < fileMagicPrefixSize {
 			assert.EqualError(t, err, ErrorEncryptedBadMagic.Error())
 			assert.Nil(t, fh)
+		} else if i < fileMagicSize {
+			assert.ErrorIs(t, err, ErrorEncryptedUnknownKey)
+			assert.Nil(t, fh)
 		} else {
 			assert.NoError(t, err)
 			_, err = io.ReadAll(fh)
@@ -1640,3 +1650,176 @@ func TestKey(t *testing.T) {
 	assert.Equal(t, [32]byte{}, c.nameKey)
 	assert.Equal(t, [16]byte{}, c.nameTweak)
 }
+
+func TestDataKeys(t *testing.T) {
+	c, err := newCipher(NameEncryptionStandard, "potato", "sausage", true, nil)
+	require.NoError(t, err)
+	old, err := newCipher(NameEncryptionStandard, "potato", "sausage", true, nil)
+	require.NoError(t, err)
+
+	encrypt := func(c *Cipher, plaintext []byte) []byte {
+		in, err := c.EncryptData(bytes.NewReader(plaintext))
+		require.NoError(t, err)
+		ciphertext, err := io.ReadAll(in)
+		require.NoError(t, err)
+		return ciphertext
+	}
+	decrypt := func(c *Cipher, ciphertext []byte) ([]byte, error) {
+		out, err := c.DecryptData(io.NopCloser(bytes.NewReader(ciphertext)))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(out)
+	}
+	plaintext := []byte("hello world")
+
+	// Files encrypted with the main password have key ID 0
+	file0 := encrypt(c, plaintext)
+	assert.Equal(t, []byte(fileMagic), file0[:fileMagicSize])
+
+	// Adding a key uses it for new files
+	id, err := c.addDataKey("new potato", "sausage")
+	require.NoError(t, err)
+	assert.NotEqual(t, uint16(0), id)
+	assert.Equal(t, id, c.dataKeyID)
+	file1 := encrypt(c, plaintext)
+	gotID, hasTrailer, err := parseKeyID(file1)
+	require.NoError(t, err)
+	assert.Equal(t, id, gotID)
+	assert.False(t, hasTrailer)
+	assert.Equal(t, len(file0), len(file1))
+
+	// Adding the same key again gives the same ID
+	id2, err := c.addDataKey("new potato", "sausage")
+	require.NoError(t, err)
+	assert.Equal(t, id, id2)
+
+	// Both files can be read with the keys
+	for _, file := range [][]byte{file0, file1} {
+		got, err := decrypt(c, file)
+		require.NoError(t, err)
+		assert.Equal(t, plaintext, got)
+	}
+
+	// But the new file can't be read without the new key
+	_, err = decrypt(old, file1)
+	assert.ErrorIs(t, err, ErrorEncryptedUnknownKey)
+	got, err := decrypt(old, file0)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, got)
+
+	// A key can be used explicitly
+	fh, err := c.newEncrypterKey(bytes.NewReader(plaintext), nil, 0)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0), fh.keyID)
+	_, err = c.newEncrypterKey(bytes.NewReader(plaintext), nil, id+1)
+	assert.ErrorIs(t, err, ErrorEncryptedUnknownKey)
+
+	// Key resets the keys
+	require.NoError(t, c.Key("potato", "sausage"))
+	assert.Equal(t, uint16(0), c.dataKeyID)
+	assert.Len(t, c.dataKeys, 1)
+
+	// IDs never use the bit reserved for the trailer flag
+	var key [32]byte
+	for i := range 1000 {
+		binary.BigEndian.PutUint32(key[:], uint32(i))
+		id := dataKeyID(&key)
+		assert.NotEqual(t, uint16(0), id)
+		assert.Zero(t, id&keyIDTrailer)
+	}
+}
+
+func TestPadding(t *testing.T) {
+	for _, test := range []struct {
+		mode string
+		in   int64
+		want int64
+	}{
+		{"off", 100, 100},
+		{"pow2", 0, 0},
+		{"pow2", 1, 1},
+		{"pow2", 100, 128},
+		{"pow2", 128, 128},
+		{"pow2", 129, 256},
+		{"padme", 0, 0},
+		{"padme", 100, 104},
+		{"padme", 1000, 1024},
+		{"padme", 65537, 67584},
+	} {
+		pad, err := newPadder(test.mode)
+		require.NoError(t, err)
+		assert.Equal(t, test.want, pad(test.in), fmt.Sprintf("%s(%d)", test.mode, test.in))
+	}
+	_, err := newPadder("potato")
+	assert.EqualError(t, err, `unknown size_padding "potato"`)
+}
+
+func TestEncryptTrailer(t *testing.T) {
+	c, err := newCipher(NameEncryptionStandard, "potato", "sausage", true, nil)
+	require.NoError(t, err)
+	c.setEncryptMetadata(true)
+	pad, err := newPadder("pow2")
+	require.NoError(t, err)
+	modTime := time.Date(2012, time.December, 17, 18, 32, 31, 0, time.UTC)
+	tr := &trailer{
+		pad: pad,
+		block: func(size int64) ([]byte, error) {
+			m := fileMetadata{Size: size, ModTime: modTime, Metadata: fs.Metadata{"potato": "jersey"}}
+			return m.marshal()
+		},
+	}
+
+	for _, size := range []int{0, 1, 100, blockDataSize, blockDataSize + 1} {
+		t.Run(fmt.Sprint(size), func(t *testing.T) {
+			plaintext := bytes.Repeat([]byte{'x'}, size)
+			in, enc, err := c.encryptData(bytes.NewReader(plaintext), tr)
+			require.NoError(t, err)
+			ciphertext, err := io.ReadAll(in)
+			require.NoError(t, err)
+			padded := pad(int64(size))
+			assert.Equal(t, padded, enc.padded())
+			assert.Equal(t, c.EncryptedSize(padded)+trailerSize, int64(len(ciphertext)))
+
+			// The trailer decrypts to the metadata
+			header := ciphertext[:fileHeaderSize]
+			block, gotPadded, err := c.decryptTrailer(header, ciphertext[len(ciphertext)-trailerSize:], int64(len(ciphertext)))
+			require.NoError(t, err)
+			assert.Equal(t, padded, gotPadded)
+			assert.Equal(t, enc.trailerBlock, block)
+			m, err := parseFileMetadata(block)
+			require.NoError(t, err)
+			assert.Equal(t, int64(size), m.Size)
+			assert.True(t, modTime.Equal(m.ModTime))
+			assert.Equal(t, fs.Metadata{"potato": "jersey"}, m.Metadata)
+
+			// The data decrypts followed by the padding
+			dataEnd := c.EncryptedSize(padded)
+			fh, err := c.DecryptData(io.NopCloser(bytes.NewReader(ciphertext[:dataEnd])))
+			require.NoError(t, err)
+			got, err := io.ReadAll(fh)
+			require.NoError(t, err)
+			assert.Equal(t, plaintext, got[:size])
+			assert.Equal(t, make([]byte, padded-int64(size)), got[size:])
+
+			// Files with trailers can't be read without encrypt_metadata
+			c.setEncryptMetadata(false)
+			_, err = c.DecryptData(io.NopCloser(bytes.NewReader(ciphertext)))
+			assert.ErrorIs(t, err, ErrorEncryptedMetadata)
+			c.setEncryptMetadata(true)
+		})
+	}
+
+	// The trailer is authenticated by its position
+	in, _, err := c.encryptData(bytes.NewReader([]byte("hello")), tr)
+	require.NoError(t, err)
+	ciphertext, err := io.ReadAll(in)
+	require.NoError(t, err)
+	_, _, err = c.decryptTrailer(ciphertext[:fileHeaderSize], ciphertext[len(ciphertext)-trailerSize:], int64(len(ciphertext))+blockSize)
+	assert.ErrorIs(t, err, ErrorEncryptedBadBlock)
+
+	// Metadata which is too large is rejected
+	m := fileMetadata{Metadata: fs.Metadata{"potato": strings.Repeat("x", trailerDataSize)}}
+	_, err = m.marshal()
+	assert.ErrorContains(t, err, "metadata is too large")
+}
@@ -2,12 +2,15 @@
 package crypt
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"path"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/rclone/rclone/fs"
@@ -30,7 +33,11 @@ func init() {
 		NewFs:       NewFs,
 		CommandHelp: commandHelp,
 		MetadataInfo: &fs.MetadataInfo{
-			Help: `Any metadata supported by the underlying remote is read and written.`,
+			Help: `Any metadata supported by the underlying remote is read and written.
+
+If encrypt_metadata is set then the modification time, mime type and
+user metadata of files are encrypted and stored with the file data so
+they are supported whatever the underlying remote.`,
 		},
 		Options: []fs.Option{{
 			Name:     "remote",
@@ -77,6 +84,24 @@ NB If filename_encryption is "off" then this option will do nothing.`,
 			Name:       "password2",
 			Help:       "Password or pass phrase for salt.\n\nOptional but recommended.\nShould be different to the previous password.",
 			IsPassword: true,
+		}, {
+			Name: "data_passwords",
+			Help: `Extra passwords or pass phrases for encrypting file data.
+
+A comma separated list of passwords. Use CSV quoting if a password
+contains a comma or a quote.
+
+New files have their data encrypted with the last password in the
+list. Files encrypted with any of the passwords in the list, or with
+the main password, can be read. File names are always encrypted with
+the main password.
+
+To change the password used for file data add a new password to the
+end of this list and run "rclone backend rekey" to re-encrypt the
+existing files with it. Passwords no longer in use can then be removed
+from the list.`,
+			IsPassword: true,
+			Advanced:   true,
 		}, {
 			Name:    "server_side_across_configs",
 			Default: false,
@@ -122,6 +147,41 @@ names, or for debugging purposes.`,
 					Help:  "Encrypt file data.",
 				},
 			},
+		}, {
+			Name: "encrypt_metadata",
+			Help: `Encrypt the size, modification time and metadata of files.
+
+If set the size, modification time, mime type and user metadata of
+each file are encrypted and stored in a block after the file data
+instead of in clear on the underlying remote. Reading them needs a
+read of the start and end of each file so listings which need sizes
+or modification times are slower.
+
+Files written without this set can still be read with it set but
+files written with it set can't be read without it.`,
+			Default:  false,
+			Advanced: true,
+		}, {
+			Name: "size_padding",
+			Help: `Pad file data to hide the exact size of files.
+
+This needs encrypt_metadata to be set. The padding is encrypted with
+the data so the underlying remote can't tell the padding from the
+data.`,
+			Default: "off",
+			Examples: []fs.OptionExample{
+				{
+					Value: "off",
+					Help:  "Don't pad files.",
+				}, {
+					Value: "padme",
+					Help:  "Pad to sizes with only the top few bits set.\nAdds at most 12% to the size.",
+				}, {
+					Value: "pow2",
+					Help:  "Pad to the next power of 2.\nAdds up to 100% to the size.",
+				},
+			},
+			Advanced: true,
 		}, {
 			Name: "pass_bad_blocks",
 			Help: `If set this will pass bad blocks through as all 0.
@@ -204,8 +264,29 @@ func newCipherForConfig(opt *Options) (*Cipher, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to make cipher: %w", err)
 	}
+	if opt.DataPasswords != "" {
+		dataPasswords, err := obscure.Reveal(opt.DataPasswords)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt data_passwords: %w", err)
+		}
+		var passwords fs.CommaSepList
+		err = passwords.Set(dataPasswords)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse data_passwords: %w", err)
+		}
+		for _, password := range passwords {
+			if password == "" {
+				continue
+			}
+			_, err = cipher.addDataKey(password, salt)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
 	cipher.setEncryptedSuffix(opt.Suffix)
 	cipher.setPassBadBlocks(opt.PassBadBlocks)
+	cipher.setEncryptMetadata(opt.EncryptMetadata)
 	return cipher, nil
 }
 
@@ -232,6 +313,16 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 	if err != nil {
 		return nil, err
 	}
+	if opt.EncryptMetadata && opt.NoDataEncryption {
+		return nil, errors.New("can't use encrypt_metadata with no_data_encryption")
+	}
+	if !opt.EncryptMetadata && !strings.EqualFold(opt.SizePadding, "off") && opt.SizePadding != "" {
+		return nil, errors.New("size_padding needs encrypt_metadata to be set")
+	}
+	pad, err := newPadder(opt.SizePadding)
+	if err != nil {
+		return nil, err
+	}
 	remote := opt.Remote
 	if strings.HasPrefix(remote, name+":") {
 		return nil, errors.New("can't point crypt remote at itself - check the value of the remote setting")
@@ -262,6 +353,7 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 		root:   rpath,
 		opt:    *opt,
 		cipher: cipher,
+		pad:    pad,
 	}
 	cache.PinUntilFinalized(f.Fs, f)
 	// Correct root if definitely pointing to a file
@@ -297,6 +389,17 @@ func NewFs(ctx context.Context, name, rpath string, m configmap.Mapper) (fs.Fs,
 	// Enable ListP always
 	f.features.ListP = f.ListP
 
+	// Metadata is stored in the encrypted trailer whatever the
+	// underlying remote supports
+	if opt.EncryptMetadata {
+		f.features.ReadMetadata = true
+		f.features.WriteMetadata = true
+		f.features.UserMetadata = true
+		f.features.ReadMimeType = true
+		f.features.WriteMimeType = true
+		f.features.SlowModTime = true
+	}
+
 	return f, err
 }
 
@@ -308,8 +411,11 @@ type Options struct {
 	NoDataEncryption        bool   `config:"no_data_encryption"`
 	Password                string `config:"password"`
 	Password2               string `config:"password2"`
+	DataPasswords           string `config:"data_passwords"`
 	ServerSideAcrossConfigs bool   `config:"server_side_across_configs"`
 	ShowMapping             bool   `config:"show_mapping"`
+	EncryptMetadata         bool   `config:"encrypt_metadata"`
+	SizePadding             string `config:"size_padding"`
 	PassBadBlocks           bool   `config:"pass_bad_blocks"`
 	FilenameEncoding        string `config:"filename_encoding"`
 	Suffix                  string `config:"suffix"`
@@ -325,6 +431,7 @@ type Fs struct {
 	opt      Options
 	features *fs.Features // optional features
 	cipher   *Cipher
+	pad      func(size int64) int64 // returns the size to pad files to
 }
 
 // Name of the remote (as passed into NewFs)
@@ -498,15 +605,26 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options [
 	ci := fs.GetConfig(ctx)
 
 	if f.opt.NoDataEncryption {
-		o, err := put(ctx, in, f.newObjectInfo(src, nonce{}), options...)
+		o, err := put(ctx, in, f.newObjectInfo(src, nonce{}, nil), options...)
 		if err == nil && o != nil {
 			o = f.newObject(o)
 		}
 		return o, err
 	}
 
+	// Encrypt the metadata into the trailer
+	var t *trailer
+	if f.opt.EncryptMetadata {
+		var err error
+		t, err = f.newTrailer(ctx, src, options)
+		if err != nil {
+			return nil, err
+		}
+		options = removeMetadataOptions(options)
+	}
+
 	// Encrypt the data into wrappedIn
-	wrappedIn, encrypter, err := f.cipher.encryptData(in)
+	wrappedIn, encrypter, err := f.cipher.encryptData(in, t)
 	if err != nil {
 		return nil, err
 	}
@@ -533,7 +651,7 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options [
 	}
 
 	// Transfer the data
-	o, err := put(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce), options...)
+	o, err := put(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce, t), options...)
 	if err != nil {
 		return nil, err
 	}
@@ -559,7 +677,20 @@ func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options [
 		}
 	}
 
-	return f.newObject(o), nil
+	return f.newObjectEncrypter(o, encrypter), nil
+}
+
+// removeMetadataOptions returns options without any
+// fs.MetadataOption so the metadata isn't passed to the underlying
+// remote
+func removeMetadataOptions(options []fs.OpenOption) []fs.OpenOption {
+	var newOptions []fs.OpenOption
+	for _, option := range options {
+		if _, ok := option.(fs.MetadataOption); !ok {
+			newOptions = append(newOptions, option)
+		}
+	}
+	return newOptions
 }
 
 // Put in to the remote path with the modTime given of the given size
@@ -662,7 +793,25 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(oResult), nil
+	return f.setMetadataAfterCopy(ctx, f.newObject(oResult))
+}
+
+// setMetadataAfterCopy applies any metadata set with --metadata-set
+// to o after a server-side copy or move as the underlying remote
+// can't set encrypted metadata
+func (f *Fs) setMetadataAfterCopy(ctx context.Context, o *Object) (*Object, error) {
+	if !f.opt.EncryptMetadata {
+		return o, nil
+	}
+	options := fs.MetadataAsOpenOptions(ctx)
+	if len(options) == 0 {
+		return o, nil
+	}
+	err := o.rewrite(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set metadata: %w", err)
+	}
+	return o, nil
 }
 
 // Move src to this remote using server-side move operations.
@@ -687,7 +836,7 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(oResult), nil
+	return f.setMetadataAfterCopy(ctx, f.newObject(oResult))
 }
 
 // DirMove moves src, srcRemote to this remote at dstRemote
@@ -720,15 +869,23 @@ func (f *Fs) PutUnchecked(ctx context.Context, in io.Reader, src fs.ObjectInfo,
 	if do == nil {
 		return nil, errors.New("can't PutUnchecked")
 	}
-	wrappedIn, encrypter, err := f.cipher.encryptData(in)
+	var t *trailer
+	if f.opt.EncryptMetadata {
+		var err error
+		t, err = f.newTrailer(ctx, src, options)
+		if err != nil {
+			return nil, err
+		}
+	}
+	wrappedIn, encrypter, err := f.cipher.encryptData(in, t)
 	if err != nil {
 		return nil, err
 	}
-	o, err := do(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce))
+	o, err := do(ctx, wrappedIn, f.newObjectInfo(src, encrypter.nonce, t))
 	if err != nil {
 		return nil, err
 	}
-	return f.newObject(o), nil
+	return f.newObjectEncrypter(o, encrypter), nil
 }
 
 // CleanUp the trash in the Fs
@@ -777,11 +934,12 @@ func (f *Fs) DecryptFileName(encryptedFileName string) (string, error) {
 	return f.cipher.DecryptFileName(encryptedFileName)
 }
 
-// computeHashWithNonce takes the nonce and encrypts the contents of
-// src with it, and calculates the hash given by HashType on the fly
+// computeHashWithNonce takes the nonce, the data key ID and the
+// trailer if any and encrypts the contents of src with them, and
+// calculates the hash given by HashType on the fly
 //
 // Note that we break lots of encapsulation in this function.
-func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, src fs.Object, hashType hash.Type) (hashStr string, err error) {
+func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, keyID uint16, t *trailer, src fs.Object, hashType hash.Type) (hashStr string, err error) {
 	// Open the src for input
 	in, err := src.Open(ctx)
 	if err != nil {
@@ -790,10 +948,13 @@ func (f *Fs) computeHashWithNonce(ctx context.Context, nonce nonce, src fs.Objec
 	defer fs.CheckClose(in, &err)
 
 	// Now encrypt the src with the nonce
-	out, err := f.cipher.newEncrypter(in, &nonce)
+	out, err := f.cipher.newEncrypterKey(in, &nonce, keyID)
 	if err != nil {
 		return "", fmt.Errorf("failed to make encrypter: %w", err)
 	}
+	if t != nil {
+		out.setTrailer(t)
+	}
 
 	// pipe into hash
 	m, err := hash.NewMultiHasherTypes(hash.NewHashSet(hashType))
@@ -828,7 +989,7 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 		_ = in.Close()
 		return "", fmt.Errorf("failed to open object to read nonce: %w", err)
 	}
-	nonce := d.nonce
+	nonce, keyID, hasTrailer := d.nonce, d.keyID, d.hasTrailer
 	// fs.Debugf(o, "Read nonce % 2x", nonce)
 
 	// Check nonce isn't all zeros
@@ -848,7 +1009,24 @@ func (f *Fs) ComputeHash(ctx context.Context, o *Object, src fs.Object, hashType
 		return "", fmt.Errorf("failed to close nonce read: %w", err)
 	}
 
-	return f.computeHashWithNonce(ctx, nonce, src, hashType)
+	// Reuse the trailer of o so only the data needs to match
+	var t *trailer
+	if hasTrailer {
+		ot, err := o.readTrailer(ctx)
+		if err != nil {
+			return "", fmt.Errorf("failed to read trailer: %w", err)
+		}
+		t = &trailer{
+			pad: func(int64) int64 {
+				return ot.padded
+			},
+			block: func(int64) ([]byte, error) {
+				return ot.plaintext, nil
+			},
+		}
+	}
+
+	return f.computeHashWithNonce(ctx, nonce, keyID, t, src, hashType)
 }
 
 // MergeDirs merges the contents of all the directories passed
@@ -944,6 +1122,29 @@ Usage Example:
 
     rclone backend decode crypt: encryptedfile1 [encryptedfile2...]
     rclone rc backend/command command=decode fs=crypt: encryptedfile1 [encryptedfile2...]
+`,
+	},
+	{
+		Name:  "rekey",
+		Short: "Re-encrypt files with the current data password",
+		Long: `This re-encrypts the data of every file, or just the files in the
+directory given, which wasn't encrypted with the current data password
+(the last of data_passwords, or the main password if that isn't set).
+
+Usage Example:
+
+    rclone backend rekey crypt: [dir]
+
+Each file is decrypted and encrypted again with the current password
+so it is uploaded again. The new copy is uploaded next to the original
+and then moved over it. The names of the files don't change. Use
+--dry-run to see which files would be re-encrypted.
+
+If encrypt_metadata is set then files without encrypted metadata are
+re-encrypted too so their metadata is encrypted.
+
+It returns a summary of the files checked and the names of any which
+couldn't be re-encrypted.
 `,
 	},
 }
@@ -976,6 +1177,12 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 			out = append(out, encryptedFileName)
 		}
 		return out, nil
+	case "rekey":
+		dir := ""
+		if len(arg) > 0 {
+			dir = arg[0]
+		}
+		return f.rekey(ctx, dir)
 	default:
 		return nil, fs.ErrorCommandNotFound
 	}
@@ -986,7 +1193,9 @@ func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[str
 // This decrypts the remote name and decrypts the data
 type Object struct {
 	fs.Object
-	f *Fs
+	f       *Fs
+	mu      sync.Mutex     // protects the following
+	trailer *objectTrailer // decrypted trailer if read
 }
 
 func (f *Fs) newObject(o fs.Object) *Object {
@@ -996,6 +1205,19 @@ func (f *Fs) newObject(o fs.Object) *Object {
 	}
 }
 
+// newObjectEncrypter returns the Object for o just uploaded with
+// encrypter, saving the trailer written so it doesn't need reading
+func (f *Fs) newObjectEncrypter(o fs.Object, encrypter *encrypter) *Object {
+	newO := f.newObject(o)
+	if encrypter.trailerBlock != nil {
+		t, err := newObjectTrailer(encrypter.trailerBlock, encrypter.padded())
+		if err == nil {
+			newO.trailer = t
+		}
+	}
+	return newO
+}
+
 // Fs returns read only access to the Fs that this object is part of
 func (o *Object) Fs() fs.Info {
 	return o.f
@@ -1022,6 +1244,14 @@ func (o *Object) Remote() string {
 
 // Size returns the size of the file
 func (o *Object) Size() int64 {
+	meta, err := o.fileMetadata(context.TODO())
+	if err != nil {
+		fs.Errorf(o, "Failed to read size: %v", err)
+		return -1
+	}
+	if meta != nil {
+		return meta.Size
+	}
 	size := o.Object.Size()
 	if !o.f.opt.NoDataEncryption {
 		var err error
@@ -1033,6 +1263,33 @@ func (o *Object) Size() int64 {
 	return size
 }
 
+// ModTime returns the modification time of the file
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	meta, err := o.fileMetadata(ctx)
+	if err != nil {
+		fs.Errorf(o, "Failed to read modification time: %v", err)
+	}
+	if meta != nil {
+		return meta.ModTime
+	}
+	return o.Object.ModTime(ctx)
+}
+
+// SetModTime sets the modification time of the file
+//
+// The modification time of files with encrypted metadata can only be
+// changed by uploading them again.
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	meta, err := o.fileMetadata(ctx)
+	if err != nil {
+		return err
+	}
+	if meta != nil {
+		return fs.ErrorCantSetModTimeWithoutDelete
+	}
+	return o.Object.SetModTime(ctx, modTime)
+}
+
 // Hash returns the selected checksum of the file
 // If no checksum is available it returns ""
 func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
@@ -1050,6 +1307,21 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 		return o.Object.Open(ctx, options...)
 	}
 
+	// With encrypted metadata only read the data before the
+	// padding and the trailer
+	var meta *fileMetadata
+	dataEnd := int64(-1) // offset of the last byte of data in the underlying object
+	if o.f.opt.EncryptMetadata {
+		t, err := o.readTrailer(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if t.meta != nil {
+			meta = t.meta
+			dataEnd = o.f.cipher.EncryptedSize(t.padded) - 1
+		}
+	}
+
 	var openOptions []fs.OpenOption
 	var offset, limit int64 = 0, -1
 	for _, option := range options {
@@ -1063,6 +1335,14 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 			openOptions = append(openOptions, option)
 		}
 	}
+	if meta != nil {
+		if offset >= meta.Size {
+			return io.NopCloser(bytes.NewReader(nil)), nil
+		}
+		if limit < 0 || offset+limit > meta.Size {
+			limit = meta.Size - offset
+		}
+	}
 	rc, err = o.f.cipher.DecryptDataSeek(ctx, func(ctx context.Context, underlyingOffset, underlyingLimit int64) (io.ReadCloser, error) {
 		if underlyingOffset == 0 && underlyingLimit < 0 {
 			// Open with no seek
@@ -1076,6 +1356,9 @@ func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (rc io.Read
 				end = -1
 			}
 		}
+		if dataEnd >= 0 && (end < 0 || end > dataEnd) {
+			end = dataEnd
+		}
 		newOpenOptions := append(openOptions, &fs.RangeOption{Start: underlyingOffset, End: end})
 		return o.Object.Open(ctx, newOpenOptions...)
 	}, offset, limit)
@@ -1090,7 +1373,13 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 	update := func(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
 		return o.Object, o.Object.Update(ctx, in, src, options...)
 	}
-	_, err := o.f.put(ctx, in, src, options, update)
+	newO, err := o.f.put(ctx, in, src, options, update)
+	o.mu.Lock()
+	o.trailer = nil
+	if err == nil {
+		o.trailer = newO.(*Object).trailer
+	}
+	o.mu.Unlock()
 	return err
 }
 
@@ -1140,15 +1429,19 @@ func (f *Fs) Shutdown(ctx context.Context) error {
 // This encrypts the remote name and adjusts the size
 type ObjectInfo struct {
 	fs.ObjectInfo
-	f     *Fs
-	nonce nonce
+	f       *Fs
+	nonce   nonce
+	trailer *trailer  // trailer holding the metadata if set
+	modTime time.Time // modification time to show the underlying remote if trailer is set
 }
 
-func (f *Fs) newObjectInfo(src fs.ObjectInfo, nonce nonce) *ObjectInfo {
+func (f *Fs) newObjectInfo(src fs.ObjectInfo, nonce nonce, t *trailer) *ObjectInfo {
 	return &ObjectInfo{
 		ObjectInfo: src,
 		f:          f,
 		nonce:      nonce,
+		trailer:    t,
+		modTime:    time.Now(),
 	}
 }
 
@@ -1171,9 +1464,22 @@ func (o *ObjectInfo) Size() int64 {
 	if o.f.opt.NoDataEncryption {
 		return size
 	}
+	if o.trailer != nil {
+		return o.f.cipher.EncryptedSize(max(o.trailer.pad(size), size)) + trailerSize
+	}
 	return o.f.cipher.EncryptedSize(size)
 }
 
+// ModTime returns the modification time of the file
+//
+// If the metadata is encrypted this is the time of the upload.
+func (o *ObjectInfo) ModTime(ctx context.Context) time.Time {
+	if o.trailer != nil {
+		return o.modTime
+	}
+	return o.ObjectInfo.ModTime(ctx)
+}
+
 // Hash returns the selected checksum of the file
 // If no checksum is available it returns ""
 func (o *ObjectInfo) Hash(ctx context.Context, hash hash.Type) (string, error) {
@@ -1193,7 +1499,7 @@ func (o *ObjectInfo) Hash(ctx context.Context, hash hash.Type) (string, error) {
 	if srcObj.Fs().Features().IsLocal {
 		// Read the data and encrypt it to calculate the hash
 		fs.Debugf(o, "Computing %v hash of encrypted source", hash)
-		return o.f.computeHashWithNonce(ctx, o.nonce, srcObj, hash)
+		return o.f.computeHashWithNonce(ctx, o.nonce, o.f.cipher.dataKeyID, o.trailer, srcObj, hash)
 	}
 	return "", nil
 }
@@ -1220,6 +1526,9 @@ func (o *ObjectInfo) ID() string {
 //
 // It should return nil if there is no Metadata
 func (o *ObjectInfo) Metadata(ctx context.Context) (fs.Metadata, error) {
+	if o.trailer != nil {
+		return nil, nil
+	}
 	do, ok := o.ObjectInfo.(fs.Metadataer)
 	if !ok {
 		return nil, nil
@@ -1274,6 +1583,19 @@ func (o *Object) GetTier() string {
 //
 // It should return nil if there is no Metadata
 func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
+	meta, err := o.fileMetadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if meta != nil {
+		metadata := make(fs.Metadata, len(meta.Metadata)+2)
+		maps.Copy(metadata, meta.Metadata)
+		metadata["mtime"] = meta.ModTime.Format(time.RFC3339Nano)
+		if meta.MimeType != "" {
+			metadata["content-type"] = meta.MimeType
+		}
+		return metadata, nil
+	}
 	do, ok := o.Object.(fs.Metadataer)
 	if !ok {
 		return nil, nil
@@ -1285,6 +1607,10 @@ func (o *Object) Metadata(ctx context.Context) (fs.Metadata, error) {
 //
 // It should return fs.ErrorNotImplemented if it can't set metadata
 func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
+	if o.f.opt.EncryptMetadata {
+		// Re-encrypt the object with the new metadata
+		return o.rewrite(ctx, fs.MetadataOption(metadata))
+	}
 	do, ok := o.Object.(fs.SetMetadataer)
 	if !ok {
 		return fs.ErrorNotImplemented
@@ -1295,9 +1621,16 @@ func (o *Object) SetMetadata(ctx context.Context, metadata fs.Metadata) error {
 // MimeType returns the content type of the Object if
 // known, or "" if not
 //
-// This is deliberately unsupported so we don't leak mime type info by
-// default.
+// This is deliberately unsupported unless the metadata is encrypted
+// so we don't leak mime type info by default.
 func (o *Object) MimeType(ctx context.Context) string {
+	meta, err := o.fileMetadata(ctx)
+	if err != nil {
+		fs.Errorf(o, "Failed to read mime type: %v", err)
+	}
+	if meta != nil {
+		return meta.MimeType
+	}
 	return ""
 }
 
@@ -4,12 +4,16 @@ import (
 	"bytes"
 	"context"
 	"crypto/md5"
+	"errors"
 	"fmt"
 	"io"
 	"testing"
 	"time"
 
+	_ "github.com/rclone/rclone/backend/local"
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/obscure"
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/fs/object"
 	"github.com/rclone/rclone/lib/random"
@@ -73,7 +77,7 @@ func testObjectInfo(t *testing.T, f *Fs, wrap bool) {
 
 	// wrap the object in a crypt for upload using the nonce we
 	// saved from the encrypter
-	src := f.newObjectInfo(oi, nonce)
+	src := f.newObjectInfo(oi, nonce, nil)
 
 	// Test ObjectInfo methods
 	if !f.opt.NoDataEncryption {
@@ -125,3 +129,324 @@ func (f *Fs) InternalTest(t *testing.T) {
 	t.Run("ObjectInfoWrap", func(t *testing.T) { testObjectInfo(t, f, true) })
 	t.Run("ComputeHash", func(t *testing.T) { testComputeHash(t, f) })
 }
+
+func TestRekey(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	m := configmap.Simple{
+		"type":                      "crypt",
+		"remote":                    dir,
+		"password":                  obscure.MustObscure("potato"),
+		"password2":                 obscure.MustObscure("sausage"),
+		"filename_encryption":       "standard",
+		"directory_name_encryption": "true",
+		"filename_encoding":         "base32",
+		"suffix":                    ".bin",
+	}
+	newFs := func() *Fs {
+		f, err := NewFs(ctx, "TestRekey", "", m)
+		require.NoError(t, err)
+		return f.(*Fs)
+	}
+	read := func(f *Fs, remote string) (string, error) {
+		o, err := f.NewObject(ctx, remote)
+		require.NoError(t, err)
+		in, err := o.Open(ctx)
+		if err != nil {
+			return "", err
+		}
+		data, err := io.ReadAll(in)
+		require.NoError(t, in.Close())
+		return string(data), err
+	}
+	keyID := func(f *Fs, remote string) uint16 {
+		o, err := f.NewObject(ctx, remote)
+		require.NoError(t, err)
+		id, _, err := o.(*Object).keyID(ctx)
+		require.NoError(t, err)
+		return id
+	}
+
+	// Write a file with the main password
+	f := newFs()
+	contents := random.String(100)
+	uploadFile(t, f, "dir/old", contents)
+	assert.Equal(t, uint16(0), keyID(f, "dir/old"))
+
+	// Add a data password - new files use it and the old one can be read
+	m.Set("data_passwords", obscure.MustObscure("new potato"))
+	f = newFs()
+	newID := f.cipher.dataKeyID
+	assert.NotEqual(t, uint16(0), newID)
+	uploadFile(t, f, "new", contents)
+	assert.Equal(t, newID, keyID(f, "new"))
+	got, err := read(f, "dir/old")
+	require.NoError(t, err)
+	assert.Equal(t, contents, got)
+
+	// The main password alone can't read the new file
+	m.Set("data_passwords", "")
+	_, err = read(newFs(), "new")
+	assert.ErrorIs(t, err, ErrorEncryptedUnknownKey)
+
+	// Rekeying re-encrypts just the old file
+	m.Set("data_passwords", obscure.MustObscure("new potato"))
+	f = newFs()
+	stats, err := f.rekey(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, &rekeyStats{Objects: 2, Current: 1, Rekeyed: 1, Failed: []string{}}, stats)
+	assert.Equal(t, newID, keyID(f, "dir/old"))
+	got, err = read(f, "dir/old")
+	require.NoError(t, err)
+	assert.Equal(t, contents, got)
+	entries, err := f.List(ctx, "dir")
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Rotating again with a second password
+	m.Set("data_passwords", obscure.MustObscure(`new potato,"new, new potato"`))
+	f = newFs()
+	assert.NotEqual(t, newID, f.cipher.dataKeyID)
+	stats, err = f.rekey(ctx, "dir")
+	require.NoError(t, err)
+	assert.Equal(t, &rekeyStats{Objects: 1, Rekeyed: 1, Failed: []string{}}, stats)
+
+	// Only the latest password is needed for the rekeyed file
+	m.Set("data_passwords", obscure.MustObscure(`"new, new potato"`))
+	got, err = read(newFs(), "dir/old")
+	require.NoError(t, err)
+	assert.Equal(t, contents, got)
+	stats, err = newFs().rekey(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"new"}, stats.Failed)
+}
+
+func TestMetadataTrailer(t *testing.T) {
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.Metadata = true
+	dir := t.TempDir()
+	m := configmap.Simple{
+		"type":                      "crypt",
+		"remote":                    dir,
+		"password":                  obscure.MustObscure("potato"),
+		"filename_encryption":       "standard",
+		"directory_name_encryption": "true",
+		"filename_encoding":         "base32",
+		"suffix":                    ".bin",
+	}
+	newFs := func() *Fs {
+		f, err := NewFs(ctx, "TestMetadataTrailer", "", m)
+		require.NoError(t, err)
+		return f.(*Fs)
+	}
+	read := func(o fs.Object, options ...fs.OpenOption) string {
+		in, err := o.Open(ctx, options...)
+		require.NoError(t, err)
+		data, err := io.ReadAll(in)
+		require.NoError(t, err)
+		require.NoError(t, in.Close())
+		return string(data)
+	}
+
+	// A file written without encrypted metadata
+	f := newFs()
+	contents := random.String(100)
+	uploadFile(t, f, "old", contents)
+
+	// size_padding needs encrypt_metadata
+	m.Set("size_padding", "pow2")
+	_, err := NewFs(ctx, "TestMetadataTrailer", "", m)
+	assert.ErrorContains(t, err, "size_padding needs encrypt_metadata")
+
+	m.Set("encrypt_metadata", "true")
+	f = newFs()
+	assert.True(t, f.Features().UserMetadata)
+	assert.True(t, f.Features().ReadMimeType)
+
+	// Upload a file with metadata
+	t1 := time.Date(2012, time.December, 17, 18, 32, 31, 123456789, time.UTC)
+	src := object.NewStaticObjectInfo("new", t1, int64(len(contents)), true, nil, nil).
+		WithMetadata(fs.Metadata{"potato": "jersey"}).
+		WithMimeType("text/potato")
+	o, err := f.Put(ctx, bytes.NewBufferString(contents), src)
+	require.NoError(t, err)
+
+	check := func(o fs.Object, potato string) {
+		assert.Equal(t, int64(len(contents)), o.Size())
+		assert.True(t, t1.Equal(o.ModTime(ctx)))
+		assert.Equal(t, "text/potato", o.(fs.MimeTyper).MimeType(ctx))
+		metadata, err := o.(fs.Metadataer).Metadata(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, fs.Metadata{
+			"potato":       potato,
+			"mtime":        t1.Format(time.RFC3339Nano),
+			"content-type": "text/potato",
+		}, metadata)
+		assert.Equal(t, contents, read(o))
+		assert.Equal(t, contents[10:20], read(o, &fs.RangeOption{Start: 10, End: 19}))
+		assert.Equal(t, contents[90:], read(o, &fs.SeekOption{Offset: 90}))
+
+		// The underlying object doesn't show the metadata
+		under := o.(*Object).UnWrap()
+		assert.Equal(t, f.cipher.EncryptedSize(128)+trailerSize, under.Size())
+		assert.False(t, t1.Equal(under.ModTime(ctx)))
+		underMetadata, err := fs.GetMetadata(ctx, under)
+		require.NoError(t, err)
+		assert.NotContains(t, underMetadata, "potato")
+	}
+	check(o, "jersey")
+	o, err = f.NewObject(ctx, "new")
+	require.NoError(t, err)
+	check(o, "jersey")
+
+	// Setting the metadata re-encrypts the file
+	err = o.(fs.SetMetadataer).SetMetadata(ctx, fs.Metadata{"potato": "royal"})
+	require.NoError(t, err)
+	check(o, "royal")
+	o, err = f.NewObject(ctx, "new")
+	require.NoError(t, err)
+	check(o, "royal")
+	assert.Equal(t, fs.ErrorCantSetModTimeWithoutDelete, o.SetModTime(ctx, t1))
+
+	// The old file can still be read and rekey adds the trailer
+	oldO, err := f.NewObject(ctx, "old")
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(contents)), oldO.Size())
+	assert.Equal(t, contents, read(oldO))
+	stats, err := f.rekey(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, &rekeyStats{Objects: 2, Current: 1, Rekeyed: 1, Failed: []string{}}, stats)
+	oldO, err = f.NewObject(ctx, "old")
+	require.NoError(t, err)
+	_, hasTrailer, err := oldO.(*Object).keyID(ctx)
+	require.NoError(t, err)
+	assert.True(t, hasTrailer)
+	assert.Equal(t, contents, read(oldO))
+
+	// Files with encrypted metadata can't be read without encrypt_metadata
+	m.Set("encrypt_metadata", "false")
+	m.Set("size_padding", "off")
+	o, err = newFs().NewObject(ctx, "new")
+	require.NoError(t, err)
+	_, err = o.Open(ctx)
+	assert.ErrorIs(t, err, ErrorEncryptedMetadata)
+	_, err = o.Open(ctx, &fs.RangeOption{Start: 10, End: 19})
+	assert.ErrorIs(t, err, ErrorEncryptedMetadata)
+}
+
+// failMoveFs fails the second server-side move
+type failMoveFs struct {
+	fs.Fs
+	features *fs.Features
+	moves    int
+}
+
+func newFailMoveFs(f fs.Fs) *failMoveFs {
+	ff := &failMoveFs{Fs: f}
+	ff.features = (&fs.Features{}).Fill(context.Background(), f)
+	ff.features.Move = func(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+		ff.moves++
+		if ff.moves == 2 {
+			return nil, errors.New("move failed")
+		}
+		return f.Features().Move(ctx, src, remote)
+	}
+	return ff
+}
+
+func (f *failMoveFs) Features() *fs.Features {
+	return f.features
+}
+
+// Check the original is kept if it can't be replaced with the
+// re-encrypted copy
+func TestRekeyMoveFails(t *testing.T) {
+	ctx := context.Background()
+	m := configmap.Simple{
+		"type":                      "crypt",
+		"remote":                    t.TempDir(),
+		"password":                  obscure.MustObscure("potato"),
+		"filename_encryption":       "standard",
+		"directory_name_encryption": "true",
+		"filename_encoding":         "base32",
+		"suffix":                    ".bin",
+	}
+	f, err := NewFs(ctx, "TestRekeyMoveFails", "", m)
+	require.NoError(t, err)
+	contents := random.String(100)
+	uploadFile(t, f, "file", contents)
+
+	m.Set("data_passwords", obscure.MustObscure("new potato"))
+	f, err = NewFs(ctx, "TestRekeyMoveFails", "", m)
+	require.NoError(t, err)
+	cf := f.(*Fs)
+	underlying := cf.Fs
+	cf.Fs = newFailMoveFs(underlying)
+	stats, err := cf.rekey(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"file"}, stats.Failed)
+	cf.Fs = underlying
+
+	// The original is still there and nothing else is
+	entries, err := cf.List(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	o, err := cf.NewObject(ctx, "file")
+	require.NoError(t, err)
+	keyID, _, err := o.(*Object).keyID(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(0), keyID)
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, contents, string(data))
+}
+
+// Check SetMetadata keeps the original if it can't be replaced with
+// the rewritten copy
+func TestRewriteMoveFails(t *testing.T) {
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.Metadata = true
+	f, err := NewFs(ctx, "TestRewriteMoveFails", "", configmap.Simple{
+		"type":                      "crypt",
+		"remote":                    t.TempDir(),
+		"password":                  obscure.MustObscure("potato"),
+		"filename_encryption":       "standard",
+		"directory_name_encryption": "true",
+		"filename_encoding":         "base32",
+		"suffix":                    ".bin",
+		"encrypt_metadata":          "true",
+		"size_padding":              "off",
+	})
+	require.NoError(t, err)
+	cf := f.(*Fs)
+	contents := random.String(100)
+	src := object.NewStaticObjectInfo("file", time.Now(), int64(len(contents)), true, nil, nil).
+		WithMetadata(fs.Metadata{"potato": "jersey"})
+	o, err := cf.Put(ctx, bytes.NewBufferString(contents), src)
+	require.NoError(t, err)
+
+	underlying := cf.Fs
+	cf.Fs = newFailMoveFs(underlying)
+	err = o.(fs.SetMetadataer).SetMetadata(ctx, fs.Metadata{"potato": "royal"})
+	assert.ErrorContains(t, err, "move failed")
+	cf.Fs = underlying
+
+	// The original is still there and nothing else is
+	entries, err := cf.List(ctx, "")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	o, err = cf.NewObject(ctx, "file")
+	require.NoError(t, err)
+	metadata, err := fs.GetMetadata(ctx, o)
+	require.NoError(t, err)
+	assert.Equal(t, "jersey", metadata["potato"])
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, contents, string(data))
+}
@@ -0,0 +1,343 @@
+package crypt
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math/bits"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/lib/random"
+)
+
+// With encrypt_metadata set the size, modification time, mime type
+// and user metadata of each file are stored in a trailer after the
+// file data so the underlying remote doesn't see them. The data may
+// be padded with zeros before the trailer to hide its size.
+//
+// The plaintext of the trailer is a 4 byte little endian length
+// followed by that many bytes of JSON encoded fileMetadata and zeros
+// up to trailerDataSize bytes.
+
+// fileMetadata is stored encrypted in the trailer of a file
+type fileMetadata struct {
+	Size     int64       `json:"size"`
+	ModTime  time.Time   `json:"mtime"`
+	MimeType string      `json:"mime,omitempty"`
+	Metadata fs.Metadata `json:"meta,omitempty"`
+}
+
+// marshal m into the plaintext of a trailer
+func (m *fileMetadata) marshal() ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	if len(data) > trailerDataSize-4 {
+		return nil, fmt.Errorf("metadata is too large to encrypt: %d bytes, maximum %d", len(data), trailerDataSize-4)
+	}
+	buf := make([]byte, trailerDataSize)
+	binary.LittleEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	return buf, nil
+}
+
+// parseFileMetadata parses the plaintext of a trailer
+func parseFileMetadata(buf []byte) (*fileMetadata, error) {
+	if len(buf) < 4 {
+		return nil, errors.New("metadata trailer too short")
+	}
+	n := binary.LittleEndian.Uint32(buf)
+	if n > uint32(len(buf)-4) {
+		return nil, errors.New("metadata trailer has bad length")
+	}
+	m := new(fileMetadata)
+	err := json.Unmarshal(buf[4:4+n], m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	return m, nil
+}
+
+// newPadder returns a function to find the size to pad files to for
+// the size_padding option
+func newPadder(mode string) (func(size int64) int64, error) {
+	switch strings.ToLower(mode) {
+	case "off", "":
+		return func(size int64) int64 {
+			return size
+		}, nil
+	case "pow2":
+		return padPow2, nil
+	case "padme":
+		return padPadme, nil
+	}
+	return nil, fmt.Errorf("unknown size_padding %q", mode)
+}
+
+// padPow2 pads size up to the next power of 2
+func padPow2(size int64) int64 {
+	if size <= 1 {
+		return size
+	}
+	return 1 << bits.Len64(uint64(size-1))
+}
+
+// padPadme pads size with the Padmé scheme which leaks at most
+// O(log log size) bits of the size and adds at most 12% to it
+func padPadme(size int64) int64 {
+	if size <= 1 {
+		return size
+	}
+	e := bits.Len64(uint64(size)) - 1 // floor(log2(size))
+	s := bits.Len64(uint64(e))        // floor(log2(e)) + 1
+	mask := int64(1)<<(e-s) - 1
+	return (size + mask) &^ mask
+}
+
+// newTrailer makes the trailer holding the metadata of src
+func (f *Fs) newTrailer(ctx context.Context, src fs.ObjectInfo, options []fs.OpenOption) (*trailer, error) {
+	metadata, err := fs.GetMetadataOptions(ctx, f, src, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata from source object: %w", err)
+	}
+	metadata = maps.Clone(metadata)
+	m := fileMetadata{
+		ModTime:  src.ModTime(ctx),
+		MimeType: fs.MimeType(ctx, src),
+	}
+	// mtime and content-type in the metadata take precedence
+	if mtime, ok := metadata["mtime"]; ok {
+		modTime, err := time.Parse(time.RFC3339Nano, mtime)
+		if err != nil {
+			fs.Debugf(src, "Failed to parse mtime %q from metadata: %v", mtime, err)
+		} else {
+			m.ModTime = modTime
+		}
+		delete(metadata, "mtime")
+	}
+	if contentType, ok := metadata["content-type"]; ok {
+		m.MimeType = contentType
+		delete(metadata, "content-type")
+	}
+	if len(metadata) > 0 {
+		m.Metadata = metadata
+	}
+	// Check the metadata fits before uploading anything
+	if _, err := m.marshal(); err != nil {
+		return nil, err
+	}
+	return &trailer{
+		pad: f.pad,
+		block: func(size int64) ([]byte, error) {
+			m := m
+			m.Size = size
+			return m.marshal()
+		},
+	}, nil
+}
+
+// objectTrailer is the decrypted trailer of an Object
+type objectTrailer struct {
+	meta      *fileMetadata // nil if the object doesn't have a trailer
+	plaintext []byte        // the plaintext of the trailer
+	padded    int64         // size of the data with its padding
+}
+
+// newObjectTrailer parses the plaintext of a trailer
+func newObjectTrailer(plaintext []byte, padded int64) (*objectTrailer, error) {
+	meta, err := parseFileMetadata(plaintext)
+	if err != nil {
+		return nil, err
+	}
+	return &objectTrailer{
+		meta:      meta,
+		plaintext: plaintext,
+		padded:    padded,
+	}, nil
+}
+
+// readHeader reads the file header of o
+func (o *Object) readHeader(ctx context.Context) (header []byte, err error) {
+	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: 0, End: int64(fileHeaderSize) - 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object to read header: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+	header = make([]byte, fileHeaderSize)
+	_, err = io.ReadFull(in, header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, ErrorEncryptedFileTooShort
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read header: %w", err)
+	}
+	return header, nil
+}
+
+// readTrailerBlock reads and decrypts the trailer of o
+func (o *Object) readTrailerBlock(ctx context.Context) (t *objectTrailer, err error) {
+	header, err := o.readHeader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, hasTrailer, err := parseKeyID(header)
+	if err != nil {
+		return nil, err
+	}
+	if !hasTrailer {
+		return &objectTrailer{}, nil
+	}
+	size := o.Object.Size()
+	if size < int64(fileHeaderSize+trailerSize) {
+		return nil, ErrorEncryptedFileTooShort
+	}
+	in, err := o.Object.Open(ctx, &fs.RangeOption{Start: size - trailerSize, End: size - 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open object to read metadata: %w", err)
+	}
+	defer fs.CheckClose(in, &err)
+	buf := make([]byte, trailerSize)
+	_, err = io.ReadFull(in, buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata: %w", err)
+	}
+	plaintext, padded, err := o.f.cipher.decryptTrailer(header, buf, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt metadata: %w", err)
+	}
+	return newObjectTrailer(plaintext, padded)
+}
+
+// readTrailer returns the decrypted trailer of o, reading it if
+// necessary
+//
+// The meta of the trailer returned is nil if the object was written
+// without encrypt_metadata.
+func (o *Object) readTrailer(ctx context.Context) (*objectTrailer, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.trailer != nil {
+		return o.trailer, nil
+	}
+	t, err := o.readTrailerBlock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	o.trailer = t
+	return t, nil
+}
+
+// fileMetadata returns the decrypted metadata of o or nil if it
+// isn't stored encrypted
+func (o *Object) fileMetadata(ctx context.Context) (*fileMetadata, error) {
+	if !o.f.opt.EncryptMetadata {
+		return nil, nil
+	}
+	t, err := o.readTrailer(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return t.meta, nil
+}
+
+// rewrite re-encrypts o with the current data key, merging the
+// metadata in options with its metadata
+//
+// The data is uploaded to a temporary name and then replaces o so o
+// isn't lost if the upload fails.
+func (o *Object) rewrite(ctx context.Context, options ...fs.OpenOption) (err error) {
+	f := o.f
+	// Read all the metadata of o into the new object
+	ctx, ci := fs.AddConfig(ctx)
+	ci.Metadata = true
+	ci.MetadataSet = nil
+	ci.MetadataMapper = nil
+	tr := accounting.Stats(ctx).NewTransfer(o, f)
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+	in, err := o.Open(ctx)
+	if err != nil {
+		return err
+	}
+	acc := tr.Account(ctx, in)
+	tmpRemote := o.Remote() + ".rewrite-" + random.String(8)
+	tmp, err := f.Put(ctx, acc, fs.NewOverrideRemote(o, tmpRemote), options...)
+	closeErr := acc.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if tmp != nil {
+			_ = tmp.Remove(ctx)
+		}
+		return fmt.Errorf("failed to upload re-encrypted copy: %w", err)
+	}
+	tmpO := tmp.(*Object)
+	newO, err := f.replaceObject(ctx, o, tmpO)
+	if err != nil {
+		return fmt.Errorf("failed to replace with re-encrypted copy %q: %w", tmpRemote, err)
+	}
+	// o now has the same plaintext and trailer as tmp
+	tmpO.mu.Lock()
+	t := tmpO.trailer
+	tmpO.mu.Unlock()
+	o.mu.Lock()
+	o.Object = newO.Object
+	o.trailer = t
+	o.mu.Unlock()
+	return nil
+}
+
+// replaceObject replaces o with tmp and removes tmp, returning the
+// replaced object
+//
+// If the remote can move, o is moved aside first and moved back if
+// tmp can't be moved over it so o isn't lost.
+func (f *Fs) replaceObject(ctx context.Context, o, tmp *Object) (newO *Object, err error) {
+	if f.Fs.Features().Move != nil {
+		oldRemote := o.Remote() + ".rewrite-old-" + random.String(8)
+		old, err := f.Move(ctx, o, oldRemote)
+		if err != nil {
+			_ = tmp.Remove(ctx)
+			return nil, err
+		}
+		moved, err := f.Move(ctx, tmp, o.Remote())
+		if err != nil {
+			_, restoreErr := f.Move(ctx, old, o.Remote())
+			if restoreErr != nil {
+				fs.Errorf(o, "Failed to restore original from %q: %v", oldRemote, restoreErr)
+			} else {
+				_ = tmp.Remove(ctx)
+			}
+			return nil, err
+		}
+		err = old.Remove(ctx)
+		if err != nil {
+			fs.Errorf(old, "Failed to remove original after replacing it: %v", err)
+		}
+		return moved.(*Object), nil
+	}
+	// Otherwise copy tmp over o
+	in, err := tmp.Open(ctx)
+	if err != nil {
+		_ = tmp.Remove(ctx)
+		return nil, err
+	}
+	err = o.Update(ctx, in, fs.NewOverrideRemote(tmp, o.Remote()))
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return o, tmp.Remove(ctx)
+}
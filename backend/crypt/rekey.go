@@ -0,0 +1,112 @@
+package crypt
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+)
+
+// rekeyStats is the output of the rekey command
+type rekeyStats struct {
+	Objects int      `json:"objects"`
+	Current int      `json:"current"` // objects already encrypted with the current key
+	Rekeyed int      `json:"rekeyed"` // objects re-encrypted with the current key
+	Failed  []string `json:"failed"`  // objects which couldn't be re-encrypted
+}
+
+// rekey re-encrypts the objects in dir which weren't encrypted with
+// the current data key
+func (f *Fs) rekey(ctx context.Context, dir string) (*rekeyStats, error) {
+	if f.opt.NoDataEncryption {
+		return nil, errors.New("can't rekey as file data isn't encrypted")
+	}
+	// List the objects first so the re-encrypted copies aren't listed
+	var objects []*Object
+	err := walk.ListR(ctx, f, dir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			if o, ok := entry.(*Object); ok {
+				objects = append(objects, o)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats := &rekeyStats{
+		Objects: len(objects),
+		Failed:  []string{},
+	}
+	var mu sync.Mutex
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Transfers)
+	for _, o := range objects {
+		g.Go(func() error {
+			rekeyed, err := f.rekeyObject(gCtx, o)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				fs.Errorf(o, "Failed to rekey: %v", err)
+				_ = fs.CountError(gCtx, err)
+				stats.Failed = append(stats.Failed, o.Remote())
+			case rekeyed:
+				stats.Rekeyed++
+			default:
+				stats.Current++
+			}
+			return gCtx.Err()
+		})
+	}
+	err = g.Wait()
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(stats.Failed)
+	return stats, nil
+}
+
+// keyID reads the ID of the data key o was encrypted with from its
+// header and whether it has a metadata trailer
+func (o *Object) keyID(ctx context.Context) (keyID uint16, hasTrailer bool, err error) {
+	header, err := o.readHeader(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	return parseKeyID(header)
+}
+
+// rekeyObject re-encrypts o with the current data key if it was
+// encrypted with a different one, returning whether it was.
+//
+// With encrypt_metadata set objects without encrypted metadata are
+// re-encrypted too so their metadata is encrypted.
+func (f *Fs) rekeyObject(ctx context.Context, o *Object) (rekeyed bool, err error) {
+	keyID, hasTrailer, err := o.keyID(ctx)
+	if err != nil {
+		return false, err
+	}
+	if keyID == f.cipher.dataKeyID && (hasTrailer || !f.opt.EncryptMetadata) {
+		fs.Debugf(o, "Already encrypted with the current key")
+		return false, nil
+	}
+	if f.cipher.dataKeys[keyID] == nil {
+		return false, fmt.Errorf("%w: key ID %04x", ErrorEncryptedUnknownKey, keyID)
+	}
+	if fs.GetConfig(ctx).DryRun {
+		fs.Logf(o, "Not re-encrypting as --dry-run")
+		return true, nil
+	}
+	err = o.rewrite(ctx)
+	if err != nil {
+		return false, err
+	}
+	fs.Infof(o, "Re-encrypted with the current key")
+	return true, nil
+}
@@ -0,0 +1,209 @@
+package erasure
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+)
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "scrub",
+	Short: "Check the shards of all the objects and repair them.",
+	Long: `Reads every shard of every object, or just the objects in the
+directory given, and checks each is present and undamaged.
+
+Usage Example:
+
+    rclone backend scrub erasure: [dir]
+
+With the repair option the missing and damaged shards are rebuilt from
+the others and uploaded again.
+
+    rclone backend scrub erasure: -o repair
+
+Objects with fewer good shards than data shards can't be repaired and
+are reported as lost.
+`,
+	Opts: map[string]string{
+		"repair": "Rebuild and upload the missing and damaged shards",
+	},
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out any, err error) {
+	switch name {
+	case "scrub":
+		dir := ""
+		if len(arg) > 0 {
+			dir = arg[0]
+		}
+		_, repair := opt["repair"]
+		return f.scrub(ctx, dir, repair)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// scrubStats is the output of the scrub command
+type scrubStats struct {
+	Objects  int      `json:"objects"`
+	Healthy  int      `json:"healthy"`
+	Damaged  []string `json:"damaged"`  // objects with bad shards not repaired
+	Repaired []string `json:"repaired"` // objects with bad shards repaired
+	Lost     []string `json:"lost"`     // objects which can't be read
+}
+
+// scrub checks all the shards of the objects in dir and rewrites the
+// bad ones if repair is set
+func (f *Fs) scrub(ctx context.Context, dir string, repair bool) (*scrubStats, error) {
+	stats := &scrubStats{
+		Damaged:  []string{},
+		Repaired: []string{},
+		Lost:     []string{},
+	}
+	var mu sync.Mutex
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	err := walk.ListR(ctx, f, dir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(*Object)
+			if !ok {
+				continue
+			}
+			g.Go(func() error {
+				bad := o.checkShards(gCtx)
+				var repairErr error
+				if len(bad) > 0 && len(bad) <= f.m && repair {
+					repairErr = o.repair(gCtx, bad)
+					if repairErr != nil {
+						fs.Errorf(o, "Failed to repair: %v", repairErr)
+					}
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				stats.Objects++
+				switch {
+				case len(bad) == 0:
+					stats.Healthy++
+				case len(bad) > f.m:
+					fs.Errorf(o, "Only %d good shards, need %d", len(f.upstreams)-len(bad), f.k)
+					stats.Lost = append(stats.Lost, o.remote)
+				case repair && repairErr == nil:
+					fs.Infof(o, "Repaired shards %v", bad)
+					stats.Repaired = append(stats.Repaired, o.remote)
+				default:
+					stats.Damaged = append(stats.Damaged, o.remote)
+				}
+				return gCtx.Err()
+			})
+		}
+		return nil
+	})
+	if gErr := g.Wait(); err == nil {
+		err = gErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(stats.Damaged)
+	slices.Sort(stats.Repaired)
+	slices.Sort(stats.Lost)
+	return stats, nil
+}
+
+// checkShards reads all the shards of o and returns the numbers of
+// the ones which are missing or damaged
+func (o *Object) checkShards(ctx context.Context) (bad []int) {
+	errs := make([]error, len(o.shards))
+	multithread(len(o.shards), func(number int) {
+		errs[number] = o.checkShard(ctx, number)
+	})
+	for number, err := range errs {
+		if err != nil {
+			fs.Infof(o, "Shard %d is bad: %v", number, err)
+			bad = append(bad, number)
+		}
+	}
+	return bad
+}
+
+// checkShard reads shard number of o and checks its data matches
+// the footer
+func (o *Object) checkShard(ctx context.Context, number int) (err error) {
+	shard := o.shards[number]
+	if shard == nil {
+		return errors.New("missing")
+	}
+	in, err := shard.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(in, &err)
+	hasher := md5.New()
+	_, err = io.CopyN(hasher, in, layout{k: o.f.k, size: o.size}.shardDataSize())
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, footerLen)
+	_, err = io.ReadFull(in, buf)
+	if err != nil {
+		return err
+	}
+	ft, err := parseFooter(buf)
+	if err != nil {
+		return err
+	}
+	err = ft.check(o.f, number, o.size)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(hasher.Sum(nil), ft.shardMD5[:]) {
+		return errors.New("data is corrupt")
+	}
+	return nil
+}
+
+// repair rebuilds the shards with the numbers given from the other
+// shards and uploads them
+func (o *Object) repair(ctx context.Context, numbers []int) (err error) {
+	good := &Object{
+		f:       o.f,
+		remote:  o.remote,
+		size:    o.size,
+		version: o.version,
+		shards:  slices.Clone(o.shards),
+	}
+	for _, number := range numbers {
+		good.shards[number] = nil
+	}
+	in, err := good.Open(ctx)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(in, &err)
+	shards, err := o.f.putShards(ctx, in, good, o.version, numbers)
+	if err != nil {
+		return fmt.Errorf("failed to upload rebuilt shards: %w", err)
+	}
+	for _, number := range numbers {
+		o.shards[number] = shards[number]
+	}
+	return nil
+}
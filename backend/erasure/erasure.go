@@ -0,0 +1,685 @@
+// Package erasure implements a backend which stripes objects across
+// several remotes with Reed-Solomon erasure coding
+package erasure
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+	"storj.io/infectious"
+)
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "erasure",
+		Description: "Stripe files across remotes with erasure coding",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name: "upstreams",
+			Help: `List of space separated upstreams.
+
+Each object is split into shards and one shard is stored on each
+upstream, so these should be on different providers or disks.
+
+The order of the upstreams matters - don't change it once files have
+been written.
+
+Embedded spaces can be added using quotes, e.g.
+
+    "remote1:dir" "remote2:my dir" remote3:dir
+`,
+			Required: true,
+		}, {
+			Name: "parity_shards",
+			Help: `Number of parity shards.
+
+This many upstreams can be unavailable and objects can still be read.
+The rest of the upstreams store data shards so the space used is the
+size of the objects multiplied by the number of upstreams and divided
+by the number of data shards.
+
+This can't be changed once files have been written.`,
+			Default: 1,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Upstreams    fs.SpaceSepList `config:"upstreams"`
+	ParityShards int             `config:"parity_shards"`
+}
+
+// Fs represents objects striped across the upstreams
+type Fs struct {
+	name      string
+	root      string
+	opt       Options
+	features  *fs.Features
+	upstreams []fs.Fs // shard i of each object is stored on upstreams[i]
+	k         int     // number of data shards
+	m         int     // number of parity shards
+	fec       *infectious.FEC
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	n := len(opt.Upstreams)
+	if n < 2 {
+		return nil, errors.New("erasure needs at least 2 upstreams - check the value of the upstreams setting")
+	}
+	if n > 256 {
+		return nil, errors.New("erasure can't have more than 256 upstreams")
+	}
+	if opt.ParityShards < 1 || opt.ParityShards >= n {
+		return nil, fmt.Errorf("parity_shards must be between 1 and %d", n-1)
+	}
+	for _, u := range opt.Upstreams {
+		if strings.HasPrefix(u, name+":") {
+			return nil, errors.New("can't point erasure remote at itself - check the value of the upstreams setting")
+		}
+	}
+	root = strings.Trim(root, "/")
+	f := &Fs{
+		name: name,
+		root: root,
+		opt:  *opt,
+		k:    n - opt.ParityShards,
+		m:    opt.ParityShards,
+	}
+	f.fec, err = infectious.NewFEC(f.k, n)
+	if err != nil {
+		return nil, err
+	}
+	f.upstreams, err = f.newUpstreams(ctx, root)
+	if err != nil {
+		return nil, err
+	}
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		CanHaveEmptyDirectories: true,
+	}).Fill(ctx, f)
+	for _, u := range f.upstreams {
+		f.features = f.features.Mask(ctx, u)
+	}
+
+	// Check to see if the root is an object
+	if root != "" {
+		parent := path.Dir(root)
+		if parent == "." {
+			parent = ""
+		}
+		pf := *f
+		pf.root = parent
+		pf.upstreams, err = f.newUpstreams(ctx, parent)
+		if err != nil {
+			return nil, err
+		}
+		_, err = pf.NewObject(ctx, path.Base(root))
+		if err == nil {
+			return pinUpstreams(&pf), fs.ErrorIsFile
+		}
+	}
+	return pinUpstreams(f), nil
+}
+
+// newUpstreams makes the upstream Fs for root
+func (f *Fs) newUpstreams(ctx context.Context, root string) ([]fs.Fs, error) {
+	upstreams := make([]fs.Fs, len(f.opt.Upstreams))
+	errs := make([]error, len(f.opt.Upstreams))
+	multithread(len(upstreams), func(i int) {
+		remote := fspath.JoinRootPath(f.opt.Upstreams[i], root)
+		upstreams[i], errs[i] = cache.Get(ctx, remote)
+		if errs[i] != nil {
+			errs[i] = fmt.Errorf("failed to make upstream %q: %w", remote, errs[i])
+		}
+	})
+	return upstreams, errors.Join(errs...)
+}
+
+// pinUpstreams pins the upstreams in the cache until f is finalized
+func pinUpstreams(f *Fs) *Fs {
+	for _, u := range f.upstreams {
+		cache.Pin(u)
+	}
+	runtime.SetFinalizer(f, func(f *Fs) {
+		for _, u := range f.upstreams {
+			cache.Unpin(u)
+		}
+	})
+	return f
+}
+
+// multithread runs fn for each of 0..num-1 concurrently
+func multithread(num int, fn func(int)) {
+	var wg sync.WaitGroup
+	for i := range num {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
+
+// forEach runs fn on each upstream concurrently returning the errors
+func (f *Fs) forEach(fn func(i int, u fs.Fs) error) error {
+	errs := make([]error, len(f.upstreams))
+	multithread(len(f.upstreams), func(i int) {
+		err := fn(i, f.upstreams[i])
+		if err != nil {
+			errs[i] = fmt.Errorf("upstream %d: %w", i, err)
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("erasure root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision is the greatest precision of all the upstreams
+func (f *Fs) Precision() time.Duration {
+	var greatestPrecision time.Duration
+	for _, u := range f.upstreams {
+		greatestPrecision = max(greatestPrecision, u.Precision())
+	}
+	return greatestPrecision
+}
+
+// Hashes returns the supported hash sets.
+func (f *Fs) Hashes() hash.Set {
+	return hash.Set(hash.MD5)
+}
+
+// shardKey identifies the shards of one version of an object
+type shardKey struct {
+	remote  string
+	size    int64
+	version int64
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+//
+// Objects are listed if at least as many shards as there are data
+// shards are found and directories if they are on any upstream. Up to
+// parity_shards upstreams may fail.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	lists := make([]fs.DirEntries, len(f.upstreams))
+	errs := make([]error, len(f.upstreams))
+	multithread(len(f.upstreams), func(i int) {
+		lists[i], errs[i] = f.upstreams[i].List(ctx, dir)
+	})
+	found, failed := 0, 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			found++
+		case errors.Is(err, fs.ErrorDirNotFound):
+		default:
+			failed++
+			fs.Debugf(f, "Failed to list %q on upstream %d: %v", dir, i, err)
+			if failed > f.m {
+				return nil, fmt.Errorf("failed to list %d upstreams: %w", failed, err)
+			}
+		}
+	}
+	if found == 0 {
+		return nil, fs.ErrorDirNotFound
+	}
+
+	dirs := map[string]bool{}
+	shardSets := map[shardKey][]fs.Object{}
+	for i, list := range lists {
+		for _, entry := range list {
+			switch x := entry.(type) {
+			case fs.Directory:
+				if !dirs[x.Remote()] {
+					dirs[x.Remote()] = true
+					entries = append(entries, fs.NewDir(x.Remote(), x.ModTime(ctx)))
+				}
+			case fs.Object:
+				remote, size, version, ok := parseShardName(x.Remote())
+				if !ok {
+					fs.Debugf(x, "Ignoring file which isn't a shard")
+					continue
+				}
+				if want := (layout{k: f.k, size: size}).shardSize(); x.Size() != want {
+					fs.Debugf(x, "Ignoring shard with size %d, expecting %d", x.Size(), want)
+					continue
+				}
+				key := shardKey{remote: remote, size: size, version: version}
+				if shardSets[key] == nil {
+					shardSets[key] = make([]fs.Object, len(f.upstreams))
+				}
+				shardSets[key][i] = x
+			}
+		}
+	}
+
+	// Choose the version with the most shards, then the newest, if
+	// an update didn't complete
+	objects := map[string]*Object{}
+	for key, shards := range shardSets {
+		o := &Object{f: f, remote: key.remote, size: key.size, version: key.version, shards: shards}
+		count := o.shardCount()
+		if count < f.k {
+			fs.Debugf(o, "Ignoring object with %d shards, need %d", count, f.k)
+			continue
+		}
+		prev := objects[key.remote]
+		if prev == nil || count > prev.shardCount() || (count == prev.shardCount() && o.version > prev.version) {
+			objects[key.remote] = o
+		}
+	}
+	for _, o := range objects {
+		entries = append(entries, o)
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Remote(), b.Remote())
+	})
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error fs.ErrorObjectNotFound.
+//
+// As the size of the object is part of the names of its shards this
+// lists the directory the object is in.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	dir := path.Dir(remote)
+	if dir == "." {
+		dir = ""
+	}
+	entries, err := f.List(ctx, dir)
+	if errors.Is(err, fs.ErrorDirNotFound) {
+		return nil, fs.ErrorObjectNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if o, ok := entry.(*Object); ok && o.remote == remote {
+			return o, nil
+		}
+	}
+	return nil, fs.ErrorObjectNotFound
+}
+
+// shardInfo is the info for a shard being uploaded
+type shardInfo struct {
+	fs.ObjectInfo
+	remote string
+	size   int64
+}
+
+// Remote returns the name of the shard
+func (si *shardInfo) Remote() string {
+	return si.remote
+}
+
+// Size returns the size of the shard
+func (si *shardInfo) Size() int64 {
+	return si.size
+}
+
+// Hash returns no hashes as the shard isn't the same as the source
+func (si *shardInfo) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	return "", nil
+}
+
+// putShards uploads the shards of version with the numbers given made
+// from in and returns them indexed by number.
+//
+// If any of the uploads fail the shards which were uploaded are
+// removed.
+func (f *Fs) putShards(ctx context.Context, in io.Reader, src fs.ObjectInfo, version int64, numbers []int) ([]fs.Object, error) {
+	size := src.Size()
+	if size < 0 {
+		return nil, errors.New("erasure can't upload files of unknown size")
+	}
+	info := &shardInfo{
+		ObjectInfo: src,
+		remote:     makeShardName(src.Remote(), size, version),
+		size:       layout{k: f.k, size: size}.shardSize(),
+	}
+	out := make([]io.Writer, len(f.upstreams))
+	pipes := make([]*io.PipeWriter, len(f.upstreams))
+	shards := make([]fs.Object, len(f.upstreams))
+	errs := make([]error, len(f.upstreams))
+	var wg sync.WaitGroup
+	for _, number := range numbers {
+		pr, pw := io.Pipe()
+		out[number], pipes[number] = pw, pw
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			shards[number], errs[number] = f.upstreams[number].Put(ctx, pr, info)
+			_ = pr.CloseWithError(errs[number])
+		}()
+	}
+	err := f.encode(in, size, out)
+	for _, pw := range pipes {
+		if pw != nil {
+			_ = pw.CloseWithError(err)
+		}
+	}
+	wg.Wait()
+	for _, number := range numbers {
+		if errs[number] != nil {
+			err = fmt.Errorf("failed to upload shard %d: %w", number, errs[number])
+			break
+		}
+	}
+	if err != nil {
+		for _, shard := range shards {
+			if shard != nil {
+				if removeErr := shard.Remove(ctx); removeErr != nil {
+					fs.Errorf(shard, "Failed to remove shard after failed upload: %v", removeErr)
+				}
+			}
+		}
+		return nil, err
+	}
+	return shards, nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// All the shards must be uploaded for this to succeed. If the object
+// exists already it is updated.
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	existingObj, err := f.NewObject(ctx, src.Remote())
+	switch err {
+	case nil:
+		return existingObj, existingObj.Update(ctx, in, src, options...)
+	case fs.ErrorObjectNotFound:
+		return f.put(ctx, in, src, newVersion(0))
+	default:
+		return nil, err
+	}
+}
+
+// put uploads all the shards of version of the object
+func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, version int64) (*Object, error) {
+	numbers := make([]int, len(f.upstreams))
+	for i := range numbers {
+		numbers[i] = i
+	}
+	shards, err := f.putShards(ctx, in, src, version, numbers)
+	if err != nil {
+		return nil, err
+	}
+	return &Object{
+		f:       f,
+		remote:  src.Remote(),
+		size:    src.Size(),
+		version: version,
+		shards:  shards,
+	}, nil
+}
+
+// Mkdir makes the directory on all the upstreams
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	return f.forEach(func(i int, u fs.Fs) error {
+		return u.Mkdir(ctx, dir)
+	})
+}
+
+// Rmdir removes the directory from all the upstreams
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	var notFound atomic.Int32
+	err := f.forEach(func(i int, u fs.Fs) error {
+		err := u.Rmdir(ctx, dir)
+		if errors.Is(err, fs.ErrorDirNotFound) {
+			notFound.Add(1)
+			return nil
+		}
+		return err
+	})
+	if err == nil && int(notFound.Load()) == len(f.upstreams) {
+		return fs.ErrorDirNotFound
+	}
+	return err
+}
+
+// Object describes an object striped across the upstreams
+type Object struct {
+	f       *Fs
+	remote  string
+	size    int64
+	version int64       // version of the upload the shards are from
+	shards  []fs.Object // shard i is on upstream i or nil if missing
+
+	mu     sync.Mutex
+	footer *footer // footer of one of the shards if read
+}
+
+// shardCount returns the number of shards of the object found
+func (o *Object) shardCount() (count int) {
+	for _, shard := range o.shards {
+		if shard != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the object
+func (o *Object) Size() int64 {
+	return o.size
+}
+
+// Storable returns whether the object is storable
+func (o *Object) Storable() bool {
+	return true
+}
+
+// ModTime returns the modification time of the first shard found
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	for _, shard := range o.shards {
+		if shard != nil {
+			return shard.ModTime(ctx)
+		}
+	}
+	return time.Time{}
+}
+
+// SetModTime sets the modification time of all the shards
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	return o.f.forEach(func(i int, u fs.Fs) error {
+		if o.shards[i] == nil {
+			return nil
+		}
+		return o.shards[i].SetModTime(ctx, modTime)
+	})
+}
+
+// readFooter reads the footer from the first shard it can
+func (o *Object) readFooter(ctx context.Context) (ft *footer, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.footer != nil {
+		return o.footer, nil
+	}
+	shardSize := layout{k: o.f.k, size: o.size}.shardSize()
+	for number, shard := range o.shards {
+		if shard == nil {
+			continue
+		}
+		ft, err = readShardFooter(ctx, shard, shardSize)
+		if err == nil {
+			err = ft.check(o.f, number, o.size)
+		}
+		if err == nil {
+			o.footer = ft
+			return ft, nil
+		}
+		fs.Debugf(o, "Failed to read footer of shard %d: %v", number, err)
+	}
+	return nil, fmt.Errorf("failed to read footer: %w", err)
+}
+
+// readShardFooter reads the footer of a shard of shardSize bytes
+func readShardFooter(ctx context.Context, shard fs.Object, shardSize int64) (ft *footer, err error) {
+	in, err := shard.Open(ctx, &fs.RangeOption{Start: shardSize - footerLen, End: shardSize - 1})
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(in, &err)
+	buf := make([]byte, footerLen)
+	_, err = io.ReadFull(in, buf)
+	if err != nil {
+		return nil, err
+	}
+	return parseFooter(buf)
+}
+
+// Hash returns the MD5 of the object which is stored in the shards
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	if ht != hash.MD5 {
+		return "", hash.ErrUnsupported
+	}
+	ft, err := o.readFooter(ctx)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", ft.md5), nil
+}
+
+// Open an object for read
+//
+// The data is read from the data shards if they are available,
+// otherwise it is reconstructed from the parity shards.
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (io.ReadCloser, error) {
+	var offset, limit int64 = 0, -1
+	for _, option := range options {
+		switch x := option.(type) {
+		case *fs.SeekOption:
+			offset = x.Offset
+		case *fs.RangeOption:
+			offset, limit = x.Decode(o.size)
+		default:
+			if option.Mandatory() {
+				fs.Logf(o, "Unsupported mandatory option: %v", option)
+			}
+		}
+	}
+	if limit < 0 || offset+limit > o.size {
+		limit = o.size - offset
+	}
+	if limit <= 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	return newDecoder(ctx, o, offset, limit)
+}
+
+// Update the object with the contents of the io.Reader, modTime and size
+//
+// The new shards are uploaded as a new version and the shards of the
+// old object are only removed once all of them have been written, so
+// the old object is left intact if the upload fails.
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	newO, err := o.f.put(ctx, in, fs.NewOverrideRemote(src, o.remote), newVersion(o.version))
+	if err != nil {
+		return err
+	}
+	for _, shard := range o.shards {
+		if shard != nil {
+			if err := shard.Remove(ctx); err != nil {
+				fs.Errorf(shard, "Failed to remove old shard: %v", err)
+			}
+		}
+	}
+	o.size = newO.size
+	o.version = newO.version
+	o.shards = newO.shards
+	o.mu.Lock()
+	o.footer = nil
+	o.mu.Unlock()
+	return nil
+}
+
+// Remove the shards of the object
+func (o *Object) Remove(ctx context.Context) error {
+	return o.f.forEach(func(i int, u fs.Fs) error {
+		if o.shards[i] == nil {
+			return nil
+		}
+		return o.shards[i].Remove(ctx)
+	})
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs        = (*Fs)(nil)
+	_ fs.Commander = (*Fs)(nil)
+	_ fs.Object    = (*Object)(nil)
+)
@@ -0,0 +1,203 @@
+package erasure
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardName(t *testing.T) {
+	for _, size := range []int64{0, 1, 1 << 40} {
+		version := newVersion(size)
+		name := makeShardName("dir/file.txt", size, version)
+		assert.True(t, strings.HasSuffix(name, shardExt))
+		remote, gotSize, gotVersion, ok := parseShardName(name)
+		require.True(t, ok)
+		assert.Equal(t, "dir/file.txt", remote)
+		assert.Equal(t, size, gotSize)
+		assert.Equal(t, version, gotVersion)
+	}
+	for _, name := range []string{"file.txt", "file.ec", "file.!!!.ec", "file.AAAA.ec", "file.AAAAAAAAAAA.ec"} {
+		_, _, _, ok := parseShardName(name)
+		assert.False(t, ok, name)
+	}
+}
+
+func TestLayout(t *testing.T) {
+	l := layout{k: 3, size: 3*blockSize + 10}
+	assert.Equal(t, int64(2), l.stripes())
+	assert.Equal(t, int64(10), l.dataLen(1))
+	assert.Equal(t, int64(4), l.blockLen(1))
+	assert.Equal(t, int64(blockSize+4), l.shardDataSize())
+	assert.Equal(t, int64(0), layout{k: 3}.shardDataSize())
+}
+
+// readAll reads the object at remote in f
+func readAll(t *testing.T, ctx context.Context, f fs.Fs, remote string, options ...fs.OpenOption) string {
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	in, err := o.Open(ctx, options...)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+func TestDegradedReadAndScrub(t *testing.T) {
+	fstest.Initialise()
+	ctx := context.Background()
+	dirs := []string{t.TempDir(), t.TempDir(), t.TempDir(), t.TempDir()}
+	ff, err := NewFs(ctx, "TestErasure", "", configmap.Simple{
+		"type":          "erasure",
+		"upstreams":     strings.Join(dirs, " "),
+		"parity_shards": "2",
+	})
+	require.NoError(t, err)
+	f := ff.(*Fs)
+	assert.Equal(t, 2, f.k)
+
+	contents := random.String(300000)
+	src := object.NewStaticObjectInfo("dir/file.bin", fstest.Time("2001-02-03T04:05:06.499999999Z"), int64(len(contents)), true, nil, nil)
+	o, err := f.Put(ctx, strings.NewReader(contents), src)
+	require.NoError(t, err)
+	shardName := filepath.FromSlash(makeShardName("dir/file.bin", int64(len(contents)), o.(*Object).version))
+
+	// Lose a data shard and a parity shard
+	parity, err := os.ReadFile(filepath.Join(dirs[3], shardName))
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(dirs[0], shardName)))
+	require.NoError(t, os.Remove(filepath.Join(dirs[3], shardName)))
+	assert.Equal(t, contents, readAll(t, ctx, f, "dir/file.bin"))
+	assert.Equal(t, contents[200000:250000], readAll(t, ctx, f, "dir/file.bin", &fs.RangeOption{Start: 200000, End: 249999}))
+	o, err = f.NewObject(ctx, "dir/file.bin")
+	require.NoError(t, err)
+	sum, err := o.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("%x", md5.Sum([]byte(contents))), sum)
+
+	// Damage another shard so it can only be found by scrubbing
+	shard := filepath.Join(dirs[1], shardName)
+	data, err := os.ReadFile(shard)
+	require.NoError(t, err)
+	data[1000] ^= 0xFF
+	require.NoError(t, os.WriteFile(shard, data, 0666))
+
+	stats, err := f.scrub(ctx, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Objects)
+	assert.Equal(t, []string{"dir/file.bin"}, stats.Lost)
+
+	// Restore the parity shard so there are enough to repair
+	require.NoError(t, os.WriteFile(filepath.Join(dirs[3], shardName), parity, 0666))
+	stats, err = f.scrub(ctx, "dir", false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir/file.bin"}, stats.Damaged)
+	stats, err = f.scrub(ctx, "", true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"dir/file.bin"}, stats.Repaired)
+	stats, err = f.scrub(ctx, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Healthy)
+	for _, dir := range dirs {
+		assert.FileExists(t, filepath.Join(dir, shardName))
+	}
+
+	// Check the repaired shards are used
+	require.NoError(t, os.Remove(filepath.Join(dirs[1], shardName)))
+	require.NoError(t, os.Remove(filepath.Join(dirs[2], shardName)))
+	assert.Equal(t, contents, readAll(t, ctx, f, "dir/file.bin"))
+
+	// Too many shards lost
+	require.NoError(t, os.Remove(filepath.Join(dirs[3], shardName)))
+	_, err = f.NewObject(ctx, "dir/file.bin")
+	assert.ErrorIs(t, err, fs.ErrorObjectNotFound)
+}
+
+// failPutFs fails all uploads to the Fs it wraps
+type failPutFs struct {
+	fs.Fs
+}
+
+// Put fails without reading in
+func (f failPutFs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return nil, errors.New("upload failed")
+}
+
+// shardFiles returns the names of the files in dir
+func shardFiles(t *testing.T, dir string) (names []string) {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestUpdateFailure(t *testing.T) {
+	fstest.Initialise()
+	ctx := context.Background()
+	dirs := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+	ff, err := NewFs(ctx, "TestErasure", "", configmap.Simple{
+		"type":          "erasure",
+		"upstreams":     strings.Join(dirs, " "),
+		"parity_shards": "1",
+	})
+	require.NoError(t, err)
+	f := ff.(*Fs)
+
+	oldContents := random.String(200000)
+	newContents := random.String(len(oldContents))
+	modTime := fstest.Time("2001-02-03T04:05:06.499999999Z")
+	src := object.NewStaticObjectInfo("file.bin", modTime, int64(len(oldContents)), true, nil, nil)
+	o, err := f.Put(ctx, strings.NewReader(oldContents), src)
+	require.NoError(t, err)
+	oldShards := shardFiles(t, dirs[0])
+	require.Len(t, oldShards, 1)
+
+	// Make one upstream fail while updating with the same size
+	upstream := f.upstreams[1]
+	f.upstreams[1] = failPutFs{Fs: upstream}
+	err = o.Update(ctx, strings.NewReader(newContents), src)
+	f.upstreams[1] = upstream
+	require.ErrorContains(t, err, "upload failed")
+
+	// The old object must be intact with no new shards left behind
+	for _, dir := range dirs {
+		assert.Equal(t, oldShards, shardFiles(t, dir))
+	}
+	assert.Equal(t, oldContents, readAll(t, ctx, f, "file.bin"))
+
+	// A successful update replaces the old shards
+	require.NoError(t, o.Update(ctx, strings.NewReader(newContents), src))
+	for _, dir := range dirs {
+		newShards := shardFiles(t, dir)
+		require.Len(t, newShards, 1)
+		assert.NotEqual(t, oldShards, newShards)
+	}
+	assert.Equal(t, newContents, readAll(t, ctx, f, "file.bin"))
+
+	// Putting over the object updates it too
+	_, err = f.Put(ctx, strings.NewReader(oldContents), src)
+	require.NoError(t, err)
+	for _, dir := range dirs {
+		assert.Len(t, shardFiles(t, dir), 1)
+	}
+	assert.Equal(t, oldContents, readAll(t, ctx, f, "file.bin"))
+}
@@ -0,0 +1,373 @@
+package erasure
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"storj.io/infectious"
+)
+
+const (
+	shardExt      = ".ec"      // extension of the shard files
+	blockSize     = 64 * 1024  // bytes of each shard per stripe
+	footerMagic   = "RCLONEEC" // start of the footer
+	footerVersion = 1
+	footerLen     = 56
+)
+
+// Shard files are named after the object they are a shard of with the
+// size of the object and the version of the upload appended, eg
+// "file.txt.AAAAAAAAAAAAAAAAAAAAAA.ec", so the objects can be listed
+// without reading the shards. Each upload of an object writes shards
+// with a new version so an update never overwrites the shards of the
+// object it replaces.
+//
+// Objects are split into stripes of k*blockSize bytes. Each stripe is
+// split into k blocks, the last stripe being padded with zeros to a
+// multiple of k, and m parity blocks are made from them. Shard i is
+// block i of each stripe followed by a footer.
+
+// newVersion returns a version for a new upload of an object which is
+// greater than prev, the version of the object being replaced
+func newVersion(prev int64) int64 {
+	return max(time.Now().UnixNano(), prev+1)
+}
+
+// makeShardName returns the name of the shards of version of remote
+// with size
+func makeShardName(remote string, size, version int64) string {
+	buf := make([]byte, 16)
+	binary.LittleEndian.PutUint64(buf, uint64(size))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(version))
+	return remote + "." + base64.RawURLEncoding.EncodeToString(buf) + shardExt
+}
+
+// parseShardName returns the remote, the size and the version of the
+// object the shard called name is from or ok false if it isn't a
+// shard name
+func parseShardName(name string) (remote string, size, version int64, ok bool) {
+	base, found := strings.CutSuffix(name, shardExt)
+	if !found {
+		return "", 0, 0, false
+	}
+	dot := strings.LastIndexByte(base, '.')
+	if dot < 0 {
+		return "", 0, 0, false
+	}
+	buf, err := base64.RawURLEncoding.DecodeString(base[dot+1:])
+	if err != nil || len(buf) != 16 {
+		return "", 0, 0, false
+	}
+	size = int64(binary.LittleEndian.Uint64(buf))
+	version = int64(binary.LittleEndian.Uint64(buf[8:]))
+	if size < 0 {
+		return "", 0, 0, false
+	}
+	return base[:dot], size, version, true
+}
+
+// layout describes how an object of size bytes is split into stripes
+type layout struct {
+	k    int
+	size int64
+}
+
+// stripeSize returns the number of bytes of the object in a full stripe
+func (l layout) stripeSize() int64 {
+	return int64(l.k) * blockSize
+}
+
+// stripes returns the number of stripes
+func (l layout) stripes() int64 {
+	return (l.size + l.stripeSize() - 1) / l.stripeSize()
+}
+
+// dataLen returns the number of bytes of the object in stripe s
+func (l layout) dataLen(s int64) int64 {
+	return min(l.stripeSize(), l.size-s*l.stripeSize())
+}
+
+// blockLen returns the size of the blocks of stripe s
+func (l layout) blockLen(s int64) int64 {
+	return (l.dataLen(s) + int64(l.k) - 1) / int64(l.k)
+}
+
+// shardDataSize returns the size of the data in each shard
+func (l layout) shardDataSize() int64 {
+	n := l.stripes()
+	if n == 0 {
+		return 0
+	}
+	return (n-1)*blockSize + l.blockLen(n-1)
+}
+
+// shardSize returns the size of each shard file
+func (l layout) shardSize() int64 {
+	return l.shardDataSize() + footerLen
+}
+
+// footer is stored at the end of each shard
+type footer struct {
+	k, m     int      // data and parity shards
+	number   int      // the number of this shard
+	size     int64    // size of the object
+	md5      [16]byte // MD5 of the object
+	shardMD5 [16]byte // MD5 of the data in this shard
+}
+
+// marshal the footer into footerLen bytes
+func (ft *footer) marshal() []byte {
+	buf := make([]byte, footerLen)
+	copy(buf, footerMagic)
+	buf[8] = footerVersion
+	buf[9] = byte(ft.k)
+	buf[10] = byte(ft.m)
+	buf[11] = byte(ft.number)
+	binary.LittleEndian.PutUint64(buf[16:], uint64(ft.size))
+	copy(buf[24:], ft.md5[:])
+	copy(buf[40:], ft.shardMD5[:])
+	return buf
+}
+
+// parseFooter parses the footer in buf
+func parseFooter(buf []byte) (*footer, error) {
+	if len(buf) != footerLen || !bytes.HasPrefix(buf, []byte(footerMagic)) {
+		return nil, errors.New("shard footer not found")
+	}
+	if buf[8] != footerVersion {
+		return nil, fmt.Errorf("unknown shard footer version %d", buf[8])
+	}
+	ft := &footer{
+		k:      int(buf[9]),
+		m:      int(buf[10]),
+		number: int(buf[11]),
+		size:   int64(binary.LittleEndian.Uint64(buf[16:])),
+	}
+	copy(ft.md5[:], buf[24:])
+	copy(ft.shardMD5[:], buf[40:])
+	return ft, nil
+}
+
+// check the footer is for shard number of an object of size bytes
+// made with this configuration
+func (ft *footer) check(f *Fs, number int, size int64) error {
+	switch {
+	case ft.k != f.k || ft.m != f.m:
+		return fmt.Errorf("shard made with %d+%d shards but configured for %d+%d", ft.k, ft.m, f.k, f.m)
+	case ft.number != number:
+		return fmt.Errorf("shard number %d found on upstream %d", ft.number, number)
+	case ft.size != size:
+		return fmt.Errorf("shard is for an object of size %d not %d", ft.size, size)
+	}
+	return nil
+}
+
+// encode reads size bytes from in and writes shard i to out[i] for
+// each out[i] which isn't nil followed by its footer.
+func (f *Fs) encode(in io.Reader, size int64, out []io.Writer) error {
+	l := layout{k: f.k, size: size}
+	objectHash := md5.New()
+	shardHashes := make([]hash.Hash, len(out))
+	for i := range out {
+		if out[i] != nil {
+			shardHashes[i] = md5.New()
+		}
+	}
+	buf := make([]byte, l.stripeSize())
+	for s := range l.stripes() {
+		dataLen, blockLen := l.dataLen(s), l.blockLen(s)
+		stripe := buf[:int64(f.k)*blockLen]
+		_, err := io.ReadFull(in, stripe[:dataLen])
+		if err != nil {
+			return fmt.Errorf("failed to read stripe %d: %w", s, err)
+		}
+		clear(stripe[dataLen:])
+		_, _ = objectHash.Write(stripe[:dataLen])
+		var writeErr error
+		err = f.fec.Encode(stripe, func(share infectious.Share) {
+			w := out[share.Number]
+			if w == nil || writeErr != nil {
+				return
+			}
+			_, _ = shardHashes[share.Number].Write(share.Data)
+			_, writeErr = w.Write(share.Data)
+		})
+		if err == nil {
+			err = writeErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+	ft := footer{
+		k:    f.k,
+		m:    f.m,
+		size: size,
+	}
+	objectHash.Sum(ft.md5[:0])
+	for i, w := range out {
+		if w == nil {
+			continue
+		}
+		ft.number = i
+		shardHashes[i].Sum(ft.shardMD5[:0])
+		_, err := w.Write(ft.marshal())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decoder reads the data of an object from k of its shards,
+// switching to other shards if one fails
+type decoder struct {
+	ctx       context.Context
+	o         *Object
+	l         layout
+	stripe    int64              // the next stripe to read
+	end       int64              // the stripe after the last one to read
+	sources   []source           // the k shards being read
+	spares    []int              // numbers of the shards not read yet
+	blocks    [][]byte           // buffers for the blocks of each source
+	shares    []infectious.Share // the blocks of the current stripe
+	out       []byte             // buffer for the decoded stripe
+	buf       []byte             // decoded data not returned yet
+	skip      int64              // bytes to skip in the first stripe
+	remaining int64              // bytes left to return
+}
+
+// source is a shard being read
+type source struct {
+	number int
+	in     io.ReadCloser
+}
+
+// newDecoder makes a decoder for limit bytes of o starting at offset
+func newDecoder(ctx context.Context, o *Object, offset, limit int64) (*decoder, error) {
+	l := layout{k: o.f.k, size: o.size}
+	d := &decoder{
+		ctx:       ctx,
+		o:         o,
+		l:         l,
+		stripe:    offset / l.stripeSize(),
+		end:       (offset+limit-1)/l.stripeSize() + 1,
+		skip:      offset % l.stripeSize(),
+		remaining: limit,
+		blocks:    make([][]byte, o.f.k),
+		shares:    make([]infectious.Share, o.f.k),
+		out:       make([]byte, l.stripeSize()),
+	}
+	for number, shard := range o.shards {
+		if shard != nil {
+			d.spares = append(d.spares, number)
+		}
+	}
+	for i := range d.blocks {
+		d.blocks[i] = make([]byte, blockSize)
+		in, number, err := d.openSpare()
+		if err != nil {
+			_ = d.Close()
+			return nil, err
+		}
+		d.sources = append(d.sources, source{number: number, in: in})
+	}
+	return d, nil
+}
+
+// openSpare opens the next spare shard at the current stripe
+func (d *decoder) openSpare() (in io.ReadCloser, number int, err error) {
+	for len(d.spares) > 0 {
+		number, d.spares = d.spares[0], d.spares[1:]
+		in, err = d.o.shards[number].Open(d.ctx, &fs.RangeOption{Start: d.stripe * blockSize, End: d.l.shardDataSize() - 1})
+		if err == nil {
+			return in, number, nil
+		}
+		fs.Debugf(d.o, "Failed to open shard %d: %v", number, err)
+	}
+	return nil, -1, fmt.Errorf("not enough shards to read object: need %d", d.o.f.k)
+}
+
+// readStripe reads and decodes the next stripe into d.buf
+func (d *decoder) readStripe() error {
+	blockLen := d.l.blockLen(d.stripe)
+	allData := true
+	for i := range d.sources {
+		src := &d.sources[i]
+		for {
+			_, err := io.ReadFull(src.in, d.blocks[i][:blockLen])
+			if err == nil {
+				break
+			}
+			fs.Debugf(d.o, "Failed to read shard %d: %v", src.number, err)
+			_ = src.in.Close()
+			src.in, src.number, err = d.openSpare()
+			if err != nil {
+				return err
+			}
+		}
+		d.shares[i] = infectious.Share{Number: src.number, Data: d.blocks[i][:blockLen]}
+		if src.number >= d.o.f.k {
+			allData = false
+		}
+	}
+	out := d.out[:int64(d.o.f.k)*blockLen]
+	if allData {
+		for _, share := range d.shares {
+			copy(out[int64(share.Number)*blockLen:], share.Data)
+		}
+	} else {
+		err := d.o.f.fec.Rebuild(d.shares, func(share infectious.Share) {
+			copy(out[int64(share.Number)*blockLen:], share.Data)
+		})
+		if err != nil {
+			return fmt.Errorf("failed to decode stripe %d: %w", d.stripe, err)
+		}
+	}
+	d.buf = out[d.skip:d.l.dataLen(d.stripe)]
+	d.skip = 0
+	d.stripe++
+	return nil
+}
+
+// Read data from the object
+func (d *decoder) Read(p []byte) (n int, err error) {
+	if d.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if len(d.buf) == 0 {
+		if d.stripe >= d.end {
+			return 0, io.EOF
+		}
+		err = d.readStripe()
+		if err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > d.remaining {
+		p = p[:d.remaining]
+	}
+	n = copy(p, d.buf)
+	d.buf = d.buf[n:]
+	d.remaining -= int64(n)
+	return n, nil
+}
+
+// Close the shards being read
+func (d *decoder) Close() (err error) {
+	for _, src := range d.sources {
+		fs.CheckClose(src.in, &err)
+	}
+	d.sources = nil
+	return err
+}
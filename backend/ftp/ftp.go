@@ -549,7 +549,7 @@ func (f *Fs) getFtpConnection(ctx context.Context) (c *ftp.ServerConn, err error
 	if f.opt.Concurrency > 0 {
 		f.tokens.Get()
 	}
-	accounting.LimitTPS(ctx)
+	accounting.LimitRemoteTPS(ctx, f.name)
 	f.poolMu.Lock()
 	if len(f.pool) > 0 {
 		c = f.pool[0]
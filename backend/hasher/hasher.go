@@ -425,6 +425,20 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	return f.wrapObject(oResult, err)
 }
 
+// Link src to this remote using a hard link.
+func (f *Fs) Link(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	do := f.Fs.Features().Link
+	if do == nil {
+		return nil, fs.ErrorCantLink
+	}
+	o, ok := src.(*Object)
+	if !ok {
+		return nil, fs.ErrorCantLink
+	}
+	oResult, err := do(ctx, o.Object, remote)
+	return f.wrapObject(oResult, err)
+}
+
 // Move src to this remote using server-side move operations.
 func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
 	do := f.Fs.Features().Move
@@ -584,6 +598,7 @@ var (
 	_ fs.Fs              = (*Fs)(nil)
 	_ fs.Purger          = (*Fs)(nil)
 	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Linker          = (*Fs)(nil)
 	_ fs.Mover           = (*Fs)(nil)
 	_ fs.DirMover        = (*Fs)(nil)
 	_ fs.Commander       = (*Fs)(nil)
@@ -0,0 +1,185 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// hashCacheFacility is the name of the kv database the hash cache is kept in
+const hashCacheFacility = "localhash"
+
+// hashCacheRacyWindow is how recently a file can have been changed and
+// still have its hashes cached.
+//
+// A change to a file within the timestamp granularity of the file
+// system of it being hashed might not alter its fingerprint, so hashes
+// of recently changed files aren't trusted.
+var hashCacheRacyWindow = 2 * time.Second
+
+var errHashCacheMiss = errors.New("hash not in cache")
+
+// hashCacheRecord is the value saved in the hash cache for each file
+type hashCacheRecord struct {
+	Fingerprint string            `json:"fp"`
+	Hashes      map[string]string `json:"hashes"`
+}
+
+// startHashCache opens the hash cache database if required
+func (f *Fs) startHashCache(ctx context.Context) error {
+	if !f.opt.HashCache {
+		return nil
+	}
+	if !kv.Supported() {
+		fs.Logf(f, "hash_cache is not supported on this platform - ignoring")
+		return nil
+	}
+	db, err := kv.Start(ctx, hashCacheFacility, nil)
+	if err != nil {
+		return fmt.Errorf("failed to open hash cache: %w", err)
+	}
+	f.hashCache = db
+	return nil
+}
+
+// Shutdown the backend, closing any background tasks and any
+// cached connections.
+func (f *Fs) Shutdown(ctx context.Context) error {
+	if f.hashCache == nil {
+		return nil
+	}
+	err := f.hashCache.Stop(false)
+	f.hashCache = nil
+	return err
+}
+
+// hashFingerprint returns a string which changes whenever the contents
+// of the file at path may have changed.
+//
+// It returns "" if the file can't be fingerprinted reliably, either
+// because the OS doesn't provide inode numbers or because the file
+// was changed too recently.
+func (f *Fs) hashFingerprint(path string) string {
+	fi, err := f.lstat(path)
+	if err != nil || !fi.Mode().IsRegular() {
+		return ""
+	}
+	dev, ino, ok := readInode(fi)
+	if !ok {
+		return ""
+	}
+	mtime := fi.ModTime()
+	ctime := readTime(cTime, fi)
+	since := time.Since(mtime)
+	if sinceC := time.Since(ctime); sinceC < since {
+		since = sinceC
+	}
+	if since < hashCacheRacyWindow {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d:%d:%d:%d", dev, ino, fi.Size(), mtime.UnixNano(), ctime.UnixNano())
+}
+
+// getCachedHash reads the hash of type ht from the hash cache if the
+// file's fingerprint is still fp.
+func (o *Object) getCachedHash(ht hash.Type, fp string) (string, error) {
+	op := &opGetHash{key: o.path, fp: fp, hashType: ht.String()}
+	if err := o.fs.hashCache.Do(false, op); err != nil {
+		return "", err
+	}
+	return op.value, nil
+}
+
+// putCachedHashes saves hashes to the hash cache if the file's
+// fingerprint is still fp
+func (o *Object) putCachedHashes(hashes map[hash.Type]string, fp string) {
+	if fp == "" || o.fs.hashFingerprint(o.path) != fp {
+		fs.Debugf(o, "Not caching hashes as the file may have changed while hashing")
+		return
+	}
+	op := &opPutHashes{key: o.path, fp: fp, hashes: map[string]string{}}
+	for ht, value := range hashes {
+		op.hashes[ht.String()] = value
+	}
+	if err := o.fs.hashCache.Do(true, op); err != nil {
+		fs.Debugf(o, "Failed to save hashes to cache: %v", err)
+	}
+}
+
+// removeCachedHashes removes the hash cache entry for path
+func (f *Fs) removeCachedHashes(path string) {
+	if f.hashCache == nil {
+		return
+	}
+	if err := f.hashCache.Do(true, &opRemoveHashes{key: path}); err != nil && err != kv.ErrEmpty {
+		fs.Debugf(path, "Failed to remove hashes from cache: %v", err)
+	}
+}
+
+// opGetHash reads a hash from the cache
+type opGetHash struct {
+	key      string
+	fp       string
+	hashType string
+	value    string
+}
+
+func (op *opGetHash) Do(ctx context.Context, b kv.Bucket) error {
+	data := b.Get([]byte(op.key))
+	if len(data) == 0 {
+		return errHashCacheMiss
+	}
+	var r hashCacheRecord
+	if err := json.Unmarshal(data, &r); err != nil || r.Fingerprint != op.fp {
+		return errHashCacheMiss
+	}
+	value, found := r.Hashes[op.hashType]
+	if !found {
+		return errHashCacheMiss
+	}
+	op.value = value
+	return nil
+}
+
+// opPutHashes adds hashes to the cache, replacing any from a
+// previous version of the file
+type opPutHashes struct {
+	key    string
+	fp     string
+	hashes map[string]string
+}
+
+func (op *opPutHashes) Do(ctx context.Context, b kv.Bucket) error {
+	var r hashCacheRecord
+	if data := b.Get([]byte(op.key)); len(data) > 0 {
+		if err := json.Unmarshal(data, &r); err != nil || r.Fingerprint != op.fp {
+			r = hashCacheRecord{}
+		}
+	}
+	r.Fingerprint = op.fp
+	if r.Hashes == nil {
+		r.Hashes = map[string]string{}
+	}
+	maps.Copy(r.Hashes, op.hashes)
+	data, err := json.Marshal(&r)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(op.key), data)
+}
+
+// opRemoveHashes removes a file from the cache
+type opRemoveHashes struct {
+	key string
+}
+
+func (op *opRemoveHashes) Do(ctx context.Context, b kv.Bucket) error {
+	return b.Delete([]byte(op.key))
+}
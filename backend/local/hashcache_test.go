@@ -0,0 +1,81 @@
+package local
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashCache(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("kv database not supported")
+	}
+	oldWindow := hashCacheRacyWindow
+	hashCacheRacyWindow = 0
+	defer func() { hashCacheRacyWindow = oldWindow }()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	fi, err := NewFs(ctx, "local", dir, configmap.Simple{"hash_cache": "true"})
+	require.NoError(t, err)
+	f := fi.(*Fs)
+	defer func() {
+		assert.NoError(t, f.Shutdown(ctx))
+	}()
+	require.NotNil(t, f.hashCache)
+
+	const filePath = "file.txt"
+	localPath := filepath.Join(dir, filePath)
+	when := time.Now().Add(-time.Hour)
+	require.NoError(t, os.WriteFile(localPath, []byte("content"), 0666))
+	require.NoError(t, os.Chtimes(localPath, when, when))
+	if f.hashFingerprint(localPath) == "" {
+		t.Skip("hash cache not supported on this OS")
+	}
+
+	newObject := func() *Object {
+		o, err := f.NewObject(ctx, filePath)
+		require.NoError(t, err)
+		return o.(*Object)
+	}
+
+	// Hashing saves the hash in the cache
+	o := newObject()
+	md5, err := o.Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, "9a0364b9e99bb480dd25e1f0284c8555", md5)
+	fp := f.hashFingerprint(localPath)
+	cached, err := o.getCachedHash(hash.MD5, fp)
+	require.NoError(t, err)
+	assert.Equal(t, md5, cached)
+	_, err = o.getCachedHash(hash.MD5, fp+"x")
+	assert.ErrorIs(t, err, errHashCacheMiss)
+
+	// Hashes are read from the cache when the file is unchanged
+	require.NoError(t, f.hashCache.Do(true, &opPutHashes{key: localPath, fp: fp, hashes: map[string]string{"md5": "from cache"}}))
+	md5, err = newObject().Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, "from cache", md5)
+
+	// Changing the file invalidates the cache even if the size and
+	// modification time are restored
+	require.NoError(t, os.WriteFile(localPath, []byte("CONTENT"), 0666))
+	require.NoError(t, os.Chtimes(localPath, when, when))
+	md5, err = newObject().Hash(ctx, hash.MD5)
+	require.NoError(t, err)
+	assert.Equal(t, "45685e95985e20822fb2538a522a5ccf", md5)
+
+	// Removing the file removes it from the cache
+	o = newObject()
+	require.NoError(t, o.Remove(ctx))
+	_, err = o.getCachedHash(hash.MD5, f.hashFingerprint(localPath))
+	assert.ErrorIs(t, err, errHashCacheMiss)
+}
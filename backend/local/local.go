@@ -27,6 +27,8 @@ import (
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/lib/encoder"
 	"github.com/rclone/rclone/lib/file"
+	"github.com/rclone/rclone/lib/kv"
+	"github.com/rclone/rclone/lib/random"
 	"github.com/rclone/rclone/lib/readers"
 	"golang.org/x/text/unicode/norm"
 )
@@ -311,6 +313,29 @@ only useful for reading.
 				Default:  fs.CommaSepList{},
 				Advanced: true,
 			},
+			{
+				Name: "hash_cache",
+				Help: `Keep a persistent cache of file hashes.
+
+Normally rclone reads the whole of a file to find its hash every time
+it is needed, e.g. on every ` + "`rclone check`" + ` or ` + "`rclone sync --checksum`" + `.
+
+If this flag is set, rclone saves the hashes it calculates in a
+database in its cache directory. The next time a hash is needed it is
+read from the database instead, provided the file's device and inode
+numbers, size, modification time and change time (ctime) are all
+unchanged. As ctime is updated by the OS whenever a file is written,
+even a change which keeps the size and restores the modification time
+causes the file to be hashed again.
+
+Hashes of files changed in the last couple of seconds are never saved
+as a change made while hashing might not be noticed.
+
+This is only supported on Unix-like systems as it needs inode numbers.
+It is ignored elsewhere.`,
+				Default:  false,
+				Advanced: true,
+			},
 			{
 				Name:     config.ConfigEncoding,
 				Help:     config.ConfigEncodingHelp,
@@ -340,6 +365,7 @@ type Options struct {
 	Hashes            fs.CommaSepList      `config:"hashes"`
 	Enc               encoder.MultiEncoder `config:"encoding"`
 	NoClone           bool                 `config:"no_clone"`
+	HashCache         bool                 `config:"hash_cache"`
 }
 
 // Fs represents a local filesystem rooted at root
@@ -354,6 +380,7 @@ type Fs struct {
 	warnedMu       sync.Mutex          // used for locking access to 'warned'.
 	warned         map[string]struct{} // whether we have warned about this string
 	xattrSupported atomic.Int32        // whether xattrs are supported
+	hashCache      *kv.DB              // persistent hash cache if enabled
 
 	// do os.Lstat or os.Stat
 	lstat        func(name string) (os.FileInfo, error)
@@ -437,6 +464,9 @@ func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, e
 		// Disable server-side copy when --local-no-clone is set
 		f.features.Copy = nil
 	}
+	if err := f.startHashCache(ctx); err != nil {
+		return nil, err
+	}
 
 	// Check to see if this points to a file
 	fi, err := f.lstat(f.root)
@@ -967,6 +997,7 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 		fs.Debugf(src, "Can't move: %v: trying copy", err)
 		return nil, fs.ErrorCantMove
 	}
+	f.removeCachedHashes(srcObj.path)
 
 	// Set metadata if --metadata is in use
 	err = dstObj.writeMetadata(meta)
@@ -983,6 +1014,81 @@ func (f *Fs) Move(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	return dstObj, nil
 }
 
+// Link src to this remote using a hard link.
+//
+// This is stored with the remote path given, replacing any file
+// which is already there
+//
+// It returns the destination Object and a possible error.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantLink
+func (f *Fs) Link(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok || srcObj.translatedLink {
+		fs.Debugf(src, "Can't link - not same remote type")
+		return nil, fs.ErrorCantLink
+	}
+
+	// Temporary Object under construction
+	dstObj := f.newObject(remote)
+	dstObj.fs.objectMetaMu.RLock()
+	dstObjMode := dstObj.mode
+	dstObj.fs.objectMetaMu.RUnlock()
+
+	// Check it is a file if it exists
+	err := dstObj.lstat()
+	exists := err == nil
+	if os.IsNotExist(err) {
+		// OK
+	} else if err != nil {
+		return nil, err
+	} else if !dstObj.fs.isRegular(dstObjMode) {
+		// It isn't a file
+		return nil, errors.New("can't link file onto non-file")
+	}
+
+	// Create destination
+	err = dstObj.mkdirAll()
+	if err != nil {
+		return nil, err
+	}
+
+	// Link to a temporary name if replacing an existing file so
+	// the swap happens atomically
+	linkPath := dstObj.path
+	if exists {
+		linkPath = dstObj.path + ".rclonelink-" + random.String(8)
+	}
+	err = os.Link(srcObj.path, linkPath)
+	if os.IsNotExist(err) {
+		// race condition, source was deleted in the meantime
+		return nil, err
+	} else if err != nil {
+		// probably linking across file system boundaries or on a
+		// file system without hard links. Copying might still work.
+		fs.Debugf(src, "Can't link: %v: trying copy", err)
+		return nil, fs.ErrorCantLink
+	}
+	if exists {
+		err = os.Rename(linkPath, dstObj.path)
+		if err != nil {
+			_ = os.Remove(linkPath)
+			return nil, fmt.Errorf("link: failed to replace existing file: %w", err)
+		}
+	}
+	f.removeCachedHashes(dstObj.path)
+
+	// Update the info
+	err = dstObj.lstat()
+	if err != nil {
+		return nil, err
+	}
+
+	return dstObj, nil
+}
+
 // DirMove moves src, srcRemote to this remote at dstRemote
 // using server-side move operations.
 //
@@ -1144,6 +1250,24 @@ func (o *Object) Hash(ctx context.Context, r hash.Type) (string, error) {
 	o.fs.objectMetaMu.RUnlock()
 
 	if changed || !hashFound {
+		// Try the persistent hash cache
+		var fp string
+		if o.fs.hashCache != nil && !o.translatedLink {
+			fp = o.fs.hashFingerprint(o.path)
+			if fp != "" {
+				hashValue, err = o.getCachedHash(r, fp)
+				if err == nil {
+					o.fs.objectMetaMu.Lock()
+					if o.hashes == nil || changed {
+						o.hashes = map[hash.Type]string{}
+					}
+					o.hashes[r] = hashValue
+					o.fs.objectMetaMu.Unlock()
+					return hashValue, nil
+				}
+			}
+		}
+
 		var in io.ReadCloser
 
 		if !o.translatedLink {
@@ -1179,6 +1303,9 @@ func (o *Object) Hash(ctx context.Context, r hash.Type) (string, error) {
 			o.hashes[r] = hashValue
 		}
 		o.fs.objectMetaMu.Unlock()
+		if fp != "" && !o.fs.opt.NoCheckUpdated {
+			o.putCachedHashes(hashes, fp)
+		}
 	}
 	return hashValue, nil
 }
@@ -1414,6 +1541,7 @@ func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, op
 
 	// Wipe hashes before update
 	o.clearHashCache()
+	o.fs.removeCachedHashes(o.path)
 
 	var symlinkData bytes.Buffer
 	// If the object is a regular file, create it.
@@ -1606,6 +1734,7 @@ func (o *Object) lstat() error {
 // Remove an object
 func (o *Object) Remove(ctx context.Context) error {
 	o.clearHashCache()
+	o.fs.removeCachedHashes(o.path)
 	return remove(o.path)
 }
 
@@ -1731,11 +1860,13 @@ var (
 	_ fs.Fs              = &Fs{}
 	_ fs.PutStreamer     = &Fs{}
 	_ fs.Mover           = &Fs{}
+	_ fs.Linker          = &Fs{}
 	_ fs.DirMover        = &Fs{}
 	_ fs.Commander       = &Fs{}
 	_ fs.OpenWriterAter  = &Fs{}
 	_ fs.DirSetModTimer  = &Fs{}
 	_ fs.MkdirMetadataer = &Fs{}
+	_ fs.Shutdowner      = &Fs{}
 	_ fs.Object          = &Object{}
 	_ fs.Metadataer      = &Object{}
 	_ fs.SetMetadataer   = &Object{}
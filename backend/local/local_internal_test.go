@@ -280,6 +280,36 @@ func TestHashOnDelete(t *testing.T) {
 	require.Error(t, err)
 }
 
+func TestLink(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	when := time.Now()
+	r.WriteFile("src.txt", "content", when)
+	r.WriteFile("dir/dst.txt", "old", when)
+	f := r.Flocal.(*Fs)
+
+	src, err := f.NewObject(ctx, "src.txt")
+	require.NoError(t, err)
+
+	for _, remote := range []string{"new/dst.txt", "dir/dst.txt"} {
+		dst, err := f.Link(ctx, src, remote)
+		require.NoError(t, err)
+		assert.Equal(t, remote, dst.Remote())
+		assert.Equal(t, int64(7), dst.Size())
+
+		srcInfo, err := os.Stat(src.(*Object).path)
+		require.NoError(t, err)
+		dstInfo, err := os.Stat(dst.(*Object).path)
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(srcInfo, dstInfo), remote)
+	}
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(filepath.Join(r.LocalName, "dir"))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
 func TestMetadata(t *testing.T) {
 	ctx := context.Background()
 	r := fstest.NewRun(t)
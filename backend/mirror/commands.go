@@ -0,0 +1,210 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/walk"
+	"golang.org/x/sync/errgroup"
+)
+
+var commandHelp = []fs.CommandHelp{{
+	Name:  "verify",
+	Short: "Report replicas which are missing or differ.",
+	Long: `Checks the replicas of all the objects, or just the objects in the
+directory given, on every upstream and reports the ones which are
+missing or have a different size, modification time or hash from the
+newest replica.
+
+Usage Example:
+
+    rclone backend verify mirror: [dir]
+
+The hashes are only compared if all the upstreams support a common hash
+type. With the repair option the newest replica is copied over the bad
+ones.
+
+    rclone backend verify mirror: -o repair
+`,
+	Opts: map[string]string{
+		"repair": "Copy the newest replica over the missing and differing ones",
+	},
+}}
+
+// Command the backend to run a named command
+//
+// The command run is name
+// args may be used to read arguments from
+// opts may be used to read optional arguments from
+//
+// The result should be capable of being JSON encoded
+// If it is a string or a []string it will be shown to the user
+// otherwise it will be JSON encoded and shown to the user like that
+func (f *Fs) Command(ctx context.Context, name string, arg []string, opt map[string]string) (out any, err error) {
+	switch name {
+	case "verify":
+		dir := ""
+		if len(arg) > 0 {
+			dir = arg[0]
+		}
+		_, repair := opt["repair"]
+		return f.verify(ctx, dir, repair)
+	default:
+		return nil, fs.ErrorCommandNotFound
+	}
+}
+
+// replicaProblem describes a replica which is missing or differs
+type replicaProblem struct {
+	Remote   string `json:"remote"`
+	Upstream string `json:"upstream"`
+	Problem  string `json:"problem"`
+}
+
+// verifyStats is the output of the verify command
+type verifyStats struct {
+	Objects  int              `json:"objects"`
+	OK       int              `json:"ok"`
+	Repaired int              `json:"repaired"`
+	Problems []replicaProblem `json:"problems"`
+}
+
+// verify checks the replicas of the objects in dir and repairs the
+// bad ones if repair is set
+func (f *Fs) verify(ctx context.Context, dir string, repair bool) (*verifyStats, error) {
+	stats := &verifyStats{
+		Problems: []replicaProblem{},
+	}
+	var mu sync.Mutex
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	err := walk.ListR(ctx, f, dir, true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(*Object)
+			if !ok {
+				continue
+			}
+			g.Go(func() error {
+				problems := o.check(gCtx)
+				var repairErr error
+				if len(problems) > 0 && repair {
+					var numbers []int
+					for i := range problems {
+						numbers = append(numbers, i)
+					}
+					slices.Sort(numbers)
+					repairErr = o.repair(gCtx, numbers)
+					if repairErr != nil {
+						fs.Errorf(o, "Failed to repair: %v", repairErr)
+					}
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				stats.Objects++
+				if len(problems) == 0 {
+					stats.OK++
+				} else if repair && repairErr == nil {
+					stats.Repaired++
+				}
+				for i, problem := range problems {
+					fs.Logf(o, "Replica on upstream %d: %s", i, problem)
+					stats.Problems = append(stats.Problems, replicaProblem{
+						Remote:   o.remote,
+						Upstream: fs.ConfigString(f.upstreams[i]),
+						Problem:  problem,
+					})
+				}
+				return gCtx.Err()
+			})
+		}
+		return nil
+	})
+	if gErr := g.Wait(); err == nil {
+		err = gErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(stats.Problems, func(a, b replicaProblem) int {
+		if c := strings.Compare(a.Remote, b.Remote); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Upstream, b.Upstream)
+	})
+	return stats, nil
+}
+
+// check compares the replicas of o with the primary returning a
+// description of the problem with each one which differs, indexed by
+// upstream
+//
+// If the replicas have the same size and modification time but
+// different hashes the primary is changed to one with the hash most
+// of them have.
+func (o *Object) check(ctx context.Context) map[int]string {
+	problems := map[int]string{}
+	for i, replica := range o.replicas {
+		if replica == nil {
+			var err error
+			replica, err = o.f.upstreams[i].NewObject(ctx, o.remote)
+			if errors.Is(err, fs.ErrorObjectNotFound) {
+				problems[i] = "missing"
+				continue
+			} else if err != nil {
+				problems[i] = fmt.Sprintf("error: %v", err)
+				continue
+			}
+			o.replicas[i] = replica
+		}
+		if replica.Size() != o.primary.Size() {
+			problems[i] = fmt.Sprintf("size %d, want %d", replica.Size(), o.primary.Size())
+		} else if o.differs(ctx, replica) {
+			problems[i] = fmt.Sprintf("modification time %v, want %v", replica.ModTime(ctx), o.primary.ModTime(ctx))
+		}
+	}
+	ht := o.f.hashes.GetOne()
+	if ht == hash.None {
+		return problems
+	}
+
+	// Compare the hashes of the rest choosing the most common
+	hashes := map[int]string{}
+	counts := map[string]int{}
+	for i, replica := range o.replicas {
+		if _, found := problems[i]; found {
+			continue
+		}
+		sum, err := replica.Hash(ctx, ht)
+		if err != nil {
+			problems[i] = fmt.Sprintf("error: %v", err)
+			continue
+		}
+		if sum != "" {
+			hashes[i] = sum
+			counts[sum]++
+		}
+	}
+	primaryHash := ""
+	for i, sum := range hashes {
+		if o.replicas[i] == o.primary {
+			primaryHash = sum
+		}
+	}
+	for i, sum := range hashes {
+		if counts[sum] > counts[primaryHash] {
+			o.primary, primaryHash = o.replicas[i], sum
+		}
+	}
+	for i, sum := range hashes {
+		if sum != primaryHash {
+			problems[i] = fmt.Sprintf("%v %s, want %s", ht, sum, primaryHash)
+		}
+	}
+	return problems
+}
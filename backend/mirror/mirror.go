@@ -0,0 +1,697 @@
+// Package mirror implements a backend which keeps a replica of every
+// object on each of several remotes
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/hash"
+)
+
+// Time an upstream which failed is tried after the others
+const unhealthyTime = time.Minute
+
+// Register with Fs
+func init() {
+	fs.Register(&fs.RegInfo{
+		Name:        "mirror",
+		Description: "Replicate files to several remotes with read failover",
+		NewFs:       NewFs,
+		CommandHelp: commandHelp,
+		Options: []fs.Option{{
+			Name: "upstreams",
+			Help: `List of space separated upstreams.
+
+Every object is written to all of them and read from the first one
+which is working, so list the fastest or cheapest to read from first.
+
+Embedded spaces can be added using quotes, e.g.
+
+    "remote1:dir" "remote2:my dir" remote3:dir
+`,
+			Required: true,
+		}, {
+			Name: "write_quorum",
+			Help: `Number of upstreams a write must succeed on.
+
+If a file is written to fewer upstreams than this the write fails,
+otherwise the upstreams which failed are repaired later. 0 means all
+the upstreams.`,
+			Default: 0,
+		}, {
+			Name: "repair",
+			Help: `Repair divergent replicas in the background.
+
+When objects are found to be missing from an upstream or to have a
+different size or modification time from the newest replica, the
+newest replica is copied over them in the background.
+
+Repairs which haven't finished when rclone exits are abandoned and
+will be tried again the next time the object is listed.`,
+			Default:  true,
+			Advanced: true,
+		}},
+	})
+}
+
+// Options defines the configuration for this backend
+type Options struct {
+	Upstreams   fs.SpaceSepList `config:"upstreams"`
+	WriteQuorum int             `config:"write_quorum"`
+	Repair      bool            `config:"repair"`
+}
+
+// Fs represents the same objects replicated on each upstream
+type Fs struct {
+	name      string
+	root      string
+	opt       Options
+	features  *fs.Features
+	upstreams []fs.Fs
+	quorum    int            // writes must succeed on this many upstreams
+	hashes    hash.Set       // hashes supported by all the upstreams
+	unhealthy []atomic.Int64 // UnixNano time each upstream failed until
+	repairs   repairer
+}
+
+// NewFs constructs an Fs from the path, container:path
+func NewFs(ctx context.Context, name, root string, m configmap.Mapper) (fs.Fs, error) {
+	opt := new(Options)
+	err := configstruct.Set(m, opt)
+	if err != nil {
+		return nil, err
+	}
+	n := len(opt.Upstreams)
+	if n == 0 {
+		return nil, errors.New("mirror can't point to an empty upstream - check the value of the upstreams setting")
+	}
+	if opt.WriteQuorum < 0 || opt.WriteQuorum > n {
+		return nil, fmt.Errorf("write_quorum must be between 0 and %d", n)
+	}
+	for _, u := range opt.Upstreams {
+		if strings.HasPrefix(u, name+":") {
+			return nil, errors.New("can't point mirror remote at itself - check the value of the upstreams setting")
+		}
+	}
+	root = strings.Trim(root, "/")
+	f := &Fs{
+		name:      name,
+		root:      root,
+		opt:       *opt,
+		quorum:    opt.WriteQuorum,
+		unhealthy: make([]atomic.Int64, n),
+	}
+	if f.quorum == 0 {
+		f.quorum = n
+	}
+	var isFile bool
+	f.upstreams, isFile, err = newUpstreams(ctx, opt.Upstreams, root)
+	if err != nil {
+		return nil, err
+	}
+	// If any upstream has a file at root use its parent on all of them
+	if isFile {
+		f.root = path.Dir(root)
+		if f.root == "." {
+			f.root = ""
+		}
+		f.upstreams, _, err = newUpstreams(ctx, opt.Upstreams, f.root)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, u := range f.upstreams {
+		cache.Pin(u)
+	}
+	runtime.SetFinalizer(f, func(f *Fs) {
+		for _, u := range f.upstreams {
+			cache.Unpin(u)
+		}
+	})
+	f.hashes = hash.Supported()
+	for _, u := range f.upstreams {
+		f.hashes = f.hashes.Overlap(u.Hashes())
+	}
+	f.repairs.init(ctx)
+	f.features = (&fs.Features{
+		CaseInsensitive:         true,
+		DuplicateFiles:          false,
+		ReadMimeType:            true,
+		WriteMimeType:           true,
+		CanHaveEmptyDirectories: true,
+		BucketBased:             true,
+	}).Fill(ctx, f)
+	for _, u := range f.upstreams {
+		f.features = f.features.Mask(ctx, u)
+	}
+	// We always have background tasks to shut down
+	f.features.Shutdown = f.Shutdown
+	if isFile {
+		return f, fs.ErrorIsFile
+	}
+	return f, nil
+}
+
+// newUpstreams makes the upstream Fs for root returning whether any
+// of them found a file there
+func newUpstreams(ctx context.Context, remotes []string, root string) (upstreams []fs.Fs, isFile bool, err error) {
+	upstreams = make([]fs.Fs, len(remotes))
+	errs := make([]error, len(remotes))
+	multithread(len(remotes), func(i int) {
+		remote := fspath.JoinRootPath(remotes[i], root)
+		upstreams[i], errs[i] = cache.Get(ctx, remote)
+		if errs[i] != nil && errs[i] != fs.ErrorIsFile {
+			errs[i] = fmt.Errorf("failed to make upstream %q: %w", remote, errs[i])
+		}
+	})
+	for i, err := range errs {
+		if err == fs.ErrorIsFile {
+			isFile, errs[i] = true, nil
+		}
+	}
+	return upstreams, isFile, errors.Join(errs...)
+}
+
+// multithread runs fn for each of 0..num-1 concurrently
+func multithread(num int, fn func(int)) {
+	var wg sync.WaitGroup
+	for i := range num {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn(i)
+		}()
+	}
+	wg.Wait()
+}
+
+// quorumErr returns an error if fewer than quorum of errs are nil,
+// logging the errors otherwise
+func (f *Fs) quorumErr(what string, errs []error) error {
+	ok := 0
+	for i, err := range errs {
+		if err == nil {
+			ok++
+		} else {
+			errs[i] = fmt.Errorf("upstream %d: %w", i, err)
+		}
+	}
+	if ok < f.quorum {
+		return fmt.Errorf("%s succeeded on %d upstreams, need %d: %w", what, ok, f.quorum, errors.Join(errs...))
+	}
+	for _, err := range errs {
+		if err != nil {
+			fs.Errorf(f, "%s failed: %v", what, err)
+		}
+	}
+	return nil
+}
+
+// markUnhealthy notes that upstream i failed
+func (f *Fs) markUnhealthy(i int) {
+	f.unhealthy[i].Store(time.Now().Add(unhealthyTime).UnixNano())
+}
+
+// healthy returns whether upstream i hasn't failed recently
+func (f *Fs) healthy(i int) bool {
+	return time.Now().UnixNano() >= f.unhealthy[i].Load()
+}
+
+// Name of the remote (as passed into NewFs)
+func (f *Fs) Name() string {
+	return f.name
+}
+
+// Root of the remote (as passed into NewFs)
+func (f *Fs) Root() string {
+	return f.root
+}
+
+// String converts this Fs to a string
+func (f *Fs) String() string {
+	return fmt.Sprintf("mirror root '%s'", f.root)
+}
+
+// Features returns the optional features of this Fs
+func (f *Fs) Features() *fs.Features {
+	return f.features
+}
+
+// Precision is the greatest precision of all the upstreams
+func (f *Fs) Precision() time.Duration {
+	var greatestPrecision time.Duration
+	for _, u := range f.upstreams {
+		greatestPrecision = max(greatestPrecision, u.Precision())
+	}
+	return greatestPrecision
+}
+
+// Hashes returns the hashes supported by all the upstreams
+func (f *Fs) Hashes() hash.Set {
+	return f.hashes
+}
+
+// List the objects and directories in dir into entries.  The
+// entries can be returned in any order but should be for a
+// complete directory.
+//
+// dir should be "" to list the root, and should not have
+// trailing slashes.
+//
+// This should return ErrDirNotFound if the directory isn't
+// found.
+//
+// The listing succeeds if any of the upstreams can be listed. If they
+// all can, objects with divergent replicas are queued for repair.
+func (f *Fs) List(ctx context.Context, dir string) (entries fs.DirEntries, err error) {
+	lists := make([]fs.DirEntries, len(f.upstreams))
+	errs := make([]error, len(f.upstreams))
+	multithread(len(f.upstreams), func(i int) {
+		lists[i], errs[i] = f.upstreams[i].List(ctx, dir)
+	})
+	found, failed := 0, 0
+	var lastErr error
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			found++
+		case errors.Is(err, fs.ErrorDirNotFound):
+		default:
+			failed++
+			lastErr = err
+			fs.Debugf(f, "Failed to list %q on upstream %d: %v", dir, i, err)
+		}
+	}
+	if found == 0 {
+		if failed > 0 {
+			return nil, lastErr
+		}
+		return nil, fs.ErrorDirNotFound
+	}
+
+	dirs := map[string]bool{}
+	replicas := map[string][]fs.Object{}
+	for i, list := range lists {
+		for _, entry := range list {
+			switch x := entry.(type) {
+			case fs.Directory:
+				if !dirs[x.Remote()] {
+					dirs[x.Remote()] = true
+					entries = append(entries, fs.NewDir(x.Remote(), x.ModTime(ctx)))
+				}
+			case fs.Object:
+				if replicas[x.Remote()] == nil {
+					replicas[x.Remote()] = make([]fs.Object, len(f.upstreams))
+				}
+				replicas[x.Remote()][i] = x
+			}
+		}
+	}
+	for remote, objs := range replicas {
+		o := f.newObject(remote, objs)
+		if failed == 0 && len(o.divergent(ctx)) > 0 {
+			f.queueRepair(o)
+		}
+		entries = append(entries, o)
+	}
+	slices.SortFunc(entries, func(a, b fs.DirEntry) int {
+		return strings.Compare(a.Remote(), b.Remote())
+	})
+	return entries, nil
+}
+
+// NewObject finds the Object at remote.  If it can't be found
+// it returns the error fs.ErrorObjectNotFound.
+func (f *Fs) NewObject(ctx context.Context, remote string) (fs.Object, error) {
+	replicas := make([]fs.Object, len(f.upstreams))
+	errs := make([]error, len(f.upstreams))
+	multithread(len(f.upstreams), func(i int) {
+		replicas[i], errs[i] = f.upstreams[i].NewObject(ctx, remote)
+	})
+	found, failed := 0, 0
+	var lastErr error
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			found++
+		case errors.Is(err, fs.ErrorObjectNotFound):
+			replicas[i] = nil
+		default:
+			replicas[i] = nil
+			failed++
+			lastErr = err
+			fs.Debugf(f, "Failed to find %q on upstream %d: %v", remote, i, err)
+		}
+	}
+	if found == 0 {
+		if failed > 0 {
+			return nil, lastErr
+		}
+		return nil, fs.ErrorObjectNotFound
+	}
+	o := f.newObject(remote, replicas)
+	if failed == 0 && len(o.divergent(ctx)) > 0 {
+		f.queueRepair(o)
+	}
+	return o, nil
+}
+
+// tee copies in to n readers returning them and a channel which gets
+// the result of reading in when it has finished.
+//
+// Each reader must be read to the end for the copy to finish.
+func tee(n int, in io.Reader) ([]io.Reader, <-chan error) {
+	readers := make([]io.Reader, n)
+	writers := make([]io.Writer, n)
+	pipes := make([]*io.PipeWriter, n)
+	for i := range readers {
+		pr, pw := io.Pipe()
+		readers[i], writers[i], pipes[i] = pr, pw, pw
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.MultiWriter(writers...), in)
+		for _, pw := range pipes {
+			_ = pw.CloseWithError(err)
+		}
+		errChan <- err
+	}()
+	return readers, errChan
+}
+
+// putAll writes in to every upstream with put and returns the
+// replicas written, nil for the upstreams which failed.
+//
+// It fails if fewer than the write quorum succeed.
+func (f *Fs) putAll(in io.Reader, put func(i int, in io.Reader) (fs.Object, error)) ([]fs.Object, error) {
+	readers, errChan := tee(len(f.upstreams), in)
+	replicas := make([]fs.Object, len(f.upstreams))
+	errs := make([]error, len(f.upstreams))
+	multithread(len(f.upstreams), func(i int) {
+		replicas[i], errs[i] = put(i, readers[i])
+		if errs[i] != nil {
+			replicas[i] = nil
+			f.markUnhealthy(i)
+		}
+		// Drain the input so the other uploads can continue
+		_, _ = io.Copy(io.Discard, readers[i])
+	})
+	if err := <-errChan; err != nil {
+		return nil, err
+	}
+	err := f.quorumErr("write", errs)
+	if err != nil {
+		return nil, err
+	}
+	return replicas, nil
+}
+
+// put an object on all the upstreams, streaming it if stream is set
+func (f *Fs) put(ctx context.Context, in io.Reader, src fs.ObjectInfo, stream bool, options ...fs.OpenOption) (fs.Object, error) {
+	replicas, err := f.putAll(in, func(i int, in io.Reader) (fs.Object, error) {
+		u := f.upstreams[i]
+		if stream {
+			return u.Features().PutStream(ctx, in, src, options...)
+		}
+		return u.Put(ctx, in, src, options...)
+	})
+	if err != nil {
+		return nil, err
+	}
+	o := f.newObject(src.Remote(), replicas)
+	if slices.Contains(replicas, nil) {
+		f.queueRepair(o)
+	}
+	return o, nil
+}
+
+// Put in to the remote path with the modTime given of the given size
+//
+// The object is written to all the upstreams at once and the write
+// succeeds if it succeeds on at least write_quorum of them.
+func (f *Fs) Put(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, false, options...)
+}
+
+// PutStream uploads to the remote path with the modTime given of indeterminate size
+func (f *Fs) PutStream(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) (fs.Object, error) {
+	return f.put(ctx, in, src, true, options...)
+}
+
+// Mkdir makes the directory on all the upstreams
+func (f *Fs) Mkdir(ctx context.Context, dir string) error {
+	errs := make([]error, len(f.upstreams))
+	multithread(len(f.upstreams), func(i int) {
+		errs[i] = f.upstreams[i].Mkdir(ctx, dir)
+	})
+	return f.quorumErr("mkdir", errs)
+}
+
+// Rmdir removes the directory from all the upstreams
+//
+// Return an error if it doesn't exist or isn't empty
+func (f *Fs) Rmdir(ctx context.Context, dir string) error {
+	errs := make([]error, len(f.upstreams))
+	multithread(len(f.upstreams), func(i int) {
+		errs[i] = f.upstreams[i].Rmdir(ctx, dir)
+	})
+	notFound := 0
+	for i, err := range errs {
+		if errors.Is(err, fs.ErrorDirNotFound) {
+			notFound++
+			errs[i] = nil
+		} else if err != nil {
+			errs[i] = fmt.Errorf("upstream %d: %w", i, err)
+		}
+	}
+	if notFound == len(f.upstreams) {
+		return fs.ErrorDirNotFound
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown the backend, waiting for the background repairs
+func (f *Fs) Shutdown(ctx context.Context) error {
+	return f.repairs.wait(ctx)
+}
+
+// Object describes an object replicated on the upstreams
+type Object struct {
+	f        *Fs
+	remote   string
+	replicas []fs.Object // replica on upstream i or nil if missing
+	primary  fs.Object   // the newest replica
+}
+
+// newObject makes an Object from the replicas found
+//
+// The primary replica is the newest, or if several are the same age
+// the one which most of the others agree with.
+func (f *Fs) newObject(remote string, replicas []fs.Object) *Object {
+	o := &Object{
+		f:        f,
+		remote:   remote,
+		replicas: replicas,
+	}
+	ctx := context.Background()
+	agreeing := func(replica fs.Object) (n int) {
+		for _, other := range replicas {
+			if other != nil && other.Size() == replica.Size() && f.sameModTime(ctx, other, replica) {
+				n++
+			}
+		}
+		return n
+	}
+	bestAgreeing := 0
+	for _, replica := range replicas {
+		if replica == nil {
+			continue
+		}
+		if o.primary == nil || replica.ModTime(ctx).After(o.primary.ModTime(ctx)) && !f.sameModTime(ctx, replica, o.primary) {
+			o.primary, bestAgreeing = replica, agreeing(replica)
+		} else if f.sameModTime(ctx, replica, o.primary) {
+			if n := agreeing(replica); n > bestAgreeing {
+				o.primary, bestAgreeing = replica, n
+			}
+		}
+	}
+	return o
+}
+
+// sameModTime returns whether a and b have the same modification
+// time within the precision of the upstreams, true if they don't
+// support modification times
+func (f *Fs) sameModTime(ctx context.Context, a, b fs.Object) bool {
+	window := fs.GetModifyWindow(ctx, f)
+	if window == fs.ModTimeNotSupported {
+		return true
+	}
+	dt := a.ModTime(ctx).Sub(b.ModTime(ctx))
+	return dt <= window && dt >= -window
+}
+
+// differs returns whether replica differs from the primary replica
+// by size or modification time
+func (o *Object) differs(ctx context.Context, replica fs.Object) bool {
+	return replica == nil || replica.Size() != o.primary.Size() || !o.f.sameModTime(ctx, replica, o.primary)
+}
+
+// divergent returns the numbers of the upstreams whose replica is
+// missing or differs from the primary
+func (o *Object) divergent(ctx context.Context) (numbers []int) {
+	for i, replica := range o.replicas {
+		if o.differs(ctx, replica) {
+			numbers = append(numbers, i)
+		}
+	}
+	return numbers
+}
+
+// Fs returns read only access to the Fs that this object is part of
+func (o *Object) Fs() fs.Info {
+	return o.f
+}
+
+// Return a string version
+func (o *Object) String() string {
+	if o == nil {
+		return "<nil>"
+	}
+	return o.remote
+}
+
+// Remote returns the remote path
+func (o *Object) Remote() string {
+	return o.remote
+}
+
+// Size returns the size of the newest replica
+func (o *Object) Size() int64 {
+	return o.primary.Size()
+}
+
+// ModTime returns the modification time of the newest replica
+func (o *Object) ModTime(ctx context.Context) time.Time {
+	return o.primary.ModTime(ctx)
+}
+
+// Hash returns the hash of the newest replica
+func (o *Object) Hash(ctx context.Context, ht hash.Type) (string, error) {
+	return o.primary.Hash(ctx, ht)
+}
+
+// Storable returns whether the object is storable
+func (o *Object) Storable() bool {
+	return o.primary.Storable()
+}
+
+// MimeType returns the content type of the newest replica if known
+func (o *Object) MimeType(ctx context.Context) string {
+	if do, ok := o.primary.(fs.MimeTyper); ok {
+		return do.MimeType(ctx)
+	}
+	return ""
+}
+
+// SetModTime sets the modification time of all the replicas
+func (o *Object) SetModTime(ctx context.Context, modTime time.Time) error {
+	errs := make([]error, len(o.replicas))
+	multithread(len(o.replicas), func(i int) {
+		if o.replicas[i] == nil {
+			errs[i] = fs.ErrorObjectNotFound
+			return
+		}
+		errs[i] = o.replicas[i].SetModTime(ctx, modTime)
+	})
+	return o.f.quorumErr("set modification time", errs)
+}
+
+// Open an object for read
+//
+// The replicas which are the same as the newest are tried in the
+// order of the upstreams, trying the upstreams which have failed
+// recently last.
+func (o *Object) Open(ctx context.Context, options ...fs.OpenOption) (in io.ReadCloser, err error) {
+	var healthy, unhealthy []int
+	for i, replica := range o.replicas {
+		if o.differs(ctx, replica) {
+			continue
+		}
+		if o.f.healthy(i) {
+			healthy = append(healthy, i)
+		} else {
+			unhealthy = append(unhealthy, i)
+		}
+	}
+	for _, i := range append(healthy, unhealthy...) {
+		in, err = o.replicas[i].Open(ctx, options...)
+		if err == nil {
+			return in, nil
+		}
+		fs.Debugf(o, "Failed to open replica on upstream %d: %v", i, err)
+		o.f.markUnhealthy(i)
+	}
+	return nil, err
+}
+
+// Update the object with the contents of the io.Reader, modTime and size
+func (o *Object) Update(ctx context.Context, in io.Reader, src fs.ObjectInfo, options ...fs.OpenOption) error {
+	src = fs.NewOverrideRemote(src, o.remote)
+	replicas, err := o.f.putAll(in, func(i int, in io.Reader) (fs.Object, error) {
+		if replica := o.replicas[i]; replica != nil {
+			return replica, replica.Update(ctx, in, src, options...)
+		}
+		return o.f.upstreams[i].Put(ctx, in, src, options...)
+	})
+	if err != nil {
+		return err
+	}
+	*o = *o.f.newObject(o.remote, replicas)
+	if slices.Contains(replicas, nil) {
+		o.f.queueRepair(o)
+	}
+	return nil
+}
+
+// Remove the replicas of the object
+//
+// This fails unless all the replicas are removed, otherwise a repair
+// could bring the object back.
+func (o *Object) Remove(ctx context.Context) error {
+	errs := make([]error, len(o.replicas))
+	multithread(len(o.replicas), func(i int) {
+		if o.replicas[i] == nil {
+			return
+		}
+		err := o.replicas[i].Remove(ctx)
+		if err != nil {
+			errs[i] = fmt.Errorf("upstream %d: %w", i, err)
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// Check the interfaces are satisfied
+var (
+	_ fs.Fs          = (*Fs)(nil)
+	_ fs.PutStreamer = (*Fs)(nil)
+	_ fs.Commander   = (*Fs)(nil)
+	_ fs.Shutdowner  = (*Fs)(nil)
+	_ fs.Object      = (*Object)(nil)
+	_ fs.MimeTyper   = (*Object)(nil)
+)
@@ -0,0 +1,160 @@
+package mirror
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestFs makes a mirror of upstreams with the options in m
+func newTestFs(t *testing.T, upstreams []string, m configmap.Simple) *Fs {
+	m["type"] = "mirror"
+	m["upstreams"] = strings.Join(upstreams, " ")
+	f, err := NewFs(context.Background(), "TestMirror", "", m)
+	require.NoError(t, err)
+	return f.(*Fs)
+}
+
+// put contents to remote in f
+func put(ctx context.Context, f fs.Fs, remote, contents string) (fs.Object, error) {
+	src := object.NewStaticObjectInfo(remote, fstest.Time("2001-02-03T04:05:06.499999999Z"), int64(len(contents)), true, nil, nil)
+	return f.Put(ctx, strings.NewReader(contents), src)
+}
+
+// read remote from f
+func read(t *testing.T, ctx context.Context, f fs.Fs, remote string) string {
+	o, err := f.NewObject(ctx, remote)
+	require.NoError(t, err)
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	return string(data)
+}
+
+func TestWriteQuorum(t *testing.T) {
+	fstest.Initialise()
+	ctx := context.Background()
+	notDir := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(notDir, nil, 0666))
+	dirs := []string{t.TempDir(), t.TempDir(), filepath.Join(notDir, "broken")}
+
+	// All the upstreams are needed by default
+	f := newTestFs(t, dirs, configmap.Simple{})
+	_, err := put(ctx, f, "file.txt", "hello")
+	assert.ErrorContains(t, err, "succeeded on 2 upstreams, need 3")
+
+	f = newTestFs(t, dirs, configmap.Simple{"write_quorum": "2", "repair": "false"})
+	o, err := put(ctx, f, "file.txt", "hello")
+	require.NoError(t, err)
+	assert.Nil(t, o.(*Object).replicas[2])
+	assert.False(t, f.healthy(2))
+	assert.Equal(t, "hello", read(t, ctx, f, "file.txt"))
+}
+
+func TestReadFailover(t *testing.T) {
+	fstest.Initialise()
+	ctx := context.Background()
+	dirs := []string{t.TempDir(), t.TempDir()}
+	f := newTestFs(t, dirs, configmap.Simple{"repair": "false"})
+	_, err := put(ctx, f, "dir/file.txt", "hello")
+	require.NoError(t, err)
+	o, err := f.NewObject(ctx, "dir/file.txt")
+	require.NoError(t, err)
+
+	// Lose the replica on the first upstream after finding it
+	require.NoError(t, os.Remove(filepath.Join(dirs[0], "dir", "file.txt")))
+	in, err := o.Open(ctx)
+	require.NoError(t, err)
+	data, err := io.ReadAll(in)
+	require.NoError(t, err)
+	require.NoError(t, in.Close())
+	assert.Equal(t, "hello", string(data))
+	assert.False(t, f.healthy(0))
+	assert.True(t, f.healthy(1))
+}
+
+func TestVerifyAndRepair(t *testing.T) {
+	fstest.Initialise()
+	ctx := context.Background()
+	dirs := []string{t.TempDir(), t.TempDir(), t.TempDir()}
+	f := newTestFs(t, dirs, configmap.Simple{"repair": "false"})
+	for _, remote := range []string{"a.txt", "dir/b.txt", "dir/c.txt"} {
+		_, err := put(ctx, f, remote, "contents of "+remote)
+		require.NoError(t, err)
+	}
+
+	// Lose one replica, truncate another and corrupt a third
+	require.NoError(t, os.Remove(filepath.Join(dirs[1], "a.txt")))
+	b := filepath.Join(dirs[0], "dir", "b.txt")
+	fi, err := os.Stat(b)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(b, 3))
+	require.NoError(t, os.Chtimes(b, fi.ModTime(), fi.ModTime()))
+	c := filepath.Join(dirs[0], "dir", "c.txt")
+	require.NoError(t, os.WriteFile(c, []byte("CONTENTS of dir/c.txt"), 0666))
+	require.NoError(t, os.Chtimes(c, fi.ModTime(), fi.ModTime()))
+
+	stats, err := f.verify(ctx, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, 3, stats.Objects)
+	assert.Equal(t, 0, stats.OK)
+	require.Len(t, stats.Problems, 3)
+	assert.Equal(t, "a.txt", stats.Problems[0].Remote)
+	assert.Equal(t, "missing", stats.Problems[0].Problem)
+	assert.Contains(t, stats.Problems[1].Problem, "size 3, want 21")
+	assert.Contains(t, stats.Problems[2].Problem, "md5")
+
+	stats, err = f.verify(ctx, "dir", true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.Objects)
+	assert.Equal(t, 2, stats.Repaired)
+	stats, err = f.verify(ctx, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.OK)
+	assert.Len(t, stats.Problems, 1)
+	data, err := os.ReadFile(c)
+	require.NoError(t, err)
+	assert.Equal(t, "contents of dir/c.txt", string(data))
+}
+
+func TestBackgroundRepair(t *testing.T) {
+	fstest.Initialise()
+	ctx := context.Background()
+	dirs := []string{t.TempDir(), t.TempDir()}
+	f := newTestFs(t, dirs, configmap.Simple{"repair": "true"})
+	_, err := put(ctx, f, "dir/file.txt", "hello")
+	require.NoError(t, err)
+
+	// Update one replica directly then list to find it
+	p := filepath.Join(dirs[1], "dir", "file.txt")
+	require.NoError(t, os.WriteFile(p, []byte("hello again"), 0666))
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(p, later, later))
+	require.NoError(t, os.Remove(filepath.Join(dirs[0], "dir", "file.txt")))
+	entries, err := f.List(ctx, "dir")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(len("hello again")), entries[0].Size())
+	require.NoError(t, f.Shutdown(ctx))
+
+	data, err := os.ReadFile(filepath.Join(dirs[0], "dir", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello again", string(data))
+	o, err := f.NewObject(ctx, "dir/file.txt")
+	require.NoError(t, err)
+	assert.Len(t, o.(*Object).divergent(ctx), 0)
+}
@@ -0,0 +1,114 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+// Maximum number of background repairs running at once
+const maxRepairs = 4
+
+// repairer runs the background repairs
+type repairer struct {
+	ctx     context.Context
+	mu      sync.Mutex
+	pending map[string]bool // remotes being repaired
+	wg      sync.WaitGroup
+	tokens  chan struct{}
+}
+
+// init the repairer copying the config from ctx
+func (r *repairer) init(ctx context.Context) {
+	r.ctx = fs.CopyConfig(context.Background(), ctx)
+	r.pending = map[string]bool{}
+	r.tokens = make(chan struct{}, maxRepairs)
+}
+
+// wait for the background repairs to finish
+func (r *repairer) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// queueRepair repairs the divergent replicas of o in the background
+// if repairs are enabled and it isn't being repaired already
+func (f *Fs) queueRepair(o *Object) {
+	if !f.opt.Repair {
+		return
+	}
+	r := &f.repairs
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending[o.remote] {
+		return
+	}
+	r.pending[o.remote] = true
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		r.tokens <- struct{}{}
+		numbers := o.divergent(r.ctx)
+		fs.Infof(o, "Repairing replicas on upstreams %v in the background", numbers)
+		err := o.repair(r.ctx, numbers)
+		if err != nil {
+			fs.Errorf(o, "Background repair failed: %v", err)
+		}
+		<-r.tokens
+		r.mu.Lock()
+		delete(r.pending, o.remote)
+		r.mu.Unlock()
+	}()
+}
+
+// sameHash returns whether a and b have the same hash of type ht,
+// false if either can't be read
+func sameHash(ctx context.Context, ht hash.Type, a, b fs.Object) bool {
+	if ht == hash.None {
+		return false
+	}
+	aHash, errA := a.Hash(ctx, ht)
+	bHash, errB := b.Hash(ctx, ht)
+	return errA == nil && errB == nil && aHash != "" && aHash == bHash
+}
+
+// repair copies the primary replica over the replicas on the
+// upstreams numbered
+//
+// If a replica has the same contents as the primary only its
+// modification time is set.
+func (o *Object) repair(ctx context.Context, numbers []int) error {
+	var errs []error
+	for _, i := range numbers {
+		replica := o.replicas[i]
+		if replica == o.primary {
+			continue
+		}
+		if replica != nil && replica.Size() == o.primary.Size() && sameHash(ctx, o.f.hashes.GetOne(), replica, o.primary) {
+			err := replica.SetModTime(ctx, o.primary.ModTime(ctx))
+			if err == nil {
+				continue
+			}
+			fs.Debugf(o, "Failed to set modification time on upstream %d, copying instead: %v", i, err)
+		}
+		_, err := operations.Copy(ctx, o.f.upstreams[i], replica, o.remote, o.primary)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("upstream %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -6464,6 +6464,153 @@ func (f *Fs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectIn
 	return info, chunkWriter, err
 }
 
+// s3ResumeState is the state of a multipart upload returned by
+// ResumeState
+type s3ResumeState struct {
+	UploadID  string         `json:"uploadId"`
+	ChunkSize int64          `json:"chunkSize"`
+	Parts     []s3ResumePart `json:"parts"`
+}
+
+// s3ResumePart is a part of a multipart upload which has been written
+type s3ResumePart struct {
+	PartNumber int32  `json:"partNumber"`
+	ETag       string `json:"etag"`
+	MD5        string `json:"md5"`
+}
+
+// ResumeChunkWriter carries on with the multipart upload described by
+// state as returned by ResumeState
+//
+// Parts which are no longer on the server are uploaded again.
+func (f *Fs) ResumeChunkWriter(ctx context.Context, remote string, src fs.ObjectInfo, state string, options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, err error) {
+	var rs s3ResumeState
+	err = json.Unmarshal([]byte(state), &rs)
+	if err != nil {
+		return info, nil, fmt.Errorf("failed to decode multipart upload state: %w", err)
+	}
+	if rs.UploadID == "" || rs.ChunkSize <= 0 {
+		return info, nil, errors.New("invalid multipart upload state")
+	}
+
+	// Temporary Object under construction
+	o := &Object{
+		fs:     f,
+		remote: remote,
+	}
+	ui, err := o.prepareUpload(ctx, src, options, false)
+	if err != nil {
+		return info, nil, fmt.Errorf("failed to prepare upload: %w", err)
+	}
+	var mReq s3.CreateMultipartUploadInput
+	setFrom_s3CreateMultipartUploadInput_s3PutObjectInput(&mReq, ui.req)
+
+	// Find the parts the server has for the upload
+	uploaded := map[int32]string{}
+	var partNumberMarker *string
+	for {
+		req := s3.ListPartsInput{
+			Bucket:               ui.req.Bucket,
+			Key:                  ui.req.Key,
+			UploadId:             &rs.UploadID,
+			PartNumberMarker:     partNumberMarker,
+			RequestPayer:         mReq.RequestPayer,
+			SSECustomerAlgorithm: mReq.SSECustomerAlgorithm,
+			SSECustomerKey:       mReq.SSECustomerKey,
+			SSECustomerKeyMD5:    mReq.SSECustomerKeyMD5,
+		}
+		var resp *s3.ListPartsOutput
+		err = f.pacer.Call(func() (bool, error) {
+			resp, err = f.c.ListParts(ctx, &req)
+			return f.shouldRetry(ctx, err)
+		})
+		if err != nil {
+			return info, nil, fmt.Errorf("failed to list parts of multipart upload %q: %w", rs.UploadID, err)
+		}
+		for _, part := range resp.Parts {
+			if part.PartNumber != nil && part.ETag != nil {
+				uploaded[*part.PartNumber] = *part.ETag
+			}
+		}
+		if !deref(resp.IsTruncated) {
+			break
+		}
+		partNumberMarker = resp.NextPartNumberMarker
+	}
+
+	chunkWriter := &s3ChunkWriter{
+		chunkSize:            rs.ChunkSize,
+		size:                 src.Size(),
+		f:                    f,
+		bucket:               ui.req.Bucket,
+		key:                  ui.req.Key,
+		uploadID:             aws.String(rs.UploadID),
+		multiPartUploadInput: &mReq,
+		completedParts:       make([]types.CompletedPart, 0, len(rs.Parts)),
+		ui:                   ui,
+		o:                    o,
+	}
+	for _, part := range rs.Parts {
+		md5binary, err := hex.DecodeString(part.MD5)
+		if err != nil || len(md5binary) != md5.Size || part.PartNumber < 1 {
+			return info, nil, fmt.Errorf("invalid part %d in multipart upload state", part.PartNumber)
+		}
+		if eTag, ok := uploaded[part.PartNumber]; !ok || eTag != part.ETag {
+			fs.Debugf(o, "multipart upload %q: part %d will be uploaded again", rs.UploadID, part.PartNumber)
+			continue
+		}
+		chunkWriter.addCompletedPart(aws.Int32(part.PartNumber), aws.String(part.ETag))
+		chunkWriter.addMd5(&md5binary, int64(part.PartNumber-1))
+	}
+	info = fs.ChunkWriterInfo{
+		ChunkSize:         rs.ChunkSize,
+		Concurrency:       o.fs.opt.UploadConcurrency,
+		LeavePartsOnError: o.fs.opt.LeavePartsOnError,
+	}
+	fs.Debugf(o, "open chunk writer: resumed multipart upload %v with %d parts", rs.UploadID, len(chunkWriter.completedParts))
+	return info, chunkWriter, nil
+}
+
+// ResumeState returns the state of the multipart upload so it can be
+// carried on with by ResumeChunkWriter
+func (w *s3ChunkWriter) ResumeState() (string, error) {
+	w.completedPartsMu.Lock()
+	defer w.completedPartsMu.Unlock()
+	w.md5sMu.Lock()
+	defer w.md5sMu.Unlock()
+	rs := s3ResumeState{
+		UploadID:  *w.uploadID,
+		ChunkSize: w.chunkSize,
+		Parts:     make([]s3ResumePart, 0, len(w.completedParts)),
+	}
+	for _, part := range w.completedParts {
+		start := int(*part.PartNumber-1) * md5.Size
+		end := start + md5.Size
+		if end > len(w.md5s) {
+			continue
+		}
+		rs.Parts = append(rs.Parts, s3ResumePart{
+			PartNumber: *part.PartNumber,
+			ETag:       deref(part.ETag),
+			MD5:        hex.EncodeToString(w.md5s[start:end]),
+		})
+	}
+	state, err := json.Marshal(&rs)
+	return string(state), err
+}
+
+// ChunkWritten returns true if chunkNumber has been written already
+func (w *s3ChunkWriter) ChunkWritten(chunkNumber int) bool {
+	w.completedPartsMu.Lock()
+	defer w.completedPartsMu.Unlock()
+	for _, part := range w.completedParts {
+		if int(*part.PartNumber) == chunkNumber+1 {
+			return true
+		}
+	}
+	return false
+}
+
 // add a part number and etag to the completed parts
 func (w *s3ChunkWriter) addCompletedPart(partNum *int32, eTag *string) {
 	w.completedPartsMu.Lock()
@@ -7089,18 +7236,20 @@ func (o *Object) Metadata(ctx context.Context) (metadata fs.Metadata, err error)
 
 // Check the interfaces are satisfied
 var (
-	_ fs.Fs              = &Fs{}
-	_ fs.Purger          = &Fs{}
-	_ fs.Copier          = &Fs{}
-	_ fs.PutStreamer     = &Fs{}
-	_ fs.ListRer         = &Fs{}
-	_ fs.ListPer         = &Fs{}
-	_ fs.Commander       = &Fs{}
-	_ fs.CleanUpper      = &Fs{}
-	_ fs.OpenChunkWriter = &Fs{}
-	_ fs.Object          = &Object{}
-	_ fs.MimeTyper       = &Object{}
-	_ fs.GetTierer       = &Object{}
-	_ fs.SetTierer       = &Object{}
-	_ fs.Metadataer      = &Object{}
+	_ fs.Fs                   = &Fs{}
+	_ fs.Purger               = &Fs{}
+	_ fs.Copier               = &Fs{}
+	_ fs.PutStreamer          = &Fs{}
+	_ fs.ListRer              = &Fs{}
+	_ fs.ListPer              = &Fs{}
+	_ fs.Commander            = &Fs{}
+	_ fs.CleanUpper           = &Fs{}
+	_ fs.OpenChunkWriter      = &Fs{}
+	_ fs.ChunkWriterResumer   = &Fs{}
+	_ fs.ResumableChunkWriter = &s3ChunkWriter{}
+	_ fs.Object               = &Object{}
+	_ fs.MimeTyper            = &Object{}
+	_ fs.GetTierer            = &Object{}
+	_ fs.SetTierer            = &Object{}
+	_ fs.Metadataer           = &Object{}
 )
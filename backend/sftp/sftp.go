@@ -30,6 +30,7 @@ import (
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/lib/env"
 	"github.com/rclone/rclone/lib/pacer"
+	"github.com/rclone/rclone/lib/random"
 	"github.com/rclone/rclone/lib/readers"
 	sshagent "github.com/xanzy/ssh-agent"
 	"golang.org/x/crypto/ssh"
@@ -783,7 +784,7 @@ func (f *Fs) newSftpClient(client sshClient, opts ...sftp.ClientOption) (*sftp.C
 
 // Get an SFTP connection from the pool, or open a new one
 func (f *Fs) getSftpConnection(ctx context.Context) (c *conn, err error) {
-	accounting.LimitTPS(ctx)
+	accounting.LimitRemoteTPS(ctx, f.name)
 	if f.opt.Connections > 0 {
 		f.tokens.Get()
 	}
@@ -1561,31 +1562,87 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 		fs.Debugf(src, "Can't copy - not same remote type")
 		return nil, fs.ErrorCantCopy
 	}
+	err := f.hardLink(ctx, srcObj, remote, false)
+	if errors.Is(err, fs.ErrorCantLink) {
+		return nil, fs.ErrorCantCopy
+	} else if err != nil {
+		return nil, fmt.Errorf("Copy failed: %w", err)
+	}
+	dstObj, err := f.NewObject(ctx, remote)
+	if err != nil {
+		return nil, fmt.Errorf("Copy NewObject failed: %w", err)
+	}
+	return dstObj, nil
+}
+
+// Link hard links a remote sftp file object replacing any existing
+// file at remote
+func (f *Fs) Link(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't link - not same remote type")
+		return nil, fs.ErrorCantLink
+	}
+	err := f.hardLink(ctx, srcObj, remote, true)
+	if errors.Is(err, fs.ErrorCantLink) {
+		return nil, err
+	} else if err != nil {
+		return nil, fmt.Errorf("Link failed: %w", err)
+	}
+	dstObj, err := f.NewObject(ctx, remote)
+	if err != nil {
+		return nil, fmt.Errorf("Link NewObject failed: %w", err)
+	}
+	return dstObj, nil
+}
+
+// hardLink makes a hard link to srcObj at remote
+//
+// If replace is set then the link is made under a temporary name and
+// renamed over any existing file.
+//
+// It returns fs.ErrorCantLink if the server doesn't support links
+func (f *Fs) hardLink(ctx context.Context, srcObj *Object, remote string, replace bool) error {
 	err := f.mkParentDir(ctx, remote)
 	if err != nil {
-		return nil, fmt.Errorf("Copy mkParentDir failed: %w", err)
+		return fmt.Errorf("mkParentDir failed: %w", err)
 	}
 	c, err := f.getSftpConnection(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("Copy: %w", err)
+		return err
 	}
 	srcPath, dstPath := srcObj.path(), path.Join(f.absRoot, remote)
-	err = c.sftpClient.Link(srcPath, dstPath)
+	linkPath := dstPath
+	if replace {
+		linkPath = dstPath + ".rclonelink-" + random.String(8)
+	}
+	err = c.sftpClient.Link(srcPath, linkPath)
+	if err == nil && replace {
+		if _, ok := c.sftpClient.HasExtension("posix-rename@openssh.com"); ok {
+			err = c.sftpClient.PosixRename(linkPath, dstPath)
+		} else {
+			// If haven't got PosixRename then remove destination first before renaming
+			err = c.sftpClient.Remove(dstPath)
+			if err != nil && !errors.Is(err, iofs.ErrNotExist) {
+				fs.Errorf(f, "Link: Failed to remove existing file %q: %v", dstPath, err)
+			}
+			err = c.sftpClient.Rename(linkPath, dstPath)
+		}
+		if err != nil {
+			_ = c.sftpClient.Remove(linkPath)
+		}
+	}
 	f.putSftpConnection(&c, err)
 	if err != nil {
 		if sftpErr, ok := err.(*sftp.StatusError); ok {
 			if sftpErr.FxCode() == sftp.ErrSSHFxOpUnsupported {
 				// Remote doesn't support Link
-				return nil, fs.ErrorCantCopy
+				return fs.ErrorCantLink
 			}
 		}
-		return nil, fmt.Errorf("Copy failed: %w", err)
-	}
-	dstObj, err := f.NewObject(ctx, remote)
-	if err != nil {
-		return nil, fmt.Errorf("Copy NewObject failed: %w", err)
+		return err
 	}
-	return dstObj, nil
+	return nil
 }
 
 // DirMove moves src, srcRemote to this remote at dstRemote
@@ -2418,6 +2475,7 @@ var (
 	_ fs.PutStreamer    = &Fs{}
 	_ fs.Mover          = &Fs{}
 	_ fs.Copier         = &Fs{}
+	_ fs.Linker         = &Fs{}
 	_ fs.DirMover       = &Fs{}
 	_ fs.DirSetModTimer = &Fs{}
 	_ fs.Abouter        = &Fs{}
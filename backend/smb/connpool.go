@@ -157,7 +157,7 @@ func (c *conn) mountShare(share string) (err error) {
 
 // Get a SMB connection from the pool, or open a new one
 func (f *Fs) getConnection(ctx context.Context, share string) (c *conn, err error) {
-	accounting.LimitTPS(ctx)
+	accounting.LimitRemoteTPS(ctx, f.name)
 	f.poolMu.Lock()
 	for len(f.pool) > 0 {
 		c = f.pool[0]
@@ -302,6 +302,42 @@ func (f *Fs) Copy(ctx context.Context, src fs.Object, remote string) (fs.Object,
 	return wo.(*Object), err
 }
 
+// Link src to this remote using a hard link.
+//
+// Will only be called if src.Fs().Name() == f.Name()
+//
+// If it isn't possible then return fs.ErrorCantLink
+func (f *Fs) Link(ctx context.Context, src fs.Object, remote string) (fs.Object, error) {
+	srcObj, ok := src.(*Object)
+	if !ok {
+		fs.Debugf(src, "Can't link - not same remote type")
+		return nil, fs.ErrorCantLink
+	}
+	o := srcObj.UnWrapUpstream()
+	su := o.UpstreamFs()
+	if su.Features().Link == nil {
+		return nil, fs.ErrorCantLink
+	}
+	var du *upstream.Fs
+	for _, u := range f.upstreams {
+		if operations.Same(u.RootFs, su.RootFs) {
+			du = u
+		}
+	}
+	if du == nil {
+		return nil, fs.ErrorCantLink
+	}
+	if !du.IsCreatable() {
+		return nil, fs.ErrorPermissionDenied
+	}
+	lo, err := du.Features().Link(ctx, o.UnWrap(), remote)
+	if err != nil || lo == nil {
+		return nil, err
+	}
+	wo, err := f.wrapEntries(du.WrapObject(lo))
+	return wo.(*Object), err
+}
+
 // Move src to this remote using server-side move operations.
 //
 // This is stored with the remote path given.
@@ -1065,6 +1101,7 @@ var (
 	_ fs.Purger          = (*Fs)(nil)
 	_ fs.PutStreamer     = (*Fs)(nil)
 	_ fs.Copier          = (*Fs)(nil)
+	_ fs.Linker          = (*Fs)(nil)
 	_ fs.Mover           = (*Fs)(nil)
 	_ fs.DirMover        = (*Fs)(nil)
 	_ fs.DirSetModTimer  = (*Fs)(nil)
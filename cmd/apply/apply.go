@@ -0,0 +1,237 @@
+// Package apply provides the apply command.
+package apply
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/cmd/diff"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/spf13/cobra"
+)
+
+var sourceRemote string
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.StringVarP(cmdFlags, &sourceRemote, "source", "", "", "Copy added and modified files from this remote:path instead of the batch", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "apply batch dst:path",
+	Short: `Apply a change set made by rclone diff to dst:path.`,
+	Long: `Makes the changes in a change set made by ` + "`rclone diff`" + ` to the
+files in dst:path, which should be the same as the old files the
+change set was made from.
+
+The first argument is either a batch directory written by
+` + "`rclone diff --batch`" + `, which contains the change set and the
+contents of the files it adds and modifies, or a change set file. If it
+is a change set file then ` + "`--source`" + ` must be used to say where the
+contents of added and modified files can be copied from, which is
+normally the new remote the change set was made from.
+
+Renamed files are moved within dst:path so they don't need to be
+copied again. If the file to rename isn't found it is copied from the
+source instead, if possible. Removed files which don't exist and added
+or modified files which are already up to date are skipped, so
+applying a change set a second time is harmless.
+
+Use ` + "`--dry-run`" + ` or ` + "`--interactive`" + ` to see what would be done
+first. Removed and overwritten files go to ` + "`--backup-dir`" + ` or
+` + "`--trash-dir`" + ` if set, as with ` + "`rclone sync`" + `.
+
+Eg
+
+    rclone apply /media/usb/batch offsite:path
+    rclone apply changes.json offsite:path --source remote:path
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.71",
+		"groups":            "Important,Copy",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(2, 2, command, args)
+		fbatch, changesFile := cmd.NewFsFile(args[0])
+		fdst := cmd.NewFsDir(args[1:])
+		cmd.Run(true, true, command, func() error {
+			ctx := context.Background()
+			if changesFile == "" {
+				changesFile = diff.ChangesFile
+			}
+			cs, err := Load(ctx, fbatch, changesFile)
+			if err != nil {
+				return err
+			}
+			var fdata fs.Fs
+			if sourceRemote != "" {
+				fdata = cmd.NewFsSrc([]string{sourceRemote})
+			} else if changesFile == diff.ChangesFile {
+				fdata, err = cache.Get(ctx, fspath.JoinRootPath(fs.ConfigString(fbatch), diff.DataDir))
+				if err != nil {
+					return fmt.Errorf("failed to open batch data: %w", err)
+				}
+			}
+			return Apply(ctx, cs, fdst, fdata)
+		})
+	},
+}
+
+// Load the change set from name in f
+func Load(ctx context.Context, f fs.Fs, name string) (*diff.ChangeSet, error) {
+	o, err := f.NewObject(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find change set: %w", err)
+	}
+	data, err := operations.ReadFile(ctx, o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read change set: %w", err)
+	}
+	return diff.Read(bytes.NewReader(data))
+}
+
+// state for applying a change set
+type applyState struct {
+	fdst    fs.Fs
+	fdata   fs.Fs // where to copy files from - may be nil
+	lastErr error
+}
+
+// fail records an error for remote
+func (s *applyState) fail(ctx context.Context, remote string, err error) {
+	fs.Errorf(remote, "Failed to apply change: %v", err)
+	s.lastErr = fs.CountError(ctx, err)
+}
+
+// find returns the object at remote in f or nil if it isn't found
+func find(ctx context.Context, f fs.Fs, remote string) (fs.Object, error) {
+	o, err := f.NewObject(ctx, remote)
+	if errors.Is(err, fs.ErrorObjectNotFound) {
+		return nil, nil
+	}
+	return o, err
+}
+
+// copy the file at remote from the data to the destination
+func (s *applyState) copy(ctx context.Context, remote string) {
+	if s.fdata == nil {
+		s.fail(ctx, remote, errors.New("no source to copy from - use --source"))
+		return
+	}
+	src, err := s.fdata.NewObject(ctx, remote)
+	if err != nil {
+		s.fail(ctx, remote, fmt.Errorf("failed to find source: %w", err))
+		return
+	}
+	dst, err := find(ctx, s.fdst, remote)
+	if err != nil {
+		s.fail(ctx, remote, err)
+		return
+	}
+	if dst != nil && !operations.NeedTransfer(ctx, dst, src) {
+		return
+	}
+	_, err = operations.Copy(ctx, s.fdst, dst, remote, src)
+	if err != nil {
+		s.fail(ctx, remote, err)
+	}
+}
+
+// rename the file at from to remote, copying it if from isn't found
+func (s *applyState) rename(ctx context.Context, from, remote string) {
+	src, err := find(ctx, s.fdst, from)
+	if err != nil {
+		s.fail(ctx, from, err)
+		return
+	}
+	if src == nil {
+		fs.Logf(from, "Not found to rename to %q - copying instead", remote)
+		s.copy(ctx, remote)
+		return
+	}
+	dst, err := find(ctx, s.fdst, remote)
+	if err != nil {
+		s.fail(ctx, remote, err)
+		return
+	}
+	_, err = operations.Move(ctx, s.fdst, dst, remote, src)
+	if err != nil {
+		s.fail(ctx, remote, err)
+	}
+}
+
+// remove the file at remote
+func (s *applyState) remove(ctx context.Context, remote string) {
+	dst, err := find(ctx, s.fdst, remote)
+	if err != nil {
+		s.fail(ctx, remote, err)
+		return
+	}
+	if dst == nil {
+		fs.Debugf(remote, "Not removing as not found")
+		return
+	}
+	err = operations.DeleteFile(ctx, dst)
+	if err != nil {
+		s.fail(ctx, remote, err)
+	}
+}
+
+// Apply makes the changes in cs to fdst, copying added and modified
+// files from fdata, which may be nil if there are none.
+//
+// The renames are done first, then the removals and then the copies.
+func Apply(ctx context.Context, cs *diff.ChangeSet, fdst, fdata fs.Fs) error {
+	s := &applyState{fdst: fdst, fdata: fdata}
+
+	// Rename files, doing a rename before any which would overwrite its
+	// source, and going via a temporary name to break cycles
+	var renames []diff.Change
+	for _, change := range cs.Changes {
+		if change.Op == diff.OpRename {
+			renames = append(renames, change)
+		}
+	}
+	for len(renames) > 0 {
+		sources := make(map[string]struct{}, len(renames))
+		for _, change := range renames {
+			sources[change.From] = struct{}{}
+		}
+		var blocked []diff.Change
+		for _, change := range renames {
+			if _, found := sources[change.Path]; found {
+				blocked = append(blocked, change)
+				continue
+			}
+			s.rename(ctx, change.From, change.Path)
+			delete(sources, change.From)
+		}
+		if len(blocked) == len(renames) {
+			tmp := blocked[0].From + ".rclone-apply-" + random.String(8)
+			s.rename(ctx, blocked[0].From, tmp)
+			blocked[0].From = tmp
+		}
+		renames = blocked
+	}
+
+	for _, change := range cs.Changes {
+		if change.Op == diff.OpRemove {
+			s.remove(ctx, change.Path)
+		}
+	}
+	for _, change := range cs.Changes {
+		if change.Op == diff.OpAdd || change.Op == diff.OpModify {
+			s.copy(ctx, change.Path)
+		}
+	}
+	return s.lastErr
+}
@@ -0,0 +1,81 @@
+package apply
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/cmd/diff"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 = t1.Add(time.Hour)
+)
+
+// TestMain drives the tests
+func TestMain(m *testing.M) {
+	fstest.TestMain(m)
+}
+
+func TestApply(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	fold, err := fs.NewFs(ctx, r.LocalName+"/old")
+	require.NoError(t, err)
+	fnew, err := fs.NewFs(ctx, r.LocalName+"/new")
+	require.NoError(t, err)
+	fbatch, err := fs.NewFs(ctx, r.LocalName+"/batch")
+	require.NoError(t, err)
+
+	// a.txt and b.txt are swapped, c.txt is modified, d.txt removed
+	// and e.txt added
+	old := map[string]string{
+		"a.txt": "aaaa",
+		"b.txt": "bbbbbb",
+		"c.txt": "cc",
+		"d.txt": "dd",
+	}
+	for name, contents := range old {
+		r.WriteFile("old/"+name, contents, t1)
+	}
+	r.WriteFile("new/a.txt", "bbbbbb", t1)
+	r.WriteFile("new/b.txt", "aaaa", t1)
+	r.WriteFile("new/c.txt", "modified", t2)
+	r.WriteFile("new/e.txt", "eeeee", t2)
+
+	cs, _, err := diff.Make(ctx, fold, "", fnew)
+	require.NoError(t, err)
+	require.Len(t, cs.Changes, 5)
+	require.NoError(t, diff.WriteBatch(ctx, cs, fnew, fbatch))
+
+	// Apply the batch to a copy of the old files
+	fdst := r.Fremote
+	for name, contents := range old {
+		r.WriteObject(ctx, name, contents, t1)
+	}
+	cs, err = Load(ctx, fbatch, diff.ChangesFile)
+	require.NoError(t, err)
+	fdata, err := fs.NewFs(ctx, r.LocalName+"/batch/"+diff.DataDir)
+	require.NoError(t, err)
+	require.NoError(t, Apply(ctx, cs, fdst, fdata))
+
+	want := []fstest.Item{
+		fstest.NewItem("a.txt", "bbbbbb", t1),
+		fstest.NewItem("b.txt", "aaaa", t1),
+		fstest.NewItem("c.txt", "modified", t2),
+		fstest.NewItem("e.txt", "eeeee", t2),
+	}
+	fstest.CheckListingWithPrecision(t, fdst, want, nil, fs.GetModifyWindow(ctx, fdst))
+
+	// Applying it again changes nothing
+	require.NoError(t, Apply(ctx, cs, fdst, fdata))
+	fstest.CheckListingWithPrecision(t, fdst, want, nil, fs.GetModifyWindow(ctx, fdst))
+
+	// Without any data the copies fail
+	require.Error(t, Apply(ctx, &diff.ChangeSet{Changes: []diff.Change{{Op: diff.OpAdd, Path: "x.txt"}}}, fdst, nil))
+}
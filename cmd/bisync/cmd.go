@@ -61,6 +61,9 @@ type Options struct {
 	ConflictSuffixFlag    string
 	ConflictSuffix1       string
 	ConflictSuffix2       string
+	ConflictMerge         bool
+	ConflictMergeInclude  string
+	ConflictMergeMaxSize  fs.SizeSuffix
 }
 
 // Default values
@@ -120,6 +123,7 @@ var Opt Options
 
 func init() {
 	Opt.MaxLock = 0
+	Opt.ConflictMergeMaxSize = DefaultConflictMergeMaxSize
 	cmd.Root.AddCommand(commandDefinition)
 	cmdFlags := commandDefinition.Flags()
 	// when adding new flags, remember to also update the rc params:
@@ -151,6 +155,9 @@ func init() {
 	flags.FVarP(cmdFlags, &Opt.ConflictResolve, "conflict-resolve", "", "Automatically resolve conflicts by preferring the version that is: "+ConflictResolveList+" (default: none)", "")
 	flags.FVarP(cmdFlags, &Opt.ConflictLoser, "conflict-loser", "", "Action to take on the loser of a sync conflict (when there is a winner) or on both files (when there is no winner): "+ConflictLoserList+" (default: num)", "")
 	flags.StringVarP(cmdFlags, &Opt.ConflictSuffixFlag, "conflict-suffix", "", Opt.ConflictSuffixFlag, "Suffix to use when renaming a --conflict-loser. Can be either one string or two comma-separated strings to assign different suffixes to Path1/Path2. (default: 'conflict')", "")
+	flags.BoolVarP(cmdFlags, &Opt.ConflictMerge, "conflict-merge", "", Opt.ConflictMerge, "Try a three-way merge of text files changed on both paths before resolving a conflict, using a copy of the file from the last run kept in the workdir", "")
+	flags.StringVarP(cmdFlags, &Opt.ConflictMergeInclude, "conflict-merge-include", "", Opt.ConflictMergeInclude, "Comma-separated list of glob patterns of files to keep merge bases for with --conflict-merge ex. '*.txt,*.md' (default: all files)", "")
+	flags.FVarP(cmdFlags, &Opt.ConflictMergeMaxSize, "conflict-merge-max-size", "", "Don't keep merge bases for --conflict-merge for files larger than this", "")
 	_ = cmdFlags.MarkHidden("debugname")
 	_ = cmdFlags.MarkHidden("localtime")
 }
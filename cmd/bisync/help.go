@@ -41,6 +41,12 @@ var rcHelp = makeHelp(`This takes the following parameters
 - backupdir1 - --backup-dir for Path1. Must be a non-overlapping path on the same remote.
 - backupdir2 - --backup-dir for Path2. Must be a non-overlapping path on the same remote.
 - noCleanup - retain working files
+- conflictMerge - try a three-way merge of text files changed on both paths
+  before resolving a conflict
+- conflictMergeInclude - comma-separated glob patterns of files to keep
+  merge bases for (default: all files)
+- conflictMergeMaxSize - don't keep merge bases for files larger than this
+  (default: 1Mi)
 
 See [bisync command help](https://rclone.org/commands/rclone_bisync/)
 and [full bisync description](https://rclone.org/bisync/)
@@ -0,0 +1,440 @@
+package bisync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rclone/rclone/cmd/bisync/bilib"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/lib/terminal"
+)
+
+// DefaultConflictMergeMaxSize is the largest file --conflict-merge keeps a merge base for by default
+const DefaultConflictMergeMaxSize = fs.SizeSuffix(fs.Mebi)
+
+// maxMergeEdits limits the work done diffing a file against its merge base.
+// Files with more differences than this are treated as conflicting.
+const maxMergeEdits = 4096
+
+var errMergeChanged = errors.New("file changed since it was listed")
+
+// mergeOpt is the runtime state for --conflict-merge
+type mergeOpt struct {
+	include []*regexp.Regexp
+}
+
+func (b *bisyncRun) setMergeDefaults() error {
+	if !b.opt.ConflictMerge {
+		return nil
+	}
+	if b.opt.ConflictMergeMaxSize <= 0 {
+		b.opt.ConflictMergeMaxSize = DefaultConflictMergeMaxSize
+	}
+	for _, glob := range strings.Split(b.opt.ConflictMergeInclude, ",") {
+		glob = strings.TrimSpace(glob)
+		if glob == "" {
+			continue
+		}
+		re, err := filter.GlobPathToRegexp(glob, false)
+		if err != nil {
+			return fmt.Errorf("invalid --conflict-merge-include pattern %q: %w", glob, err)
+		}
+		b.mergeOpt.include = append(b.mergeOpt.include, re)
+	}
+	return nil
+}
+
+// mergeSelected returns whether --conflict-merge keeps a merge base for remote
+func (b *bisyncRun) mergeSelected(remote string, size int64) bool {
+	if size < 0 || size > int64(b.opt.ConflictMergeMaxSize) {
+		return false
+	}
+	if len(b.mergeOpt.include) == 0 {
+		return true
+	}
+	for _, re := range b.mergeOpt.include {
+		if re.MatchString(remote) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeListing is the listing of the merge bases saved in the workdir
+func (b *bisyncRun) mergeListing() string {
+	return b.basePath + ".merge.lst"
+}
+
+// mergeBasePath is where the merge base of remote is saved in the workdir
+func (b *bisyncRun) mergeBasePath(remote string) string {
+	return filepath.Join(b.basePath+".merge", filepath.FromSlash(remote))
+}
+
+// sameMergeBase returns whether a merge base saved for old is still valid for new
+func sameMergeBase(old, new *fileInfo) bool {
+	if old.time.IsZero() && old.hash == "" {
+		return false // nothing to tell a change without a size change
+	}
+	return old.size == new.size && old.time.Equal(new.time) && old.hash == new.hash
+}
+
+// updateMergeBases keeps a copy of each file selected by --conflict-merge
+// as it was at the end of a successful run, to be used as the base of a
+// three-way merge if it is then changed on both paths.
+//
+// Failures are logged but don't fail the run as they only mean those
+// files can't be merged next time.
+func (b *bisyncRun) updateMergeBases(ctx context.Context) {
+	if !b.opt.ConflictMerge || b.opt.DryRun {
+		return
+	}
+	fs.Infof(nil, "Updating merge bases")
+	listing, err := b.loadListing(b.listing1)
+	if err != nil {
+		fs.Errorf(nil, "Failed to update merge bases: %v", err)
+		return
+	}
+	old, err := b.loadListing(b.mergeListing())
+	if err != nil {
+		old = newFileList()
+	}
+	bases := newFileList()
+	bases.hash = listing.hash
+	for _, remote := range listing.list {
+		info := listing.get(remote)
+		if info.flags == "d" || !b.mergeSelected(remote, info.size) {
+			continue
+		}
+		prev := old.get(remote)
+		if prev == nil || !sameMergeBase(prev, info) || !bilib.FileExists(b.mergeBasePath(remote)) {
+			if err := b.saveMergeBase(ctx, remote, info); err != nil {
+				fs.Errorf(remote, "Failed to save merge base: %v", err)
+				continue
+			}
+		}
+		bases.put(remote, info.size, info.time, info.hash, info.id, info.flags)
+	}
+	for _, remote := range old.list {
+		if !bases.has(remote) {
+			_ = os.Remove(b.mergeBasePath(remote))
+		}
+	}
+	if err := bases.save(b.mergeListing()); err != nil {
+		fs.Errorf(nil, "Failed to save merge base listing: %v", err)
+	}
+}
+
+// saveMergeBase saves a copy of remote on Path1 as its merge base
+func (b *bisyncRun) saveMergeBase(ctx context.Context, remote string, info *fileInfo) error {
+	obj, err := b.fs1.NewObject(ctx, remote)
+	if err != nil {
+		return err
+	}
+	if obj.Size() != info.size || timeDiffers(ctx, obj.ModTime(ctx), info.time, b.fs1, b.fs1) {
+		return errMergeChanged
+	}
+	data, err := b.readMergeFile(ctx, obj)
+	if err != nil {
+		return err
+	}
+	basePath := b.mergeBasePath(remote)
+	if err := os.MkdirAll(filepath.Dir(basePath), 0700); err != nil {
+		return err
+	}
+	tmpPath := basePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, bilib.PermSecure); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, basePath)
+}
+
+// readMergeFile reads the whole of obj provided it isn't too big to merge
+func (b *bisyncRun) readMergeFile(ctx context.Context, obj fs.Object) (data []byte, err error) {
+	maxSize := int64(b.opt.ConflictMergeMaxSize)
+	if obj.Size() > maxSize {
+		return nil, fmt.Errorf("file is larger than --conflict-merge-max-size %v", b.opt.ConflictMergeMaxSize)
+	}
+	tr := accounting.Stats(ctx).NewTransfer(obj, nil)
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+	rc, err := operations.Open(ctx, obj)
+	if err != nil {
+		return nil, err
+	}
+	in := tr.Account(ctx, rc)
+	data, err = io.ReadAll(io.LimitReader(in, maxSize+1))
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("file is larger than --conflict-merge-max-size %v", b.opt.ConflictMergeMaxSize)
+	}
+	return data, nil
+}
+
+// merge attempts a three-way merge of a file which was changed on both
+// paths, using the copy saved at the end of the last run as the base.
+//
+// If the changes merge cleanly the result is written to Path1 and queued
+// to be copied to Path2 and merged is returned as true. Otherwise the
+// conflict should be resolved as usual.
+func (b *bisyncRun) merge(ctx context.Context, path1, path2, file, alias string, renameSkipped, copy1to2 *bilib.Names) (merged bool, err error) {
+	if !b.opt.ConflictMerge {
+		return false, nil
+	}
+	remote2 := b.march.ls2.getTryAlias(file, alias)
+	if remote2 == "" || !b.mergeSelected(file, b.march.ls1.getSize(file)) || !b.mergeSelected(remote2, b.march.ls2.getSize(remote2)) {
+		fs.Debugf(file, "Not selected for --conflict-merge")
+		return false, nil
+	}
+	base, err := os.ReadFile(b.mergeBasePath(file))
+	if err != nil {
+		fs.Infof(file, "Can't merge as there is no merge base")
+		return false, nil
+	}
+	read := func(f fs.Fs, remote string) []byte {
+		obj, err := f.NewObject(ctx, remote)
+		if err != nil {
+			fs.Infof(remote, "Can't merge: %v", err)
+			return nil
+		}
+		data, err := b.readMergeFile(ctx, obj)
+		if err != nil {
+			fs.Infof(remote, "Can't merge: %v", err)
+			return nil
+		}
+		return data
+	}
+	data1 := read(b.fs1, file)
+	if data1 == nil {
+		return false, nil
+	}
+	data2 := read(b.fs2, remote2)
+	if data2 == nil {
+		return false, nil
+	}
+	if !isText(base) || !isText(data1) || !isText(data2) {
+		fs.Infof(file, "Can't merge as it is not a text file")
+		return false, nil
+	}
+	result, ok := merge3(base, data1, data2)
+	if !ok {
+		fs.Infof(file, Color(terminal.RedFg, "Changes could not be merged as they overlap"))
+		return false, nil
+	}
+	fs.Infof(file, Color(terminal.GreenFg, "Changes from both paths merged successfully"))
+
+	if operations.SkipDestructive(ctx, file, "write merged file") {
+		renameSkipped.Add(file) // (due to dry-run, not equality)
+	} else {
+		b.indent("!Path1", path1+file, "Writing merged file to Path1")
+		_, err = operations.RcatSize(ctx, b.fs1, file, io.NopCloser(bytes.NewReader(result)), int64(len(result)), time.Now(), nil)
+		if err != nil {
+			b.critical = true
+			return false, fmt.Errorf("%s merge failed for %s: %w", path1, path1+file, err)
+		}
+	}
+	b.indent("!Path1", path2+remote2, "Queue copy to Path2")
+	copy1to2.Add(file)
+	return true, nil
+}
+
+// isText returns whether data looks like a text file which can be merged
+func isText(data []byte) bool {
+	return utf8.Valid(data) && bytes.IndexByte(data, 0) < 0
+}
+
+// splitLines splits data into lines keeping the line endings
+func splitLines(data []byte) [][]byte {
+	if len(data) == 0 {
+		return nil
+	}
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	if len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// merge3 does a line based three-way merge of the changes made to base
+// in a and b.
+//
+// It returns the merged result and true, or false if the changes in a
+// and b overlap and so can't be merged.
+func merge3(base, a, b []byte) (merged []byte, ok bool) {
+	// intern the lines so they can be compared as ints
+	ids := map[string]int{}
+	intern := func(data []byte) []int {
+		lines := splitLines(data)
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			id, found := ids[string(line)]
+			if !found {
+				id = len(ids)
+				ids[string(line)] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	o, x, y := intern(base), intern(a), intern(b)
+	lines := make([][]byte, len(ids))
+	for line, id := range ids {
+		lines[id] = []byte(line)
+	}
+
+	matchA, ok := diffMatches(o, x)
+	if !ok {
+		return nil, false
+	}
+	matchB, ok := diffMatches(o, y)
+	if !ok {
+		return nil, false
+	}
+
+	var out []int
+	i, j, k := 0, 0, 0 // positions in o, x, y
+	for i < len(o) || j < len(x) || k < len(y) {
+		// copy lines unchanged in both
+		n := 0
+		for i+n < len(o) && matchA[i+n] == j+n && matchB[i+n] == k+n {
+			n++
+		}
+		if n > 0 {
+			out = append(out, o[i:i+n]...)
+			i, j, k = i+n, j+n, k+n
+			continue
+		}
+		// find the next base line kept in both to end the changed chunk
+		end := i
+		for end < len(o) && (matchA[end] < 0 || matchB[end] < 0) {
+			end++
+		}
+		endA, endB := len(x), len(y)
+		if end < len(o) {
+			endA, endB = matchA[end], matchB[end]
+		}
+		chunkO, chunkA, chunkB := o[i:end], x[j:endA], y[k:endB]
+		switch {
+		case equalInts(chunkA, chunkO):
+			out = append(out, chunkB...)
+		case equalInts(chunkB, chunkO), equalInts(chunkA, chunkB):
+			out = append(out, chunkA...)
+		default:
+			return nil, false
+		}
+		i, j, k = end, endA, endB
+	}
+
+	for _, id := range out {
+		merged = append(merged, lines[id]...)
+	}
+	return merged, true
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// diffMatches finds a longest common subsequence of a and b using the
+// Myers diff algorithm.
+//
+// It returns for each line of a the index of the matching line in b or
+// -1 if it was removed. It returns false if there are more than
+// maxMergeEdits differences.
+func diffMatches(a, b []int) (match []int, ok bool) {
+	match = make([]int, len(a))
+	for i := range match {
+		match[i] = -1
+	}
+	// match the common prefix and suffix directly
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		match[prefix] = prefix
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		match[len(a)-1-suffix] = len(b) - 1 - suffix
+		suffix++
+	}
+	ma, mb := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(ma), len(mb)
+	if n == 0 || m == 0 {
+		return match, true
+	}
+
+	// v[k+offset] is the furthest x reached on diagonal k
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	var trace [][]int // the relevant part of v before each step
+	for d := 0; ; d++ {
+		if d > maxMergeEdits {
+			return nil, false
+		}
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && ma[x] == mb[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				// walk back through the trace recording the matches
+				x, y := n, m
+				for d := len(trace) - 1; d >= 0; d-- {
+					prev := trace[d] // index k is at k+d+1
+					k := x - y
+					var prevK int
+					if k == -d || (k != d && prev[k-1+d+1] < prev[k+1+d+1]) {
+						prevK = k + 1
+					} else {
+						prevK = k - 1
+					}
+					prevX := prev[prevK+d+1]
+					prevY := prevX - prevK
+					for x > prevX && y > prevY {
+						x--
+						y--
+						match[prefix+x] = prefix + y
+					}
+					x, y = prevX, prevY
+				}
+				return match, true
+			}
+		}
+	}
+}
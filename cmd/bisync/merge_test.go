@@ -0,0 +1,118 @@
+package bisync
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerge3(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		base string
+		a    string
+		b    string
+		want string // "" for a conflict
+	}{{
+		name: "separate edits",
+		base: "one\ntwo\nthree\nfour\nfive\n",
+		a:    "ONE\ntwo\nthree\nfour\nfive\n",
+		b:    "one\ntwo\nthree\nfour\nFIVE\n",
+		want: "ONE\ntwo\nthree\nfour\nFIVE\n",
+	}, {
+		name: "insert and delete",
+		base: "one\ntwo\nthree\nfour\nfive\n",
+		a:    "zero\none\ntwo\nthree\nfour\nfive\n",
+		b:    "one\ntwo\nfour\nfive\nsix\n",
+		want: "zero\none\ntwo\nfour\nfive\nsix\n",
+	}, {
+		name: "same edit",
+		base: "one\ntwo\nthree\n",
+		a:    "one\n2\nthree\n",
+		b:    "one\n2\nthree\n",
+		want: "one\n2\nthree\n",
+	}, {
+		name: "overlapping edits",
+		base: "one\ntwo\nthree\n",
+		a:    "one\nTWO\nthree\n",
+		b:    "one\n2\nthree\n",
+	}, {
+		name: "inserts at same place",
+		base: "one\ntwo\n",
+		a:    "one\nA\ntwo\n",
+		b:    "one\nB\ntwo\n",
+	}, {
+		name: "empty base",
+		base: "",
+		a:    "one\n",
+		b:    "",
+		want: "one\n",
+	}, {
+		name: "no final newline",
+		base: "one\ntwo\nthree",
+		a:    "ONE\ntwo\nthree",
+		b:    "one\ntwo\nthree\nfour",
+		want: "ONE\ntwo\nthree\nfour",
+	}, {
+		name: "CRLF",
+		base: "one\r\ntwo\r\nthree\r\nfour\r\n",
+		a:    "one\r\n2\r\nthree\r\nfour\r\n",
+		b:    "one\r\ntwo\r\nthree\r\n4\r\n",
+		want: "one\r\n2\r\nthree\r\n4\r\n",
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := merge3([]byte(test.base), []byte(test.a), []byte(test.b))
+			if test.want == "" {
+				assert.False(t, ok)
+				return
+			}
+			assert.True(t, ok)
+			assert.Equal(t, test.want, string(got))
+			// merging is symmetric
+			got, ok = merge3([]byte(test.base), []byte(test.b), []byte(test.a))
+			assert.True(t, ok)
+			assert.Equal(t, test.want, string(got))
+		})
+	}
+}
+
+func TestMerge3Large(t *testing.T) {
+	var base, a, b strings.Builder
+	for i := range 10000 {
+		line := fmt.Sprintf("line %d\n", i)
+		base.WriteString(line)
+		switch {
+		case i%1000 == 10:
+			a.WriteString("changed in a\n")
+			b.WriteString(line)
+		case i%1000 == 500:
+			a.WriteString(line)
+			b.WriteString("changed in b\n")
+		default:
+			a.WriteString(line)
+			b.WriteString(line)
+		}
+	}
+	got, ok := merge3([]byte(base.String()), []byte(a.String()), []byte(b.String()))
+	assert.True(t, ok)
+	assert.Equal(t, 10, strings.Count(string(got), "changed in a\n"))
+	assert.Equal(t, 10, strings.Count(string(got), "changed in b\n"))
+	assert.Equal(t, 10000, strings.Count(string(got), "\n"))
+
+	// too many differences to diff
+	var other strings.Builder
+	for i := range 10000 {
+		fmt.Fprintf(&other, "other %d\n", i)
+	}
+	_, ok = merge3([]byte(base.String()), []byte(other.String()), []byte(b.String()))
+	assert.False(t, ok)
+}
+
+func TestIsText(t *testing.T) {
+	assert.True(t, isText([]byte("hello\nworld\n")))
+	assert.True(t, isText(nil))
+	assert.False(t, isText([]byte("hello\x00world")))
+	assert.False(t, isText([]byte{0xff, 0xfe}))
+}
@@ -56,6 +56,7 @@ type bisyncRun struct {
 	queueOpt           bisyncQueueOpt
 	downloadHashOpt    downloadHashOpt
 	lockFileOpt        lockFileOpt
+	mergeOpt           mergeOpt
 }
 
 type queues struct {
@@ -104,6 +105,11 @@ func Bisync(ctx context.Context, fs1, fs2 fs.Fs, optArg *Options) (err error) {
 		return err
 	}
 
+	err = b.setMergeDefaults()
+	if err != nil {
+		return err
+	}
+
 	if b.workDir, err = filepath.Abs(opt.Workdir); err != nil {
 		return fmt.Errorf("failed to make workdir absolute: %w", err)
 	}
@@ -273,7 +279,11 @@ func (b *bisyncRun) runLocked(octx context.Context) (err error) {
 
 	// Generate Path1 and Path2 listings and copy any unique Path2 files to Path1
 	if opt.Resync {
-		return b.resync(fctx)
+		if err = b.resync(fctx); err != nil {
+			return err
+		}
+		b.updateMergeBases(fctx)
+		return nil
 	}
 
 	// Check for existence of prior Path1 and Path2 listings
@@ -456,6 +466,7 @@ func (b *bisyncRun) runLocked(octx context.Context) (err error) {
 		}
 	}
 
+	b.updateMergeBases(fctx)
 	return nil
 }
 
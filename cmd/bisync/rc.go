@@ -64,6 +64,19 @@ func rcBisync(ctx context.Context, in rc.Params) (out rc.Params, err error) {
 	if opt.Resilient, err = in.GetBool("resilient"); rc.NotErrParamNotFound(err) {
 		return
 	}
+	if opt.ConflictMerge, err = in.GetBool("conflictMerge"); rc.NotErrParamNotFound(err) {
+		return
+	}
+	if opt.ConflictMergeInclude, err = in.GetString("conflictMergeInclude"); rc.NotErrParamNotFound(err) {
+		return
+	}
+	if conflictMergeMaxSize, err := in.GetString("conflictMergeMaxSize"); err == nil {
+		if err := opt.ConflictMergeMaxSize.Set(conflictMergeMaxSize); err != nil {
+			return nil, rc.NewErrParamInvalid(err)
+		}
+	} else if rc.NotErrParamNotFound(err) {
+		return nil, err
+	}
 
 	if opt.CheckFilename, err = in.GetString("checkFilename"); rc.NotErrParamNotFound(err) {
 		return
@@ -136,6 +136,11 @@ type namePair struct {
 }
 
 func (b *bisyncRun) resolve(ctxMove context.Context, path1, path2, file, alias string, renameSkipped, copy1to2, copy2to1 *bilib.Names, ds1, ds2 *deltaSet) (err error) {
+	merged, err := b.merge(ctxMove, path1, path2, file, alias, renameSkipped, copy1to2)
+	if err != nil || merged {
+		return err
+	}
+
 	winningPath := 0
 	if b.opt.ConflictResolve != PreferNone {
 		winningPath = b.conflictWinner(ds1, ds2, file, alias)
@@ -328,8 +333,9 @@ func (b *bisyncRun) delete(ctx context.Context, thisNamePair namePair, thisPath
 		ctx = b.setBackupDir(ctx, thisPathNum)
 		ci := fs.GetConfig(ctx)
 		var backupDir fs.Fs
+		var trash bool
 		if ci.BackupDir != "" {
-			backupDir, err = operations.BackupDir(ctx, thisFs, thisFs, thisNamePair.oldName)
+			backupDir, trash, err = operations.BackupDirTrash(ctx, thisFs, thisFs, thisNamePair.oldName)
 			if err != nil {
 				b.critical = true
 				return err
@@ -340,7 +346,7 @@ func (b *bisyncRun) delete(ctx context.Context, thisNamePair namePair, thisPath
 			b.critical = true
 			return err
 		}
-		if err = operations.DeleteFileWithBackupDir(ctx, obj, backupDir); err != nil {
+		if err = operations.DeleteFileWithBackupDirTrash(ctx, obj, backupDir, trash); err != nil {
 			err = fmt.Errorf("%s delete failed for %s: %w", thisPath, thisPath+thisNamePair.oldName, err)
 			b.critical = true
 			return err
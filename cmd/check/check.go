@@ -154,6 +154,11 @@ both remotes and check them against each other on the fly.  This can
 be useful for remotes that don't support hashes or if you really want
 to check all the data.
 
+Files bigger than |--multi-thread-cutoff| are downloaded in chunks of
+|--multi-thread-chunk-size| using |--multi-thread-streams| parallel
+streams for each side and the digests of the chunks are compared. When
+files differ the offset of the first differing byte is logged.
+
 If you supply the |--checkfile HASH| flag with a valid hash name,
 the |source:path| must point to a text file in the SUM format.
 `, "|", "`") + FlagsHelp,
@@ -37,6 +37,7 @@ import (
 	"github.com/rclone/rclone/lib/buildinfo"
 	"github.com/rclone/rclone/lib/exitcode"
 	"github.com/rclone/rclone/lib/terminal"
+	"github.com/rclone/rclone/lib/tracing"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
@@ -46,6 +47,7 @@ var (
 	// Flags
 	cpuProfile    = flags.StringP("cpuprofile", "", "", "Write cpu profile to file", "Debugging")
 	memProfile    = flags.StringP("memprofile", "", "", "Write memory profile to file", "Debugging")
+	traceOutput   = flags.StringP("trace-output", "", "", "Write OTLP JSON traces to file or to the http(s) URL of a collector", "Debugging")
 	statsInterval = flags.DurationP("stats", "", time.Minute*1, "Interval between printing stats, e.g. 500ms, 60s, 5m (0 to disable)", "Logging")
 	version       bool
 	// Errors
@@ -460,6 +462,25 @@ func initConfig() {
 		})
 	}
 
+	// Setup tracing if desired
+	if *traceOutput != "" {
+		fs.Infof(nil, "Writing traces to %q", *traceOutput)
+		exporter, err := tracing.NewExporter(*traceOutput)
+		if err != nil {
+			err = fs.CountError(ctx, err)
+			fs.Fatal(nil, fmt.Sprint(err))
+		}
+		tracing.Enable(exporter, func(err error) {
+			fs.Errorf(nil, "Tracing: %v", err)
+		}, tracing.String("service.name", "rclone"), tracing.String("service.version", fs.Version))
+		atexit.Register(func() {
+			err := tracing.Shutdown(ctx)
+			if err != nil {
+				fs.Errorf(nil, "Failed to write traces: %v", err)
+			}
+		})
+	}
+
 	// Setup memory profiling if desired
 	if *memProfile != "" {
 		atexit.Register(func() {
@@ -0,0 +1,292 @@
+package diff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+)
+
+// Change operations
+const (
+	OpAdd    = "add"    // the file was added
+	OpRemove = "remove" // the file was removed
+	OpModify = "modify" // the contents of the file changed
+	OpRename = "rename" // the file was moved from From to Path
+)
+
+// ChangesFile is the name of the change set in a batch directory
+const ChangesFile = "changes.json"
+
+// DataDir is the directory in a batch holding the contents of the
+// added and modified files
+const DataDir = "data"
+
+// Change is a single change to a file
+type Change struct {
+	Op      string            `json:"op"`               // what happened - one of the Op constants
+	Path    string            `json:"path"`             // path of the file
+	From    string            `json:"from,omitempty"`   // previous path of a renamed file
+	Size    int64             `json:"size"`             // new size of the file
+	ModTime time.Time         `json:"modTime"`          // new modification time of the file
+	Hashes  map[string]string `json:"hashes,omitempty"` // new hashes of the file
+}
+
+// ChangeSet describes the changes which turn Old into New
+type ChangeSet struct {
+	Old     string    `json:"old"`     // what the changes are from
+	New     string    `json:"new"`     // what the changes are to
+	Created time.Time `json:"created"` // when the change set was made
+	Changes []Change  `json:"changes"` // the changes, in path order
+}
+
+// Counts returns the number of changes of each type
+func (cs *ChangeSet) Counts() map[string]int {
+	counts := map[string]int{}
+	for _, change := range cs.Changes {
+		counts[change.Op]++
+	}
+	return counts
+}
+
+// Write the change set to out as JSON
+func (cs *ChangeSet) Write(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "\t")
+	return enc.Encode(cs)
+}
+
+// Read a change set written by Write from in
+func Read(in io.Reader) (*ChangeSet, error) {
+	var cs ChangeSet
+	err := json.NewDecoder(in).Decode(&cs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read change set: %w", err)
+	}
+	for _, change := range cs.Changes {
+		switch change.Op {
+		case OpAdd, OpRemove, OpModify:
+		case OpRename:
+			if change.From == "" {
+				return nil, fmt.Errorf("rename of %q has no from", change.Path)
+			}
+		default:
+			return nil, fmt.Errorf("unknown change %q for %q", change.Op, change.Path)
+		}
+		if change.Path == "" {
+			return nil, errors.New("change has no path")
+		}
+	}
+	return &cs, nil
+}
+
+// Listing is the files in a remote, indexed by path
+type Listing map[string]*operations.ListJSONItem
+
+// listingItem is used to read the items in a listing made by lsjson
+type listingItem struct {
+	Path    string
+	Size    int64
+	ModTime string
+	IsDir   bool
+	Hashes  map[string]string
+}
+
+// ReadListing reads a listing in the format made by `rclone lsjson -R`
+func ReadListing(in io.Reader) (Listing, error) {
+	var items []listingItem
+	err := json.NewDecoder(in).Decode(&items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read listing: %w", err)
+	}
+	listing := make(Listing, len(items))
+	for _, item := range items {
+		if item.IsDir {
+			continue
+		}
+		var modTime time.Time
+		if item.ModTime != "" {
+			modTime, err = time.Parse(time.RFC3339Nano, item.ModTime)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read listing: bad time for %q: %w", item.Path, err)
+			}
+		}
+		listing[item.Path] = &operations.ListJSONItem{
+			Path:    item.Path,
+			Size:    item.Size,
+			ModTime: operations.Timestamp{When: modTime, Format: time.RFC3339Nano},
+			Hashes:  item.Hashes,
+		}
+	}
+	return listing, nil
+}
+
+// ListRemote lists the files in f reading the hashes of hashType
+func ListRemote(ctx context.Context, f fs.Fs, hashType hash.Type) (Listing, error) {
+	opt := operations.ListJSONOpt{
+		Recurse:    true,
+		FilesOnly:  true,
+		NoMimeType: true,
+	}
+	if hashType != hash.None {
+		opt.ShowHash = true
+		opt.HashTypes = []string{hashType.String()}
+	}
+	listing := Listing{}
+	err := operations.ListJSON(ctx, f, "", &opt, func(item *operations.ListJSONItem) error {
+		listing[item.Path] = item
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return listing, nil
+}
+
+// Write the listing to out in the format made by `rclone lsjson -R`
+func (l Listing) Write(out io.Writer) error {
+	items := make([]*operations.ListJSONItem, 0, len(l))
+	for _, p := range l.paths() {
+		items = append(items, l[p])
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "\t")
+	return enc.Encode(items)
+}
+
+// paths returns the paths in the listing in order
+func (l Listing) paths() []string {
+	paths := make([]string, 0, len(l))
+	for p := range l {
+		paths = append(paths, p)
+	}
+	slices.Sort(paths)
+	return paths
+}
+
+// Compare describes how to compare files
+type Compare struct {
+	HashType     hash.Type     // hash to compare with if both files have it
+	ModifyWindow time.Duration // maximum difference in modification times
+	SizeOnly     bool          // only compare sizes
+	CheckSum     bool          // don't compare modification times
+}
+
+// sameHash returns whether a and b have the same hash of the compare
+// type and whether that could be determined
+func (c *Compare) sameHash(a, b *operations.ListJSONItem) (same, ok bool) {
+	if c.HashType == hash.None {
+		return false, false
+	}
+	ha, hb := a.Hashes[c.HashType.String()], b.Hashes[c.HashType.String()]
+	if ha == "" || hb == "" {
+		return false, false
+	}
+	return ha == hb, true
+}
+
+// equal returns true if a and b have the same contents
+func (c *Compare) equal(a, b *operations.ListJSONItem) bool {
+	if a.Size != b.Size {
+		return false
+	}
+	if c.SizeOnly {
+		return true
+	}
+	if same, ok := c.sameHash(a, b); ok {
+		return same
+	}
+	if c.CheckSum || a.ModTime.When.IsZero() || b.ModTime.When.IsZero() {
+		return true
+	}
+	dt := a.ModTime.When.Sub(b.ModTime.When)
+	return dt >= -c.ModifyWindow && dt <= c.ModifyWindow
+}
+
+// newChange makes a change of op for the item
+func newChange(op string, item *operations.ListJSONItem) Change {
+	change := Change{
+		Op:      op,
+		Path:    item.Path,
+		Size:    item.Size,
+		ModTime: item.ModTime.When,
+		Hashes:  item.Hashes,
+	}
+	if op == OpRemove {
+		change.Size = 0
+		change.ModTime = time.Time{}
+		change.Hashes = nil
+	}
+	return change
+}
+
+// Diff returns the changes which turn the files in oldListing into the
+// ones in newListing.
+//
+// A file removed from one path and added at another with the same size
+// and hash is reported as a rename.
+func Diff(oldListing, newListing Listing, c *Compare) []Change {
+	var changes, added, removed []Change
+	for _, p := range newListing.paths() {
+		newItem := newListing[p]
+		oldItem, found := oldListing[p]
+		switch {
+		case !found:
+			added = append(added, newChange(OpAdd, newItem))
+		case !c.equal(oldItem, newItem):
+			changes = append(changes, newChange(OpModify, newItem))
+		}
+	}
+	for _, p := range oldListing.paths() {
+		if _, found := newListing[p]; !found {
+			removed = append(removed, newChange(OpRemove, oldListing[p]))
+		}
+	}
+
+	// Match up the removed and added files with the same contents
+	if c.HashType != hash.None && !c.SizeOnly {
+		contentKey := func(item *operations.ListJSONItem) string {
+			sum := item.Hashes[c.HashType.String()]
+			if sum == "" {
+				return ""
+			}
+			return fmt.Sprintf("%d:%s", item.Size, sum)
+		}
+		addedByContent := map[string][]int{}
+		for j := range added {
+			if key := contentKey(newListing[added[j].Path]); key != "" {
+				addedByContent[key] = append(addedByContent[key], j)
+			}
+		}
+		for i := range removed {
+			key := contentKey(oldListing[removed[i].Path])
+			candidates := addedByContent[key]
+			if key == "" || len(candidates) == 0 {
+				continue
+			}
+			j := candidates[0]
+			addedByContent[key] = candidates[1:]
+			added[j].Op = OpRename
+			added[j].From = removed[i].Path
+			removed[i].Op = ""
+		}
+	}
+	for _, change := range removed {
+		if change.Op != "" {
+			changes = append(changes, change)
+		}
+	}
+	changes = append(changes, added...)
+	slices.SortStableFunc(changes, func(a, b Change) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return changes
+}
@@ -0,0 +1,240 @@
+// Package diff provides the diff command and the change sets it makes.
+package diff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+var (
+	oldListingFile  string
+	saveListingFile string
+	outFileName     string
+	batchDir        string
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.StringVarP(cmdFlags, &oldListingFile, "old-listing", "", "", "Compare against this listing made by lsjson or --save-listing instead of a remote", "")
+	flags.StringVarP(cmdFlags, &saveListingFile, "save-listing", "", "", "Save the listing of the new remote to this file for a later --old-listing", "")
+	flags.StringVarP(cmdFlags, &outFileName, "output", "o", "", "Write the change set to this file instead of stdout", "")
+	flags.StringVarP(cmdFlags, &batchDir, "batch", "", "", "Write a batch with the change set and the changed files to this remote:path for rclone apply", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "diff old:path new:path",
+	Short: `Make a change set describing the differences between two remotes.`,
+	Long: `Compares the files in old:path with the files in new:path and writes a
+change set describing how to turn the old files into the new ones as
+JSON to standard output.
+
+Each change is one of
+
+- ` + "`add`" + ` - the file is only in new:path
+- ` + "`remove`" + ` - the file is only in old:path
+- ` + "`modify`" + ` - the file is in both but its contents differ
+- ` + "`rename`" + ` - a file only in old:path has the same size and hash as one only in new:path
+
+Files are compared by size and hash when both have a hash in common,
+otherwise by size and modification time, as ` + "`rclone sync`" + ` does.
+Use ` + "`--size-only`" + ` or ` + "`--checksum`" + ` to change this. Renames
+can only be found with a hash.
+
+Instead of a remote the old files can be a listing saved earlier with
+` + "`--old-listing`" + `, which is the output of ` + "`rclone lsjson -R --hash`" + `.
+Use ` + "`--save-listing`" + ` to save a listing of new:path at the same time,
+so a remote can be compared with how it was when the command was last
+run, eg
+
+    rclone diff --old-listing monday.json --save-listing tuesday.json remote:path
+
+Use ` + "`--batch remote:dir`" + ` to write a batch to a directory, similar
+to rsync's ` + "`--write-batch`" + `. This contains the change set and a copy
+of each added and modified file so the changes can be made somewhere
+else with ` + "`rclone apply`" + ` without access to new:path, eg
+
+    rclone diff backup:last remote:path --batch /media/usb/batch
+    rclone apply /media/usb/batch offsite:path
+
+The change set looks like this
+
+    {
+    	"old": "backup:last",
+    	"new": "remote:path",
+    	"created": "2025-06-01T12:00:00Z",
+    	"changes": [
+    		{"op": "add", "path": "new.txt", "size": 5, "modTime": "2025-06-01T11:00:00Z", "hashes": {"md5": "..."}},
+    		{"op": "rename", "path": "b.txt", "from": "a.txt", "size": 5, "modTime": "2025-05-01T11:00:00Z", "hashes": {"md5": "..."}},
+    		{"op": "remove", "path": "old.txt", "size": 0, "modTime": "0001-01-01T00:00:00Z"}
+    	]
+    }
+
+The filter flags can be used to choose which files are compared.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.71",
+		"groups":            "Filter,Listing,Check",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		var fold, fnew fs.Fs
+		if oldListingFile != "" {
+			cmd.CheckArgs(1, 1, command, args)
+			fnew = cmd.NewFsSrc(args)
+		} else {
+			cmd.CheckArgs(2, 2, command, args)
+			fold, fnew = cmd.NewFsSrcDst(args)
+		}
+		cmd.Run(false, false, command, func() error {
+			ctx := context.Background()
+			cs, newListing, err := Make(ctx, fold, oldListingFile, fnew)
+			if err != nil {
+				return err
+			}
+			if saveListingFile != "" {
+				err = writeFile(saveListingFile, newListing.Write)
+				if err != nil {
+					return fmt.Errorf("failed to save listing: %w", err)
+				}
+			}
+			if batchDir != "" {
+				fbatch := cmd.NewFsDir([]string{batchDir})
+				err = WriteBatch(ctx, cs, fnew, fbatch)
+				if err != nil {
+					return err
+				}
+			}
+			if outFileName != "" {
+				return writeFile(outFileName, cs.Write)
+			}
+			return cs.Write(os.Stdout)
+		})
+	},
+}
+
+// writeFile creates name and calls write to fill it
+func writeFile(name string, write func(io.Writer) error) (err error) {
+	out, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	defer fs.CheckClose(out, &err)
+	return write(out)
+}
+
+// listingHashType returns the first hash type supported by f which the
+// items in listing have
+func listingHashType(listing Listing, f fs.Fs) hash.Type {
+	for _, ht := range f.Hashes().Array() {
+		for _, item := range listing {
+			if item.Hashes[ht.String()] != "" {
+				return ht
+			}
+		}
+	}
+	return hash.None
+}
+
+// Make a change set describing the changes from fold, or the listing
+// in oldListingFile if fold is nil, to fnew, returning the listing of
+// fnew too.
+func Make(ctx context.Context, fold fs.Fs, oldListingFile string, fnew fs.Fs) (cs *ChangeSet, newListing Listing, err error) {
+	ci := fs.GetConfig(ctx)
+	c := &Compare{
+		SizeOnly: ci.SizeOnly,
+		CheckSum: ci.CheckSum,
+	}
+	var oldListing Listing
+	cs = &ChangeSet{
+		New:     fs.ConfigString(fnew),
+		Created: time.Now(),
+	}
+	if fold != nil {
+		cs.Old = fs.ConfigString(fold)
+		c.ModifyWindow = fs.GetModifyWindow(ctx, fold, fnew)
+		if !c.SizeOnly {
+			c.HashType = fold.Hashes().Overlap(fnew.Hashes()).GetOne()
+		}
+		oldListing, err = ListRemote(ctx, fold, c.HashType)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list old: %w", err)
+		}
+	} else {
+		if oldListingFile == "" {
+			return nil, nil, errors.New("need an old remote or listing")
+		}
+		cs.Old = oldListingFile
+		in, err := os.Open(oldListingFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		oldListing, err = ReadListing(in)
+		_ = in.Close()
+		if err != nil {
+			return nil, nil, err
+		}
+		c.ModifyWindow = fs.GetModifyWindow(ctx, fnew)
+		if !c.SizeOnly {
+			c.HashType = listingHashType(oldListing, fnew)
+		}
+	}
+	if c.HashType == hash.None && !c.SizeOnly {
+		fs.Logf(fnew, "No common hash found - renames won't be detected")
+	}
+	newListing, err = ListRemote(ctx, fnew, c.HashType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list new: %w", err)
+	}
+	cs.Changes = Diff(oldListing, newListing, c)
+	if cs.Changes == nil {
+		cs.Changes = []Change{}
+	}
+	counts := cs.Counts()
+	fs.Infof(fnew, "%d added, %d removed, %d modified, %d renamed", counts[OpAdd], counts[OpRemove], counts[OpModify], counts[OpRename])
+	return cs, newListing, nil
+}
+
+// WriteBatch writes cs to fbatch along with copies of the files in
+// fnew it adds or modifies, so it can be applied without fnew.
+func WriteBatch(ctx context.Context, cs *ChangeSet, fnew, fbatch fs.Fs) error {
+	var lastErr error
+	for _, change := range cs.Changes {
+		if change.Op != OpAdd && change.Op != OpModify {
+			continue
+		}
+		o, err := fnew.NewObject(ctx, change.Path)
+		if err == nil {
+			_, err = operations.Copy(ctx, fbatch, nil, path.Join(DataDir, change.Path), o)
+		}
+		if err != nil {
+			fs.Errorf(change.Path, "Failed to add to batch: %v", err)
+			lastErr = fs.CountError(ctx, err)
+		}
+	}
+	if lastErr != nil {
+		return fmt.Errorf("failed to write batch: %w", lastErr)
+	}
+	var buf bytes.Buffer
+	err := cs.Write(&buf)
+	if err != nil {
+		return err
+	}
+	_, err = operations.Rcat(ctx, fbatch, ChangesFile, io.NopCloser(&buf), cs.Created, nil)
+	if err != nil {
+		return fmt.Errorf("failed to write change set to batch: %w", err)
+	}
+	return nil
+}
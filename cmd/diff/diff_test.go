@@ -0,0 +1,140 @@
+package diff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	t1 = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	t2 = t1.Add(time.Hour)
+)
+
+// item makes a listing item
+func item(path string, size int64, modTime time.Time, md5 string) *operations.ListJSONItem {
+	i := &operations.ListJSONItem{
+		Path:    path,
+		Size:    size,
+		ModTime: operations.Timestamp{When: modTime, Format: time.RFC3339Nano},
+	}
+	if md5 != "" {
+		i.Hashes = map[string]string{"md5": md5}
+	}
+	return i
+}
+
+// ops summarises the changes
+func ops(changes []Change) (out []string) {
+	for _, change := range changes {
+		s := change.Op + " " + change.Path
+		if change.From != "" {
+			s += " from " + change.From
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+func TestDiff(t *testing.T) {
+	oldListing := Listing{
+		"same.txt":     item("same.txt", 1, t1, "aa"),
+		"modified.txt": item("modified.txt", 1, t1, "aa"),
+		"touched.txt":  item("touched.txt", 1, t1, "aa"),
+		"removed.txt":  item("removed.txt", 2, t1, "bb"),
+		"dir/a.txt":    item("dir/a.txt", 3, t1, "cc"),
+		"dir/b.txt":    item("dir/b.txt", 3, t1, "cc"),
+		"nohash.txt":   item("nohash.txt", 4, t1, ""),
+	}
+	newListing := Listing{
+		"same.txt":     item("same.txt", 1, t1, "aa"),
+		"modified.txt": item("modified.txt", 1, t1, "zz"),
+		"touched.txt":  item("touched.txt", 1, t2, "aa"),
+		"added.txt":    item("added.txt", 5, t1, "dd"),
+		"moved/a.txt":  item("moved/a.txt", 3, t1, "cc"),
+		"moved/b.txt":  item("moved/b.txt", 3, t1, "cc"),
+		"nohash2.txt":  item("nohash2.txt", 4, t1, ""),
+	}
+
+	changes := Diff(oldListing, newListing, &Compare{HashType: hash.MD5})
+	assert.Equal(t, []string{
+		"add added.txt",
+		"modify modified.txt",
+		"rename moved/a.txt from dir/a.txt",
+		"rename moved/b.txt from dir/b.txt",
+		"remove nohash.txt",
+		"add nohash2.txt",
+		"remove removed.txt",
+	}, ops(changes))
+	assert.Equal(t, int64(5), changes[0].Size)
+	assert.Equal(t, map[string]string{"md5": "dd"}, changes[0].Hashes)
+
+	// Without hashes modification times are compared and renames
+	// aren't found
+	changes = Diff(oldListing, newListing, &Compare{ModifyWindow: time.Second})
+	assert.Equal(t, []string{
+		"add added.txt",
+		"remove dir/a.txt",
+		"remove dir/b.txt",
+		"add moved/a.txt",
+		"add moved/b.txt",
+		"remove nohash.txt",
+		"add nohash2.txt",
+		"remove removed.txt",
+		"modify touched.txt",
+	}, ops(changes))
+
+	changes = Diff(oldListing, newListing, &Compare{HashType: hash.MD5, SizeOnly: true})
+	assert.NotContains(t, ops(changes), "modify modified.txt")
+	assert.NotContains(t, ops(changes), "rename moved/a.txt from dir/a.txt")
+}
+
+func TestListingRoundTrip(t *testing.T) {
+	listing := Listing{
+		"a.txt":     item("a.txt", 1, t1, "aa"),
+		"dir/b.txt": item("dir/b.txt", 2, t2, ""),
+	}
+	var buf bytes.Buffer
+	require.NoError(t, listing.Write(&buf))
+	got, err := ReadListing(&buf)
+	require.NoError(t, err)
+	assert.Empty(t, Diff(listing, got, &Compare{HashType: hash.MD5}))
+
+	// Directories in lsjson output are ignored
+	got, err = ReadListing(strings.NewReader(`[{"Path":"dir","IsDir":true,"ModTime":""},{"Path":"dir/b.txt","Size":2,"ModTime":"2025-01-02T04:04:05Z"}]`))
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	assert.Equal(t, t2, got["dir/b.txt"].ModTime.When)
+
+	_, err = ReadListing(strings.NewReader(`[{"Path":"a","ModTime":"yesterday"}]`))
+	assert.ErrorContains(t, err, "bad time")
+}
+
+func TestChangeSetRoundTrip(t *testing.T) {
+	cs := &ChangeSet{
+		Old:     "old:",
+		New:     "new:",
+		Created: t1,
+		Changes: []Change{{Op: OpRename, Path: "b", From: "a", Size: 1, ModTime: t1}},
+	}
+	var buf bytes.Buffer
+	require.NoError(t, cs.Write(&buf))
+	got, err := Read(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, cs, got)
+
+	for _, in := range []string{
+		`{"changes": [{"op": "potato", "path": "a"}]}`,
+		`{"changes": [{"op": "rename", "path": "a"}]}`,
+		`{"changes": [{"op": "add"}]}`,
+	} {
+		_, err = Read(strings.NewReader(in))
+		assert.Error(t, err, in)
+	}
+}
@@ -0,0 +1,470 @@
+package index
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/kv"
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// facility is the name of the kv database the index is kept in
+	facility = "index"
+	// rootPrefix starts the keys recording which roots were indexed
+	rootPrefix = "\x00root\x00"
+	// batchSize is the number of objects read and written in each
+	// database transaction
+	batchSize = 1000
+)
+
+// ErrNotIndexed is returned by Search if the root has never been indexed
+var ErrNotIndexed = errors.New("not indexed - run rclone index first")
+
+// Entry describes an object in the index
+type Entry struct {
+	Path     string            `json:"Path,omitempty"` // relative to the root searched - not stored
+	Size     int64             `json:"Size"`
+	ModTime  time.Time         `json:"ModTime"`
+	MimeType string            `json:"MimeType,omitempty"`
+	Hashes   map[string]string `json:"Hashes,omitempty"`
+	Metadata fs.Metadata       `json:"Metadata,omitempty"`
+}
+
+// rootRecord records when a root was last indexed completely
+type rootRecord struct {
+	Updated time.Time `json:"updated"`
+}
+
+// Options control what is put in the index
+type Options struct {
+	Hashes   []hash.Type // hashes to record - nil for the defaults
+	Metadata bool        // set to record metadata
+}
+
+// Stats counts the changes made by an update
+type Stats struct {
+	New       int
+	Changed   int
+	Unchanged int
+	Removed   int
+}
+
+// String returns a summary of the stats
+func (s Stats) String() string {
+	return fmt.Sprintf("%d new, %d changed, %d unchanged, %d removed", s.New, s.Changed, s.Unchanged, s.Removed)
+}
+
+// Index is an index of the objects in an Fs kept in a kv database
+//
+// There is one database for each remote name and the keys are paths
+// relative to the root of the remote, so indexes of different parts
+// of a remote share it.
+type Index struct {
+	f      fs.Fs
+	opt    Options
+	prefix string // root of f relative to the root of the remote
+	mu     sync.Mutex
+	db     *kv.DB
+}
+
+// indexOp adapts a function to a kv.Op
+type indexOp func(b kv.Bucket) error
+
+// Do the operation
+func (op indexOp) Do(ctx context.Context, b kv.Bucket) error {
+	return op(b)
+}
+
+// Open the index for f
+func Open(ctx context.Context, f fs.Fs, opt *Options) (*Index, error) {
+	if !kv.Supported() {
+		return nil, errors.New("the index is not supported on this platform")
+	}
+	db, err := kv.Start(ctx, facility, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index: %w", err)
+	}
+	ix := &Index{
+		f:      f,
+		prefix: strings.Trim(f.Root(), "/"),
+		db:     db,
+	}
+	if opt != nil {
+		ix.opt = *opt
+	}
+	if ix.opt.Hashes == nil && !f.Features().SlowHash {
+		ix.opt.Hashes = f.Hashes().Array()
+	}
+	return ix, nil
+}
+
+// Close the index
+func (ix *Index) Close() error {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if ix.db == nil {
+		return nil
+	}
+	err := ix.db.Stop(false)
+	ix.db = nil
+	return err
+}
+
+// do a database operation
+func (ix *Index) do(write bool, op indexOp) error {
+	ix.mu.Lock()
+	db := ix.db
+	ix.mu.Unlock()
+	err := db.Do(write, op)
+	if err == kv.ErrEmpty {
+		return ErrNotIndexed
+	}
+	return err
+}
+
+// key returns the database key for remote
+func (ix *Index) key(remote string) string {
+	return strings.Trim(path.Join(ix.prefix, remote), "/")
+}
+
+// dirKey returns the prefix of the keys of the objects in dir
+func (ix *Index) dirKey(dir string) string {
+	key := ix.key(dir)
+	if key == "" {
+		return ""
+	}
+	return key + "/"
+}
+
+// Update the index for everything in dir, removing any objects which
+// no longer exist. Use "" for the whole of the root.
+func (ix *Index) Update(ctx context.Context, dir string) (stats Stats, err error) {
+	start := time.Now()
+	seen := make(map[string]struct{})
+	batch := make([]fs.Object, 0, batchSize)
+	flush := func() error {
+		err := ix.put(ctx, batch, &stats)
+		for _, o := range batch {
+			seen[ix.key(o.Remote())] = struct{}{}
+		}
+		batch = batch[:0]
+		return err
+	}
+	err = walk.ListR(ctx, ix.f, dir, false, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok {
+				continue
+			}
+			batch = append(batch, o)
+			if len(batch) >= batchSize {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return stats, err
+	}
+
+	// Remove the objects which weren't seen, leaving the ones which
+	// were excluded by the filters alone
+	fi := filter.GetConfig(ctx)
+	dirKey := ix.dirKey(dir)
+	rootKey := ix.dirKey("")
+	err = ix.do(true, func(b kv.Bucket) error {
+		var remove []string
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(dirKey)); k != nil && strings.HasPrefix(string(k), dirKey); k, v = c.Next() {
+			key := string(k)
+			if strings.HasPrefix(key, "\x00") {
+				continue
+			}
+			if _, found := seen[key]; found {
+				continue
+			}
+			var entry Entry
+			if json.Unmarshal(v, &entry) == nil && !fi.Include(strings.TrimPrefix(key, rootKey), entry.Size, entry.ModTime, entry.Metadata) {
+				continue
+			}
+			remove = append(remove, key)
+		}
+		for _, key := range remove {
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+		}
+		stats.Removed += len(remove)
+		if dir != "" {
+			return nil
+		}
+		data, err := json.Marshal(rootRecord{Updated: start})
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(rootPrefix+ix.key("")), data)
+	})
+	return stats, err
+}
+
+// UpdateObject updates the index for the object at remote, removing
+// it and anything under it if it no longer exists
+func (ix *Index) UpdateObject(ctx context.Context, remote string) (stats Stats, err error) {
+	o, err := ix.f.NewObject(ctx, remote)
+	switch err {
+	case nil:
+		err = ix.put(ctx, []fs.Object{o}, &stats)
+		return stats, err
+	case fs.ErrorIsDir:
+		return ix.Update(ctx, remote)
+	case fs.ErrorObjectNotFound, fs.ErrorNotAFile:
+	default:
+		return stats, err
+	}
+	key := ix.key(remote)
+	dirKey := key + "/"
+	err = ix.do(true, func(b kv.Bucket) error {
+		remove := []string{key}
+		c := b.Cursor()
+		for k, _ := c.Seek([]byte(dirKey)); k != nil && strings.HasPrefix(string(k), dirKey); k, _ = c.Next() {
+			remove = append(remove, string(k))
+		}
+		for _, key := range remove {
+			if b.Get([]byte(key)) == nil {
+				continue
+			}
+			if err := b.Delete([]byte(key)); err != nil {
+				return err
+			}
+			stats.Removed++
+		}
+		return nil
+	})
+	return stats, err
+}
+
+// upToDate returns true if old has everything needed to describe an
+// object of size and modTime
+func (ix *Index) upToDate(old *Entry, size int64, modTime time.Time) bool {
+	if old.Size != size || !old.ModTime.Equal(modTime) {
+		return false
+	}
+	for _, ht := range ix.opt.Hashes {
+		if _, ok := old.Hashes[ht.String()]; !ok {
+			return false
+		}
+	}
+	return !ix.opt.Metadata || old.Metadata != nil
+}
+
+// put the objects into the index, only reading the hashes and
+// metadata of the ones which have changed
+func (ix *Index) put(ctx context.Context, objects []fs.Object, stats *Stats) error {
+	if len(objects) == 0 {
+		return nil
+	}
+	keys := make([]string, len(objects))
+	for i, o := range objects {
+		keys[i] = ix.key(o.Remote())
+	}
+
+	// Read what is in the index already
+	old := make([]*Entry, len(objects))
+	err := ix.do(false, func(b kv.Bucket) error {
+		for i, key := range keys {
+			data := b.Get([]byte(key))
+			if data == nil {
+				continue
+			}
+			var entry Entry
+			if err := json.Unmarshal(data, &entry); err != nil {
+				fs.Debugf(key, "Ignoring corrupt index entry: %v", err)
+				continue
+			}
+			old[i] = &entry
+		}
+		return nil
+	})
+	if err != nil && err != ErrNotIndexed {
+		return err
+	}
+
+	// Make entries for the objects which have changed
+	entries := make([]*Entry, len(objects))
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(fs.GetConfig(ctx).Checkers)
+	for i, o := range objects {
+		modTime := o.ModTime(ctx)
+		if old[i] != nil && ix.upToDate(old[i], o.Size(), modTime) {
+			stats.Unchanged++
+			continue
+		}
+		if old[i] == nil {
+			stats.New++
+		} else {
+			stats.Changed++
+		}
+		g.Go(func() error {
+			entry := &Entry{
+				Size:     o.Size(),
+				ModTime:  modTime,
+				MimeType: fs.MimeType(gCtx, o),
+			}
+			for _, ht := range ix.opt.Hashes {
+				sum, err := o.Hash(gCtx, ht)
+				if err != nil {
+					fs.Errorf(o, "Failed to read %v hash for index: %v", ht, err)
+					continue
+				}
+				// Empty hashes are recorded so they aren't read again
+				if entry.Hashes == nil {
+					entry.Hashes = make(map[string]string, len(ix.opt.Hashes))
+				}
+				entry.Hashes[ht.String()] = sum
+			}
+			if ix.opt.Metadata {
+				metadata, err := fs.GetMetadata(gCtx, o)
+				if err != nil {
+					fs.Errorf(o, "Failed to read metadata for index: %v", err)
+				}
+				if metadata == nil {
+					metadata = fs.Metadata{}
+				}
+				entry.Metadata = metadata
+			}
+			entries[i] = entry
+			return nil
+		})
+	}
+	err = g.Wait()
+	if err != nil {
+		return err
+	}
+
+	// Write the changes
+	return ix.do(true, func(b kv.Bucket) error {
+		for i, entry := range entries {
+			if entry == nil {
+				continue
+			}
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(keys[i]), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Watch keeps the index up to date using the change notifications from
+// the remote until ctx is cancelled
+func (ix *Index) Watch(ctx context.Context, pollInterval time.Duration) error {
+	doChangeNotify := ix.f.Features().ChangeNotify
+	if doChangeNotify == nil {
+		return errors.New("remote doesn't support change notifications")
+	}
+	pollChan := make(chan time.Duration)
+	doChangeNotify(ctx, func(remote string, entryType fs.EntryType) {
+		var stats Stats
+		var err error
+		if entryType == fs.EntryDirectory {
+			stats, err = ix.Update(ctx, remote)
+			if errors.Is(err, fs.ErrorDirNotFound) {
+				stats, err = ix.UpdateObject(ctx, remote)
+			}
+		} else {
+			stats, err = ix.UpdateObject(ctx, remote)
+		}
+		if err != nil {
+			fs.Errorf(remote, "Failed to update index: %v", err)
+			return
+		}
+		fs.Infof(remote, "Updated index: %v", stats)
+	}, pollChan)
+	pollChan <- pollInterval
+	<-ctx.Done()
+	close(pollChan)
+	return nil
+}
+
+// Updated returns when the root, or the nearest directory above it,
+// was last indexed completely, or the zero time if it never was.
+func (ix *Index) Updated() (updated time.Time, err error) {
+	err = ix.do(false, func(b kv.Bucket) error {
+		key := ix.key("")
+		for {
+			data := b.Get([]byte(rootPrefix + key))
+			if data != nil {
+				var record rootRecord
+				if err := json.Unmarshal(data, &record); err != nil {
+					return err
+				}
+				updated = record.Updated
+				return nil
+			}
+			if key == "" {
+				return nil
+			}
+			key = path.Dir(key)
+			if key == "." || key == "/" {
+				key = ""
+			}
+		}
+	})
+	if err == ErrNotIndexed {
+		return updated, nil
+	}
+	return updated, err
+}
+
+// Search calls fn for each object in the index under the root which
+// is included by the filters in ctx, in path order. The Path of each
+// entry is set relative to the root.
+func (ix *Index) Search(ctx context.Context, fn func(entry *Entry) error) error {
+	fi := filter.GetConfig(ctx)
+	rootKey := ix.dirKey("")
+	return ix.do(false, func(b kv.Bucket) error {
+		c := b.Cursor()
+		for k, v := c.Seek([]byte(rootKey)); k != nil && strings.HasPrefix(string(k), rootKey); k, v = c.Next() {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if len(k) == 0 || k[0] == 0 {
+				continue
+			}
+			var entry Entry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				fs.Debugf(string(k), "Ignoring corrupt index entry: %v", err)
+				continue
+			}
+			remote := strings.TrimPrefix(string(k), rootKey)
+			if !fi.Include(remote, entry.Size, entry.ModTime, entry.Metadata) {
+				continue
+			}
+			entry.Path = remote
+			if err := fn(&entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
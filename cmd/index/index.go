@@ -0,0 +1,118 @@
+// Package index provides the index command and the index it maintains.
+package index
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/lib/atexit"
+	"github.com/spf13/cobra"
+)
+
+var (
+	hashNames    []string
+	withMetadata bool
+	watch        bool
+	pollInterval = fs.Duration(time.Minute)
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.StringArrayVarP(cmdFlags, &hashNames, "hash", "", nil, "Hash type to record, eg MD5 - may be repeated (default all the remote supports unless slow)", "")
+	flags.BoolVarP(cmdFlags, &withMetadata, "metadata", "M", false, "Record metadata in the index", "")
+	flags.BoolVarP(cmdFlags, &watch, "watch", "", false, "Keep updating the index with changes on the remote until stopped", "")
+	flags.FVarP(cmdFlags, &pollInterval, "poll-interval", "", "Time to wait between polling for changes with --watch", "")
+}
+
+// parseHashes parses the names of the hashes to record
+func parseHashes(names []string) (hashes []hash.Type, err error) {
+	for _, name := range names {
+		var ht hash.Type
+		if err := ht.Set(name); err != nil {
+			return nil, fmt.Errorf("bad --hash: %w", err)
+		}
+		hashes = append(hashes, ht)
+	}
+	return hashes, nil
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "index remote:path",
+	Short: `Build or refresh a local index of the objects in remote:path.`,
+	Long: `Lists remote:path and records the path, size, modification time,
+MIME type and hashes of every object in it in a local database, so
+that ` + "`rclone search`" + ` can answer queries without listing the remote.
+
+Running the command again refreshes the index. The hashes and metadata
+are only read again for objects whose size or modification time have
+changed and objects which no longer exist are removed from the index.
+Use ` + "`--fast-list`" + ` to list remotes which support it with fewer
+transactions.
+
+By default the hashes the remote supports are recorded unless reading
+them is slow, as it is on the local disk. Use ` + "`--hash`" + ` to choose
+which are recorded instead. Use ` + "`--metadata`" + ` to record the
+metadata of each object too so it can be searched with the metadata
+filters.
+
+With ` + "`--watch`" + ` the command keeps running after the index is built
+and applies changes on the remote to it as they are noticed, polling
+every ` + "`--poll-interval`" + `. This needs a remote which supports
+change notifications, such as Google Drive.
+
+The filter flags can be used to choose what is indexed. Objects which
+are excluded are left in the index as they are.
+
+There is a database for each remote in the ` + "`kv`" + ` directory of the
+cache directory, which is shared by indexes of different paths on the
+remote. Indexing a path also indexes every path within it.
+
+Eg
+
+    rclone index remote:photos
+    rclone index remote:docs --hash MD5 --metadata
+    rclone index drive: --watch
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.71",
+		"groups":            "Filter,Listing",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		fsrc := cmd.NewFsSrc(args)
+		cmd.Run(false, false, command, func() error {
+			ctx := context.Background()
+			hashes, err := parseHashes(hashNames)
+			if err != nil {
+				return err
+			}
+			ix, err := Open(ctx, fsrc, &Options{
+				Hashes:   hashes,
+				Metadata: withMetadata,
+			})
+			if err != nil {
+				return err
+			}
+			defer func() {
+				_ = ix.Close()
+			}()
+			stats, err := ix.Update(ctx, "")
+			if err != nil {
+				return err
+			}
+			fs.Infof(fsrc, "Indexed: %v", stats)
+			if !watch {
+				return nil
+			}
+			ctx, cancel := context.WithCancel(ctx)
+			defer atexit.Unregister(atexit.Register(cancel))
+			return ix.Watch(ctx, time.Duration(pollInterval))
+		})
+	},
+}
@@ -0,0 +1,118 @@
+package index
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/hash"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// search returns the paths of the entries in the index matching fi
+func search(t *testing.T, ctx context.Context, ix *Index, fi *filter.Filter) (paths []string) {
+	if fi != nil {
+		ctx = filter.ReplaceConfig(ctx, fi)
+	}
+	err := ix.Search(ctx, func(entry *Entry) error {
+		paths = append(paths, entry.Path)
+		return nil
+	})
+	require.NoError(t, err)
+	return paths
+}
+
+func TestIndex(t *testing.T) {
+	fstest.Initialise()
+	ctx := context.Background()
+	dir := t.TempDir()
+	write := func(name, contents string, modTime time.Time) {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0777))
+		require.NoError(t, os.WriteFile(p, []byte(contents), 0666))
+		require.NoError(t, os.Chtimes(p, modTime, modTime))
+	}
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	write("a/photo.jpg", "jpeg", old)
+	write("a/b/doc.txt", "some text", time.Now())
+	write("big.bin", "0123456789abcdef", old)
+
+	f, err := fs.NewFs(ctx, dir)
+	require.NoError(t, err)
+	ix, err := Open(ctx, f, &Options{Hashes: []hash.Type{hash.MD5}})
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, ix.Close())
+	}()
+
+	updated, err := ix.Updated()
+	require.NoError(t, err)
+	assert.True(t, updated.IsZero())
+
+	stats, err := ix.Update(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, Stats{New: 3}, stats)
+	updated, err = ix.Updated()
+	require.NoError(t, err)
+	assert.False(t, updated.IsZero())
+
+	var entries []Entry
+	require.NoError(t, ix.Search(ctx, func(entry *Entry) error {
+		entries = append(entries, *entry)
+		return nil
+	}))
+	require.Len(t, entries, 3)
+	assert.Equal(t, "a/b/doc.txt", entries[0].Path)
+	assert.Equal(t, int64(9), entries[0].Size)
+	assert.Equal(t, "text/plain; charset=utf-8", entries[0].MimeType)
+	assert.Equal(t, "552e21cd4cd9918678e3c1a0df491bc3", entries[0].Hashes["md5"])
+
+	// Search with the filters
+	fi, err := filter.NewFilter(nil)
+	require.NoError(t, err)
+	require.NoError(t, fi.AddRule("+ *.jpg"))
+	require.NoError(t, fi.AddRule("- *"))
+	assert.Equal(t, []string{"a/photo.jpg"}, search(t, ctx, ix, fi))
+	fi, err = filter.NewFilter(&filter.Options{MinSize: 5, MaxSize: -1, MaxAge: fs.Duration(30 * 24 * time.Hour)})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a/b/doc.txt"}, search(t, ctx, ix, fi))
+
+	// Changes are picked up incrementally
+	write("a/photo.jpg", "bigger jpeg", time.Now())
+	require.NoError(t, os.Remove(filepath.Join(dir, "big.bin")))
+	stats, err = ix.Update(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Changed: 1, Unchanged: 1, Removed: 1}, stats)
+	assert.Equal(t, []string{"a/b/doc.txt", "a/photo.jpg"}, search(t, ctx, ix, nil))
+
+	// Single objects can be updated
+	write("a/new.txt", "new", time.Now())
+	stats, err = ix.UpdateObject(ctx, "a/new.txt")
+	require.NoError(t, err)
+	assert.Equal(t, Stats{New: 1}, stats)
+	require.NoError(t, os.RemoveAll(filepath.Join(dir, "a", "b")))
+	stats, err = ix.UpdateObject(ctx, "a/b")
+	require.NoError(t, err)
+	assert.Equal(t, Stats{Removed: 1}, stats)
+	assert.Equal(t, []string{"a/new.txt", "a/photo.jpg"}, search(t, ctx, ix, nil))
+
+	// A path within the root is covered by the index of the root
+	fsub, err := fs.NewFs(ctx, filepath.Join(dir, "a"))
+	require.NoError(t, err)
+	ixSub, err := Open(ctx, fsub, nil)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, ixSub.Close())
+	}()
+	subUpdated, err := ixSub.Updated()
+	require.NoError(t, err)
+	assert.Equal(t, updated.Unix(), subUpdated.Unix())
+	assert.Equal(t, []string{"new.txt", "photo.jpg"}, search(t, ctx, ixSub, nil))
+}
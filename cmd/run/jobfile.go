@@ -0,0 +1,325 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/config/configstruct"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fs/sync"
+	"gopkg.in/yaml.v3"
+)
+
+// Operations a job can do
+var operationNames = []string{"sync", "copy", "move", "check"}
+
+// JobFile is the contents of a job file
+type JobFile struct {
+	Parallel int            `json:"parallel" yaml:"parallel"` // number of jobs to run at once
+	Config   map[string]any `json:"config" yaml:"config"`     // config options for all jobs
+	Filter   map[string]any `json:"filter" yaml:"filter"`     // filter options for all jobs
+	Jobs     []*Job         `json:"jobs" yaml:"jobs"`         // the jobs
+}
+
+// Job describes a single job in a job file
+type Job struct {
+	Name               string         `json:"name" yaml:"name"`
+	Operation          string         `json:"operation" yaml:"operation"`
+	Source             string         `json:"source" yaml:"source"`
+	Destination        string         `json:"destination" yaml:"destination"`
+	Config             map[string]any `json:"config" yaml:"config"`
+	Filter             map[string]any `json:"filter" yaml:"filter"`
+	Schedule           string         `json:"schedule" yaml:"schedule"`
+	CreateEmptySrcDirs bool           `json:"create_empty_src_dirs" yaml:"create_empty_src_dirs"`
+	DeleteEmptySrcDirs bool           `json:"delete_empty_src_dirs" yaml:"delete_empty_src_dirs"`
+
+	interval time.Duration // parsed Schedule
+}
+
+// ReadJobFile reads and checks the job file at path.
+//
+// Files ending in .json are read as JSON, anything else as YAML.
+func ReadJobFile(path string) (*JobFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	jf := new(JobFile)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(jf)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		err = dec.Decode(jf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse job file %q: %w", path, err)
+	}
+	err = jf.check()
+	if err != nil {
+		return nil, fmt.Errorf("bad job file %q: %w", path, err)
+	}
+	return jf, nil
+}
+
+// check the job file is valid, filling in defaults
+func (jf *JobFile) check() error {
+	if len(jf.Jobs) == 0 {
+		return errors.New("no jobs found")
+	}
+	if jf.Parallel <= 0 {
+		jf.Parallel = 1
+	}
+	// Check the options parse here so errors are found before
+	// any of the jobs have run
+	ctx := context.Background()
+	if _, err := jf.addOptions(ctx, nil); err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(jf.Jobs))
+	for i, job := range jf.Jobs {
+		if job == nil {
+			return fmt.Errorf("job %d is empty", i+1)
+		}
+		if job.Name == "" {
+			return fmt.Errorf("job %d has no name", i+1)
+		}
+		if seen[job.Name] {
+			return fmt.Errorf("duplicate job name %q", job.Name)
+		}
+		seen[job.Name] = true
+		err := job.check()
+		if err != nil {
+			return fmt.Errorf("job %q: %w", job.Name, err)
+		}
+		if _, err := jf.addOptions(ctx, job); err != nil {
+			return fmt.Errorf("job %q: %w", job.Name, err)
+		}
+	}
+	return nil
+}
+
+// check the job is valid
+func (job *Job) check() (err error) {
+	job.Operation = strings.ToLower(job.Operation)
+	found := false
+	for _, name := range operationNames {
+		if job.Operation == name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown operation %q - must be one of %s", job.Operation, strings.Join(operationNames, ", "))
+	}
+	if job.Source == "" || job.Destination == "" {
+		return errors.New("source and destination must be set")
+	}
+	if job.DeleteEmptySrcDirs && job.Operation != "move" {
+		return errors.New("delete_empty_src_dirs can only be used with move")
+	}
+	job.interval = 0
+	if job.Schedule != "" {
+		d, err := fs.ParseDuration(job.Schedule)
+		if err != nil {
+			return fmt.Errorf("bad schedule: %w", err)
+		}
+		if d <= 0 {
+			return errors.New("schedule must be a positive duration")
+		}
+		job.interval = d
+	}
+	return nil
+}
+
+// Turn the values read from the job file into the types configstruct
+// understands, normalising the option names as it goes.
+func normaliseOptions(in map[string]any) (map[string]any, error) {
+	out := make(map[string]any, len(in))
+	for name, value := range in {
+		name = strings.ReplaceAll(strings.TrimLeft(name, "-"), "-", "_")
+		switch x := value.(type) {
+		case []any:
+			ss := make([]string, len(x))
+			for i, v := range x {
+				ss[i] = fmt.Sprint(v)
+			}
+			value = ss
+		case map[string]any, nil:
+			return nil, fmt.Errorf("option %q: unsupported value %v", name, value)
+		}
+		out[name] = value
+	}
+	return out, nil
+}
+
+// setOptions sets the options in opt from in, returning an error if
+// any are unknown.
+func setOptions(what string, in map[string]any, opt any) error {
+	if len(in) == 0 {
+		return nil
+	}
+	values, err := normaliseOptions(in)
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	items, err := configstruct.Items(opt)
+	if err != nil {
+		return err
+	}
+	known := make(map[string]bool, len(items))
+	for _, item := range items {
+		known[item.Name] = true
+	}
+	for name := range values {
+		if !known[name] {
+			return fmt.Errorf("%s: unknown option %q", what, name)
+		}
+	}
+	err = configstruct.SetAny(values, opt)
+	if err != nil {
+		return fmt.Errorf("%s: %w", what, err)
+	}
+	return nil
+}
+
+// addOptions returns a new context with the config and filter options
+// from the job file and job (if not nil) applied on top of those
+// already in ctx.
+func (jf *JobFile) addOptions(ctx context.Context, job *Job) (context.Context, error) {
+	ctx, ci := fs.AddConfig(ctx)
+	opt := filter.GetConfig(ctx).Opt
+	err := setOptions("config", jf.Config, ci)
+	if err != nil {
+		return ctx, err
+	}
+	err = setOptions("filter", jf.Filter, &opt)
+	if err != nil {
+		return ctx, err
+	}
+	if job != nil {
+		err = setOptions("config", job.Config, ci)
+		if err != nil {
+			return ctx, err
+		}
+		err = setOptions("filter", job.Filter, &opt)
+		if err != nil {
+			return ctx, err
+		}
+	}
+	fi, err := filter.NewFilter(&opt)
+	if err != nil {
+		return ctx, fmt.Errorf("filter: %w", err)
+	}
+	return filter.ReplaceConfig(ctx, fi), nil
+}
+
+// do runs the operation for the job once
+func (job *Job) do(ctx context.Context) error {
+	fsrc, err := cache.Get(ctx, job.Source)
+	if err == fs.ErrorIsFile {
+		return fmt.Errorf("source %q must be a directory", job.Source)
+	} else if err != nil {
+		return err
+	}
+	fdst, err := cache.Get(ctx, job.Destination)
+	if err == fs.ErrorIsFile {
+		return fmt.Errorf("destination %q must be a directory", job.Destination)
+	} else if err != nil {
+		return err
+	}
+	switch job.Operation {
+	case "sync":
+		return sync.Sync(ctx, fdst, fsrc, job.CreateEmptySrcDirs)
+	case "copy":
+		return sync.CopyDir(ctx, fdst, fsrc, job.CreateEmptySrcDirs)
+	case "move":
+		return sync.MoveDir(ctx, fdst, fsrc, job.DeleteEmptySrcDirs, job.CreateEmptySrcDirs)
+	case "check":
+		return operations.Check(ctx, &operations.CheckOpt{Fdst: fdst, Fsrc: fsrc})
+	}
+	return fmt.Errorf("unknown operation %q", job.Operation)
+}
+
+// Result is the outcome of running a job once
+type Result struct {
+	Name        string        `json:"name"`
+	Operation   string        `json:"operation"`
+	Source      string        `json:"source"`
+	Destination string        `json:"destination"`
+	Group       string        `json:"group"`
+	Start       time.Time     `json:"start"`
+	Duration    time.Duration `json:"duration"`
+	Bytes       int64         `json:"bytes"`
+	Transfers   int64         `json:"transfers"`
+	Checks      int64         `json:"checks"`
+	Deletes     int64         `json:"deletes"`
+	Renames     int64         `json:"renames"`
+	Errors      int64         `json:"errors"`
+	Error       string        `json:"error,omitempty"`
+}
+
+// run the job, retrying as set by --retries, returning the result
+func (jf *JobFile) run(ctx context.Context, job *Job) (result Result) {
+	group := "run/" + job.Name
+	ctx = accounting.WithStatsGroup(ctx, group)
+	stats := accounting.Stats(ctx)
+	stats.ResetCounters()
+	result = Result{
+		Name:        job.Name,
+		Operation:   job.Operation,
+		Source:      job.Source,
+		Destination: job.Destination,
+		Group:       group,
+		Start:       time.Now(),
+	}
+	ctx, err := jf.addOptions(ctx, job)
+	if err == nil {
+		ci := fs.GetConfig(ctx)
+		fs.Infof(nil, "Job %q: starting %s from %q to %q", job.Name, job.Operation, job.Source, job.Destination)
+		for try := 1; try <= ci.Retries; try++ {
+			err = fs.CountError(ctx, job.do(ctx))
+			if err == nil {
+				err = stats.GetLastError()
+			}
+			if err == nil {
+				break
+			}
+			if stats.HadFatalError() || !stats.HadRetryError() || try == ci.Retries {
+				break
+			}
+			fs.Errorf(nil, "Job %q: attempt %d/%d failed with %d errors and: %v", job.Name, try, ci.Retries, stats.GetErrors(), err)
+			stats.ResetErrors()
+			if ci.RetriesInterval > 0 {
+				time.Sleep(time.Duration(ci.RetriesInterval))
+			}
+		}
+	}
+	result.Duration = time.Since(result.Start)
+	result.Bytes = stats.GetBytes()
+	result.Transfers = stats.GetTransfers()
+	result.Checks = stats.GetChecks()
+	result.Deletes = stats.GetDeletes()
+	result.Renames = stats.Renames(0)
+	result.Errors = stats.GetErrors()
+	if err != nil {
+		result.Error = err.Error()
+		fs.Errorf(nil, "Job %q: failed: %v", job.Name, err)
+	} else {
+		fs.Infof(nil, "Job %q: finished in %v", job.Name, result.Duration.Truncate(time.Millisecond))
+	}
+	return result
+}
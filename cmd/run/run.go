@@ -0,0 +1,273 @@
+// Package run provides the run command.
+package run
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/spf13/cobra"
+)
+
+var (
+	jsonOutput bool
+	once       bool
+	parallel   int
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.BoolVarP(cmdFlags, &jsonOutput, "json", "", false, "Format the summary report as JSON", "")
+	flags.BoolVarP(cmdFlags, &once, "once", "", false, "Run each job once ignoring any schedule", "")
+	flags.IntVarP(cmdFlags, &parallel, "parallel", "", 0, "Number of jobs to run at once, overriding the job file", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "run jobfile [job...]",
+	Short: `Run the sync jobs described in a job file.`,
+	// Warning! "|" will be replaced by backticks below
+	Long: strings.ReplaceAll(`Run the named sync, copy, move and check jobs described in a YAML
+or JSON job file, then print a summary report.
+
+If any job names are given then only those jobs are run, otherwise all
+the jobs in the file are run in the order they appear. Files ending in
+|.json| are read as JSON, anything else as YAML.
+
+Here is an example job file:
+
+|||yaml
+# Run up to 2 jobs at once
+parallel: 2
+# Config options for all jobs
+config:
+  transfers: 8
+# Filter options for all jobs
+filter:
+  exclude:
+    - "*.tmp"
+jobs:
+  - name: photos
+    operation: sync
+    source: /home/user/photos
+    destination: remote:backup/photos
+    config:
+      checksum: true
+      backup_dir: remote:backup/old-photos
+  - name: documents
+    operation: copy
+    source: /home/user/documents
+    destination: remote:backup/documents
+    filter:
+      max_age: 1w
+    schedule: 1h
+|||
+
+Each job has these fields:
+
+- |name| - the name of the job (required, must be unique)
+- |operation| - one of |sync|, |copy|, |move| or |check| (required)
+- |source| - the source remote and path (required)
+- |destination| - the destination remote and path (required)
+- |config| - config options for this job
+- |filter| - filter options for this job
+- |schedule| - run the job again this long after it last started, eg |30m|
+- |create_empty_src_dirs| - create empty source dirs on the destination
+- |delete_empty_src_dirs| - delete empty source dirs after a move
+
+The |config| and |filter| sections take the same options as the
+command line flags, with either |_| or |-| in the names, so
+|--max-age 1d| becomes |max_age: 1d|. Options from the command line are
+used as the defaults, then the top level sections of the job file are
+applied, then the sections in the job. Options which control logging
+or the rc have no effect here.
+
+Each job is run in its own stats group called |run/name| so its stats
+can be seen separately in the rc, and it is retried according to
+|--retries| on its own. At the end a table summarising each job is
+printed, or a JSON list of results if |--json| is given. The command
+returns an error if any of the jobs failed.
+
+If any of the jobs being run have a |schedule| then the command runs
+until interrupted, running each scheduled job again once the interval
+has passed since it last started, and printing a summary line as each
+job finishes. Use |--once| to run every job once, ignoring the
+schedules.
+`, "|", "`"),
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.71",
+		"groups":            "Sync,Copy,Filter,Listing,Important",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1000000, command, args)
+		jf, err := ReadJobFile(args[0])
+		if err != nil {
+			fs.Fatal(nil, err.Error())
+		}
+		jobs, err := jf.selectJobs(args[1:])
+		if err != nil {
+			fs.Fatal(nil, err.Error())
+		}
+		if parallel > 0 {
+			jf.Parallel = parallel
+		}
+		cmd.Run(false, false, command, func() error {
+			results := jf.Run(context.Background(), jobs, once, os.Stdout)
+			return writeReport(os.Stdout, results, jsonOutput)
+		})
+	},
+}
+
+// selectJobs returns the jobs called names or all the jobs if there
+// are no names.
+func (jf *JobFile) selectJobs(names []string) ([]*Job, error) {
+	if len(names) == 0 {
+		return jf.Jobs, nil
+	}
+	var jobs []*Job
+	for _, job := range jf.Jobs {
+		if slices.Contains(names, job.Name) {
+			jobs = append(jobs, job)
+		}
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(jobs, func(job *Job) bool { return job.Name == name }) {
+			return nil, fmt.Errorf("job %q not found in job file", name)
+		}
+	}
+	return jobs, nil
+}
+
+// Run the jobs with up to jf.Parallel at once, returning the results
+// in the order of jobs.
+//
+// Jobs are started in order. If once is false then jobs with a
+// schedule are run repeatedly until ctx is cancelled, with a summary
+// line for each run written to out.
+func (jf *JobFile) Run(ctx context.Context, jobs []*Job, once bool, out io.Writer) []Result {
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		tokens  = make(chan struct{}, max(jf.Parallel, 1))
+		results = make([]Result, len(jobs))
+		looping = !once && slices.ContainsFunc(jobs, func(job *Job) bool { return job.interval > 0 })
+	)
+	if looping {
+		writeReportHeader(out)
+	}
+	for i, job := range jobs {
+		// Take the token here so jobs start in order
+		select {
+		case tokens <- struct{}{}:
+		case <-ctx.Done():
+			return results[:i]
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				result := jf.run(ctx, job)
+				<-tokens
+				mu.Lock()
+				results[i] = result
+				if looping {
+					writeReportLine(out, result)
+				}
+				mu.Unlock()
+				if once || job.interval == 0 {
+					return
+				}
+				next := time.Until(result.Start.Add(job.interval))
+				fs.Infof(nil, "Job %q: next run in %v", job.Name, next.Truncate(time.Second))
+				select {
+				case <-time.After(next):
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case tokens <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// Write the table header for the report
+func writeReportHeader(out io.Writer) {
+	_, _ = fmt.Fprintf(out, "%-20s %-6s %-6s %10s %9s %9s %9s %9s %10s\n", "Job", "Op", "Status", "Bytes", "Transfers", "Checks", "Deletes", "Errors", "Duration")
+}
+
+// Write a line for result to the report
+func writeReportLine(out io.Writer, result Result) {
+	status := "OK"
+	if result.Error != "" {
+		status = "FAILED"
+	}
+	_, _ = fmt.Fprintf(out, "%-20s %-6s %-6s %10s %9d %9d %9d %9d %10v\n",
+		result.Name, result.Operation, status, fs.SizeSuffix(result.Bytes).ByteUnit(),
+		result.Transfers, result.Checks, result.Deletes, result.Errors,
+		result.Duration.Truncate(time.Millisecond))
+}
+
+// writeReport writes the summary of results to out returning an error
+// if any of the jobs failed.
+func writeReport(out io.Writer, results []Result, asJSON bool) error {
+	failed := 0
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+		}
+	}
+	if asJSON {
+		if results == nil {
+			results = []Result{}
+		}
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "\t")
+		if err := enc.Encode(results); err != nil {
+			return err
+		}
+	} else {
+		writeReportHeader(out)
+		var total Result
+		var end time.Time
+		for _, result := range results {
+			writeReportLine(out, result)
+			total.Bytes += result.Bytes
+			total.Transfers += result.Transfers
+			total.Checks += result.Checks
+			total.Deletes += result.Deletes
+			total.Errors += result.Errors
+			if total.Start.IsZero() || result.Start.Before(total.Start) {
+				total.Start = result.Start
+			}
+			if resultEnd := result.Start.Add(result.Duration); resultEnd.After(end) {
+				end = resultEnd
+			}
+		}
+		// Wall clock time of all the jobs as they may run in parallel
+		total.Duration = end.Sub(total.Start)
+		total.Name = fmt.Sprintf("Total (%d jobs)", len(results))
+		if failed > 0 {
+			total.Error = "failed"
+		}
+		writeReportLine(out, total)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d jobs failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package run
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/rclone/rclone/backend/local"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/filter"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, path, contents string) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0777))
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0666))
+}
+
+func TestReadJobFile(t *testing.T) {
+	dir := t.TempDir()
+	for _, test := range []struct {
+		name    string
+		in      string
+		wantErr string
+	}{
+		{"ok.yaml", `
+config:
+  transfers: 2
+jobs:
+  - name: one
+    operation: Sync
+    source: /a
+    destination: /b
+    config:
+      dry-run: true
+    filter:
+      exclude: ["*.tmp", "*.bak"]
+      max_age: 1d
+    schedule: 1h
+`, ""},
+		{"ok.json", `{"jobs": [{"name": "one", "operation": "copy", "source": "/a", "destination": "/b"}]}`, ""},
+		{"empty.yaml", `parallel: 2`, "no jobs found"},
+		{"unknown.yaml", "jobs:\n  - name: one\n    operations: copy\n", "field operations not found"},
+		{"unknown.json", `{"jobs": [{"name": "one", "src": "/a"}]}`, `unknown field "src"`},
+		{"noname.yaml", "jobs:\n  - operation: copy\n    source: /a\n    destination: /b\n", "job 1 has no name"},
+		{"dup.yaml", "jobs:\n  - {name: a, operation: copy, source: /a, destination: /b}\n  - {name: a, operation: copy, source: /a, destination: /b}\n", `duplicate job name "a"`},
+		{"op.yaml", "jobs:\n  - {name: a, operation: mirror, source: /a, destination: /b}\n", `unknown operation "mirror"`},
+		{"src.yaml", "jobs:\n  - {name: a, operation: copy, destination: /b}\n", "source and destination must be set"},
+		{"schedule.yaml", "jobs:\n  - {name: a, operation: copy, source: /a, destination: /b, schedule: soon}\n", "bad schedule"},
+		{"delete.yaml", "jobs:\n  - {name: a, operation: copy, source: /a, destination: /b, delete_empty_src_dirs: true}\n", "only be used with move"},
+		{"config.yaml", "config: {transfer: 2}\njobs:\n  - {name: a, operation: copy, source: /a, destination: /b}\n", `unknown option "transfer"`},
+		{"value.yaml", "jobs:\n  - {name: a, operation: copy, source: /a, destination: /b, config: {transfers: lots}}\n", `job "a": config: couldn't parse config item "transfers"`},
+		{"filter.yaml", "jobs:\n  - {name: a, operation: copy, source: /a, destination: /b, filter: {filter: [bad]}}\n", `job "a": filter:`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(dir, test.name)
+			writeFile(t, path, test.in)
+			jf, err := ReadJobFile(path)
+			if test.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, jf.Jobs, 1)
+			assert.Equal(t, 1, jf.Parallel)
+		})
+	}
+}
+
+func TestJobOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.yaml")
+	writeFile(t, path, `
+config:
+  transfers: 2
+  checksum: true
+filter:
+  exclude: ["*.tmp"]
+jobs:
+  - name: one
+    operation: copy
+    source: /a
+    destination: /b
+    config:
+      transfers: 3
+      --dry-run: true
+    filter:
+      max-age: 1d
+    schedule: 2h
+`)
+	jf, err := ReadJobFile(path)
+	require.NoError(t, err)
+	job := jf.Jobs[0]
+	assert.Equal(t, "2h0m0s", job.interval.String())
+
+	ctx := context.Background()
+	jobCtx, err := jf.addOptions(ctx, job)
+	require.NoError(t, err)
+	ci := fs.GetConfig(jobCtx)
+	assert.Equal(t, 3, ci.Transfers)
+	assert.True(t, ci.CheckSum)
+	assert.True(t, ci.DryRun)
+	fi := filter.GetConfig(jobCtx)
+	assert.Equal(t, []string{"*.tmp"}, fi.Opt.ExcludeRule)
+	assert.Equal(t, fs.Duration(24*60*60*1e9), fi.Opt.MaxAge)
+
+	// The global config is unchanged
+	assert.False(t, fs.GetConfig(ctx).DryRun)
+	assert.True(t, filter.GetConfig(ctx).InActive())
+}
+
+func TestRun(t *testing.T) {
+	fstest.Initialise()
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	writeFile(t, filepath.Join(src, "file1"), "file1 contents")
+	writeFile(t, filepath.Join(src, "sub", "file2"), "file2")
+	writeFile(t, filepath.Join(src, "file3.tmp"), "temporary")
+	writeFile(t, filepath.Join(dir, "dst2", "old"), "old")
+	path := filepath.Join(dir, "jobs.yaml")
+	writeFile(t, path, `
+parallel: 2
+filter:
+  exclude: ["*.tmp"]
+jobs:
+  - name: copy
+    operation: copy
+    source: `+filepath.Join(dir, "src")+`
+    destination: `+filepath.Join(dir, "dst1")+`
+  - name: sync
+    operation: sync
+    source: `+filepath.Join(dir, "src")+`
+    destination: `+filepath.Join(dir, "dst2")+`
+  - name: check
+    operation: check
+    source: `+filepath.Join(dir, "src")+`
+    destination: `+filepath.Join(dir, "missing")+`
+    config:
+      retries: 1
+    schedule: 1h
+`)
+	jf, err := ReadJobFile(path)
+	require.NoError(t, err)
+
+	jobs, err := jf.selectJobs([]string{"sync", "copy"})
+	require.NoError(t, err)
+	require.Len(t, jobs, 2)
+	assert.Equal(t, "copy", jobs[0].Name)
+	_, err = jf.selectJobs([]string{"potato"})
+	assert.ErrorContains(t, err, `job "potato" not found`)
+
+	var out bytes.Buffer
+	results := jf.Run(context.Background(), jf.Jobs, true, &out)
+	require.Len(t, results, 3)
+	assert.Equal(t, "", out.String())
+
+	copyResult, syncResult, checkResult := results[0], results[1], results[2]
+	assert.Equal(t, "copy", copyResult.Name)
+	assert.Equal(t, "run/copy", copyResult.Group)
+	assert.Equal(t, "", copyResult.Error)
+	assert.Equal(t, int64(2), copyResult.Transfers)
+	assert.Equal(t, int64(19), copyResult.Bytes)
+
+	assert.Equal(t, "", syncResult.Error)
+	assert.Equal(t, int64(2), syncResult.Transfers)
+	assert.Equal(t, int64(1), syncResult.Deletes)
+
+	assert.NotEqual(t, "", checkResult.Error)
+	assert.NotEqual(t, int64(0), checkResult.Errors)
+
+	for _, dst := range []string{"dst1", "dst2"} {
+		assert.FileExists(t, filepath.Join(dir, dst, "file1"))
+		assert.FileExists(t, filepath.Join(dir, dst, "sub", "file2"))
+		assert.NoFileExists(t, filepath.Join(dir, dst, "file3.tmp"))
+	}
+	assert.NoFileExists(t, filepath.Join(dir, "dst2", "old"))
+
+	// Report
+	out.Reset()
+	err = writeReport(&out, results, false)
+	assert.EqualError(t, err, "1 of 3 jobs failed")
+	assert.Contains(t, out.String(), "Job ")
+	assert.Contains(t, out.String(), "Total (3 jobs)")
+	assert.Contains(t, out.String(), "FAILED")
+
+	out.Reset()
+	err = writeReport(&out, results[:2], true)
+	assert.NoError(t, err)
+	assert.Contains(t, out.String(), `"name": "copy"`)
+}
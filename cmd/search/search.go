@@ -0,0 +1,122 @@
+// Package search provides the search command.
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/cmd/index"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/spf13/cobra"
+)
+
+var (
+	long       bool
+	jsonOutput bool
+)
+
+func init() {
+	cmd.Root.AddCommand(commandDefinition)
+	cmdFlags := commandDefinition.Flags()
+	flags.BoolVarP(cmdFlags, &long, "long", "", false, "Show the size and modification time of each object", "")
+	flags.BoolVarP(cmdFlags, &jsonOutput, "json", "", false, "Format output as JSON", "")
+}
+
+var commandDefinition = &cobra.Command{
+	Use:   "search remote:path",
+	Short: `Search the index of remote:path made by rclone index.`,
+	Long: `Lists the objects in the index of remote:path made by ` + "`rclone index`" + `
+which match the filter flags, without listing the remote.
+
+The filters are the usual ones, so objects can be found by path or name
+with ` + "`--include`" + `, by size with ` + "`--min-size`" + ` and ` + "`--max-size`" + `,
+by modification time with ` + "`--min-age`" + ` and ` + "`--max-age`" + ` and by
+metadata with ` + "`--metadata-include`" + ` if it was indexed with
+` + "`--metadata`" + `. See the [filtering docs](/filtering/) for more info.
+
+The output is the path of each object. Use ` + "`--long`" + ` to show the size
+and modification time too, or ` + "`--json`" + ` to show everything in the
+index about each object in the same format as ` + "`rclone lsjson`" + `.
+
+The results are as up to date as the last run of ` + "`rclone index`" + `.
+It is an error to search a path which hasn't been indexed.
+
+Eg find every JPEG modified in the last month
+
+    rclone search remote:photos --include "*.{jpg,jpeg}" --max-age 30d
+
+Or every object larger than 1 GiB with a particular metadata value
+
+    rclone search remote: --min-size 1G --metadata-include "owner=alice" --long
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.71",
+		"groups":            "Filter,Listing",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		fsrc := cmd.NewFsSrc(args)
+		cmd.Run(false, false, command, func() error {
+			return Search(context.Background(), fsrc, os.Stdout)
+		})
+	},
+}
+
+// Search writes the objects in the index of f which match the filters
+// to out
+func Search(ctx context.Context, f fs.Fs, out io.Writer) error {
+	ix, err := index.Open(ctx, f, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = ix.Close()
+	}()
+	updated, err := ix.Updated()
+	if err != nil {
+		return err
+	}
+	if updated.IsZero() {
+		return index.ErrNotIndexed
+	}
+	fs.Debugf(f, "Searching index last updated %v", updated.Local().Format(time.RFC3339))
+
+	if jsonOutput {
+		_, _ = fmt.Fprintln(out, "[")
+	}
+	first := true
+	err = ix.Search(ctx, func(entry *index.Entry) error {
+		switch {
+		case jsonOutput:
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+			if !first {
+				_, _ = fmt.Fprintln(out, ",")
+			}
+			_, err = out.Write(data)
+			first = false
+			return err
+		case long:
+			_, err := fmt.Fprintf(out, "%9d %s %s\n", entry.Size, entry.ModTime.Local().Format("2006-01-02 15:04:05.000000000"), entry.Path)
+			return err
+		default:
+			_, err := fmt.Fprintln(out, entry.Path)
+			return err
+		}
+	})
+	if jsonOutput {
+		if !first {
+			_, _ = fmt.Fprintln(out)
+		}
+		_, _ = fmt.Fprintln(out, "]")
+	}
+	return err
+}
@@ -117,7 +117,7 @@ control the stats printing.
 	},
 	Run: func(command *cobra.Command, args []string) {
 		var f fs.Fs
-		if proxy.Opt.AuthProxy == "" {
+		if !proxy.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
@@ -170,6 +170,15 @@ func (s *HTTP) auth(user, pass string) (value any, err error) {
 	return VFS, err
 }
 
+// authIdentity finds the VFS for users authenticated by JWT or LDAP
+func (s *HTTP) authIdentity(id *libhttp.Identity) (value any, err error) {
+	VFS, _, err := s.proxy.CallIdentity(id)
+	if err != nil {
+		return nil, err
+	}
+	return VFS, err
+}
+
 func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Options, proxyOpt *proxy.Options) (s *HTTP, err error) {
 	s = &HTTP{
 		f:   f,
@@ -177,10 +186,14 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 		opt: *opt,
 	}
 
-	if proxyOpt.AuthProxy != "" {
+	if proxyOpt.Enabled() {
+		if err := proxyOpt.CheckAuth(&s.opt.Auth); err != nil {
+			return nil, err
+		}
 		s.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
 		// override auth
 		s.opt.Auth.CustomAuthFn = s.auth
+		s.opt.Auth.IdentityAuthFn = s.authIdentity
 	} else {
 		s._vfs = vfs.New(f, vfsOpt)
 	}
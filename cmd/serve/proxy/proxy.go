@@ -10,6 +10,8 @@ import (
 	"errors"
 	"fmt"
 	"os/exec"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
@@ -18,6 +20,7 @@ import (
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/obscure"
 	libcache "github.com/rclone/rclone/lib/cache"
+	libhttp "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/vfs"
 	"github.com/rclone/rclone/vfs/vfscommon"
 )
@@ -48,8 +51,17 @@ config.
 This config generated must have this extra parameter
 - |_root| - root to use for the backend
 
-And it may have this parameter
+And it may have these parameters
 - |_obscure| - comma separated strings for parameters to obscure
+- |_read_only| - |true| to serve the backend read only
+- |_quota| - maximum space the user's files may use, either in bytes or with a suffix, eg |10G|
+- |_operations| - comma separated operations to allow from |read|, |write|, |mkdir|, |delete| and |rename|
+
+These override the |--read-only|, |--vfs-quota| and |--vfs-operations|
+flags for the user, except that |_read_only| can't make a read only
+server writable. Writes which would take the user over their quota fail
+with "no space left on device" and the quota is reported as the size of
+the disk. See the VFS Quota and Operations section for more info.
 
 If password authentication was used by the client, input to the proxy
 process (on STDIN) would look similar to this:
@@ -104,6 +116,26 @@ before it takes effect.
 This can be used to build general purpose proxies to any kind of
 backend that rclone supports.  
 
+If the server authenticates users itself with JWT bearer tokens or
+LDAP then the proxy program is called with the user and, if known, the
+user's groups and the claims from the token instead of the password.
+
+|||
+{
+	"user": "me",
+	"groups": ["staff", "admins"],
+	"claims": {"sub": "me", "email": "me@example.com"}
+}
+|||
+
+For users authenticated like this the proxy program isn't needed to
+choose a backend. Use |--auth-root remote:path/{user}| to serve each
+user the remote path with |{user}| replaced by their user name, and
+|--auth-group-root group=remote:path| to serve members of |group| a
+remote path instead. |--auth-group-root| may be repeated and the first
+group the user is a member of is used. The remotes must be in the
+config file.
+
 `, "|", "`")
 
 // OptionsInfo descripts the Options in use
@@ -111,11 +143,36 @@ var OptionsInfo = fs.Options{{
 	Name:    "auth_proxy",
 	Default: "",
 	Help:    "A program to use to create the backend from the auth",
+}, {
+	Name:    "auth_root",
+	Default: "",
+	Help:    "Remote path to serve to JWT or LDAP users - {user} is replaced with the user name",
+}, {
+	Name:    "auth_group_root",
+	Default: []string{},
+	Help:    "Remote path to serve to members of a JWT or LDAP group as group=remote:path",
 }}
 
 // Options is options for creating the proxy
 type Options struct {
-	AuthProxy string `config:"auth_proxy"`
+	AuthProxy     string   `config:"auth_proxy"`
+	AuthRoot      string   `config:"auth_root"`
+	AuthGroupRoot []string `config:"auth_group_root"`
+}
+
+// Enabled returns true if the proxy should be used to find the backend
+// for each user.
+func (opt *Options) Enabled() bool {
+	return opt.AuthProxy != "" || opt.AuthRoot != "" || len(opt.AuthGroupRoot) > 0
+}
+
+// CheckAuth returns an error if the proxy can't find the backend for
+// the users authenticated as set in auth.
+func (opt *Options) CheckAuth(auth *libhttp.AuthConfig) error {
+	if opt.AuthProxy == "" && opt.Enabled() && auth.JWTJWKS == "" && auth.LDAPURL == "" {
+		return errors.New("--auth-root and --auth-group-root need JWT or LDAP authentication")
+	}
+	return nil
 }
 
 // Opt is the default options
@@ -136,8 +193,9 @@ type Proxy struct {
 
 // cacheEntry is what is stored in the vfsCache
 type cacheEntry struct {
-	vfs    *vfs.VFS          // stored VFS
-	pwHash [sha256.Size]byte // sha256 hash of the password/publicKey
+	vfs      *vfs.VFS          // stored VFS
+	pwHash   [sha256.Size]byte // sha256 hash of the password/publicKey
+	identity bool              // set if made for a user authenticated by JWT or LDAP
 }
 
 // New creates a new proxy with the Options passed in
@@ -154,7 +212,7 @@ func New(ctx context.Context, opt *Options, vfsOpt *vfscommon.Options) *Proxy {
 }
 
 // run the proxy command returning a config map
-func (p *Proxy) run(in map[string]string) (config configmap.Simple, err error) {
+func (p *Proxy) run(in any) (config configmap.Simple, err error) {
 	cmd := exec.Command(p.cmdLine[0], p.cmdLine[1:]...)
 	inBytes, err := json.MarshalIndent(in, "", "\t")
 	if err != nil {
@@ -171,10 +229,27 @@ func (p *Proxy) run(in map[string]string) (config configmap.Simple, err error) {
 	if err != nil {
 		return nil, fmt.Errorf("proxy: failed on %v: %q: %w", p.cmdLine, strings.TrimSpace(stderr.String()), err)
 	}
-	err = json.Unmarshal(stdout.Bytes(), &config)
+	// Values may be strings, numbers or booleans
+	var out map[string]any
+	dec := json.NewDecoder(bytes.NewReader(stdout.Bytes()))
+	dec.UseNumber()
+	err = dec.Decode(&out)
 	if err != nil {
 		return nil, fmt.Errorf("proxy: failed to read output: %q: %w", stdout.String(), err)
 	}
+	config = make(configmap.Simple, len(out))
+	for key, value := range out {
+		switch value := value.(type) {
+		case string:
+			config[key] = value
+		case json.Number:
+			config[key] = value.String()
+		case bool:
+			config[key] = strconv.FormatBool(value)
+		default:
+			return nil, fmt.Errorf("proxy: value for %q must be a string, number or boolean", key)
+		}
+	}
 	fs.Debugf(nil, "Proxy returned in %v", duration)
 
 	// Obscure any values in the config map that need it
@@ -213,7 +288,12 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error)
 	if err != nil {
 		return nil, err
 	}
+	return p.newEntry(user, config, cacheEntry{pwHash: sha256.Sum256([]byte(auth))})
+}
 
+// newEntry makes the backend described by config for user, returning
+// entry with the VFS for it added after putting it in the cache
+func (p *Proxy) newEntry(user string, config configmap.Simple, entry cacheEntry) (value any, err error) {
 	// Look for required fields in the answer
 	fsName, ok := config.Get("type")
 	if !ok {
@@ -230,6 +310,12 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error)
 		return nil, fmt.Errorf("proxy: couldn't find backend for %q: %w", fsName, err)
 	}
 
+	// Read the per user VFS options
+	vfsOpt, err := p.userVFSOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
 	// base name of config on user name.  This may appear in logs
 	name := "proxy-" + user
 	fsString := name + ":" + root
@@ -251,13 +337,11 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error)
 			return nil, false, err
 		}
 
-		// We hash the auth here so we don't copy the auth more than we
-		// need to in memory. An attacker would find it easier to go
-		// after the unencrypted password in memory most likely.
-		entry := cacheEntry{
-			vfs:    vfs.New(f, &p.vfsOpt),
-			pwHash: sha256.Sum256([]byte(auth)),
-		}
+		// We hash the auth in the caller so we don't copy the auth
+		// more than we need to in memory. An attacker would find it
+		// easier to go after the unencrypted password in memory most
+		// likely.
+		entry.vfs = vfs.New(f, vfsOpt)
 		return entry, true, nil
 	})
 	if err != nil {
@@ -266,9 +350,46 @@ func (p *Proxy) call(user, auth string, isPublicKey bool) (value any, err error)
 	return value, nil
 }
 
+// userVFSOptions returns the VFS options for a user, starting from the
+// ones the proxy was created with and applying any _read_only, _quota
+// and _operations in config.
+func (p *Proxy) userVFSOptions(config configmap.Simple) (*vfscommon.Options, error) {
+	vfsOpt := p.vfsOpt
+	if value, ok := config.Get("_read_only"); ok {
+		readOnly, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: bad _read_only %q: %w", value, err)
+		}
+		vfsOpt.ReadOnly = vfsOpt.ReadOnly || readOnly
+	}
+	if value, ok := config.Get("_quota"); ok {
+		// Plain numbers are bytes rather than KiB as on the command line
+		if quota, err := strconv.ParseInt(value, 10, 64); err == nil {
+			vfsOpt.Quota = fs.SizeSuffix(quota)
+		} else if err := vfsOpt.Quota.Set(value); err != nil {
+			return nil, fmt.Errorf("proxy: bad _quota %q: %w", value, err)
+		}
+	}
+	if value, ok := config.Get("_operations"); ok {
+		for op := range strings.SplitSeq(value, ",") {
+			op = strings.ToLower(strings.TrimSpace(op))
+			if op != "" && !slices.Contains(vfs.Operations, op) {
+				return nil, fmt.Errorf("proxy: unknown operation %q in _operations - expecting one of %s", op, strings.Join(vfs.Operations, ","))
+			}
+		}
+		vfsOpt.Operations = value
+	}
+	return &vfsOpt, nil
+}
+
 // Call runs the auth proxy with the username and password/public key provided
 // returning a *vfs.VFS and the key used in the VFS cache.
 func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey string, err error) {
+	// Without the program there is nothing to check the password with
+	if p.Opt.AuthProxy == "" {
+		return nil, "", errors.New("proxy: --auth-proxy must be set to log in with a password")
+	}
+
 	// Look in the cache first
 	value, ok := p.vfsCache.GetMaybe(user)
 
@@ -286,6 +407,11 @@ func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey
 		return nil, "", fmt.Errorf("proxy: value is not cache entry: %#v", value)
 	}
 
+	// Entries for users authenticated by the server have no password
+	if entry.identity {
+		return nil, "", errors.New("proxy: user must log in with JWT or LDAP")
+	}
+
 	// Check the password / public key is correct in the cached entry.  This
 	// prevents an attack where subsequent requests for the same
 	// user don't have their auth checked. It does mean that if
@@ -302,6 +428,92 @@ func (p *Proxy) Call(user, auth string, isPublicKey bool) (VFS *vfs.VFS, vfsKey
 	return entry.vfs, user, nil
 }
 
+// identityRoot returns the remote path to serve to id from the
+// --auth-group-root and --auth-root options
+func (p *Proxy) identityRoot(id *libhttp.Identity) (string, error) {
+	// Don't let the user name change the path it is substituted into
+	if id.User == "." || id.User == ".." || strings.ContainsAny(id.User, "/\\:") {
+		return "", fmt.Errorf("proxy: user name %q can't be used in a path", id.User)
+	}
+	for _, groupRoot := range p.Opt.AuthGroupRoot {
+		group, root, ok := strings.Cut(groupRoot, "=")
+		if !ok {
+			return "", fmt.Errorf("proxy: --auth-group-root %q must be group=remote:path", groupRoot)
+		}
+		if slices.Contains(id.Groups, group) {
+			return strings.ReplaceAll(root, "{user}", id.User), nil
+		}
+	}
+	if p.Opt.AuthRoot == "" {
+		return "", fmt.Errorf("proxy: no root configured for user %q", id.User)
+	}
+	return strings.ReplaceAll(p.Opt.AuthRoot, "{user}", id.User), nil
+}
+
+// callIdentity finds the backend for id returning a cacheEntry
+func (p *Proxy) callIdentity(id *libhttp.Identity) (value any, err error) {
+	entry := cacheEntry{identity: true}
+	if p.Opt.AuthProxy != "" {
+		in := map[string]any{
+			"user": id.User,
+		}
+		if len(id.Groups) > 0 {
+			in["groups"] = id.Groups
+		}
+		if len(id.Claims) > 0 {
+			in["claims"] = id.Claims
+		}
+		config, err := p.run(in)
+		if err != nil {
+			return nil, err
+		}
+		return p.newEntry(id.User, config, entry)
+	}
+	root, err := p.identityRoot(id)
+	if err != nil {
+		return nil, err
+	}
+	value, err = p.vfsCache.Get(id.User, func(key string) (value any, ok bool, err error) {
+		f, err := cache.Get(p.ctx, root)
+		if err != nil {
+			return nil, false, err
+		}
+		entry.vfs = vfs.New(f, &p.vfsOpt)
+		return entry, true, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("proxy: failed to create backend: %w", err)
+	}
+	return value, nil
+}
+
+// CallIdentity returns a *vfs.VFS for a user who has been
+// authenticated by a JWT bearer token or LDAP and the key used in the
+// VFS cache.
+//
+// If the auth proxy program is set then it is called with the user,
+// groups and claims, otherwise the backend comes from the
+// --auth-group-root and --auth-root options.
+func (p *Proxy) CallIdentity(id *libhttp.Identity) (VFS *vfs.VFS, vfsKey string, err error) {
+	// Look in the cache first
+	value, ok := p.vfsCache.GetMaybe(id.User)
+
+	// If not found then find the backend for the user
+	if !ok {
+		value, err = p.callIdentity(id)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	// check we got what we were expecting
+	entry, ok := value.(cacheEntry)
+	if !ok {
+		return nil, "", fmt.Errorf("proxy: value is not cache entry: %#v", value)
+	}
+	return entry.vfs, id.User, nil
+}
+
 // Get VFS from the cache using key - returns nil if not found
 func (p *Proxy) Get(key string) *vfs.VFS {
 	value, ok := p.vfsCache.GetMaybe(key)
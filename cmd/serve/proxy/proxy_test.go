@@ -6,6 +6,7 @@ import (
 	"crypto/rsa"
 	"crypto/sha256"
 	"encoding/base64"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -13,6 +14,7 @@ import (
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/obscure"
+	libhttp "github.com/rclone/rclone/lib/http"
 	"github.com/rclone/rclone/vfs/vfscommon"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -234,3 +236,87 @@ func TestRun(t *testing.T) {
 		assert.Equal(t, 1, p.vfsCache.Entries())
 	})
 }
+
+func TestCallIdentity(t *testing.T) {
+	dir := t.TempDir()
+	opt := Opt
+	opt.AuthRoot = filepath.Join(dir, "home", "{user}")
+	opt.AuthGroupRoot = []string{"admins=" + filepath.Join(dir, "admin")}
+	assert.True(t, opt.Enabled())
+	assert.ErrorContains(t, opt.CheckAuth(&libhttp.AuthConfig{}), "need JWT or LDAP")
+	assert.NoError(t, opt.CheckAuth(&libhttp.AuthConfig{LDAPURL: "ldaps://ldap.example.com"}))
+	p := New(context.Background(), &opt, &vfscommon.Opt)
+
+	VFS, vfsKey, err := p.CallIdentity(&libhttp.Identity{User: "alice", Groups: []string{"staff"}})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", vfsKey)
+	assert.Equal(t, filepath.Join(dir, "home", "alice"), VFS.Fs().Root())
+
+	VFS, _, err = p.CallIdentity(&libhttp.Identity{User: "bob", Groups: []string{"staff", "admins"}})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "admin"), VFS.Fs().Root())
+
+	// The VFS is cached
+	VFS2, _, err := p.CallIdentity(&libhttp.Identity{User: "alice"})
+	require.NoError(t, err)
+	assert.Equal(t, p.Get("alice"), VFS2)
+
+	// But can't be used with a password
+	_, _, err = p.Call("alice", "", false)
+	assert.ErrorContains(t, err, "--auth-proxy must be set")
+	p.Opt.AuthProxy = "potato"
+	_, _, err = p.Call("alice", "", false)
+	assert.ErrorContains(t, err, "must log in with JWT or LDAP")
+	p.Opt.AuthProxy = ""
+
+	for _, user := range []string{"..", "a/b", `a\b`, "remote:"} {
+		_, _, err = p.CallIdentity(&libhttp.Identity{User: user})
+		assert.ErrorContains(t, err, "can't be used in a path", user)
+	}
+
+	p.Opt.AuthRoot = ""
+	_, _, err = p.CallIdentity(&libhttp.Identity{User: "carol"})
+	assert.ErrorContains(t, err, "no root configured")
+	p.Opt.AuthGroupRoot = []string{"nogroup"}
+	_, _, err = p.CallIdentity(&libhttp.Identity{User: "carol"})
+	assert.ErrorContains(t, err, "must be group=remote:path")
+}
+
+func TestUserVFSOptions(t *testing.T) {
+	vfsOpt := vfscommon.Opt
+	p := New(context.Background(), &Opt, &vfsOpt)
+
+	got, err := p.userVFSOptions(configmap.Simple{})
+	require.NoError(t, err)
+	assert.Equal(t, vfsOpt, *got)
+
+	got, err = p.userVFSOptions(configmap.Simple{
+		"_read_only":  "true",
+		"_quota":      "1000",
+		"_operations": "read,write",
+	})
+	require.NoError(t, err)
+	assert.True(t, got.ReadOnly)
+	assert.Equal(t, fs.SizeSuffix(1000), got.Quota)
+	assert.Equal(t, "read,write", got.Operations)
+	assert.False(t, p.vfsOpt.ReadOnly)
+
+	got, err = p.userVFSOptions(configmap.Simple{"_quota": "10G"})
+	require.NoError(t, err)
+	assert.Equal(t, 10*fs.Gibi, got.Quota)
+
+	// _read_only can't make a read only server writable
+	p.vfsOpt.ReadOnly = true
+	got, err = p.userVFSOptions(configmap.Simple{"_read_only": "false"})
+	require.NoError(t, err)
+	assert.True(t, got.ReadOnly)
+
+	for _, config := range []configmap.Simple{
+		{"_read_only": "potato"},
+		{"_quota": "potato"},
+		{"_operations": "read,potato"},
+	} {
+		_, err = p.userVFSOptions(config)
+		assert.Error(t, err, config)
+	}
+}
@@ -25,8 +25,9 @@ var (
 // s3Backend implements the gofacess3.Backend interface to make an S3
 // backend for gofakes3
 type s3Backend struct {
-	s    *Server
-	meta *sync.Map
+	s         *Server
+	meta      *sync.Map
+	versionMu sync.Mutex // held while changing object versions
 }
 
 // newBackend creates a new SimpleBucketBackend.
@@ -116,43 +117,14 @@ func (b *s3Backend) HeadObject(ctx context.Context, bucketName, objectName strin
 	if err != nil {
 		return nil, gofakes3.BucketNotFound(bucketName)
 	}
-
-	fp := path.Join(bucketName, objectName)
-	node, err := _vfs.Stat(fp)
-	if err != nil {
-		return nil, gofakes3.KeyNotFound(objectName)
-	}
-
-	if !node.IsFile() {
-		return nil, gofakes3.KeyNotFound(objectName)
-	}
-
-	entry := node.DirEntry()
-	if entry == nil {
+	if isVersionsKey(objectName) {
 		return nil, gofakes3.KeyNotFound(objectName)
 	}
-
-	fobj := entry.(fs.Object)
-	size := node.Size()
-	hash := getFileHashByte(fobj, b.s.etagHashType)
-
-	meta := map[string]string{
-		"Last-Modified": formatHeaderTime(node.ModTime()),
-		"Content-Type":  fs.MimeType(context.Background(), fobj),
-	}
-
-	if val, ok := b.meta.Load(fp); ok {
-		metaMap := val.(map[string]string)
-		maps.Copy(meta, metaMap)
+	if versionID, ok := versionIDFromContext(ctx); ok {
+		return b.HeadObjectVersion(bucketName, objectName, versionID)
 	}
 
-	return &gofakes3.Object{
-		Name:     objectName,
-		Hash:     hash,
-		Metadata: meta,
-		Size:     size,
-		Contents: noOpReadCloser{},
-	}, nil
+	return b.openObject(_vfs, path.Join(bucketName, objectName), objectName, nil, true)
 }
 
 // GetObject fetches the object from the filesystem.
@@ -165,8 +137,21 @@ func (b *s3Backend) GetObject(ctx context.Context, bucketName, objectName string
 	if err != nil {
 		return nil, gofakes3.BucketNotFound(bucketName)
 	}
+	if isVersionsKey(objectName) {
+		return nil, gofakes3.KeyNotFound(objectName)
+	}
+	if versionID, ok := versionIDFromContext(ctx); ok {
+		return b.GetObjectVersion(bucketName, objectName, versionID, rangeRequest)
+	}
 
-	fp := path.Join(bucketName, objectName)
+	return b.openObject(_vfs, path.Join(bucketName, objectName), objectName, rangeRequest, false)
+}
+
+// openObject opens the file at fp in the VFS returning it as the
+// object objectName.
+//
+// If head is set then the contents aren't opened.
+func (b *s3Backend) openObject(_vfs *vfs.VFS, fp, objectName string, rangeRequest *gofakes3.ObjectRangeRequest, head bool) (obj *gofakes3.Object, err error) {
 	node, err := _vfs.Stat(fp)
 	if err != nil {
 		return nil, gofakes3.KeyNotFound(objectName)
@@ -182,11 +167,30 @@ func (b *s3Backend) GetObject(ctx context.Context, bucketName, objectName string
 	}
 
 	fobj := entry.(fs.Object)
-	file := node.(*vfs.File)
-
 	size := node.Size()
 	hash := getFileHashByte(fobj, b.s.etagHashType)
 
+	meta := map[string]string{
+		"Last-Modified": formatHeaderTime(node.ModTime()),
+		"Content-Type":  fs.MimeType(context.Background(), fobj),
+	}
+
+	if val, ok := b.meta.Load(fp); ok {
+		metaMap := val.(map[string]string)
+		maps.Copy(meta, metaMap)
+	}
+
+	if head {
+		return &gofakes3.Object{
+			Name:     objectName,
+			Hash:     hash,
+			Metadata: meta,
+			Size:     size,
+			Contents: noOpReadCloser{},
+		}, nil
+	}
+
+	file := node.(*vfs.File)
 	in, err := file.Open(os.O_RDONLY)
 	if err != nil {
 		return nil, gofakes3.ErrInternal
@@ -211,16 +215,6 @@ func (b *s3Backend) GetObject(ctx context.Context, bucketName, objectName string
 		rdr = limitReadCloser(rdr, in.Close, rnge.Length)
 	}
 
-	meta := map[string]string{
-		"Last-Modified": formatHeaderTime(node.ModTime()),
-		"Content-Type":  fs.MimeType(context.Background(), fobj),
-	}
-
-	if val, ok := b.meta.Load(fp); ok {
-		metaMap := val.(map[string]string)
-		maps.Copy(meta, metaMap)
-	}
-
 	return &gofakes3.Object{
 		Name:     objectName,
 		Hash:     hash,
@@ -301,6 +295,10 @@ func (b *s3Backend) PutObject(
 		return result, gofakes3.BucketNotFound(bucketName)
 	}
 
+	if isVersionsKey(objectName) {
+		return result, gofakes3.ErrorMessagef(gofakes3.ErrInvalidArgument, "object names starting with %q are reserved", versionsDir)
+	}
+
 	fp := path.Join(bucketName, objectName)
 	objectDir := path.Dir(fp)
 	// _, err = db.fs.Stat(objectDir)
@@ -315,27 +313,41 @@ func (b *s3Backend) PutObject(
 		}
 	}
 
-	f, err := _vfs.Create(fp)
+	config, err := readVersioning(_vfs, bucketName)
 	if err != nil {
 		return result, err
 	}
+	if config.Status != gofakes3.VersioningNone {
+		result.VersionID, err = b.putVersioned(_vfs, bucketName, objectName, meta, input, config.Status)
+		return result, err
+	}
+	err = b.putObject(_vfs, fp, meta, input)
+	return result, err
+}
+
+// putObject writes the input to fp in the VFS
+func (b *s3Backend) putObject(_vfs *vfs.VFS, fp string, meta map[string]string, input io.Reader) error {
+	f, err := _vfs.Create(fp)
+	if err != nil {
+		return err
+	}
 
 	if _, err := io.Copy(f, input); err != nil {
 		// remove file when i/o error occurred (FsPutErr)
 		_ = f.Close()
 		_ = _vfs.Remove(fp)
-		return result, err
+		return err
 	}
 
 	if err := f.Close(); err != nil {
 		// remove file when close error occurred (FsPutErr)
 		_ = _vfs.Remove(fp)
-		return result, err
+		return err
 	}
 
 	_, err = _vfs.Stat(fp)
 	if err != nil {
-		return result, err
+		return err
 	}
 
 	b.meta.Store(fp, meta)
@@ -344,24 +356,24 @@ func (b *s3Backend) PutObject(
 		ti, err := swift.FloatStringToTime(val)
 		if err == nil {
 			b.storeModtime(fp, meta, val)
-			return result, _vfs.Chtimes(fp, ti, ti)
+			return _vfs.Chtimes(fp, ti, ti)
 		}
 		// ignore error since the file is successfully created
 
 		if val, ok := meta["mtime"]; ok {
 			b.storeModtime(fp, meta, val)
-			return result, _vfs.Chtimes(fp, ti, ti)
+			return _vfs.Chtimes(fp, ti, ti)
 		}
 		// ignore error since the file is successfully created
 	}
 
-	return result, nil
+	return nil
 }
 
 // DeleteMulti deletes multiple objects in a single request.
 func (b *s3Backend) DeleteMulti(ctx context.Context, bucketName string, objects ...string) (result gofakes3.MultiDeleteResult, rerr error) {
 	for _, object := range objects {
-		if err := b.deleteObject(ctx, bucketName, object); err != nil {
+		if _, err := b.deleteObject(ctx, bucketName, object); err != nil {
 			fs.Errorf("serve s3", "delete object failed: %v", err)
 			result.Error = append(result.Error, gofakes3.ErrorResult{
 				Code:    gofakes3.ErrInternal,
@@ -380,30 +392,44 @@ func (b *s3Backend) DeleteMulti(ctx context.Context, bucketName string, objects
 
 // DeleteObject deletes the object with the given name.
 func (b *s3Backend) DeleteObject(ctx context.Context, bucketName, objectName string) (result gofakes3.ObjectDeleteResult, rerr error) {
-	return result, b.deleteObject(ctx, bucketName, objectName)
+	return b.deleteObject(ctx, bucketName, objectName)
 }
 
 // deleteObject deletes the object from the filesystem.
-func (b *s3Backend) deleteObject(ctx context.Context, bucketName, objectName string) error {
+func (b *s3Backend) deleteObject(ctx context.Context, bucketName, objectName string) (result gofakes3.ObjectDeleteResult, err error) {
 	_vfs, err := b.s.getVFS(ctx)
 	if err != nil {
-		return err
+		return result, err
 	}
 	_, err = _vfs.Stat(bucketName)
 	if err != nil {
-		return gofakes3.BucketNotFound(bucketName)
+		return result, gofakes3.BucketNotFound(bucketName)
+	}
+	if isVersionsKey(objectName) {
+		return result, nil
+	}
+	if versionID, ok := versionIDFromContext(ctx); ok {
+		return b.DeleteObjectVersion(bucketName, objectName, versionID)
+	}
+
+	config, err := readVersioning(_vfs, bucketName)
+	if err != nil {
+		return result, err
+	}
+	if config.Status != gofakes3.VersioningNone {
+		return b.deleteVersioned(_vfs, bucketName, objectName, config.Status)
 	}
 
 	fp := path.Join(bucketName, objectName)
 	// S3 does not report an error when attempting to delete a key that does not exist, so
 	// we need to skip IsNotExist errors.
 	if err := _vfs.Remove(fp); err != nil && !os.IsNotExist(err) {
-		return err
+		return result, err
 	}
 
 	// FIXME: unsafe operation
 	rmdirRecursive(fp, _vfs)
-	return nil
+	return result, nil
 }
 
 // CreateBucket creates a new bucket.
@@ -438,6 +464,9 @@ func (b *s3Backend) DeleteBucket(ctx context.Context, name string) error {
 		return gofakes3.BucketNotFound(name)
 	}
 
+	// Remove the versions area if it only has the configuration in
+	removeEmptyVersionsArea(_vfs, name)
+
 	if err := _vfs.Remove(name); err != nil {
 		return gofakes3.ErrBucketNotEmpty
 	}
@@ -26,6 +26,11 @@ func (b *s3Backend) entryListR(_vfs *vfs.VFS, bucket, fdPath, name string, addPr
 			continue
 		}
 
+		// hide the versions area in the root of the bucket
+		if fdPath == "" && object == versionsDir {
+			continue
+		}
+
 		if entry.IsDir() {
 			if addPrefix {
 				prefixWithTrailingSlash := objectPath + "/"
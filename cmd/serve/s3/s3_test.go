@@ -12,6 +12,7 @@ import (
 	"path"
 	"path/filepath"
 	"slices"
+	"sync"
 	"testing"
 	"time"
 
@@ -291,6 +292,154 @@ func TestListBucketsAuthProxy(t *testing.T) {
 	testListBuckets(t, cases, true)
 }
 
+func TestVersioning(t *testing.T) {
+	ctx := context.Background()
+	fstest.Initialise()
+	f, _, clean, err := fstest.RandomRemote()
+	require.NoError(t, err)
+	defer clean()
+	const bucket = "mybucket"
+	const key = "dir/file.txt"
+	require.NoError(t, f.Mkdir(ctx, bucket))
+
+	endpoint, keyid, keysec, s := serveS3(t, f)
+	defer func() {
+		assert.NoError(t, s.server.Shutdown())
+	}()
+	testURL, _ := url.Parse(endpoint)
+	minioClient, err := minio.New(testURL.Host, &minio.Options{
+		Creds:  credentials.NewStaticV4(keyid, keysec, ""),
+		Secure: false,
+	})
+	require.NoError(t, err)
+
+	put := func(contents string) string {
+		info, err := minioClient.PutObject(ctx, bucket, key, bytes.NewBufferString(contents), int64(len(contents)), minio.PutObjectOptions{})
+		require.NoError(t, err)
+		return info.VersionID
+	}
+	get := func(versionID string) (string, error) {
+		obj, err := minioClient.GetObject(ctx, bucket, key, minio.GetObjectOptions{VersionID: versionID})
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			_ = obj.Close()
+		}()
+		data, err := io.ReadAll(obj)
+		return string(data), err
+	}
+	type version struct {
+		versionID    string
+		isLatest     bool
+		deleteMarker bool
+	}
+	listVersions := func() (versions []version) {
+		for obj := range minioClient.ListObjects(ctx, bucket, minio.ListObjectsOptions{WithVersions: true, Recursive: true}) {
+			require.NoError(t, obj.Err)
+			assert.Equal(t, key, obj.Key)
+			versions = append(versions, version{obj.VersionID, obj.IsLatest, obj.IsDeleteMarker})
+		}
+		return versions
+	}
+
+	// Object written before versioning is the null version
+	put("zero")
+	assert.Equal(t, []version{{"null", true, false}}, listVersions())
+
+	require.NoError(t, minioClient.EnableVersioning(ctx, bucket))
+	config, err := minioClient.GetBucketVersioning(ctx, bucket)
+	require.NoError(t, err)
+	assert.Equal(t, "Enabled", config.Status)
+
+	v1 := put("one")
+	v2 := put("two")
+	require.NotEqual(t, "", v1)
+	require.NotEqual(t, v1, v2)
+	assert.Equal(t, []version{{v2, true, false}, {v1, false, false}, {"null", false, false}}, listVersions())
+
+	for versionID, want := range map[string]string{"": "two", v2: "two", v1: "one", "null": "zero"} {
+		got, err := get(versionID)
+		require.NoError(t, err)
+		assert.Equal(t, want, got, versionID)
+	}
+
+	// The versions area shouldn't be visible
+	for obj := range minioClient.ListObjects(ctx, bucket, minio.ListObjectsOptions{Recursive: true}) {
+		require.NoError(t, obj.Err)
+		assert.Equal(t, key, obj.Key)
+	}
+
+	// Deleting makes a delete marker
+	require.NoError(t, minioClient.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{}))
+	_, err = get("")
+	assert.Error(t, err)
+	versions := listVersions()
+	require.Len(t, versions, 4)
+	marker := versions[0]
+	assert.True(t, marker.isLatest)
+	assert.True(t, marker.deleteMarker)
+	got, err := get(v1)
+	require.NoError(t, err)
+	assert.Equal(t, "one", got)
+
+	// Removing the delete marker restores the object
+	require.NoError(t, minioClient.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{VersionID: marker.versionID}))
+	got, err = get("")
+	require.NoError(t, err)
+	assert.Equal(t, "two", got)
+	assert.Equal(t, []version{{v2, true, false}, {v1, false, false}, {"null", false, false}}, listVersions())
+
+	// Removing the current version promotes the previous one
+	require.NoError(t, minioClient.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{VersionID: v2}))
+	got, err = get("")
+	require.NoError(t, err)
+	assert.Equal(t, "one", got)
+	assert.Equal(t, []version{{v1, true, false}, {"null", false, false}}, listVersions())
+
+	// The current version can be read while a new one is uploaded
+	b := newBackend(s).(*s3Backend)
+	pr, pw := io.Pipe()
+	done := make(chan error)
+	go func() {
+		_, err := b.PutObject(ctx, bucket, key, map[string]string{}, pr, int64(len("three")))
+		done <- err
+	}()
+	_, err = pw.Write([]byte("thr"))
+	require.NoError(t, err)
+	got, err = get("")
+	require.NoError(t, err)
+	assert.Equal(t, "one", got)
+	_, err = pw.Write([]byte("ee"))
+	require.NoError(t, err)
+	require.NoError(t, pw.Close())
+	require.NoError(t, <-done)
+	got, err = get("")
+	require.NoError(t, err)
+	assert.Equal(t, "three", got)
+
+	// Concurrent uploads each make a version
+	var wg sync.WaitGroup
+	ids := make([]string, 5)
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			contents := fmt.Sprintf("concurrent %d", i)
+			info, err := minioClient.PutObject(ctx, bucket, key, bytes.NewBufferString(contents), int64(len(contents)), minio.PutObjectOptions{})
+			assert.NoError(t, err)
+			ids[i] = info.VersionID
+		}()
+	}
+	wg.Wait()
+	for i, id := range ids {
+		got, err = get(id)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("concurrent %d", i), got)
+	}
+	assert.Len(t, listVersions(), 3+len(ids))
+}
+
 func TestRc(t *testing.T) {
 	servetest.TestRc(t, rc.Params{
 		"type":           "s3",
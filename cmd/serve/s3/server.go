@@ -27,6 +27,7 @@ type ctxKey int
 
 const (
 	ctxKeyID ctxKey = iota
+	ctxKeyVersionID
 )
 
 // Server is a s3.FileSystem interface
@@ -71,17 +72,24 @@ func newServer(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 	}
 
 	var newLogger logger
-	w.faker = gofakes3.New(
-		newBackend(w),
+	fakerOpts := []gofakes3.Option{
 		gofakes3.WithHostBucket(!opt.ForcePathStyle),
 		gofakes3.WithLogger(newLogger),
 		gofakes3.WithRequestID(rand.Uint64()),
-		gofakes3.WithoutVersioning(),
 		gofakes3.WithV4Auth(authlistResolver(opt.AuthKey)),
 		gofakes3.WithIntegrityCheck(true), // Check Content-MD5 if supplied
-	)
+	}
+	if proxy.Opt.AuthProxy != "" {
+		// The versioning calls don't get a context so can't
+		// find the VFS for the user
+		fakerOpts = append(fakerOpts, gofakes3.WithoutVersioning())
+	}
+	w.faker = gofakes3.New(newBackend(w), fakerOpts...)
 
 	w.handler = w.faker.Server()
+	if proxy.Opt.AuthProxy == "" {
+		w.handler = versioningMiddleware(w.handler)
+	}
 
 	if proxy.Opt.AuthProxy != "" {
 		w.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
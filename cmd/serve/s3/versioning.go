@@ -0,0 +1,853 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rclone/gofakes3"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/vfs"
+)
+
+// Versioning is implemented on top of the VFS by storing non current
+// versions of objects in a hidden directory at the root of each
+// bucket which looks like this
+//
+//	bucket/.rclone-s3-versions/versioning.json - the versioning configuration
+//	bucket/.rclone-s3-versions/objects/path/to/key.versions/current.json - version ID of the current object
+//	bucket/.rclone-s3-versions/objects/path/to/key.versions/<id> - an old version of the object
+//	bucket/.rclone-s3-versions/objects/path/to/key.versions/<id>.deletemarker - a delete marker
+//	bucket/.rclone-s3-versions/uploads/<id> - an object being uploaded
+//
+// The current version of an object stays in its normal place so the
+// bucket looks the same to other users of the remote.
+const (
+	versionsDir         = ".rclone-s3-versions"
+	versioningFile      = "versioning.json"
+	versionsObjectsDir  = "objects"
+	versionsUploadsDir  = "uploads"
+	versionsKeySuffix   = ".versions"
+	currentVersionFile  = "current.json"
+	deleteMarkerSuffix  = ".deletemarker"
+	nullVersionID       = "null"
+	defaultMaxVersions  = 1000
+	versionIDTimeDigits = 16
+)
+
+// check interface
+var _ gofakes3.VersionedBackend = (*s3Backend)(nil)
+
+// currentVersion is stored in currentVersionFile to record the
+// version ID of the current object.
+//
+// The size and modification time are used to check the object
+// hasn't been replaced by something other than serve s3, in which
+// case it is treated as the null version.
+type currentVersion struct {
+	VersionID gofakes3.VersionID
+	Size      int64
+	ModTime   time.Time
+}
+
+// objectVersion describes one version of an object
+type objectVersion struct {
+	key          string
+	id           gofakes3.VersionID // "" for the null version
+	deleteMarker bool
+	current      bool      // set if this is the object in the bucket
+	path         string    // VFS path of the data, "" for a delete marker
+	created      time.Time // when the version was created
+	node         vfs.Node  // the node for the data if set
+}
+
+// isVersionsKey returns true if objectName refers to the hidden
+// versions area of a bucket.
+func isVersionsKey(objectName string) bool {
+	return objectName == versionsDir || strings.HasPrefix(objectName, versionsDir+"/")
+}
+
+// newVersionID makes a new version ID.
+//
+// Version IDs sort in the order they were created.
+func newVersionID() gofakes3.VersionID {
+	return gofakes3.VersionID(fmt.Sprintf("%0*x%08x", versionIDTimeDigits, time.Now().UnixNano(), rand.Uint32()))
+}
+
+// versionIDTime returns the time the version ID was created or the
+// zero time if it couldn't be decoded.
+func versionIDTime(id gofakes3.VersionID) time.Time {
+	if len(id) < versionIDTimeDigits {
+		return time.Time{}
+	}
+	ns, err := strconv.ParseInt(string(id[:versionIDTimeDigits]), 16, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// versionCreated returns when the version with id stored in node was
+// created. This is decoded from the id if possible, otherwise the
+// modification time of node is used.
+func versionCreated(id gofakes3.VersionID, node vfs.Node) time.Time {
+	if created := versionIDTime(id); !created.IsZero() {
+		return created
+	}
+	return node.ModTime()
+}
+
+// versionFileID returns the version ID stored in a file name in the
+// versions directory of a key.
+func versionFileID(name string) gofakes3.VersionID {
+	if name == nullVersionID {
+		return ""
+	}
+	return gofakes3.VersionID(name)
+}
+
+// versionFileName returns the file name to use for storing a version
+func versionFileName(id gofakes3.VersionID, deleteMarker bool) string {
+	name := string(id)
+	if id == "" {
+		name = nullVersionID
+	}
+	if deleteMarker {
+		name += deleteMarkerSuffix
+	}
+	return name
+}
+
+// keyVersionsDir returns the directory the versions of key are stored in
+func keyVersionsDir(bucket, key string) string {
+	return path.Join(bucket, versionsDir, versionsObjectsDir, key+versionsKeySuffix)
+}
+
+// rmdirEmpty removes dir and its parents in the versions area of the
+// bucket while they are empty.
+func rmdirEmpty(_vfs *vfs.VFS, bucketName, dir string) {
+	objects := path.Join(bucketName, versionsDir, versionsObjectsDir)
+	for strings.HasPrefix(dir, objects+"/") {
+		entries, err := getDirEntries(dir, _vfs)
+		if err != nil || len(entries) != 0 {
+			return
+		}
+		if err = _vfs.Remove(dir); err != nil {
+			return
+		}
+		dir = path.Dir(dir)
+	}
+}
+
+// getVersionedVFS returns the VFS for the versioning calls.
+//
+// The VersionedBackend interface doesn't pass a context so this only
+// works when not using an auth proxy.
+func (b *s3Backend) getVersionedVFS(bucketName string) (*vfs.VFS, error) {
+	_vfs, err := b.s.getVFS(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	if _, err = _vfs.Stat(bucketName); err != nil {
+		return nil, gofakes3.BucketNotFound(bucketName)
+	}
+	return _vfs, nil
+}
+
+// readVersioning reads the versioning configuration for the bucket
+func readVersioning(_vfs *vfs.VFS, bucketName string) (config gofakes3.VersioningConfiguration, err error) {
+	data, err := _vfs.ReadFile(path.Join(bucketName, versionsDir, versioningFile))
+	if err == vfs.ENOENT {
+		return config, nil
+	} else if err != nil {
+		return config, err
+	}
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		return config, fmt.Errorf("failed to read versioning configuration for bucket %q: %w", bucketName, err)
+	}
+	return config, nil
+}
+
+// VersioningConfiguration returns the versioning configuration of the bucket
+func (b *s3Backend) VersioningConfiguration(bucketName string) (config gofakes3.VersioningConfiguration, err error) {
+	_vfs, err := b.getVersionedVFS(bucketName)
+	if err != nil {
+		return config, err
+	}
+	return readVersioning(_vfs, bucketName)
+}
+
+// SetVersioningConfiguration sets the versioning configuration of the bucket
+func (b *s3Backend) SetVersioningConfiguration(bucketName string, config gofakes3.VersioningConfiguration) error {
+	_vfs, err := b.getVersionedVFS(bucketName)
+	if err != nil {
+		return err
+	}
+	if config.MFADelete == gofakes3.MFADeleteEnabled {
+		return gofakes3.ErrNotImplemented
+	}
+	b.versionMu.Lock()
+	defer b.versionMu.Unlock()
+	old, err := readVersioning(_vfs, bucketName)
+	if err != nil {
+		return err
+	}
+	if old.Status == gofakes3.VersioningNone && config.Status != gofakes3.VersioningEnabled {
+		// Nothing to do - versioning was never enabled
+		return nil
+	}
+	data, err := json.Marshal(gofakes3.VersioningConfiguration{Status: config.Status})
+	if err != nil {
+		return err
+	}
+	dir := path.Join(bucketName, versionsDir)
+	if err = _vfs.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	return _vfs.WriteFile(path.Join(dir, versioningFile), data, 0666)
+}
+
+// currentVersionID returns the version ID of the current object at fp
+// or "" if it is the null version.
+func currentVersionID(_vfs *vfs.VFS, bucketName, objectName string, node vfs.Node) gofakes3.VersionID {
+	data, err := _vfs.ReadFile(path.Join(keyVersionsDir(bucketName, objectName), currentVersionFile))
+	if err != nil {
+		return ""
+	}
+	var current currentVersion
+	if err = json.Unmarshal(data, &current); err != nil {
+		fs.Debugf(objectName, "Ignoring corrupted current version: %v", err)
+		return ""
+	}
+	window := fs.GetModifyWindow(context.Background(), _vfs.Fs())
+	dt := node.ModTime().Sub(current.ModTime)
+	if current.Size != node.Size() || (window != fs.ModTimeNotSupported && (dt > window || dt < -window)) {
+		fs.Debugf(objectName, "Object changed outside serve s3 - treating as null version")
+		return ""
+	}
+	return current.VersionID
+}
+
+// setCurrentVersionID records the version ID of the current object
+// at fp. If id is "" then the record is removed.
+func setCurrentVersionID(_vfs *vfs.VFS, bucketName, objectName string, id gofakes3.VersionID) error {
+	dir := keyVersionsDir(bucketName, objectName)
+	currentPath := path.Join(dir, currentVersionFile)
+	if id == "" {
+		err := _vfs.Remove(currentPath)
+		if err != nil && err != vfs.ENOENT {
+			return err
+		}
+		rmdirEmpty(_vfs, bucketName, dir)
+		return nil
+	}
+	node, err := _vfs.Stat(path.Join(bucketName, objectName))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(currentVersion{
+		VersionID: id,
+		Size:      node.Size(),
+		ModTime:   node.ModTime(),
+	})
+	if err != nil {
+		return err
+	}
+	if err = _vfs.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	return _vfs.WriteFile(currentPath, data, 0666)
+}
+
+// renameObject renames the object at from to to in the VFS along with
+// its in memory metadata.
+func (b *s3Backend) renameObject(_vfs *vfs.VFS, from, to string) error {
+	if err := _vfs.Rename(from, to); err != nil {
+		return err
+	}
+	if meta, ok := b.meta.LoadAndDelete(from); ok {
+		b.meta.Store(to, meta)
+	} else {
+		b.meta.Delete(to)
+	}
+	return nil
+}
+
+// archiveCurrent moves the current object at objectName (if any) into
+// the versions area ready for it to be replaced or deleted.
+//
+// If the object is the null version and versioning is suspended it is
+// left where it is as it will be overwritten.
+//
+// It returns a function to undo the operation.
+func (b *s3Backend) archiveCurrent(_vfs *vfs.VFS, bucketName, objectName string, status gofakes3.VersioningStatus) (undo func(), err error) {
+	undo = func() {}
+	fp := path.Join(bucketName, objectName)
+	node, err := _vfs.Stat(fp)
+	if err != nil || !node.IsFile() {
+		return undo, nil
+	}
+	id := currentVersionID(_vfs, bucketName, objectName, node)
+	if id == "" && status == gofakes3.VersioningSuspended {
+		return undo, nil
+	}
+	dir := keyVersionsDir(bucketName, objectName)
+	if err = _vfs.MkdirAll(dir, 0777); err != nil {
+		return undo, err
+	}
+	archivePath := path.Join(dir, versionFileName(id, false))
+	if err = b.renameObject(_vfs, fp, archivePath); err != nil {
+		return undo, fmt.Errorf("failed to archive old version: %w", err)
+	}
+	undo = func() {
+		if _, err := _vfs.Stat(fp); err == nil {
+			_ = _vfs.Remove(fp)
+		}
+		if err := b.renameObject(_vfs, archivePath, fp); err != nil {
+			fs.Errorf(fp, "Failed to restore old version: %v", err)
+		}
+	}
+	return undo, setCurrentVersionID(_vfs, bucketName, objectName, "")
+}
+
+// removeNullVersion removes any archived null version of the key
+// which is overwritten when versioning is suspended.
+func removeNullVersion(_vfs *vfs.VFS, bucketName, objectName string) {
+	dir := keyVersionsDir(bucketName, objectName)
+	for _, deleteMarker := range []bool{false, true} {
+		p := path.Join(dir, versionFileName("", deleteMarker))
+		if err := _vfs.Remove(p); err == nil {
+			rmdirEmpty(_vfs, bucketName, dir)
+		}
+	}
+}
+
+// putVersioned writes the object in a bucket with versioning
+// configured returning its version ID.
+//
+// The object is uploaded to the uploads area first so the current
+// object can still be read while the upload runs. Once the upload has
+// succeeded the current object is archived and replaced with it while
+// holding versionMu, so concurrent uploads of the same key each make
+// a version in the order they finish.
+func (b *s3Backend) putVersioned(_vfs *vfs.VFS, bucketName, objectName string, meta map[string]string, input io.Reader, status gofakes3.VersioningStatus) (gofakes3.VersionID, error) {
+	uploads := path.Join(bucketName, versionsDir, versionsUploadsDir)
+	if err := _vfs.MkdirAll(uploads, 0777); err != nil {
+		return "", err
+	}
+	uploadPath := path.Join(uploads, string(newVersionID()))
+	if err := b.putObject(_vfs, uploadPath, meta, input); err != nil {
+		return "", err
+	}
+
+	b.versionMu.Lock()
+	defer b.versionMu.Unlock()
+	undo, err := b.archiveCurrent(_vfs, bucketName, objectName, status)
+	if err == nil {
+		err = b.renameObject(_vfs, uploadPath, path.Join(bucketName, objectName))
+	}
+	if err != nil {
+		undo()
+		_ = _vfs.Remove(uploadPath)
+		b.meta.Delete(uploadPath)
+		return "", err
+	}
+	var id gofakes3.VersionID
+	if status == gofakes3.VersioningEnabled {
+		id = newVersionID()
+	} else {
+		removeNullVersion(_vfs, bucketName, objectName)
+	}
+	return id, setCurrentVersionID(_vfs, bucketName, objectName, id)
+}
+
+// deleteVersioned deletes the object in a bucket with versioning
+// configured by archiving it and writing a delete marker.
+func (b *s3Backend) deleteVersioned(_vfs *vfs.VFS, bucketName, objectName string, status gofakes3.VersioningStatus) (result gofakes3.ObjectDeleteResult, err error) {
+	b.versionMu.Lock()
+	defer b.versionMu.Unlock()
+	_, err = b.archiveCurrent(_vfs, bucketName, objectName, status)
+	if err != nil {
+		return result, err
+	}
+	fp := path.Join(bucketName, objectName)
+	if err := _vfs.Remove(fp); err != nil && !os.IsNotExist(err) {
+		return result, err
+	}
+	rmdirRecursive(fp, _vfs)
+
+	var id gofakes3.VersionID
+	if status == gofakes3.VersioningEnabled {
+		id = newVersionID()
+	} else {
+		removeNullVersion(_vfs, bucketName, objectName)
+	}
+	dir := keyVersionsDir(bucketName, objectName)
+	if err = _vfs.MkdirAll(dir, 0777); err != nil {
+		return result, err
+	}
+	if err = _vfs.WriteFile(path.Join(dir, versionFileName(id, true)), nil, 0666); err != nil {
+		return result, fmt.Errorf("failed to write delete marker: %w", err)
+	}
+	result.IsDeleteMarker = true
+	result.VersionID = id
+	return result, nil
+}
+
+// readKeyVersions reads the versions of a single key from dir.
+//
+// The current object is not included.
+func readKeyVersions(_vfs *vfs.VFS, dir, key string) (versions []*objectVersion, err error) {
+	entries, err := getDirEntries(dir, _vfs)
+	if err == gofakes3.ErrNoSuchKey {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || name == currentVersionFile {
+			continue
+		}
+		v := &objectVersion{
+			key: key,
+		}
+		if base, found := strings.CutSuffix(name, deleteMarkerSuffix); found {
+			v.deleteMarker = true
+			v.id = versionFileID(base)
+		} else {
+			v.id = versionFileID(name)
+			v.path = path.Join(dir, name)
+			v.node = entry
+		}
+		v.created = versionCreated(v.id, entry)
+		versions = append(versions, v)
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+// sortVersions sorts the versions newest first
+func sortVersions(versions []*objectVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		if !versions[i].created.Equal(versions[j].created) {
+			return versions[i].created.After(versions[j].created)
+		}
+		return versions[i].id > versions[j].id
+	})
+}
+
+// keyVersions returns all the versions of key, newest first
+func keyVersions(_vfs *vfs.VFS, bucketName, key string) (versions []*objectVersion, err error) {
+	fp := path.Join(bucketName, key)
+	if node, err := _vfs.Stat(fp); err == nil && node.IsFile() {
+		v := &objectVersion{
+			key:     key,
+			id:      currentVersionID(_vfs, bucketName, key, node),
+			current: true,
+			path:    fp,
+			node:    node,
+		}
+		v.created = versionCreated(v.id, node)
+		versions = append(versions, v)
+	}
+	old, err := readKeyVersions(_vfs, keyVersionsDir(bucketName, key), key)
+	if err != nil {
+		return nil, err
+	}
+	return append(versions, old...), nil
+}
+
+// findVersion finds the version of key with the id given
+func findVersion(_vfs *vfs.VFS, bucketName, key string, id gofakes3.VersionID) (*objectVersion, []*objectVersion, error) {
+	if id == nullVersionID {
+		id = ""
+	}
+	versions, err := keyVersions(_vfs, bucketName, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, v := range versions {
+		if v.id == id {
+			return v, versions, nil
+		}
+	}
+	return nil, versions, gofakes3.ErrNoSuchVersion
+}
+
+// GetObjectVersion fetches a version of an object
+func (b *s3Backend) GetObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID, rangeRequest *gofakes3.ObjectRangeRequest) (*gofakes3.Object, error) {
+	return b.getObjectVersion(bucketName, objectName, versionID, rangeRequest, false)
+}
+
+// HeadObjectVersion fetches the info on a version of an object
+func (b *s3Backend) HeadObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID) (*gofakes3.Object, error) {
+	return b.getObjectVersion(bucketName, objectName, versionID, nil, true)
+}
+
+// getObjectVersion does the work for GetObjectVersion and HeadObjectVersion
+func (b *s3Backend) getObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID, rangeRequest *gofakes3.ObjectRangeRequest, head bool) (*gofakes3.Object, error) {
+	_vfs, err := b.getVersionedVFS(bucketName)
+	if err != nil {
+		return nil, err
+	}
+	if isVersionsKey(objectName) {
+		return nil, gofakes3.KeyNotFound(objectName)
+	}
+	v, _, err := findVersion(_vfs, bucketName, objectName, versionID)
+	if err != nil {
+		return nil, err
+	}
+	if v.deleteMarker {
+		return &gofakes3.Object{
+			Name:           objectName,
+			VersionID:      v.id,
+			IsDeleteMarker: true,
+			Contents:       noOpReadCloser{},
+		}, nil
+	}
+	var obj *gofakes3.Object
+	if v.current {
+		if head {
+			obj, err = b.HeadObject(context.Background(), bucketName, objectName)
+		} else {
+			obj, err = b.GetObject(context.Background(), bucketName, objectName, rangeRequest)
+		}
+	} else {
+		obj, err = b.openObject(_vfs, v.path, objectName, rangeRequest, head)
+	}
+	if err != nil {
+		return nil, err
+	}
+	obj.VersionID = v.id
+	return obj, nil
+}
+
+// DeleteObjectVersion permanently deletes a version of an object
+func (b *s3Backend) DeleteObjectVersion(bucketName, objectName string, versionID gofakes3.VersionID) (result gofakes3.ObjectDeleteResult, err error) {
+	_vfs, err := b.getVersionedVFS(bucketName)
+	if err != nil {
+		return result, err
+	}
+	if isVersionsKey(objectName) {
+		return result, nil
+	}
+	b.versionMu.Lock()
+	defer b.versionMu.Unlock()
+	v, versions, err := findVersion(_vfs, bucketName, objectName, versionID)
+	if err == gofakes3.ErrNoSuchVersion {
+		return result, nil
+	} else if err != nil {
+		return result, err
+	}
+	result.VersionID = v.id
+	result.IsDeleteMarker = v.deleteMarker
+	if v.deleteMarker {
+		p := path.Join(keyVersionsDir(bucketName, objectName), versionFileName(v.id, true))
+		if err = _vfs.Remove(p); err != nil {
+			return result, err
+		}
+		rmdirEmpty(_vfs, bucketName, path.Dir(p))
+	} else {
+		if err = _vfs.Remove(v.path); err != nil {
+			return result, err
+		}
+		if v.current {
+			rmdirRecursive(v.path, _vfs)
+		} else {
+			rmdirEmpty(_vfs, bucketName, path.Dir(v.path))
+		}
+		if v.current {
+			if err = setCurrentVersionID(_vfs, bucketName, objectName, ""); err != nil {
+				return result, err
+			}
+		}
+	}
+	// If the latest version was removed then promote the next one
+	if versions[0] == v && len(versions) > 1 && !versions[1].deleteMarker && !versions[1].current {
+		next := versions[1]
+		fp := path.Join(bucketName, objectName)
+		if dir := path.Dir(fp); dir != bucketName {
+			if err = _vfs.MkdirAll(dir, 0777); err != nil {
+				return result, err
+			}
+		}
+		if err = b.renameObject(_vfs, next.path, fp); err != nil {
+			return result, fmt.Errorf("failed to restore previous version: %w", err)
+		}
+		rmdirEmpty(_vfs, bucketName, path.Dir(next.path))
+		if err = setCurrentVersionID(_vfs, bucketName, objectName, next.id); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// walkKeys calls fn with the key and node for every file in dir
+// (relative to the bucket) recursively.
+func walkKeys(_vfs *vfs.VFS, bucketName, dir string, fn func(key string, node vfs.Node)) error {
+	entries, err := getDirEntries(path.Join(bucketName, dir), _vfs)
+	if err == gofakes3.ErrNoSuchKey {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		key := path.Join(dir, entry.Name())
+		if dir == "" && entry.Name() == versionsDir {
+			continue
+		}
+		if entry.IsDir() {
+			if err = walkKeys(_vfs, bucketName, key, fn); err != nil {
+				return err
+			}
+		} else {
+			fn(key, entry)
+		}
+	}
+	return nil
+}
+
+// walkVersionedKeys calls fn with every key which has old versions
+func walkVersionedKeys(_vfs *vfs.VFS, dir, rel string, fn func(key string) error) error {
+	entries, err := getDirEntries(dir, _vfs)
+	if err == gofakes3.ErrNoSuchKey {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		if key, found := strings.CutSuffix(path.Join(rel, name), versionsKeySuffix); found {
+			if err = fn(key); err != nil {
+				return err
+			}
+		}
+		// Directories of versions may also contain other keys
+		if err = walkVersionedKeys(_vfs, path.Join(dir, name), path.Join(rel, name), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListBucketVersions lists all the versions of the objects in the bucket
+func (b *s3Backend) ListBucketVersions(bucketName string, prefix *gofakes3.Prefix, page *gofakes3.ListBucketVersionsPage) (*gofakes3.ListBucketVersionsResult, error) {
+	if prefix == nil {
+		prefix = emptyPrefix
+	}
+	// workaround as for ListBucket
+	if strings.TrimSpace(prefix.Prefix) == "" {
+		prefix.HasPrefix = false
+	}
+	if strings.TrimSpace(prefix.Delimiter) == "" {
+		prefix.HasDelimiter = false
+	}
+	if page == nil {
+		page = &gofakes3.ListBucketVersionsPage{}
+	}
+	result := gofakes3.NewListBucketVersionsResult(bucketName, prefix, page)
+	_vfs, err := b.getVersionedVFS(bucketName)
+	if err != nil {
+		return result, err
+	}
+
+	// Find all the keys, current and old
+	keySet := map[string]struct{}{}
+	err = walkKeys(_vfs, bucketName, "", func(key string, node vfs.Node) {
+		keySet[key] = struct{}{}
+	})
+	if err != nil {
+		return result, err
+	}
+	err = walkVersionedKeys(_vfs, path.Join(bucketName, versionsDir, versionsObjectsDir), "", func(key string) error {
+		keySet[key] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	keys := make([]string, 0, len(keySet))
+	for key := range keySet {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	maxKeys := page.MaxKeys
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxVersions
+	}
+	var (
+		match gofakes3.PrefixMatch
+		count int64
+		last  *objectVersion
+	)
+	for _, key := range keys {
+		if page.HasKeyMarker {
+			if key < page.KeyMarker || (key == page.KeyMarker && !page.HasVersionIDMarker) {
+				continue
+			}
+		}
+		if !prefix.Match(key, &match) {
+			continue
+		}
+		if match.CommonPrefix {
+			result.AddPrefix(match.MatchedPart)
+			continue
+		}
+		versions, err := keyVersions(_vfs, bucketName, key)
+		if err != nil {
+			return result, err
+		}
+		if len(versions) == 0 {
+			continue
+		}
+		latest := versions[0]
+		if page.HasVersionIDMarker && key == page.KeyMarker {
+			// Skip versions up to and including the marker
+			marker := page.VersionIDMarker
+			if marker == nullVersionID {
+				marker = ""
+			}
+			for i, v := range versions {
+				if v.id == marker {
+					versions = versions[i+1:]
+					break
+				}
+			}
+		}
+		for _, v := range versions {
+			if count >= maxKeys {
+				result.IsTruncated = true
+				result.NextKeyMarker = last.key
+				result.NextVersionIDMarker = last.id
+				if last.id == "" {
+					result.NextVersionIDMarker = nullVersionID
+				}
+				return result, nil
+			}
+			isLatest := v == latest
+			if v.deleteMarker {
+				result.Versions = append(result.Versions, &gofakes3.DeleteMarker{
+					Key:          v.key,
+					VersionID:    v.id,
+					IsLatest:     isLatest,
+					LastModified: gofakes3.NewContentTime(v.created),
+				})
+			} else {
+				result.Versions = append(result.Versions, &gofakes3.Version{
+					Key:          v.key,
+					VersionID:    v.id,
+					IsLatest:     isLatest,
+					LastModified: gofakes3.NewContentTime(v.created),
+					Size:         v.node.Size(),
+					StorageClass: gofakes3.StorageStandard,
+					ETag:         getFileHash(v.node, b.s.etagHashType),
+				})
+			}
+			last = v
+			count++
+		}
+	}
+	return result, nil
+}
+
+// removeEmptyVersionsArea removes the versions area of the bucket if
+// it is the only thing in the bucket and it has no object versions in.
+//
+// This allows a bucket which has had versioning enabled to be deleted.
+func removeEmptyVersionsArea(_vfs *vfs.VFS, bucketName string) {
+	entries, err := getDirEntries(bucketName, _vfs)
+	if err != nil || len(entries) != 1 || entries[0].Name() != versionsDir {
+		return
+	}
+	area := path.Join(bucketName, versionsDir)
+	for _, dir := range []string{versionsObjectsDir, versionsUploadsDir} {
+		dir = path.Join(area, dir)
+		if entries, err := getDirEntries(dir, _vfs); err == nil {
+			if len(entries) != 0 {
+				return
+			}
+			if err = _vfs.Remove(dir); err != nil {
+				return
+			}
+		}
+	}
+	if err := _vfs.Remove(path.Join(area, versioningFile)); err != nil && err != vfs.ENOENT {
+		return
+	}
+	_ = _vfs.Remove(area)
+}
+
+// versionsListingKeyRe matches the elements containing object names in
+// a ListBucketVersionsResult
+var versionsListingKeyRe = regexp.MustCompile(`<(Key|Prefix|KeyMarker|NextKeyMarker)>[^<]*</(?:Key|Prefix|KeyMarker|NextKeyMarker)>`)
+
+// versionIDFromContext returns the versionId the request was made
+// with if any.
+func versionIDFromContext(ctx context.Context) (versionID gofakes3.VersionID, ok bool) {
+	versionID, ok = ctx.Value(ctxKeyVersionID).(gofakes3.VersionID)
+	return versionID, ok
+}
+
+// versioningMiddleware fills in the gaps in the gofakes3 versioning
+// support.
+//
+// gofakes3 ignores the versionId for HEAD requests and treats a
+// versionId of "null" as no version at all, so the versionId is
+// stored in the request context for HeadObject, GetObject and
+// DeleteObject to find.
+//
+// gofakes3 also only URL encodes ListObjects responses, so the object
+// names in ListObjectVersions responses are encoded here if the client
+// asked for it with encoding-type=url.
+func versioningMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if versionID := q.Get("versionId"); versionID != "" {
+			r = r.WithContext(context.WithValue(r.Context(), ctxKeyVersionID, gofakes3.VersionID(versionID)))
+		}
+		if _, ok := q["versions"]; !ok || r.Method != http.MethodGet || q.Get("encoding-type") != "url" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rec := httptest.NewRecorder()
+		next.ServeHTTP(rec, r)
+		body := rec.Body.Bytes()
+		if rec.Code == http.StatusOK {
+			body = versionsListingKeyRe.ReplaceAllFunc(body, func(match []byte) []byte {
+				tag := versionsListingKeyRe.FindSubmatch(match)[1]
+				var name string
+				if err := xml.Unmarshal(match, &name); err != nil {
+					return match
+				}
+				var buf bytes.Buffer
+				_ = xml.EscapeText(&buf, []byte(gofakes3.URLEncode(name)))
+				return fmt.Appendf(nil, "<%s>%s</%s>", tag, buf.Bytes(), tag)
+			})
+		}
+		for k, v := range rec.Header() {
+			w.Header()[k] = v
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(rec.Code)
+		_, _ = w.Write(body)
+	})
+}
@@ -0,0 +1,125 @@
+package webdav
+
+import (
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/vfs"
+	"golang.org/x/net/webdav"
+)
+
+// lockSystem adapts the VFS locks to a webdav.LockSystem for a single
+// request.
+//
+// Only locks made by LOCK requests are persisted. The handler makes
+// temporary locks for the other requests which modify files and these
+// are kept in memory.
+//
+// The locks confirmed or created by the request are held by holder, so
+// with --vfs-locks the VFS lets the request, and only the request,
+// modify the paths they cover. Those created are held until release is
+// called.
+type lockSystem struct {
+	locks   *vfs.Locks
+	holder  *vfs.LockHolder
+	persist bool // set to persist locks made with Create
+
+	mu    sync.Mutex
+	holds map[string]func() // release functions for locks held by this request
+}
+
+// check interface
+var _ webdav.LockSystem = (*lockSystem)(nil)
+
+// newLockSystem makes a lock system for a request with the given method
+// which holds its locks in holder
+func newLockSystem(locks *vfs.Locks, holder *vfs.LockHolder, method string) *lockSystem {
+	return &lockSystem{
+		locks:   locks,
+		holder:  holder,
+		persist: method == "LOCK",
+		holds:   make(map[string]func()),
+	}
+}
+
+// translate a vfs lock error into a webdav one
+func translateLockError(err error) error {
+	switch err {
+	case vfs.ErrLocked:
+		return webdav.ErrLocked
+	case vfs.ErrNoSuchLock:
+		return webdav.ErrNoSuchLock
+	case vfs.ErrLockNotConfirmed:
+		return webdav.ErrConfirmationFailed
+	}
+	return err
+}
+
+// Confirm the caller can claim the locks in conditions for name0 and name1
+func (ls *lockSystem) Confirm(now time.Time, name0, name1 string, conditions ...webdav.Condition) (release func(), err error) {
+	var tokens []string
+	for _, condition := range conditions {
+		if !condition.Not && condition.Token != "" {
+			tokens = append(tokens, condition.Token)
+		}
+	}
+	release, err = ls.locks.Confirm(now, ls.holder, name0, name1, tokens...)
+	return release, translateLockError(err)
+}
+
+// Create a lock, holding it until the end of the request
+func (ls *lockSystem) Create(now time.Time, details webdav.LockDetails) (token string, err error) {
+	token, err = ls.locks.Create(now, vfs.Lock{
+		Root:      details.Root,
+		Owner:     details.OwnerXML,
+		ZeroDepth: details.ZeroDepth,
+		Duration:  details.Duration,
+	}, ls.persist)
+	if err != nil {
+		return "", translateLockError(err)
+	}
+	release, err := ls.locks.Confirm(now, ls.holder, details.Root, "", token)
+	if err != nil {
+		return "", translateLockError(err)
+	}
+	ls.mu.Lock()
+	ls.holds[token] = release
+	ls.mu.Unlock()
+	return token, nil
+}
+
+// Refresh the lock with token
+func (ls *lockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	lock, err := ls.locks.Refresh(now, token, duration)
+	if err != nil {
+		return webdav.LockDetails{}, translateLockError(err)
+	}
+	return webdav.LockDetails{
+		Root:      "/" + lock.Root,
+		Duration:  lock.Duration,
+		OwnerXML:  lock.Owner,
+		ZeroDepth: lock.ZeroDepth,
+	}, nil
+}
+
+// Unlock the lock with token, releasing it first if this request holds it
+func (ls *lockSystem) Unlock(now time.Time, token string) error {
+	ls.mu.Lock()
+	release := ls.holds[token]
+	delete(ls.holds, token)
+	ls.mu.Unlock()
+	if release != nil {
+		release()
+	}
+	return translateLockError(ls.locks.Unlock(now, token))
+}
+
+// release the locks held by this request
+func (ls *lockSystem) release() {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	for token, release := range ls.holds {
+		release()
+		delete(ls.holds, token)
+	}
+}
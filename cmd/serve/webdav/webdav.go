@@ -143,6 +143,18 @@ Create a new DWORD BasicAuthLevel with value 2.
 
 https://learn.microsoft.com/en-us/office/troubleshoot/powerpoint/office-opens-blank-from-sharepoint
 
+### Locking
+
+Locks taken with the WebDAV "LOCK" method are stored in the VFS rather
+than in memory, so they survive a restart of the server and are shared
+with any other "rclone serve webdav" using the same remote. They are
+removed when they are unlocked or their timeout expires.
+
+While a file is locked requests to modify it are refused unless they
+supply the lock token. Other servers using the same remote, for
+example "rclone serve sftp" or "rclone mount", can be made to honour
+the locks with the "--vfs-locks" flag.
+
 ### Serving over a unix socket
 
 You can serve the webdav on a unix socket like this:
@@ -163,7 +175,7 @@ done by the permissions on the socket.
 	},
 	RunE: func(command *cobra.Command, args []string) error {
 		var f fs.Fs
-		if proxy.Opt.AuthProxy == "" {
+		if !proxy.Opt.Enabled() {
 			cmd.CheckArgs(1, 1, command, args)
 			f = cmd.NewFsSrc(args)
 		} else {
@@ -226,10 +238,14 @@ func newWebDAV(ctx context.Context, f fs.Fs, opt *Options, vfsOpt *vfscommon.Opt
 	if w.etagHashType != hash.None {
 		fs.Debugf(f, "Using hash %v for ETag", w.etagHashType)
 	}
-	if proxyOpt.AuthProxy != "" {
+	if proxyOpt.Enabled() {
+		if err := proxyOpt.CheckAuth(&w.opt.Auth); err != nil {
+			return nil, err
+		}
 		w.proxy = proxy.New(ctx, proxyOpt, vfsOpt)
 		// override auth
 		w.opt.Auth.CustomAuthFn = w.auth
+		w.opt.Auth.IdentityAuthFn = w.authIdentity
 	} else {
 		w._vfs = vfs.New(f, vfsOpt)
 	}
@@ -305,6 +321,15 @@ func (w *WebDAV) auth(user, pass string) (value any, err error) {
 	return VFS, err
 }
 
+// authIdentity finds the VFS for users authenticated by JWT or LDAP
+func (w *WebDAV) authIdentity(id *libhttp.Identity) (value any, err error) {
+	VFS, _, err := w.proxy.CallIdentity(id)
+	if err != nil {
+		return nil, err
+	}
+	return VFS, err
+}
+
 type webdavRW struct {
 	http.ResponseWriter
 	status int
@@ -363,7 +388,15 @@ func (w *WebDAV) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	// return absolute references.
 	r.URL.Path = w.opt.HTTP.BaseURL + r.URL.Path
 	wrw := &webdavRW{ResponseWriter: rw}
-	w.webdavhandler.ServeHTTP(wrw, r)
+	handler := *w.webdavhandler
+	if VFS, err := w.getVFS(r.Context()); err == nil {
+		holder := vfs.NewLockHolder()
+		r = r.WithContext(vfs.WithLockHolder(r.Context(), holder))
+		ls := newLockSystem(VFS.Locks(), holder, r.Method)
+		defer ls.release()
+		handler.LockSystem = ls
+	}
+	handler.ServeHTTP(wrw, r)
 
 	if wrw.isSuccessfull() {
 		w.postprocess(r, remote)
@@ -450,12 +483,7 @@ func (w *WebDAV) Mkdir(ctx context.Context, name string, perm os.FileMode) (err
 	if err != nil {
 		return err
 	}
-	dir, leaf, err := VFS.StatParent(name)
-	if err != nil {
-		return err
-	}
-	_, err = dir.Mkdir(leaf)
-	return err
+	return VFS.MkdirContext(ctx, name, perm)
 }
 
 // OpenFile opens a file or a directory
@@ -465,7 +493,7 @@ func (w *WebDAV) OpenFile(ctx context.Context, name string, flags int, perm os.F
 	if err != nil {
 		return nil, err
 	}
-	f, err := VFS.OpenFile(name, flags, perm)
+	f, err := VFS.OpenFileContext(ctx, name, flags, perm)
 	if err != nil {
 		return nil, err
 	}
@@ -479,15 +507,7 @@ func (w *WebDAV) RemoveAll(ctx context.Context, name string) (err error) {
 	if err != nil {
 		return err
 	}
-	node, err := VFS.Stat(name)
-	if err != nil {
-		return err
-	}
-	err = node.RemoveAll()
-	if err != nil {
-		return err
-	}
-	return nil
+	return VFS.RemoveAllContext(ctx, name)
 }
 
 // Rename a file or a directory
@@ -497,7 +517,7 @@ func (w *WebDAV) Rename(ctx context.Context, oldName, newName string) (err error
 	if err != nil {
 		return err
 	}
-	return VFS.Rename(oldName, newName)
+	return VFS.RenameContext(ctx, oldName, newName)
 }
 
 // Stat returns info about the file or directory
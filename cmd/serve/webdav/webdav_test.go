@@ -271,3 +271,72 @@ func TestRc(t *testing.T) {
 		"vfs_cache_mode": "off",
 	})
 }
+
+func TestLocks(t *testing.T) {
+	ctx := context.Background()
+	f, err := fs.NewFs(ctx, t.TempDir())
+	require.NoError(t, err)
+
+	startServer := func() (*WebDAV, string) {
+		opt := Opt
+		opt.HTTP.ListenAddr = []string{testBindAddress}
+		vfsOpt := vfscommon.Opt
+		vfsOpt.Locks = true
+		w, err := newWebDAV(ctx, f, &opt, &vfsOpt, &proxy.Opt)
+		require.NoError(t, err)
+		go func() {
+			require.NoError(t, w.Serve())
+		}()
+		return w, w.server.URLs()[0]
+	}
+	do := func(method, url, body string, headers ...string) *http.Response {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		require.NoError(t, err)
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		_ = resp.Body.Close()
+		return resp
+	}
+	const lockInfo = `<?xml version="1.0" encoding="utf-8" ?>
+<D:lockinfo xmlns:D="DAV:">
+  <D:lockscope><D:exclusive/></D:lockscope>
+  <D:locktype><D:write/></D:locktype>
+  <D:owner>tester</D:owner>
+</D:lockinfo>`
+
+	w, testURL := startServer()
+	fileURL := testURL + "file.txt"
+	assert.Equal(t, http.StatusCreated, do("PUT", fileURL, "hello").StatusCode)
+
+	// Lock the file
+	resp := do("LOCK", fileURL, lockInfo, "Timeout", "Second-3600")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	token := strings.Trim(resp.Header.Get("Lock-Token"), "<>")
+	require.NotEqual(t, "", token)
+
+	// Writes without the token fail, with it succeed
+	assert.Equal(t, webdav.StatusLocked, do("PUT", fileURL, "potato").StatusCode)
+	assert.Equal(t, webdav.StatusLocked, do("DELETE", fileURL, "").StatusCode)
+	assert.Equal(t, http.StatusCreated, do("PUT", fileURL, "hello again", "If", "(<"+token+">)").StatusCode)
+
+	// The lock is enforced by the VFS with --vfs-locks
+	VFS, err := w.getVFS(ctx)
+	require.NoError(t, err)
+	assert.Error(t, VFS.WriteFile("file.txt", []byte("potato"), 0666))
+
+	// The lock survives a restart
+	require.NoError(t, w.Shutdown())
+	w, testURL = startServer()
+	defer func() {
+		assert.NoError(t, w.Shutdown())
+	}()
+	fileURL = testURL + "file.txt"
+	assert.Equal(t, webdav.StatusLocked, do("PUT", fileURL, "potato").StatusCode)
+
+	// Unlock
+	assert.Equal(t, http.StatusNoContent, do("UNLOCK", fileURL, "", "Lock-Token", "<"+token+">").StatusCode)
+	assert.Equal(t, http.StatusCreated, do("PUT", fileURL, "unlocked").StatusCode)
+}
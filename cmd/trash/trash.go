@@ -0,0 +1,206 @@
+// Package trash provides the trash command.
+package trash
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/cmd"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/flags"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/spf13/cobra"
+)
+
+var (
+	jsonOutput bool
+	restoreAll bool
+	olderThan  = fs.Duration(30 * 24 * time.Hour)
+)
+
+func init() {
+	cmd.Root.AddCommand(trashCommand)
+	trashCommand.AddCommand(trashListCommand)
+	trashCommand.AddCommand(trashRestoreCommand)
+	trashCommand.AddCommand(trashExpireCommand)
+
+	cmdFlags := trashListCommand.Flags()
+	flags.BoolVarP(cmdFlags, &jsonOutput, "json", "", false, "Format output as JSON", "")
+
+	cmdFlags = trashRestoreCommand.Flags()
+	flags.BoolVarP(cmdFlags, &restoreAll, "all", "", false, "Restore every item in the trash", "")
+
+	cmdFlags = trashExpireCommand.Flags()
+	flags.FVarP(cmdFlags, &olderThan, "older-than", "", "Remove items put in the trash longer ago than this", "")
+}
+
+var trashCommand = &cobra.Command{
+	Use:   "trash <subcommand>",
+	Short: `Manage files moved into a trash by --trash-dir.`,
+	Long: `When ` + "`--trash-dir`" + ` is used with sync, copy or move, files which
+would have been deleted or overwritten on the destination are moved
+into the trash directory instead. Each one is stored next to its
+original path with a timestamp added to the name, along with a
+` + "`.rclonetrash`" + ` file recording where it came from, when it was
+deleted and why.
+
+Use the subcommands to list, restore and expire the items in the
+trash, eg
+
+    rclone sync /path/to/files remote:current --trash-dir remote:trash
+    rclone trash list remote:trash
+    rclone trash restore remote:trash path/to/file.txt
+    rclone trash expire remote:trash --older-than 30d
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.71",
+	},
+}
+
+var trashListCommand = &cobra.Command{
+	Use:   "list remote:trash",
+	Short: `List the items in the trash.`,
+	Long: `List the items in the trash, oldest first, showing when each was
+deleted, why, its size and its original path.
+
+Use ` + "`--json`" + ` to output the full details of each item, including the
+name it is stored under in the trash and the remote it came from.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.71",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		ftrash := cmd.NewFsSrc(args)
+		cmd.Run(false, false, command, func() error {
+			items, err := operations.ListTrash(context.Background(), ftrash)
+			if err != nil {
+				return err
+			}
+			if jsonOutput {
+				if items == nil {
+					items = []operations.TrashItem{}
+				}
+				out := json.NewEncoder(os.Stdout)
+				out.SetIndent("", "\t")
+				return out.Encode(items)
+			}
+			for _, item := range items {
+				fmt.Printf("%s %-11s %9s %s\n", item.Deleted.Local().Format("2006-01-02 15:04:05"), item.Reason, fs.SizeSuffix(item.Size).ByteUnit(), item.Path)
+			}
+			return nil
+		})
+	},
+}
+
+// selectItems returns the most recently trashed version of each path
+// matching paths. A path matches if it is the original path of an
+// item, a directory containing it or the name in the trash of an
+// item.
+func selectItems(items []operations.TrashItem, paths []string) (selected []operations.TrashItem) {
+	latest := make(map[string]int)
+	for i, item := range items {
+		for _, p := range paths {
+			p = strings.Trim(p, "/")
+			if item.Name == p {
+				// An exact trash name selects that version
+				latest["\x00"+item.Name] = i
+			} else if p == "" || item.Path == p || strings.HasPrefix(item.Path, p+"/") {
+				// items are oldest first so this keeps the newest
+				latest[item.Root+"\x00"+item.Path] = i
+			}
+		}
+	}
+	for i, item := range items {
+		for _, j := range latest {
+			if i == j {
+				selected = append(selected, item)
+				break
+			}
+		}
+	}
+	return selected
+}
+
+var trashRestoreCommand = &cobra.Command{
+	Use:   "restore remote:trash [path...]",
+	Short: `Restore items from the trash.`,
+	Long: `Restore items from the trash to where they were deleted from.
+
+Each path may be the original path of a file, a directory to restore
+all the files within it, or the name of an item in the trash as shown
+by ` + "`rclone trash list --json`" + ` to restore a particular version. If
+a file was put in the trash several times then the most recent
+version is restored unless the name of an older one is given.
+
+Use ` + "`--all`" + ` to restore the most recent version of every file in the
+trash.
+
+If a file already exists where an item is being restored to, then it
+is moved into the trash first so nothing is lost.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.71",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1000000, command, args)
+		ftrash := cmd.NewFsSrc(args[:1])
+		paths := args[1:]
+		cmd.Run(true, false, command, func() error {
+			if len(paths) == 0 {
+				if !restoreAll {
+					return errors.New("need paths to restore or --all")
+				}
+				paths = []string{""}
+			}
+			ctx := context.Background()
+			items, err := operations.ListTrash(ctx, ftrash)
+			if err != nil {
+				return err
+			}
+			selected := selectItems(items, paths)
+			if len(selected) == 0 {
+				return errors.New("no matching items found in trash")
+			}
+			var lastErr error
+			for _, item := range selected {
+				err := operations.RestoreTrash(ctx, ftrash, item)
+				if err != nil {
+					fs.Errorf(item.Path, "Failed to restore from trash: %v", err)
+					lastErr = fs.CountError(ctx, err)
+					continue
+				}
+				fs.Infof(item.Path, "Restored from trash")
+			}
+			return lastErr
+		})
+	},
+}
+
+var trashExpireCommand = &cobra.Command{
+	Use:   "expire remote:trash",
+	Short: `Remove old items from the trash.`,
+	Long: `Permanently remove the items which were put in the trash longer ago
+than ` + "`--older-than`" + ` (default 30 days), then remove any directories
+left empty.
+
+Use ` + "`--older-than 0`" + ` to empty the trash completely.
+`,
+	Annotations: map[string]string{
+		"versionIntroduced": "v1.71",
+	},
+	Run: func(command *cobra.Command, args []string) {
+		cmd.CheckArgs(1, 1, command, args)
+		ftrash := cmd.NewFsSrc(args)
+		cmd.Run(true, false, command, func() error {
+			removed, err := operations.ExpireTrash(context.Background(), ftrash, time.Duration(olderThan))
+			fs.Infof(ftrash, "Removed %d items from the trash", removed)
+			return err
+		})
+	},
+}
@@ -72,6 +72,12 @@ type Account struct {
 
 	tokenBucket buckets // per file bandwidth limiter (may be nil)
 
+	// names of the remotes and group for per remote limits -
+	// protected by values.mu
+	limitSrc   string
+	limitDst   string
+	limitGroup string
+
 	values accountValues
 }
 
@@ -344,6 +350,33 @@ func (acc *Account) limitPerFileBandwidth(n int) {
 	}
 }
 
+// setLimitNames sets the names used to look up the per remote and
+// per group bandwidth limits for this transfer
+func (acc *Account) setLimitNames(srcFs, dstFs fs.Fs, group string) {
+	acc.values.mu.Lock()
+	defer acc.values.mu.Unlock()
+	if srcFs != nil {
+		acc.limitSrc = fs.LimitName(srcFs.Name())
+	}
+	if dstFs != nil {
+		acc.limitDst = fs.LimitName(dstFs.Name())
+	}
+	if group != globalStats {
+		acc.limitGroup = group
+	}
+}
+
+// Account for n bytes from the per remote and per group bandwidth
+// limits (if any)
+func (acc *Account) limitPerRemoteBandwidth(n int) {
+	acc.values.mu.Lock()
+	src, dst, group := acc.limitSrc, acc.limitDst, acc.limitGroup
+	acc.values.mu.Unlock()
+	if src != "" || dst != "" || group != "" {
+		remoteLimits.limitBandwidth(src, dst, group, n)
+	}
+}
+
 // Account the read and limit bandwidth
 func (acc *Account) accountRead(n int) {
 	// Update Stats
@@ -356,6 +389,7 @@ func (acc *Account) accountRead(n int) {
 
 	TokenBucket.LimitBandwidth(TokenBucketSlotAccounting, n)
 	acc.limitPerFileBandwidth(n)
+	acc.limitPerRemoteBandwidth(n)
 }
 
 // read bytes from the io.Reader passed in and account them
@@ -0,0 +1,303 @@
+package accounting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"golang.org/x/time/rate"
+)
+
+// remoteLimits holds the per remote and per group limiters
+var remoteLimits = newLimits()
+
+func init() {
+	fs.SetRemoteLimits = func(name string, bwLimit fs.BwTimetable, tpsLimit float64) {
+		remoteLimits.setFromConfig(name, bwLimit, tpsLimit)
+	}
+}
+
+// limiter holds the bandwidth and transaction limits for a remote or
+// an rc job group.
+//
+// These apply in addition to the global limits.
+type limiter struct {
+	mu        sync.Mutex
+	timetable fs.BwTimetable // bandwidth limits
+	bandwidth fs.BwPair      // bandwidth limit currently in force
+	checked   time.Time      // when the timetable was last checked
+	tx        *rate.Limiter  // upload limiter - may be nil
+	rx        *rate.Limiter  // download limiter - may be nil
+	tpsLimit  float64        // transactions per second, 0 for unlimited
+	tps       *rate.Limiter  // transaction limiter - may be nil
+}
+
+// newLimiter makes a new unlimited limiter
+func newLimiter() *limiter {
+	return &limiter{
+		bandwidth: fs.BwPair{Tx: -1, Rx: -1},
+	}
+}
+
+// Update the bandwidth limiters if the timetable has changed the
+// limit
+//
+// Call with the lock held
+func (l *limiter) _update(now time.Time) {
+	l.checked = now
+	bandwidth := l.timetable.LimitAt(now).Bandwidth
+	if bandwidth == l.bandwidth {
+		return
+	}
+	l.bandwidth = bandwidth
+	l.tx, l.rx = nil, nil
+	if bandwidth.Tx > 0 {
+		l.tx = newEmptyTokenBucket(bandwidth.Tx)
+	}
+	if bandwidth.Rx > 0 {
+		l.rx = newEmptyTokenBucket(bandwidth.Rx)
+	}
+}
+
+// Set the bandwidth timetable
+//
+// Call with the lock held
+func (l *limiter) _setBwLimit(timetable fs.BwTimetable) {
+	l.timetable = timetable
+	l._update(time.Now())
+}
+
+// Set the transactions per second limit
+//
+// Call with the lock held
+func (l *limiter) _setTPSLimit(tpsLimit float64) {
+	l.tpsLimit = tpsLimit
+	l.tps = nil
+	if tpsLimit > 0 {
+		l.tps = rate.NewLimiter(rate.Limit(tpsLimit), 1)
+	}
+}
+
+// limitBandwidth sleeps for the correct amount of time for the
+// passage of n bytes in the direction given by i
+func (l *limiter) limitBandwidth(i TokenBucketSlot, n int) {
+	l.mu.Lock()
+	// Follow the timetable if there is more than one entry
+	if len(l.timetable) > 1 {
+		if now := time.Now(); now.Sub(l.checked) >= time.Minute {
+			l._update(now)
+		}
+	}
+	tb := l.rx
+	if i == TokenBucketSlotTransportTx {
+		tb = l.tx
+	}
+	l.mu.Unlock()
+	if tb != nil {
+		err := tb.WaitN(context.Background(), n)
+		if err != nil {
+			fs.Errorf(nil, "Token bucket error: %v", err)
+		}
+	}
+}
+
+// limitTPS waits until a transaction is allowed
+func (l *limiter) limitTPS(ctx context.Context) {
+	l.mu.Lock()
+	tps := l.tps
+	l.mu.Unlock()
+	if tps != nil {
+		tbErr := tps.Wait(ctx)
+		if tbErr != nil && tbErr != context.Canceled {
+			fs.Errorf(nil, "HTTP token bucket error: %v", tbErr)
+		}
+	}
+}
+
+// limits returns the bandwidth and transactions per second in force
+func (l *limiter) limits() (bandwidth fs.BwPair, tpsLimit float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.bandwidth, l.tpsLimit
+}
+
+// limits holds the limiters for each remote and each rc job group
+type limits struct {
+	mu      sync.RWMutex
+	remotes map[string]*limiter
+	groups  map[string]*limiter
+}
+
+// newLimits makes an empty limits
+func newLimits() *limits {
+	return &limits{
+		remotes: make(map[string]*limiter),
+		groups:  make(map[string]*limiter),
+	}
+}
+
+// Find the table for remotes or groups
+func (ls *limits) table(group bool) map[string]*limiter {
+	if group {
+		return ls.groups
+	}
+	return ls.remotes
+}
+
+// get the limiter for name or nil if there isn't one
+func (ls *limits) get(group bool, name string) *limiter {
+	if name == "" {
+		return nil
+	}
+	ls.mu.RLock()
+	l := ls.table(group)[name]
+	ls.mu.RUnlock()
+	return l
+}
+
+// getOrCreate gets the limiter for name making it if necessary
+func (ls *limits) getOrCreate(group bool, name string) *limiter {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	table := ls.table(group)
+	l := table[name]
+	if l == nil {
+		l = newLimiter()
+		table[name] = l
+	}
+	return l
+}
+
+// setFromConfig sets the limits for the remote name from the config.
+//
+// This is called each time a backend for the remote is made so it
+// only sets the limits the first time the remote is seen, leaving
+// any changes made with the rc in place.
+func (ls *limits) setFromConfig(name string, bwLimit fs.BwTimetable, tpsLimit float64) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if _, found := ls.remotes[name]; found {
+		return
+	}
+	l := newLimiter()
+	l._setBwLimit(bwLimit)
+	l._setTPSLimit(tpsLimit)
+	ls.remotes[name] = l
+	if l.bandwidth.IsSet() {
+		fs.Infof(name, "Starting bandwidth limiter for remote at %v Byte/s", &l.bandwidth)
+	}
+	if tpsLimit > 0 {
+		fs.Infof(name, "Starting transaction limiter for remote: max %g transactions/s", tpsLimit)
+	}
+}
+
+// limitBandwidth applies the limits for the remotes and group given
+//
+// Data is read from srcName and written to dstName.
+func (ls *limits) limitBandwidth(srcName, dstName, group string, n int) {
+	if l := ls.get(false, srcName); l != nil {
+		l.limitBandwidth(TokenBucketSlotTransportRx, n)
+	}
+	if l := ls.get(false, dstName); l != nil {
+		l.limitBandwidth(TokenBucketSlotTransportTx, n)
+	}
+	if l := ls.get(true, group); l != nil {
+		l.limitBandwidth(TokenBucketSlotTransportTx, n)
+	}
+}
+
+// LimitRemoteTPS limits the number of transactions per second to the
+// remote called name if enabled as well as applying the limits from
+// LimitTPS. It should be called once per transaction.
+func LimitRemoteTPS(ctx context.Context, name string) {
+	LimitTPS(ctx)
+	if l := remoteLimits.get(false, fs.LimitName(name)); l != nil {
+		l.limitTPS(ctx)
+	}
+}
+
+// Apply the transaction limit for the rc job group in ctx if any
+func limitGroupTPS(ctx context.Context) {
+	if group, ok := StatsGroupFromContext(ctx); ok {
+		if l := remoteLimits.get(true, group); l != nil {
+			l.limitTPS(ctx)
+		}
+	}
+}
+
+// read and set the limits for a remote or group
+func (ls *limits) rcLimits(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	var name string
+	group := in["group"] != nil
+	if group {
+		name, err = in.GetString("group")
+	} else {
+		name, err = in.GetString("remote")
+		name = fs.LimitName(strings.TrimSuffix(name, ":"))
+		if strings.ContainsAny(name, ":/") {
+			return out, fmt.Errorf("remote should be the name of a remote not a path: %q", name)
+		}
+	}
+	if err != nil {
+		return out, err
+	}
+	if name == "" {
+		return out, errors.New("remote or group name must not be empty")
+	}
+	var bws fs.BwTimetable
+	if in["rate"] != nil {
+		bwlimit, err := in.GetString("rate")
+		if err != nil {
+			return out, err
+		}
+		err = bws.Set(bwlimit)
+		if err != nil {
+			return out, fmt.Errorf("bad bwlimit: %w", err)
+		}
+	}
+	var tpsLimit float64
+	if in["tpslimit"] != nil {
+		tpsLimit, err = in.GetFloat64("tpslimit")
+		if err != nil {
+			return out, err
+		}
+	}
+	var l *limiter
+	if in["rate"] == nil && in["tpslimit"] == nil {
+		// Just reading the limits so don't make a limiter as
+		// that would stop the config being read
+		if l = ls.get(group, name); l == nil {
+			l = newLimiter()
+		}
+	} else {
+		l = ls.getOrCreate(group, name)
+	}
+	l.mu.Lock()
+	if in["rate"] != nil {
+		l._setBwLimit(bws)
+		if l.bandwidth.IsSet() {
+			fs.Logf(name, "Bandwidth limit set to %v", &l.bandwidth)
+		} else {
+			fs.Logf(name, "Bandwidth limit reset to unlimited")
+		}
+	}
+	if in["tpslimit"] != nil {
+		l._setTPSLimit(tpsLimit)
+		fs.Logf(name, "Transaction limit set to %g transactions/s", tpsLimit)
+	}
+	l.mu.Unlock()
+	bp, tpsLimit := l.limits()
+	out = rc.Params{
+		"rate":             bp.String(),
+		"bytesPerSecond":   int64(max(bp.Tx, bp.Rx)),
+		"bytesPerSecondTx": int64(bp.Tx),
+		"bytesPerSecondRx": int64(bp.Rx),
+		"tpslimit":         tpsLimit,
+	}
+	return out, nil
+}
@@ -0,0 +1,105 @@
+package accounting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestRcBwLimitRemote(t *testing.T) {
+	call := rc.Calls.Get("core/bwlimit")
+	assert.NotNil(t, call)
+	oldLimits := remoteLimits
+	remoteLimits = newLimits()
+	defer func() {
+		remoteLimits = oldLimits
+	}()
+
+	// Query unknown remote doesn't make a limiter
+	out, err := call.Fn(context.Background(), rc.Params{"remote": "test:"})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{
+		"bytesPerSecond":   int64(-1),
+		"bytesPerSecondTx": int64(-1),
+		"bytesPerSecondRx": int64(-1),
+		"rate":             "off",
+		"tpslimit":         float64(0),
+	}, out)
+	assert.Nil(t, remoteLimits.get(false, "test"))
+
+	// Set
+	out, err = call.Fn(context.Background(), rc.Params{"remote": "test:", "rate": "10M:1M", "tpslimit": 5})
+	require.NoError(t, err)
+	assert.Equal(t, rc.Params{
+		"bytesPerSecond":   int64(10485760),
+		"bytesPerSecondTx": int64(10485760),
+		"bytesPerSecondRx": int64(1048576),
+		"rate":             "10Mi:1Mi",
+		"tpslimit":         float64(5),
+	}, out)
+	l := remoteLimits.get(false, "test")
+	require.NotNil(t, l)
+	assert.Equal(t, rate.Limit(10485760), l.tx.Limit())
+	assert.Equal(t, rate.Limit(1048576), l.rx.Limit())
+	assert.Equal(t, rate.Limit(5), l.tps.Limit())
+
+	// Config doesn't override the rc
+	remoteLimits.setFromConfig("test", fs.BwTimetable{{Bandwidth: fs.BwPair{Tx: 1, Rx: 1}}}, 1)
+	assert.Equal(t, rate.Limit(10485760), l.tx.Limit())
+
+	// Group
+	out, err = call.Fn(context.Background(), rc.Params{"group": "job/1", "rate": "1M"})
+	require.NoError(t, err)
+	assert.Equal(t, "1Mi", out["rate"])
+	assert.NotNil(t, remoteLimits.get(true, "job/1"))
+	assert.Nil(t, remoteLimits.get(false, "job/1"))
+
+	// Reset
+	out, err = call.Fn(context.Background(), rc.Params{"remote": "test", "rate": "off", "tpslimit": 0})
+	require.NoError(t, err)
+	assert.Equal(t, "off", out["rate"])
+	assert.Nil(t, l.tx)
+	assert.Nil(t, l.rx)
+	assert.Nil(t, l.tps)
+
+	// Errors
+	for _, in := range []rc.Params{
+		{"remote": "test:path"},
+		{"remote": ""},
+		{"remote": "test", "rate": "bad"},
+		{"tpslimit": 1},
+	} {
+		_, err = call.Fn(context.Background(), in)
+		assert.Error(t, err, in)
+	}
+}
+
+func TestLimitsFromConfig(t *testing.T) {
+	ls := newLimits()
+	ls.setFromConfig("remote", fs.BwTimetable{{Bandwidth: fs.BwPair{Tx: 1024 * 1024, Rx: -1}}}, 0)
+	l := ls.get(false, "remote")
+	require.NotNil(t, l)
+	assert.NotNil(t, l.tx)
+	assert.Nil(t, l.rx)
+	assert.Nil(t, l.tps)
+
+	// Reading is unlimited so doesn't block
+	start := time.Now()
+	ls.limitBandwidth("remote", "", "", 16*1024*1024)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Timetable is followed
+	var timetable fs.BwTimetable
+	require.NoError(t, timetable.Set("00:00,1M 12:00,2M"))
+	ls.setFromConfig("timetable", timetable, 0)
+	l = ls.get(false, "timetable")
+	require.NotNil(t, l)
+	want := timetable.LimitAt(time.Now()).Bandwidth
+	assert.Equal(t, want, l.bandwidth)
+}
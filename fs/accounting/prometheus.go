@@ -2,12 +2,20 @@ package accounting
 
 import (
 	"context"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rclone/rclone/fs"
 )
 
 var namespace = "rclone_"
 
+func init() {
+	fs.PacerRetry = func(name string) {
+		DefaultMetrics.onPacerRetry(name)
+	}
+}
+
 // RcloneCollector is a Prometheus collector for Rclone
 type RcloneCollector struct {
 	ctx              context.Context
@@ -22,6 +30,13 @@ type RcloneCollector struct {
 	listed           *prometheus.Desc
 	fatalError       *prometheus.Desc
 	retryError       *prometheus.Desc
+
+	// per stats group metrics
+	groupBytes     *prometheus.Desc
+	groupErrors    *prometheus.Desc
+	groupChecks    *prometheus.Desc
+	groupTransfers *prometheus.Desc
+	groupDeletes   *prometheus.Desc
 }
 
 // NewRcloneCollector make a new RcloneCollector
@@ -72,6 +87,26 @@ func NewRcloneCollector(ctx context.Context) *RcloneCollector {
 			"Whether there has been an error that will be retried",
 			nil, nil,
 		),
+		groupBytes: prometheus.NewDesc(namespace+"group_bytes_transferred_total",
+			"Total transferred bytes by stats group",
+			[]string{"group"}, nil,
+		),
+		groupErrors: prometheus.NewDesc(namespace+"group_errors_total",
+			"Number of errors by stats group",
+			[]string{"group"}, nil,
+		),
+		groupChecks: prometheus.NewDesc(namespace+"group_checked_files_total",
+			"Number of checked files by stats group",
+			[]string{"group"}, nil,
+		),
+		groupTransfers: prometheus.NewDesc(namespace+"group_files_transferred_total",
+			"Number of transferred files by stats group",
+			[]string{"group"}, nil,
+		),
+		groupDeletes: prometheus.NewDesc(namespace+"group_files_deleted_total",
+			"Number of files deleted by stats group",
+			[]string{"group"}, nil,
+		),
 	}
 }
 
@@ -88,6 +123,11 @@ func (c *RcloneCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.listed
 	ch <- c.fatalError
 	ch <- c.retryError
+	ch <- c.groupBytes
+	ch <- c.groupErrors
+	ch <- c.groupChecks
+	ch <- c.groupTransfers
+	ch <- c.groupDeletes
 }
 
 // Collect is part of the Collector interface: https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
@@ -108,6 +148,20 @@ func (c *RcloneCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(c.retryError, prometheus.GaugeValue, bool2Float(s.retryError))
 
 	s.mu.RUnlock()
+
+	for _, group := range groups.names() {
+		s := groups.get(group)
+		if s == nil {
+			continue
+		}
+		s.mu.RLock()
+		ch <- prometheus.MustNewConstMetric(c.groupBytes, prometheus.CounterValue, float64(s.bytes), group)
+		ch <- prometheus.MustNewConstMetric(c.groupErrors, prometheus.CounterValue, float64(s.errors), group)
+		ch <- prometheus.MustNewConstMetric(c.groupChecks, prometheus.CounterValue, float64(s.checks), group)
+		ch <- prometheus.MustNewConstMetric(c.groupTransfers, prometheus.CounterValue, float64(s.transfers), group)
+		ch <- prometheus.MustNewConstMetric(c.groupDeletes, prometheus.CounterValue, float64(s.deletes), group)
+		s.mu.RUnlock()
+	}
 }
 
 // bool2Float is a small function to convert a boolean into a float64 value that can be used for Prometheus
@@ -117,3 +171,107 @@ func bool2Float(e bool) float64 {
 	}
 	return 0
 }
+
+// Metrics provide per remote transfer and retry metrics.
+type Metrics struct {
+	TransferDuration *prometheus.HistogramVec
+	TransferBytes    *prometheus.CounterVec
+	LowLevelRetries  *prometheus.CounterVec
+	PacerRetries     *prometheus.CounterVec
+}
+
+// NewMetrics creates a new metrics instance, the instance shall be assigned to
+// DefaultMetrics before any processing takes place.
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		TransferDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "transfer",
+			Name:      "duration_seconds",
+			Help:      "Time taken by file transfers",
+			Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+		}, []string{"remote", "status"}),
+		TransferBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "transfer",
+			Name:      "bytes_total",
+			Help:      "Bytes transferred by completed file transfers",
+		}, []string{"remote"}),
+		LowLevelRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "transfer",
+			Name:      "low_level_retries_total",
+			Help:      "Number of low level retries of file transfers",
+		}, []string{"remote"}),
+		PacerRetries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "pacer",
+			Name:      "retries_total",
+			Help:      "Number of API calls retried by the pacer",
+		}, []string{"remote"}),
+	}
+}
+
+// DefaultMetrics specifies metrics used for new Transfers.
+var DefaultMetrics = (*Metrics)(nil)
+
+// Collectors returns all prometheus metrics as collectors for registration.
+func (m *Metrics) Collectors() []prometheus.Collector {
+	if m == nil {
+		return nil
+	}
+	return []prometheus.Collector{
+		m.TransferDuration,
+		m.TransferBytes,
+		m.LowLevelRetries,
+		m.PacerRetries,
+	}
+}
+
+// remoteLabel returns the name of the remote f for use as a label
+func remoteLabel(f fs.Info) string {
+	if f == nil {
+		return ""
+	}
+	return fs.LimitName(f.Name())
+}
+
+// onTransferDone records a finished transfer
+func (m *Metrics) onTransferDone(tr *Transfer, bytes int64, duration time.Duration, err error) {
+	if m == nil || tr.checking {
+		return
+	}
+	remote := tr.dstFs
+	if remote == nil {
+		remote = tr.srcFs
+	}
+	label := remoteLabel(remote)
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	m.TransferDuration.WithLabelValues(label, status).Observe(duration.Seconds())
+	m.TransferBytes.WithLabelValues(label).Add(float64(bytes))
+}
+
+// onLowLevelRetry records a low level retry of a transfer to f
+func (m *Metrics) onLowLevelRetry(f fs.Info) {
+	if m == nil {
+		return
+	}
+	m.LowLevelRetries.WithLabelValues(remoteLabel(f)).Inc()
+}
+
+// onPacerRetry records the pacer for the remote called name retrying
+func (m *Metrics) onPacerRetry(name string) {
+	if m == nil {
+		return
+	}
+	m.PacerRetries.WithLabelValues(fs.LimitName(name)).Inc()
+}
+
+// LowLevelRetry records a low level retry of a transfer to f in the
+// metrics.
+func LowLevelRetry(f fs.Info) {
+	DefaultMetrics.onLowLevelRetry(f)
+}
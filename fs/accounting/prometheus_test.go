@@ -0,0 +1,71 @@
+package accounting
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fstest/mockfs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetrics(t *testing.T) {
+	ctx := context.Background()
+	oldDefaultMetrics := DefaultMetrics
+	m := NewMetrics("test")
+	DefaultMetrics = m
+	defer func() {
+		DefaultMetrics = oldDefaultMetrics
+	}()
+	f, err := mockfs.NewFs(ctx, "potato{suffix}", "", nil)
+	require.NoError(t, err)
+
+	stats := NewStats(ctx)
+	tr := stats.NewTransferRemoteSize("a", 10, nil, f)
+	tr.Done(ctx, nil)
+	tr = stats.NewTransferRemoteSize("b", 10, nil, f)
+	tr.Done(ctx, errors.New("boom"))
+	assert.Equal(t, 1, testutil.CollectAndCount(m.TransferBytes))
+	assert.Equal(t, 2, testutil.CollectAndCount(m.TransferDuration))
+	assert.Equal(t, 0.0, testutil.ToFloat64(m.TransferBytes.WithLabelValues("potato")))
+
+	LowLevelRetry(f)
+	assert.Equal(t, 1.0, testutil.ToFloat64(m.LowLevelRetries.WithLabelValues("potato")))
+
+	fs.PacerRetry("potato{suffix}")
+	fs.PacerRetry("potato")
+	assert.Equal(t, 2.0, testutil.ToFloat64(m.PacerRetries.WithLabelValues("potato")))
+
+	// Check nil metrics don't crash
+	DefaultMetrics = nil
+	LowLevelRetry(f)
+	fs.PacerRetry("potato")
+	tr = stats.NewTransferRemoteSize("c", 10, nil, f)
+	tr.Done(ctx, nil)
+}
+
+func TestRcloneCollectorGroups(t *testing.T) {
+	ctx := context.Background()
+	stats := StatsGroup(ctx, "metrics-test-group")
+	defer groups.delete("metrics-test-group")
+	stats.Bytes(123)
+	stats.Errors(2)
+
+	c := NewRcloneCollector(ctx)
+	reg := prometheus.NewPedanticRegistry()
+	require.NoError(t, reg.Register(c))
+	err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP rclone_group_bytes_transferred_total Total transferred bytes by stats group
+# TYPE rclone_group_bytes_transferred_total counter
+rclone_group_bytes_transferred_total{group="metrics-test-group"} 123
+# HELP rclone_group_errors_total Number of errors by stats group
+# TYPE rclone_group_errors_total counter
+rclone_group_errors_total{group="metrics-test-group"} 2
+`), "rclone_group_bytes_transferred_total", "rclone_group_errors_total")
+	require.NoError(t, err)
+}
@@ -352,10 +352,11 @@ func (sg *statsGroups) get(group string) *StatsInfo {
 	return stats
 }
 
+// names returns a copy of the names of the groups in order
 func (sg *statsGroups) names() []string {
 	sg.mu.Lock()
 	defer sg.mu.Unlock()
-	return sg.order
+	return append([]string{}, sg.order...)
 }
 
 // sum returns aggregate stats that contains summation of all groups.
@@ -193,6 +193,12 @@ func (tb *tokenBucket) SetBwLimit(bandwidth fs.BwPair) {
 
 // read and set the bandwidth limits
 func (tb *tokenBucket) rcBwlimit(ctx context.Context, in rc.Params) (out rc.Params, err error) {
+	if in["remote"] != nil || in["group"] != nil {
+		return remoteLimits.rcLimits(ctx, in)
+	}
+	if in["tpslimit"] != nil {
+		return out, errors.New("tpslimit can only be set with remote or group")
+	}
 	if in["rate"] != nil {
 		bwlimit, err := in.GetString("rate")
 		if err != nil {
@@ -281,6 +287,30 @@ except only one bandwidth may be specified.
 
 In either case "rate" is returned as a human-readable string, and
 "bytesPerSecond" is returned as a number.
+
+Limits for a single remote or rc job group can be read and set by
+passing "remote" or "group". These apply in addition to the global
+limit. A remote's limits start off as the "bwlimit" and "tpslimit"
+set in its config section. The limit for a group applies to all the
+transfers of the rc jobs run with "_group" set to that group.
+
+    rclone rc core/bwlimit remote=s3: rate=10M tpslimit=5
+    {
+        "bytesPerSecond": 10485760,
+        "bytesPerSecondTx": 10485760,
+        "bytesPerSecondRx": 10485760,
+        "rate": "10Mi",
+        "tpslimit": 5
+    }
+
+When setting limits for a remote or group "rate" may be a full
+timetable and "tpslimit" sets the maximum number of transactions per
+second, with 0 meaning unlimited. A group has a single limit for the
+data uploaded and downloaded by its transfers, which is the first
+bandwidth of an upload:download pair.
+
+The limits in a remote's config are only read the first time the
+remote is used, so use this to change them afterwards.
 `,
 	})
 }
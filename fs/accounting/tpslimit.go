@@ -24,6 +24,9 @@ func StartLimitTPS(ctx context.Context) {
 
 // LimitTPS limits the number of transactions per second if enabled.
 // It should be called once per transaction.
+//
+// This applies the global limit and the limit for the rc job group
+// in ctx if any.
 func LimitTPS(ctx context.Context) {
 	if tpsBucket != nil {
 		tbErr := tpsBucket.Wait(ctx)
@@ -31,4 +34,5 @@ func LimitTPS(ctx context.Context) {
 			fs.Errorf(nil, "HTTP token bucket error: %v", tbErr)
 		}
 	}
+	limitGroupTPS(ctx)
 }
@@ -109,7 +109,9 @@ func (tr *Transfer) Done(ctx context.Context, err error) {
 	tr.mu.RUnlock()
 
 	ci := fs.GetConfig(ctx)
+	var bytes int64
 	if acc != nil {
+		bytes, _ = acc.progress()
 		// Close the file if it is still open
 		if err := acc.Close(); err != nil {
 			fs.LogLevelPrintf(ci.StatsLogLevel, nil, "can't close account: %+v\n", err)
@@ -122,8 +124,11 @@ func (tr *Transfer) Done(ctx context.Context, err error) {
 
 	tr.mu.Lock()
 	tr.completedAt = time.Now()
+	duration := tr.completedAt.Sub(tr.startedAt)
 	tr.mu.Unlock()
 
+	DefaultMetrics.onTransferDone(tr, bytes, duration, err)
+
 	if tr.checking {
 		tr.stats.DoneChecking(tr.remote)
 	} else {
@@ -157,6 +162,7 @@ func (tr *Transfer) Account(ctx context.Context, in io.ReadCloser) *Account {
 		tr.acc.UpdateReader(ctx, in)
 	}
 	tr.acc.checking = tr.checking
+	tr.acc.setLimitNames(tr.srcFs, tr.dstFs, tr.stats.group)
 	tr.mu.Unlock()
 	return tr.acc
 }
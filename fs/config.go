@@ -43,6 +43,27 @@ var (
 	// implementation from the fs
 	CountError = func(ctx context.Context, err error) error { return err }
 
+	// ConfigObscure obscures a password read from a secret store
+	// so it can be used as the value of a password option.
+	//
+	// This is a function pointer to decouple the config
+	// implementation from the fs
+	ConfigObscure = func(value string) (string, error) { return value, nil }
+
+	// SetRemoteLimits sets the bandwidth and transaction limits
+	// read from the config for the remote called name.
+	//
+	// This is a function pointer to decouple the accounting
+	// implementation from the fs
+	SetRemoteLimits = func(name string, bwLimit BwTimetable, tpsLimit float64) {}
+
+	// PacerRetry is called when the pacer for the remote called
+	// name retries a call.
+	//
+	// This is a function pointer to decouple the accounting
+	// implementation from the fs
+	PacerRetry = func(name string) {}
+
 	// ConfigProvider is the config key used for provider options
 	ConfigProvider = "provider"
 
@@ -141,6 +162,11 @@ var ConfigOptionsInfo = Options{{
 	Default: SpaceSepList{},
 	Help:    "Command for supplying password for encrypted configuration",
 	Groups:  "Config",
+}, {
+	Name:    "secret_command",
+	Default: SpaceSepList{},
+	Help:    "Command for reading secrets referenced as {{secret:cmd:name}} in the config",
+	Groups:  "Config",
 }, {
 	Name:    "max_delete",
 	Default: int64(-1),
@@ -257,11 +283,21 @@ var ConfigOptionsInfo = Options{{
 	Default: []string{},
 	Help:    "Implies --compare-dest but also copies files from paths into destination",
 	Groups:  "Copy",
+}, {
+	Name:    "link_dest",
+	Default: []string{},
+	Help:    "Implies --compare-dest but also hard links (or server-side copies) unchanged files from paths into destination",
+	Groups:  "Copy",
 }, {
 	Name:    "backup_dir",
 	Default: "",
 	Help:    "Make backups into hierarchy based in DIR",
 	Groups:  "Sync",
+}, {
+	Name:    "trash_dir",
+	Default: "",
+	Help:    "Move deleted and overwritten files into a trash in DIR",
+	Groups:  "Sync",
 }, {
 	Name:    "suffix",
 	Default: "",
@@ -544,6 +580,11 @@ var ConfigOptionsInfo = Options{{
 	Default: ".partial",
 	Help:    "Add partial-suffix to temporary file name when --inplace is not used",
 	Groups:  "Copy",
+}, {
+	Name:    "upload_state_dir",
+	Default: "",
+	Help:    "Directory to save the state of multipart uploads in so they can be resumed",
+	Groups:  "Copy",
 }, {
 	Name:     "max_connections",
 	Help:     "Maximum number of simultaneous backend API connections, 0 for unlimited.",
@@ -607,7 +648,9 @@ type ConfigInfo struct {
 	DataRateUnit               string            `config:"stats_unit"`
 	CompareDest                []string          `config:"compare_dest"`
 	CopyDest                   []string          `config:"copy_dest"`
+	LinkDest                   []string          `config:"link_dest"`
 	BackupDir                  string            `config:"backup_dir"`
+	TrashDir                   string            `config:"trash_dir"`
 	Suffix                     string            `config:"suffix"`
 	SuffixKeepExtension        bool              `config:"suffix_keep_extension"`
 	UseListR                   bool              `config:"fast_list"`
@@ -626,6 +669,7 @@ type ConfigInfo struct {
 	StatsFileNameLength        int               `config:"stats_file_name_length"`
 	AskPassword                bool              `config:"ask_password"`
 	PasswordCommand            SpaceSepList      `config:"password_command"`
+	SecretCommand              SpaceSepList      `config:"secret_command"`
 	UseServerModTime           bool              `config:"use_server_modtime"`
 	MaxTransfer                SizeSuffix        `config:"max_transfer"`
 	MaxDuration                Duration          `config:"max_duration"`
@@ -669,6 +713,7 @@ type ConfigInfo struct {
 	DefaultTime                Time              `config:"default_time"` // time that directories with no time should display
 	Inplace                    bool              `config:"inplace"`      // Download directly to destination file instead of atomic download to temp/rename
 	PartialSuffix              string            `config:"partial_suffix"`
+	UploadStateDir             string            `config:"upload_state_dir"`
 	MetadataMapper             SpaceSepList      `config:"metadata_mapper"`
 	MaxConnections             int               `config:"max_connections"`
 	NameTransform              []string          `config:"name_transform"`
@@ -703,10 +748,18 @@ func (ci *ConfigInfo) Reload(ctx context.Context) error {
 		ci.StatsLogLevel = LogLevelNotice
 	}
 
-	// Check --compare-dest and --copy-dest
+	// Check --compare-dest, --copy-dest and --link-dest
 	if len(ci.CompareDest) > 0 && len(ci.CopyDest) > 0 {
 		return fmt.Errorf("can't use --compare-dest with --copy-dest")
 	}
+	if len(ci.LinkDest) > 0 && (len(ci.CompareDest) > 0 || len(ci.CopyDest) > 0) {
+		return fmt.Errorf("can't use --link-dest with --compare-dest or --copy-dest")
+	}
+
+	// Check --trash-dir
+	if ci.TrashDir != "" && (ci.BackupDir != "" || ci.Suffix != "") {
+		return fmt.Errorf("can't use --trash-dir with --backup-dir or --suffix")
+	}
 
 	// Check --stats-one-line and dependent flags
 	switch {
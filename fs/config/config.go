@@ -128,6 +128,7 @@ func init() {
 	fs.ConfigFileHasSection = func(section string) bool {
 		return LoadedData().HasSection(section)
 	}
+	fs.ConfigObscure = obscure.Obscure
 	configPath = makeConfigPath()
 	cacheDir = makeCacheDir() // Has fallback to tempDir, so set that first
 	data = newDefaultStorage()
@@ -573,8 +574,10 @@ func updateRemote(ctx context.Context, name string, keyValues rc.Params, opt Upd
 		if strings.ContainsAny(k, "\n\r") || strings.ContainsAny(vStr, "\n\r") {
 			return nil, fmt.Errorf("update remote: invalid key or value contains \\n or \\r")
 		}
-		// Obscure parameter if necessary
-		if _, ok := needsObscure[k]; ok {
+		// Obscure parameter if necessary - secret references are
+		// stored as they are and obscured when they are read
+		_, _, isSecretRef := configmap.ParseSecretRef(vStr)
+		if _, ok := needsObscure[k]; ok && !isSecretRef {
 			_, err := obscure.Reveal(vStr)
 			if err != nil || opt.Obscure {
 				// If error => not already obscured, so obscure it
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"sort"
 	"strings"
+	"sync"
 	"unicode"
 )
 
@@ -41,11 +42,26 @@ type Mapper interface {
 	Setter
 }
 
+// ErrorGetter is a Getter which can fail to get an item, for example
+// if it refers to a secret which can't be read.
+type ErrorGetter interface {
+	// GetErr should get an item with the key passed in as Get
+	// does, returning an error if it couldn't be read.
+	GetErr(key string) (value string, ok bool, err error)
+}
+
+// Resolver returns the value to use for the value read for key, for
+// example by reading the secret it refers to.
+type Resolver func(key, value string) (string, error)
+
 // Map provides a wrapper around multiple Setter and
 // Getter interfaces.
 type Map struct {
-	setters []Setter
-	getters []getprio
+	setters  []Setter
+	getters  []getprio
+	resolver Resolver
+	mu       sync.Mutex
+	resolved map[string]string // resolved values by key and value
 }
 
 type getprio struct {
@@ -91,21 +107,72 @@ func (c *Map) ClearGetters(priority Priority) *Map {
 	return c
 }
 
-// GetPriority gets an item with the key passed in and return the
+// SetResolver sets the Resolver the values read are passed through.
+//
+// Values are resolved when they are first read and the result is
+// remembered.
+func (c *Map) SetResolver(resolver Resolver) *Map {
+	c.resolver = resolver
+	return c
+}
+
+// resolve value read for key with the resolver if set
+func (c *Map) resolve(key, value string) (string, error) {
+	if c.resolver == nil {
+		return value, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cacheKey := key + "\x00" + value
+	if resolved, found := c.resolved[cacheKey]; found {
+		return resolved, nil
+	}
+	resolved, err := c.resolver(key, value)
+	if err != nil {
+		return "", err
+	}
+	if c.resolved == nil {
+		c.resolved = make(map[string]string)
+	}
+	c.resolved[cacheKey] = resolved
+	return resolved, nil
+}
+
+// GetPriorityErr gets an item with the key passed in and return the
 // value from the first getter to return a result with priority <=
 // maxPriority. If the item is found then it returns true, otherwise
 // false.
-func (c *Map) GetPriority(key string, maxPriority Priority) (value string, ok bool) {
+//
+// The value is passed through the resolver if set. If that fails the
+// error is returned and the item is not found.
+func (c *Map) GetPriorityErr(key string, maxPriority Priority) (value string, ok bool, err error) {
 	for _, item := range c.getters {
 		if item.priority > maxPriority {
 			break
 		}
 		value, ok = item.getter.Get(key)
 		if ok {
-			return value, ok
+			resolved, err := c.resolve(key, value)
+			if err != nil {
+				return "", false, fmt.Errorf("config item %q: %w", key, err)
+			}
+			return resolved, ok, nil
 		}
 	}
-	return "", false
+	return "", false, nil
+}
+
+// GetPriority gets an item with the key passed in and return the
+// value from the first getter to return a result with priority <=
+// maxPriority. If the item is found then it returns true, otherwise
+// false.
+//
+// If the value can't be resolved the item is not found so a secret
+// reference is never used as the value - use GetPriorityErr to see
+// the error.
+func (c *Map) GetPriority(key string, maxPriority Priority) (value string, ok bool) {
+	value, ok, _ = c.GetPriorityErr(key, maxPriority)
+	return value, ok
 }
 
 // Get gets an item with the key passed in and return the value from
@@ -115,6 +182,12 @@ func (c *Map) Get(key string) (value string, ok bool) {
 	return c.GetPriority(key, PriorityMax)
 }
 
+// GetErr gets an item with the key passed in as Get does, returning
+// an error if the value couldn't be resolved.
+func (c *Map) GetErr(key string) (value string, ok bool, err error) {
+	return c.GetPriorityErr(key, PriorityMax)
+}
+
 // Set sets an item into all the stored setters.
 func (c *Map) Set(key, value string) {
 	for _, do := range c.setters {
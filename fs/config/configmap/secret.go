@@ -0,0 +1,96 @@
+package configmap
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Config values of the form {{secret:store:name}} refer to a secret
+// held outside the config. The secret is read from the store when the
+// value is read from a Map with a resolver so the config only holds
+// the reference.
+
+const (
+	secretPrefix = "{{secret:"
+	secretSuffix = "}}"
+)
+
+// SecretStore reads the secret called name
+type SecretStore func(name string) (secret string, err error)
+
+var (
+	secretStoresMu sync.RWMutex
+	secretStores   = map[string]SecretStore{
+		"env":  envSecret,
+		"file": fileSecret,
+	}
+)
+
+// RegisterSecretStore registers a store which can be used in secret
+// references as {{secret:name:...}}, replacing any existing store
+// with that name.
+func RegisterSecretStore(name string, store SecretStore) {
+	secretStoresMu.Lock()
+	defer secretStoresMu.Unlock()
+	secretStores[name] = store
+}
+
+// ParseSecretRef parses value as a secret reference returning the
+// store and the name of the secret in it. ok is false if value isn't
+// a secret reference.
+func ParseSecretRef(value string) (store, name string, ok bool) {
+	ref, found := strings.CutPrefix(value, secretPrefix)
+	if !found {
+		return "", "", false
+	}
+	ref, found = strings.CutSuffix(ref, secretSuffix)
+	if !found {
+		return "", "", false
+	}
+	store, name, found = strings.Cut(ref, ":")
+	if !found || store == "" || name == "" {
+		return "", "", false
+	}
+	return store, name, true
+}
+
+// ResolveSecret returns the secret value refers to, or value if it
+// isn't a secret reference.
+func ResolveSecret(value string) (string, error) {
+	storeName, name, ok := ParseSecretRef(value)
+	if !ok {
+		return value, nil
+	}
+	secretStoresMu.RLock()
+	store := secretStores[storeName]
+	secretStoresMu.RUnlock()
+	if store == nil {
+		return "", fmt.Errorf("unknown secret store %q in %q", storeName, value)
+	}
+	secret, err := store(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %q: %w", value, err)
+	}
+	return secret, nil
+}
+
+// envSecret reads the secret from the environment variable name
+func envSecret(name string) (string, error) {
+	secret, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %q not set", name)
+	}
+	return secret, nil
+}
+
+// fileSecret reads the secret from the file name, removing any
+// trailing line ending
+func fileSecret(name string) (string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
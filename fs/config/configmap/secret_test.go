@@ -0,0 +1,126 @@
+package configmap
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ ErrorGetter = (*Map)(nil)
+
+func TestParseSecretRef(t *testing.T) {
+	for _, test := range []struct {
+		in    string
+		store string
+		name  string
+		ok    bool
+	}{
+		{"", "", "", false},
+		{"potato", "", "", false},
+		{"{{secret:env:FOO}}", "env", "FOO", true},
+		{"{{secret:file:/path/to:file}}", "file", "/path/to:file", true},
+		{"{{secret:env:FOO}", "", "", false},
+		{"{{secret:env}}", "", "", false},
+		{"{{secret::FOO}}", "", "", false},
+		{"{{secret:env:}}", "", "", false},
+		{" {{secret:env:FOO}}", "", "", false},
+	} {
+		store, name, ok := ParseSecretRef(test.in)
+		assert.Equal(t, test.store, store, test.in)
+		assert.Equal(t, test.name, name, test.in)
+		assert.Equal(t, test.ok, ok, test.in)
+	}
+}
+
+func TestResolveSecret(t *testing.T) {
+	t.Setenv("RCLONE_TEST_SECRET", "sekrit")
+	path := filepath.Join(t.TempDir(), "secret")
+	require.NoError(t, os.WriteFile(path, []byte("filesekrit\n"), 0600))
+
+	value, err := ResolveSecret("potato")
+	require.NoError(t, err)
+	assert.Equal(t, "potato", value)
+
+	value, err = ResolveSecret("{{secret:env:RCLONE_TEST_SECRET}}")
+	require.NoError(t, err)
+	assert.Equal(t, "sekrit", value)
+
+	_, err = ResolveSecret("{{secret:env:RCLONE_TEST_SECRET_NOT_SET}}")
+	assert.ErrorContains(t, err, "not set")
+
+	value, err = ResolveSecret("{{secret:file:" + path + "}}")
+	require.NoError(t, err)
+	assert.Equal(t, "filesekrit", value)
+
+	_, err = ResolveSecret("{{secret:file:" + path + "-not-found}}")
+	assert.Error(t, err)
+
+	_, err = ResolveSecret("{{secret:potato:FOO}}")
+	assert.ErrorContains(t, err, "unknown secret store")
+
+	calls := 0
+	RegisterSecretStore("test", func(name string) (string, error) {
+		calls++
+		if name == "bad" {
+			return "", errors.New("bad secret")
+		}
+		return "test-" + name, nil
+	})
+	value, err = ResolveSecret("{{secret:test:one}}")
+	require.NoError(t, err)
+	assert.Equal(t, "test-one", value)
+	_, err = ResolveSecret("{{secret:test:bad}}")
+	assert.ErrorContains(t, err, "bad secret")
+	assert.Equal(t, 2, calls)
+}
+
+func TestConfigMapResolver(t *testing.T) {
+	m := New()
+	m.AddGetter(Simple{
+		"config1": "one",
+		"config2": "{{secret:two}}",
+		"config3": "bad",
+	}, PriorityNormal)
+
+	calls := 0
+	m.SetResolver(func(key, value string) (string, error) {
+		calls++
+		if value == "bad" {
+			return "", errors.New("bad value")
+		}
+		return key + "=" + value, nil
+	})
+
+	value, found, err := m.GetErr("config1")
+	require.NoError(t, err)
+	assert.Equal(t, "config1=one", value)
+	assert.Equal(t, true, found)
+
+	// Resolved values are remembered
+	value, found = m.Get("config2")
+	assert.Equal(t, "config2={{secret:two}}", value)
+	assert.Equal(t, true, found)
+	value, found = m.Get("config2")
+	assert.Equal(t, "config2={{secret:two}}", value)
+	assert.Equal(t, true, found)
+	assert.Equal(t, 2, calls)
+
+	// Errors are returned by GetErr and items which can't be
+	// resolved aren't found
+	value, found, err = m.GetErr("config3")
+	assert.ErrorContains(t, err, `config item "config3": bad value`)
+	assert.Equal(t, "", value)
+	assert.Equal(t, false, found)
+	value, found = m.Get("config3")
+	assert.Equal(t, "", value)
+	assert.Equal(t, false, found)
+
+	value, found, err = m.GetErr("config4")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+	assert.Equal(t, false, found)
+}
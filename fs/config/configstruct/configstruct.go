@@ -247,9 +247,20 @@ func Set(config configmap.Getter, opt any) (err error) {
 	if err != nil {
 		return err
 	}
+	errGetter, _ := config.(configmap.ErrorGetter)
 	for _, defaultItem := range defaultItems {
 		newValue := defaultItem.Value
-		if configValue, ok := config.Get(defaultItem.Name); ok {
+		var configValue string
+		var ok bool
+		if errGetter != nil {
+			configValue, ok, err = errGetter.GetErr(defaultItem.Name)
+			if err != nil {
+				return err
+			}
+		} else {
+			configValue, ok = config.Get(defaultItem.Name)
+		}
+		if ok {
 			newValue, err = setValue(newValue, configValue)
 			if err != nil {
 				return fmt.Errorf("couldn't parse config item %q = %q as %T: %w", defaultItem.Name, configValue, defaultItem.Value, err)
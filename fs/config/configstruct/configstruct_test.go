@@ -1,11 +1,13 @@
 package configstruct_test
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 	"time"
 
 	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
 	"github.com/rclone/rclone/fs/config/configstruct"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -143,6 +145,17 @@ func TestSetMore(t *testing.T) {
 	assert.Equal(t, &Conf{A: "ONE", B: "two"}, c)
 }
 
+func TestSetResolveError(t *testing.T) {
+	c := &Conf{A: "one", B: "two"}
+	m := configmap.New()
+	m.AddGetter(configMap{"a": "ONE"}, configmap.PriorityNormal)
+	m.SetResolver(func(key, value string) (string, error) {
+		return "", errors.New("can't resolve")
+	})
+	err := configstruct.Set(m, c)
+	assert.ErrorContains(t, err, `config item "a": can't resolve`)
+}
+
 func TestSetFull(t *testing.T) {
 	in := &Conf2{
 		PotatoPie:      "yum",
@@ -0,0 +1,53 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strings"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config/configmap"
+)
+
+func init() {
+	configmap.RegisterSecretStore("cmd", func(name string) (string, error) {
+		return GetSecretCommand(context.Background(), name)
+	})
+}
+
+// GetSecretCommand reads the secret called name by running
+// --secret-command with name as its last argument
+func GetSecretCommand(ctx context.Context, name string) (secret string, err error) {
+	ci := fs.GetConfig(ctx)
+	if len(ci.SecretCommand) == 0 {
+		return "", errors.New("--secret-command not set")
+	}
+
+	var stdout bytes.Buffer
+	var stderr bytes.Buffer
+
+	args := append(slices.Clone(ci.SecretCommand[1:]), name)
+	cmd := exec.Command(ci.SecretCommand[0], args...)
+
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		// One does not always get the stderr returned in the wrapped error.
+		fs.Errorf(nil, "Using --secret-command for %q returned: %v", name, err)
+		if ers := strings.TrimSpace(stderr.String()); ers != "" {
+			fs.Errorf(nil, "--secret-command stderr: %s", ers)
+		}
+		return "", fmt.Errorf("secret command failed: %w", err)
+	}
+	secret = strings.Trim(stdout.String(), "\r\n")
+	if secret == "" {
+		return "", fmt.Errorf("--secret-command returned empty string for %q", name)
+	}
+	return secret, nil
+}
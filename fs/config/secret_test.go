@@ -0,0 +1,31 @@
+package config_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetSecretCommand(t *testing.T) {
+	ctx, ci := fs.AddConfig(context.Background())
+
+	// Not configured
+	ci.SecretCommand = fs.SpaceSepList{}
+	_, err := config.GetSecretCommand(ctx, "potato")
+	assert.ErrorContains(t, err, "--secret-command not set")
+
+	// Happy path - name is passed as the last argument
+	ci.SecretCommand = fs.SpaceSepList{"echo", "secret"}
+	secret, err := config.GetSecretCommand(ctx, "potato")
+	require.NoError(t, err)
+	assert.Equal(t, "secret potato", secret)
+
+	// Error when running command
+	ci.SecretCommand = fs.SpaceSepList{"XXX non-existent command XXX"}
+	_, err = config.GetSecretCommand(ctx, "potato")
+	assert.ErrorContains(t, err, "not found")
+}
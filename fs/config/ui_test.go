@@ -250,6 +250,20 @@ func TestCreateUpdatePasswordRemote(t *testing.T) {
 	}
 }
 
+func TestCreateSecretRefRemote(t *testing.T) {
+	ctx := context.Background()
+	defer testConfigFile(t, simpleOptions, "secret.conf")()
+
+	// Secret references aren't obscured even if asked
+	for _, doObscure := range []bool{false, true} {
+		_, err := config.CreateRemote(ctx, "test2", "config_test_remote", rc.Params{
+			"pass": "{{secret:env:RCLONE_TEST_PASS}}",
+		}, config.UpdateRemoteOpt{Obscure: doObscure})
+		require.NoError(t, err)
+		assert.Equal(t, "{{secret:env:RCLONE_TEST_PASS}}", config.GetValue("test2", "pass"))
+	}
+}
+
 func TestDefaultRequired(t *testing.T) {
 	// By default options are optional (sic), regardless if a default value is defined.
 	// Setting Required=true means empty string is no longer allowed, except when
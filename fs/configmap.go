@@ -141,5 +141,27 @@ func ConfigMap(prefix string, options Options, configName string, connectionStri
 
 	// Set Config
 	config.AddSetter(setConfigFile(configName))
+
+	// Read secrets referenced in the values
+	config.SetResolver(func(key, value string) (string, error) {
+		return resolveSecret(options, key, value)
+	})
 	return config
 }
+
+// resolveSecret returns the secret value refers to if it is a secret
+// reference, obscuring it if the option is a password.
+func resolveSecret(options Options, key, value string) (string, error) {
+	if _, _, ok := configmap.ParseSecretRef(value); !ok {
+		return value, nil
+	}
+	secret, err := configmap.ResolveSecret(value)
+	if err != nil {
+		Errorf(nil, "Failed to read config item %q: %v", key, err)
+		return "", err
+	}
+	if opt := options.Get(key); opt != nil && opt.IsPassword {
+		return ConfigObscure(secret)
+	}
+	return secret, nil
+}
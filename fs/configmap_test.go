@@ -0,0 +1,52 @@
+package fs
+
+import (
+	"testing"
+
+	"github.com/rclone/rclone/fs/config/configmap"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigMapSecrets(t *testing.T) {
+	t.Setenv("RCLONE_TEST_SECRET", "sekrit")
+	oldConfigObscure := ConfigObscure
+	ConfigObscure = func(value string) (string, error) {
+		return "obscured-" + value, nil
+	}
+	defer func() {
+		ConfigObscure = oldConfigObscure
+	}()
+
+	options := Options{{
+		Name: "user",
+	}, {
+		Name:       "pass",
+		IsPassword: true,
+	}}
+	m := ConfigMap("", options, "", configmap.Simple{
+		"user":  "{{secret:env:RCLONE_TEST_SECRET}}",
+		"pass":  "{{secret:env:RCLONE_TEST_SECRET}}",
+		"plain": "potato",
+		"bad":   "{{secret:env:RCLONE_TEST_SECRET_NOT_SET}}",
+	})
+
+	value, ok, err := m.GetErr("user")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "sekrit", value)
+
+	value, ok, err = m.GetErr("pass")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "obscured-sekrit", value)
+
+	value, ok, err = m.GetErr("plain")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "potato", value)
+
+	_, _, err = m.GetErr("bad")
+	assert.ErrorContains(t, err, "RCLONE_TEST_SECRET_NOT_SET")
+	assert.NotContains(t, err.Error(), "sekrit")
+}
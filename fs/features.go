@@ -71,6 +71,19 @@ type Features struct {
 	// If it isn't possible then return fs.ErrorCantMove
 	Move func(ctx context.Context, src Object, remote string) (Object, error)
 
+	// Link src to this remote using a server-side hard link so
+	// both names share the same content.
+	//
+	// This is stored with the remote path given, replacing any
+	// object which is already there
+	//
+	// It returns the destination Object and a possible error
+	//
+	// Will only be called if src.Fs().Name() == f.Name()
+	//
+	// If it isn't possible then return fs.ErrorCantLink
+	Link func(ctx context.Context, src Object, remote string) (Object, error)
+
 	// DirMove moves src, srcRemote to this remote at dstRemote
 	// using server-side move operations.
 	//
@@ -301,6 +314,9 @@ func (ft *Features) Fill(ctx context.Context, f Fs) *Features {
 	if do, ok := f.(Mover); ok {
 		ft.Move = do.Move
 	}
+	if do, ok := f.(Linker); ok {
+		ft.Link = do.Link
+	}
 	if do, ok := f.(DirMover); ok {
 		ft.DirMove = do.DirMove
 	}
@@ -414,6 +430,9 @@ func (ft *Features) Mask(ctx context.Context, f Fs) *Features {
 	if mask.Move == nil {
 		ft.Move = nil
 	}
+	if mask.Link == nil {
+		ft.Link = nil
+	}
 	if mask.DirMove == nil {
 		ft.DirMove = nil
 	}
@@ -527,6 +546,22 @@ type Copier interface {
 	Copy(ctx context.Context, src Object, remote string) (Object, error)
 }
 
+// Linker is an optional interface for Fs
+type Linker interface {
+	// Link src to this remote using a server-side hard link so
+	// both names share the same content.
+	//
+	// This is stored with the remote path given, replacing any
+	// object which is already there
+	//
+	// It returns the destination Object and a possible error
+	//
+	// Will only be called if src.Fs().Name() == f.Name()
+	//
+	// If it isn't possible then return fs.ErrorCantLink
+	Link(ctx context.Context, src Object, remote string) (Object, error)
+}
+
 // Mover is an optional interface for Fs
 type Mover interface {
 	// Move src to this remote using server-side move operations.
@@ -767,6 +802,33 @@ type ChunkWriter interface {
 	Abort(ctx context.Context) error
 }
 
+// ResumableChunkWriter is an optional interface for a ChunkWriter
+// whose upload can be carried on with after the process has exited
+type ResumableChunkWriter interface {
+	ChunkWriter
+
+	// ResumeState returns an opaque string describing the upload and
+	// the chunks written so far which can be passed to
+	// ResumeChunkWriter to carry on with it.
+	ResumeState() (string, error)
+
+	// ChunkWritten returns true if chunk number has been written
+	// already.
+	ChunkWritten(chunkNumber int) bool
+}
+
+// ChunkWriterResumer is an optional interface for Fs which implement
+// OpenChunkWriter and can carry on with an interrupted upload
+type ChunkWriterResumer interface {
+	// ResumeChunkWriter carries on with the upload described by state,
+	// as returned by ResumeState from a ResumableChunkWriter for the
+	// same remote and src.
+	//
+	// The ChunkWriter returned should be a ResumableChunkWriter so
+	// the caller can find out which chunks don't need writing again.
+	ResumeChunkWriter(ctx context.Context, remote string, src ObjectInfo, state string, options ...OpenOption) (info ChunkWriterInfo, writer ChunkWriter, err error)
+}
+
 // UserInfoer is an optional interface for Fs
 type UserInfoer interface {
 	// UserInfo returns info about the connected user
@@ -19,6 +19,7 @@ import (
 	"github.com/rclone/rclone/fs"
 	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/lib/structs"
+	"github.com/rclone/rclone/lib/tracing"
 	"golang.org/x/net/publicsuffix"
 )
 
@@ -141,13 +142,18 @@ func NewTransportCustom(ctx context.Context, customize func(*http.Transport)) ht
 	}
 
 	// Wrap that http.Transport in our own transport
-	return newTransport(ci, t)
+	tr := newTransport(ci, t)
+	tr.remote = fs.RemoteName(ctx)
+	return tr
 }
 
 // NewTransport returns an http.RoundTripper with the correct timeouts
 func NewTransport(ctx context.Context) http.RoundTripper {
 	(*noTransport).Do(func() {
-		transport = NewTransportCustom(ctx, nil)
+		tr := NewTransportCustom(ctx, nil).(*Transport)
+		// The shared transport isn't for any one remote
+		tr.remote = ""
+		transport = tr
 	})
 	return transport
 }
@@ -192,6 +198,7 @@ type Transport struct {
 	userAgent     string
 	headers       []*fs.HTTPOption
 	metrics       *Metrics
+	remote        string // name of the remote for per remote limits
 	// Filename of the client cert in case we need to reload it
 	clientCert string
 	clientKey  string
@@ -333,8 +340,26 @@ func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error
 		t.reloadCertificates()
 	}
 
+	// Trace the request if required
+	_, span := tracing.StartKind(req.Context(), "HTTP "+req.Method, tracing.KindClient,
+		tracing.String("http.request.method", req.Method),
+		tracing.String("server.address", req.URL.Host),
+		tracing.Int64("http.request.body.size", req.ContentLength),
+	)
+	if span != nil {
+		if t.remote != "" {
+			span.SetAttributes(tracing.String("rclone.remote", t.remote))
+		}
+		defer func() {
+			if resp != nil {
+				span.SetAttributes(tracing.Int("http.response.status_code", resp.StatusCode))
+			}
+			span.End(err)
+		}()
+	}
+
 	// Limit transactions per second if required
-	accounting.LimitTPS(req.Context())
+	accounting.LimitRemoteTPS(req.Context(), t.remote)
 	// Force user agent
 	req.Header.Set("User-Agent", t.userAgent)
 	// Set user defined headers
@@ -359,7 +384,9 @@ func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error
 		logMutex.Unlock()
 	}
 	// Do round trip
+	start := time.Now()
 	resp, err = t.Transport.RoundTrip(req)
+	duration := time.Since(start)
 	// Logf response
 	if t.dump&(fs.DumpHeaders|fs.DumpBodies|fs.DumpAuth|fs.DumpRequests|fs.DumpResponses) != 0 {
 		logMutex.Lock()
@@ -375,7 +402,7 @@ func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error
 		logMutex.Unlock()
 	}
 	// Update metrics
-	t.metrics.onResponse(req, resp)
+	t.metrics.onResponse(t.remote, req, resp, duration)
 
 	if err == nil {
 		checkServerTime(req, resp)
@@ -11,6 +11,7 @@ import (
 	"github.com/rclone/rclone/fs/accounting"
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/lib/bucket"
+	"github.com/rclone/rclone/lib/tracing"
 )
 
 // DirSorted reads Object and *Dir into entries for the given Fs.
@@ -23,7 +24,10 @@ import (
 // Files will be returned in sorted order
 func DirSorted(ctx context.Context, f fs.Fs, includeAll bool, dir string) (entries fs.DirEntries, err error) {
 	// Get unfiltered entries from the fs
-	entries, err = f.List(ctx, dir)
+	listCtx, span := startSpan(ctx, f, dir)
+	entries, err = f.List(listCtx, dir)
+	span.SetAttributes(tracing.Int("rclone.entries", len(entries)))
+	span.End(err)
 	accounting.Stats(ctx).Listed(int64(len(entries)))
 	if err != nil {
 		return nil, err
@@ -39,17 +43,35 @@ func DirSorted(ctx context.Context, f fs.Fs, includeAll bool, dir string) (entri
 	return filterAndSortDir(ctx, entries, includeAll, dir, fi.IncludeObject, fi.IncludeDirectory(ctx, f))
 }
 
+// startSpan starts a tracing span for listing dir in f
+func startSpan(ctx context.Context, f fs.Fs, dir string) (context.Context, *tracing.Span) {
+	return tracing.Start(ctx, "list",
+		tracing.String("rclone.fs", fs.ConfigString(f)),
+		tracing.String("rclone.dir", dir),
+	)
+}
+
 // listP for every backend
-func listP(ctx context.Context, f fs.Fs, dir string, callback fs.ListRCallback) error {
+func listP(ctx context.Context, f fs.Fs, dir string, callback fs.ListRCallback) (err error) {
+	ctx, span := startSpan(ctx, f, dir)
+	entries := 0
+	defer func() {
+		span.SetAttributes(tracing.Int("rclone.entries", entries))
+		span.End(err)
+	}()
 	if doListP := f.Features().ListP; doListP != nil {
-		return doListP(ctx, dir, callback)
+		return doListP(ctx, dir, func(batch fs.DirEntries) error {
+			entries += len(batch)
+			return callback(batch)
+		})
 	}
 	// Fallback to List
-	entries, err := f.List(ctx, dir)
+	batch, err := f.List(ctx, dir)
 	if err != nil {
 		return err
 	}
-	return callback(entries)
+	entries = len(batch)
+	return callback(batch)
 }
 
 // DirSortedFn reads Object and *Dir into entries for the given Fs.
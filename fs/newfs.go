@@ -43,6 +43,10 @@ func NewFs(ctx context.Context, path string) (Fs, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = addRemoteLimits(configName, config)
+	if err != nil {
+		return nil, err
+	}
 	overridden := fsInfo.Options.Overridden(config)
 	if len(overridden) > 0 {
 		extraConfig := overridden.String()
@@ -72,6 +76,7 @@ func NewFs(ctx context.Context, path string) (Fs, error) {
 	if err != nil {
 		return nil, err
 	}
+	ctx = context.WithValue(ctx, remoteNameKey{}, LimitName(configName))
 	f, err := fsInfo.NewFs(ctx, configName, fsPath, config)
 	if f != nil && (err == nil || err == ErrorIsFile) {
 		addReverse(f, fsInfo)
@@ -79,6 +84,49 @@ func NewFs(ctx context.Context, path string) (Fs, error) {
 	return f, err
 }
 
+// remoteNameKey is the context key for the name of the remote being
+// created by NewFs
+type remoteNameKey struct{}
+
+// RemoteName returns the name of the remote whose backend is being
+// made with ctx or "" if not known.
+//
+// This is set in the context passed to the backend's NewFs so
+// backends and the clients they create can find the limits for the
+// remote.
+func RemoteName(ctx context.Context) string {
+	name, _ := ctx.Value(remoteNameKey{}).(string)
+	return name
+}
+
+// LimitName returns the name the limits for the remote called name
+// are stored under, removing any suffix added for overridden config.
+func LimitName(name string) string {
+	if i := strings.IndexRune(name, '{'); i >= 0 {
+		name = name[:i]
+	}
+	return name
+}
+
+// Read the per remote limits from config and pass them on if set
+//
+// The bwlimit and tpslimit keys can be set in the config of any remote
+// so they aren't backend options and don't have command line flags.
+func addRemoteLimits(configName string, config configmap.Getter) error {
+	var opt struct {
+		BwLimit  BwTimetable `config:"bwlimit"`
+		TPSLimit float64     `config:"tpslimit"`
+	}
+	err := configstruct.Set(config, &opt)
+	if err != nil {
+		return fmt.Errorf("failed to read limits for %q: %w", configName, err)
+	}
+	if len(opt.BwLimit) > 0 || opt.TPSLimit > 0 {
+		SetRemoteLimits(LimitName(configName), opt.BwLimit, opt.TPSLimit)
+	}
+	return nil
+}
+
 // Add "global" config or "override" to ctx and the global config if required.
 //
 // This looks through keys prefixed with "global." or "override." in
@@ -60,3 +60,40 @@ func TestNewFs(t *testing.T) {
 
 	assert.Equal(t, "julian", globalCI.UserAgent)
 }
+
+func TestNewFsRemoteLimits(t *testing.T) {
+	ctx := context.Background()
+
+	// Register mockfs temporarily
+	oldRegistry := fs.Registry
+	mockfs.Register()
+	defer func() {
+		fs.Registry = oldRegistry
+	}()
+
+	type limits struct {
+		name     string
+		bwLimit  string
+		tpsLimit float64
+	}
+	var got []limits
+	oldSetRemoteLimits := fs.SetRemoteLimits
+	fs.SetRemoteLimits = func(name string, bwLimit fs.BwTimetable, tpsLimit float64) {
+		got = append(got, limits{name, bwLimit.String(), tpsLimit})
+	}
+	defer func() {
+		fs.SetRemoteLimits = oldSetRemoteLimits
+	}()
+
+	_, err := fs.NewFs(ctx, ":mockfs:/tmp")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	f, err := fs.NewFs(ctx, ":mockfs,bwlimit=1M,tpslimit=2:/tmp")
+	require.NoError(t, err)
+	assert.Equal(t, []limits{{":mockfs", "1Mi", 2}}, got)
+	assert.Equal(t, ":mockfs", fs.LimitName(f.Name()))
+
+	_, err = fs.NewFs(ctx, ":mockfs,bwlimit=potato:/tmp")
+	assert.Error(t, err)
+}
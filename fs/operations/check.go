@@ -298,6 +298,13 @@ func Check(ctx context.Context, opt *CheckOpt) error {
 //
 // it returns true if differences were found
 func CheckEqualReaders(in1, in2 io.Reader) (differ bool, err error) {
+	_, differ, err = compareReaders(in1, in2)
+	return differ, err
+}
+
+// compareReaders reads in1 and in2 and returns whether they differ
+// and if so the offset of the first byte which differs.
+func compareReaders(in1, in2 io.Reader) (offset int64, differ bool, err error) {
 	const bufSize = 64 * 1024
 	buf1 := make([]byte, bufSize)
 	buf2 := make([]byte, bufSize)
@@ -306,42 +313,65 @@ func CheckEqualReaders(in1, in2 io.Reader) (differ bool, err error) {
 		n2, err2 := readers.ReadFill(in2, buf2)
 		// check errors
 		if err1 != nil && err1 != io.EOF {
-			return true, err1
+			return offset, true, err1
 		} else if err2 != nil && err2 != io.EOF {
-			return true, err2
+			return offset, true, err2
 		}
 		// err1 && err2 are nil or io.EOF here
 		// process the data
 		if n1 != n2 || !bytes.Equal(buf1[:n1], buf2[:n2]) {
-			return true, nil
+			i := 0
+			for i < min(n1, n2) && buf1[i] == buf2[i] {
+				i++
+			}
+			return offset + int64(i), true, nil
 		}
+		offset += int64(n1)
 		// if both streams finished the we have finished
 		if err1 == io.EOF && err2 == io.EOF {
 			break
 		}
 	}
-	return false, nil
+	return offset, false, nil
 }
 
 // CheckIdenticalDownload checks to see if dst and src are identical
 // by reading all their bytes if necessary.
 //
+// Large files are read in chunks in parallel according to the
+// --multi-thread-* flags.
+//
 // it returns true if differences were found
 func CheckIdenticalDownload(ctx context.Context, dst, src fs.Object) (differ bool, err error) {
+	differ, _, err = checkIdenticalDownloadRetry(ctx, dst, src)
+	return differ, err
+}
+
+// checkIdenticalDownloadRetry is CheckIdenticalDownload which also
+// returns the offset of the first byte which differs
+func checkIdenticalDownloadRetry(ctx context.Context, dst, src fs.Object) (differ bool, offset int64, err error) {
 	ci := fs.GetConfig(ctx)
 	err = Retry(ctx, src, ci.LowLevelRetries, func() error {
-		differ, err = checkIdenticalDownload(ctx, dst, src)
+		differ, offset, err = checkIdenticalDownload(ctx, dst, src)
 		return err
 	})
-	return differ, err
+	return differ, offset, err
 }
 
 // Does the work for CheckIdenticalDownload
-func checkIdenticalDownload(ctx context.Context, dst, src fs.Object) (differ bool, err error) {
+func checkIdenticalDownload(ctx context.Context, dst, src fs.Object) (differ bool, offset int64, err error) {
+	if doMultiThreadCheck(ctx, dst, src) {
+		return multiThreadCheck(ctx, dst, src)
+	}
+	return checkIdenticalDownloadSequential(ctx, dst, src)
+}
+
+// Reads dst and src from start to finish to compare them
+func checkIdenticalDownloadSequential(ctx context.Context, dst, src fs.Object) (differ bool, offset int64, err error) {
 	var in1, in2 io.ReadCloser
 	in1, err = Open(ctx, dst)
 	if err != nil {
-		return true, fmt.Errorf("failed to open %q: %w", dst, err)
+		return true, 0, fmt.Errorf("failed to open %q: %w", dst, err)
 	}
 	tr1 := accounting.Stats(ctx).NewTransfer(dst, nil)
 	defer func() {
@@ -351,7 +381,7 @@ func checkIdenticalDownload(ctx context.Context, dst, src fs.Object) (differ boo
 
 	in2, err = Open(ctx, src)
 	if err != nil {
-		return true, fmt.Errorf("failed to open %q: %w", src, err)
+		return true, 0, fmt.Errorf("failed to open %q: %w", src, err)
 	}
 	tr2 := accounting.Stats(ctx).NewTransfer(dst, nil)
 	defer func() {
@@ -360,7 +390,7 @@ func checkIdenticalDownload(ctx context.Context, dst, src fs.Object) (differ boo
 	in2 = tr2.Account(ctx, in2).WithBuffer() // account and buffer the transfer
 
 	// To assign err variable before defer.
-	differ, err = CheckEqualReaders(in1, in2)
+	offset, differ, err = compareReaders(in1, in2)
 	return
 }
 
@@ -369,10 +399,13 @@ func checkIdenticalDownload(ctx context.Context, dst, src fs.Object) (differ boo
 func CheckDownload(ctx context.Context, opt *CheckOpt) error {
 	optCopy := *opt
 	optCopy.Check = func(ctx context.Context, a, b fs.Object) (differ bool, noHash bool, err error) {
-		differ, err = CheckIdenticalDownload(ctx, a, b)
+		differ, offset, err := checkIdenticalDownloadRetry(ctx, a, b)
 		if err != nil {
 			return true, true, fmt.Errorf("failed to download: %w", err)
 		}
+		if differ {
+			fs.Errorf(b, "files differ at offset %d", offset)
+		}
 		return differ, false, nil
 	}
 	return CheckFn(ctx, &optCopy)
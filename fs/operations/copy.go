@@ -21,6 +21,7 @@ import (
 	"github.com/rclone/rclone/fs/hash"
 	"github.com/rclone/rclone/lib/atexit"
 	"github.com/rclone/rclone/lib/pacer"
+	"github.com/rclone/rclone/lib/tracing"
 	"github.com/rclone/rclone/lib/transform"
 )
 
@@ -296,7 +297,11 @@ func (c *copy) verify(ctx context.Context, newDst fs.Object) (err error) {
 func (c *copy) copy(ctx context.Context) (newDst fs.Object, err error) {
 	var actionTaken string
 	retry := true
-	for tries := 0; retry && tries < c.maxTries; tries++ {
+	tries := 0
+	defer func() {
+		tracing.FromContext(ctx).SetAttributes(tracing.Int("rclone.tries", tries))
+	}()
+	for ; retry && tries < c.maxTries; tries++ {
 		// Check we haven't hit any accounting limits
 		err = c.checkLimits(ctx)
 		if err != nil {
@@ -327,6 +332,7 @@ func (c *copy) copy(ctx context.Context) (newDst fs.Object, err error) {
 		}
 		if retry {
 			fs.Debugf(c.src, "Received error: %v - low level retry %d/%d", err, tries, c.maxTries)
+			accounting.LowLevelRetry(c.f)
 			c.tr.Reset(ctx) // skip incomplete accounting - will be overwritten by retry
 			continue
 		}
@@ -378,9 +384,16 @@ func (c *copy) copy(ctx context.Context) (newDst fs.Object, err error) {
 // be nil.
 func Copy(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Object) (newDst fs.Object, err error) {
 	ci := fs.GetConfig(ctx)
+	ctx, span := tracing.Start(ctx, "copy",
+		tracing.String("rclone.remote", src.Remote()),
+		tracing.Int64("rclone.size", src.Size()),
+		tracing.String("rclone.src", fs.ConfigString(src.Fs())),
+		tracing.String("rclone.dst", fs.ConfigString(f)),
+	)
 	tr := accounting.Stats(ctx).NewTransfer(src, f)
 	defer func() {
 		tr.Done(ctx, err)
+		span.End(err)
 	}()
 	if SkipDestructive(ctx, src, "copy") {
 		in := tr.Account(ctx, nil)
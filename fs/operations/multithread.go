@@ -2,10 +2,13 @@ package operations
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"io"
+	"sync"
 	"time"
 
 	"github.com/rclone/rclone/fs"
@@ -60,7 +63,8 @@ type multiThreadCopyState struct {
 	src         fs.Object
 	acc         *accounting.Account
 	numChunks   int
-	noBuffering bool // set to read the input without buffering
+	noBuffering bool             // set to read the input without buffering
+	resume      *uploadStateFile // if set, save the state of the upload here
 }
 
 // Copy a single chunk into place
@@ -77,6 +81,12 @@ func (mc *multiThreadCopyState) copyChunk(ctx context.Context, chunk int, writer
 	end := min(start+mc.partSize, mc.size)
 	size := end - start
 
+	if mc.resume != nil && mc.resume.writer.ChunkWritten(chunk) {
+		fs.Debugf(mc.src, "multi-thread copy: chunk %d/%d (%d-%d) size %v already uploaded", chunk+1, mc.numChunks, start, end, fs.SizeSuffix(size))
+		mc.acc.ServerSideTransferEnd(size)
+		return nil
+	}
+
 	// Reserve the memory first so we don't open the source and wait for memory buffers for ages
 	var rw *pool.RW
 	if !mc.noBuffering {
@@ -114,6 +124,13 @@ func (mc *multiThreadCopyState) copyChunk(ctx context.Context, chunk int, writer
 	if err != nil {
 		return fmt.Errorf("multi-thread copy: failed to write chunk: %w", err)
 	}
+	if mc.resume != nil {
+		err = mc.resume.save()
+		if err != nil {
+			fs.Errorf(mc.src, "multi-thread copy: %v", err)
+			err = nil
+		}
+	}
 
 	fs.Debugf(mc.src, "multi-thread copy: chunk %d/%d (%d-%d) size %v finished", chunk+1, mc.numChunks, start, end, fs.SizeSuffix(bytesWritten))
 	return nil
@@ -164,7 +181,7 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		return nil, fmt.Errorf("multi-thread copy: can't copy zero sized file")
 	}
 
-	info, chunkWriter, err := openChunkWriter(ctx, remote, src, options...)
+	info, chunkWriter, resume, err := openResumableChunkWriter(ctx, f, remote, src, openChunkWriter, options...)
 	if err != nil {
 		return nil, fmt.Errorf("multi-thread copy: failed to open chunk writer: %w", err)
 	}
@@ -177,6 +194,10 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		if info.LeavePartsOnError || uploadedOK {
 			return
 		}
+		if resume != nil {
+			fs.Infof(src, "multi-thread copy: leaving upload to be resumed from %q", resume.path)
+			return
+		}
 		fs.Debugf(src, "multi-thread copy: cancelling transfer on exit")
 		abortErr := chunkWriter.Abort(ctx)
 		if abortErr != nil {
@@ -215,6 +236,7 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		partSize:    info.ChunkSize,
 		numChunks:   numChunks,
 		noBuffering: noBuffering,
+		resume:      resume,
 	}
 
 	// Make accounting
@@ -241,6 +263,9 @@ func multiThreadCopy(ctx context.Context, f fs.Fs, remote string, src fs.Object,
 		return nil, fmt.Errorf("multi-thread copy: failed to close object after copy: %w", err)
 	}
 	uploadedOK = true // file is definitely uploaded OK so no need to abort
+	if resume != nil {
+		resume.remove()
+	}
 
 	obj, err := f.NewObject(ctx, remote)
 	if err != nil {
@@ -378,3 +403,194 @@ func openChunkWriterFromOpenWriterAt(openWriterAt fs.OpenWriterAtFn, chunkSize i
 		return info, chunkWriter, nil
 	}
 }
+
+// Return a boolean as to whether we should use a multi thread check
+// to compare the contents of dst and src
+func doMultiThreadCheck(ctx context.Context, dst, src fs.Object) bool {
+	ci := fs.GetConfig(ctx)
+
+	// Disable multi thread if...
+
+	// ...it isn't configured
+	if ci.MultiThreadStreams <= 1 || ci.MultiThreadChunkSize <= 0 {
+		return false
+	}
+	// ...either side doesn't support it
+	if src.Fs().Features().NoMultiThreading || dst.Fs().Features().NoMultiThreading {
+		return false
+	}
+	// ...size of object is less than cutoff or the sizes differ
+	if src.Size() < int64(ci.MultiThreadCutoff) || src.Size() <= 0 || src.Size() != dst.Size() {
+		return false
+	}
+	// ...if --multi-thread-streams not in use and both sides are local
+	if !ci.MultiThreadSet && dst.Fs().Features().IsLocal && src.Fs().Features().IsLocal {
+		return false
+	}
+	return true
+}
+
+// state for a multi-thread check
+type multiThreadCheckState struct {
+	dst, src       fs.Object
+	size           int64
+	partSize       int64
+	numChunks      int
+	dstAcc, srcAcc *accounting.Account
+	mu             sync.Mutex
+	firstDiffer    int // lowest chunk found to differ or numChunks
+}
+
+// differsBefore returns true if a chunk before chunk is known to differ
+func (mc *multiThreadCheckState) differsBefore(chunk int) bool {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	return mc.firstDiffer < chunk
+}
+
+// setDiffer records that chunk differs
+func (mc *multiThreadCheckState) setDiffer(chunk int) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	mc.firstDiffer = min(mc.firstDiffer, chunk)
+}
+
+// chunkRange returns the start and end of chunk
+func (mc *multiThreadCheckState) chunkRange(chunk int) (start, end int64) {
+	start = int64(chunk) * mc.partSize
+	end = min(start+mc.partSize, mc.size)
+	return start, end
+}
+
+// openChunk opens the bytes from start to end of o accounting them to acc
+func openChunk(ctx context.Context, o fs.Object, acc *accounting.Account, start, end int64) (*ReOpen, error) {
+	rc, err := Open(ctx, o, &fs.RangeOption{Start: start, End: end - 1})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %q: %w", o, err)
+	}
+	return rc.SetAccounting(acc.AccountRead), nil
+}
+
+// hashChunk reads the bytes from start to end of o and returns their SHA-256
+func hashChunk(ctx context.Context, o fs.Object, acc *accounting.Account, start, end int64) (sum []byte, err error) {
+	rc, err := openChunk(ctx, o, acc, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer fs.CheckClose(rc, &err)
+	hasher := sha256.New()
+	_, err = io.CopyN(hasher, rc, end-start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %q: %w", o, err)
+	}
+	return hasher.Sum(nil), nil
+}
+
+// Compare the digests of a single chunk of dst and src
+func (mc *multiThreadCheckState) checkChunk(ctx context.Context, chunk int) error {
+	if mc.differsBefore(chunk) {
+		return nil
+	}
+	start, end := mc.chunkRange(chunk)
+	fs.Debugf(mc.src, "multi-thread check: chunk %d/%d (%d-%d) size %v starting", chunk+1, mc.numChunks, start, end, fs.SizeSuffix(end-start))
+	var dstSum, srcSum []byte
+	g, gCtx := errgroup.WithContext(ctx)
+	g.Go(func() (err error) {
+		dstSum, err = hashChunk(gCtx, mc.dst, mc.dstAcc, start, end)
+		return err
+	})
+	g.Go(func() (err error) {
+		srcSum, err = hashChunk(gCtx, mc.src, mc.srcAcc, start, end)
+		return err
+	})
+	err := g.Wait()
+	if err != nil {
+		return fmt.Errorf("multi-thread check: chunk %d/%d: %w", chunk+1, mc.numChunks, err)
+	}
+	if !bytes.Equal(dstSum, srcSum) {
+		fs.Debugf(mc.src, "multi-thread check: chunk %d/%d (%d-%d) differs", chunk+1, mc.numChunks, start, end)
+		mc.setDiffer(chunk)
+	}
+	return nil
+}
+
+// findOffset reads chunk from dst and src together and returns the
+// offset of the first byte which differs
+func (mc *multiThreadCheckState) findOffset(ctx context.Context, chunk int) (offset int64, err error) {
+	start, end := mc.chunkRange(chunk)
+	in1, err := openChunk(ctx, mc.dst, mc.dstAcc, start, end)
+	if err != nil {
+		return 0, err
+	}
+	defer fs.CheckClose(in1, &err)
+	in2, err := openChunk(ctx, mc.src, mc.srcAcc, start, end)
+	if err != nil {
+		return 0, err
+	}
+	defer fs.CheckClose(in2, &err)
+	offset, differ, err := compareReaders(in1, in2)
+	if err != nil {
+		return 0, err
+	}
+	if !differ {
+		return 0, fmt.Errorf("multi-thread check: chunk %d/%d changed while being checked", chunk+1, mc.numChunks)
+	}
+	return start + offset, nil
+}
+
+// Compare the contents of dst and src by reading chunks of them in
+// parallel and comparing their digests.
+//
+// It returns whether they differ and if so the offset of the first
+// byte which differs.
+func multiThreadCheck(ctx context.Context, dst, src fs.Object) (differ bool, offset int64, err error) {
+	ci := fs.GetConfig(ctx)
+	mc := &multiThreadCheckState{
+		dst:      dst,
+		src:      src,
+		size:     src.Size(),
+		partSize: int64(ci.MultiThreadChunkSize),
+	}
+	mc.numChunks = calculateNumChunks(mc.size, mc.partSize)
+	mc.firstDiffer = mc.numChunks
+	concurrency := min(ci.MultiThreadStreams, mc.numChunks)
+
+	// Make accounting
+	tr1 := accounting.Stats(ctx).NewTransfer(dst, nil)
+	defer func() {
+		tr1.Done(ctx, nil) // error handling is done by the caller
+	}()
+	mc.dstAcc = tr1.Account(ctx, nil)
+	tr2 := accounting.Stats(ctx).NewTransfer(src, nil)
+	defer func() {
+		tr2.Done(ctx, nil) // error handling is done by the caller
+	}()
+	mc.srcAcc = tr2.Account(ctx, nil)
+
+	g, gCtx := errgroup.WithContext(ctx)
+	g.SetLimit(concurrency)
+
+	fs.Debugf(src, "Starting multi-thread check with %d chunks of size %v with %v parallel streams", mc.numChunks, fs.SizeSuffix(mc.partSize), concurrency)
+	for chunk := range mc.numChunks {
+		// Fail fast if a chunk has failed or an earlier chunk differs
+		if gCtx.Err() != nil || mc.differsBefore(chunk) {
+			break
+		}
+		g.Go(func() error {
+			return mc.checkChunk(gCtx, chunk)
+		})
+	}
+	err = g.Wait()
+	if err != nil {
+		return true, 0, err
+	}
+	if mc.firstDiffer == mc.numChunks {
+		fs.Debugf(src, "Finished multi-thread check with %d chunks of size %v", mc.numChunks, fs.SizeSuffix(mc.partSize))
+		return false, 0, nil
+	}
+	offset, err = mc.findOffset(ctx, mc.firstDiffer)
+	if err != nil {
+		return true, 0, err
+	}
+	return true, offset, nil
+}
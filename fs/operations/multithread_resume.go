@@ -0,0 +1,176 @@
+package operations
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fspath"
+)
+
+// uploadState is the state of a resumable multi-thread upload which is
+// saved in --upload-state-dir
+type uploadState struct {
+	Remote      string    `json:"remote"`      // destination of the upload
+	Fingerprint string    `json:"fingerprint"` // fingerprint of the source when the upload started
+	ChunkSize   int64     `json:"chunkSize"`   // size of the chunks being uploaded
+	State       string    `json:"state"`       // state from the chunk writer
+	Created     time.Time `json:"created"`     // when the upload started
+}
+
+// uploadStateFile saves the state of a resumable upload as it goes along
+type uploadStateFile struct {
+	mu     sync.Mutex
+	path   string                  // path of the state file
+	state  uploadState             // the state to save
+	writer fs.ResumableChunkWriter // the upload in progress
+}
+
+// newUploadStateFile returns the state file for uploading remote to f
+// in dir
+func newUploadStateFile(dir string, f fs.Fs, remote string) *uploadStateFile {
+	dst := fspath.JoinRootPath(fs.ConfigString(f), remote)
+	sum := sha256.Sum256([]byte(dst))
+	return &uploadStateFile{
+		path: filepath.Join(dir, hex.EncodeToString(sum[:16])+".json"),
+		state: uploadState{
+			Remote: dst,
+		},
+	}
+}
+
+// load reads the saved state returning nil if there isn't any
+func (s *uploadStateFile) load() (*uploadState, error) {
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read upload state: %w", err)
+	}
+	var state uploadState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode upload state %q: %w", s.path, err)
+	}
+	if state.Remote != s.state.Remote {
+		return nil, fmt.Errorf("upload state %q is for %q not %q", s.path, state.Remote, s.state.Remote)
+	}
+	return &state, nil
+}
+
+// save writes the current state of the upload to the state file
+//
+// The file is replaced atomically so an interruption leaves either
+// the old or the new state.
+func (s *uploadStateFile) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, err := s.writer.ResumeState()
+	if err != nil {
+		return fmt.Errorf("failed to read upload state: %w", err)
+	}
+	s.state.State = state
+	data, err := json.Marshal(&s.state)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(s.path), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to make upload state directory: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	err = os.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write upload state: %w", err)
+	}
+	err = os.Rename(tmp, s.path)
+	if err != nil {
+		return fmt.Errorf("failed to write upload state: %w", err)
+	}
+	return nil
+}
+
+// remove the state file
+func (s *uploadStateFile) remove() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		fs.Errorf(nil, "multi-thread copy: failed to remove upload state: %v", err)
+	}
+}
+
+// openResumableChunkWriter opens a chunk writer for remote, resuming
+// an interrupted upload of src if there is one saved in
+// --upload-state-dir.
+//
+// If the upload can be resumed later the state file is returned,
+// otherwise it is nil.
+func openResumableChunkWriter(ctx context.Context, f fs.Fs, remote string, src fs.Object, openChunkWriter fs.OpenChunkWriterFn, options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, s *uploadStateFile, err error) {
+	ci := fs.GetConfig(ctx)
+	resumer, ok := f.(fs.ChunkWriterResumer)
+	if ci.UploadStateDir == "" || !ok || f.Features().OpenChunkWriter == nil {
+		info, writer, err = openChunkWriter(ctx, remote, src, options...)
+		return info, writer, nil, err
+	}
+	s = newUploadStateFile(ci.UploadStateDir, f, remote)
+	fingerprint := fs.Fingerprint(ctx, src, true)
+
+	old, err := s.load()
+	if err != nil {
+		fs.Errorf(src, "multi-thread copy: ignoring upload state: %v", err)
+	}
+	if old != nil {
+		info, writer, err = resumer.ResumeChunkWriter(ctx, remote, src, old.State, options...)
+		if err == nil {
+			rw, ok := writer.(fs.ResumableChunkWriter)
+			switch {
+			case old.Fingerprint != fingerprint:
+				fs.Logf(src, "multi-thread copy: source has changed since the upload was interrupted - starting again")
+			case old.ChunkSize != info.ChunkSize:
+				fs.Logf(src, "multi-thread copy: chunk size has changed since the upload was interrupted - starting again")
+			case !ok:
+				fs.Logf(src, "multi-thread copy: resumed upload can't be resumed again - starting again")
+			default:
+				fs.Infof(src, "multi-thread copy: resuming upload started at %v", old.Created.Local().Format(time.RFC3339))
+				s.state = *old
+				s.writer = rw
+				return info, writer, s, nil
+			}
+			abortErr := writer.Abort(ctx)
+			if abortErr != nil {
+				fs.Debugf(src, "multi-thread copy: abort of old upload failed: %v", abortErr)
+			}
+		} else {
+			fs.Logf(src, "multi-thread copy: can't resume upload - starting again: %v", err)
+		}
+		s.remove()
+	}
+
+	info, writer, err = openChunkWriter(ctx, remote, src, options...)
+	if err != nil {
+		return info, nil, nil, err
+	}
+	rw, ok := writer.(fs.ResumableChunkWriter)
+	if !ok {
+		return info, writer, nil, nil
+	}
+	s.state.Fingerprint = fingerprint
+	s.state.ChunkSize = info.ChunkSize
+	s.state.Created = time.Now()
+	s.writer = rw
+	err = s.save()
+	if err != nil {
+		fs.Errorf(src, "multi-thread copy: upload won't be resumable: %v", err)
+		return info, writer, nil, nil
+	}
+	return info, writer, s, nil
+}
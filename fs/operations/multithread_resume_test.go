@@ -0,0 +1,194 @@
+package operations
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/accounting"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fstest"
+	"github.com/rclone/rclone/lib/random"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const resumableChunkSize = 1024
+
+// resumableFs wraps an Fs with a chunk writer which can be resumed
+type resumableFs struct {
+	fs.Fs
+	mu      sync.Mutex
+	uploads map[string]map[int][]byte // chunks written by upload ID
+	written int                       // number of chunks written
+	aborted int                       // number of uploads aborted
+}
+
+// Features returns the optional features of this Fs
+func (f *resumableFs) Features() *fs.Features {
+	ft := *f.Fs.Features()
+	ft.OpenWriterAt = nil
+	ft.OpenChunkWriter = f.OpenChunkWriter
+	return &ft
+}
+
+// OpenChunkWriter starts a new upload
+func (f *resumableFs) OpenChunkWriter(ctx context.Context, remote string, src fs.ObjectInfo, options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	id := random.String(8)
+	f.uploads[id] = map[int][]byte{}
+	return f.info(), &resumableChunkWriter{f: f, id: id, remote: remote, src: src}, nil
+}
+
+// ResumeChunkWriter carries on with an upload
+func (f *resumableFs) ResumeChunkWriter(ctx context.Context, remote string, src fs.ObjectInfo, state string, options ...fs.OpenOption) (info fs.ChunkWriterInfo, writer fs.ChunkWriter, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.uploads[state]; !ok {
+		return info, nil, errors.New("upload not found")
+	}
+	return f.info(), &resumableChunkWriter{f: f, id: state, remote: remote, src: src}, nil
+}
+
+func (f *resumableFs) info() fs.ChunkWriterInfo {
+	return fs.ChunkWriterInfo{
+		ChunkSize:   resumableChunkSize,
+		Concurrency: 1,
+	}
+}
+
+type resumableChunkWriter struct {
+	f      *resumableFs
+	id     string
+	remote string
+	src    fs.ObjectInfo
+}
+
+func (w *resumableChunkWriter) WriteChunk(ctx context.Context, chunkNumber int, reader io.ReadSeeker) (int64, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return 0, err
+	}
+	w.f.mu.Lock()
+	defer w.f.mu.Unlock()
+	w.f.uploads[w.id][chunkNumber] = data
+	w.f.written++
+	return int64(len(data)), nil
+}
+
+func (w *resumableChunkWriter) Close(ctx context.Context) error {
+	w.f.mu.Lock()
+	chunks := w.f.uploads[w.id]
+	delete(w.f.uploads, w.id)
+	w.f.mu.Unlock()
+	var buf bytes.Buffer
+	for i := range len(chunks) {
+		buf.Write(chunks[i])
+	}
+	info := object.NewStaticObjectInfo(w.remote, w.src.ModTime(ctx), int64(buf.Len()), true, nil, nil)
+	_, err := w.f.Fs.Put(ctx, &buf, info)
+	return err
+}
+
+func (w *resumableChunkWriter) Abort(ctx context.Context) error {
+	w.f.mu.Lock()
+	defer w.f.mu.Unlock()
+	delete(w.f.uploads, w.id)
+	w.f.aborted++
+	return nil
+}
+
+func (w *resumableChunkWriter) ResumeState() (string, error) {
+	return w.id, nil
+}
+
+func (w *resumableChunkWriter) ChunkWritten(chunkNumber int) bool {
+	w.f.mu.Lock()
+	defer w.f.mu.Unlock()
+	_, ok := w.f.uploads[w.id][chunkNumber]
+	return ok
+}
+
+var (
+	_ fs.ChunkWriterResumer   = &resumableFs{}
+	_ fs.ResumableChunkWriter = &resumableChunkWriter{}
+)
+
+func TestMultithreadCopyResume(t *testing.T) {
+	r := fstest.NewRun(t)
+	ctx, ci := fs.AddConfig(context.Background())
+	stateDir := t.TempDir()
+	ci.UploadStateDir = stateDir
+	f := &resumableFs{Fs: r.Fremote, uploads: map[string]map[int][]byte{}}
+
+	const fileName = "test-multithread-resume"
+	const size = 3 * resumableChunkSize
+	t1 := fstest.Time("2001-02-03T04:05:06.499999999Z")
+
+	stateFiles := func() []string {
+		entries, err := os.ReadDir(stateDir)
+		require.NoError(t, err)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+
+	// copy the source failing on the last chunk if interrupt is set
+	copyFile := func(interrupt bool) (dst fs.Object, err error) {
+		src, err := r.Flocal.NewObject(ctx, fileName)
+		require.NoError(t, err)
+		tr := accounting.GlobalStats().NewTransfer(src, nil)
+		defer func() {
+			tr.Done(ctx, err)
+		}()
+		if interrupt {
+			src = errorObject{src, size, new(sync.WaitGroup)}
+		}
+		return multiThreadCopy(ctx, f, fileName, src, 1, tr)
+	}
+
+	// Interrupt the upload after two chunks
+	contents := random.String(size)
+	file1 := r.WriteFile(fileName, contents, t1)
+	_, err := copyFile(true)
+	require.Error(t, err)
+	assert.Equal(t, 2, f.written)
+	assert.Equal(t, 0, f.aborted)
+	assert.Len(t, f.uploads, 1)
+	assert.Len(t, stateFiles(), 1)
+
+	// Resuming only uploads the last chunk
+	dst, err := copyFile(false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(size), dst.Size())
+	assert.Equal(t, 3, f.written)
+	assert.Len(t, f.uploads, 0)
+	assert.Len(t, stateFiles(), 0)
+	r.CheckRemoteItems(t, file1)
+
+	// Interrupt the upload then change the source
+	f.written = 0
+	_, err = copyFile(true)
+	require.Error(t, err)
+	assert.Equal(t, 2, f.written)
+	contents = random.String(size)
+	file1 = r.WriteFile(fileName, contents, t1.Add(1e9))
+
+	// The old upload is aborted and the file uploaded from scratch
+	dst, err = copyFile(false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(size), dst.Size())
+	assert.Equal(t, 5, f.written)
+	assert.Equal(t, 1, f.aborted)
+	assert.Len(t, f.uploads, 0)
+	assert.Len(t, stateFiles(), 0)
+	r.CheckRemoteItems(t, file1)
+}
@@ -1,6 +1,7 @@
 package operations
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -333,3 +334,78 @@ func TestMultithreadCopyAbort(t *testing.T) {
 		require.NoError(t, o.Remove(ctx))
 	}
 }
+
+func TestMultithreadCheck(t *testing.T) {
+	r := fstest.NewRun(t)
+	ctx, ci := fs.AddConfig(context.Background())
+	ci.MultiThreadStreams = 4
+	ci.MultiThreadCutoff = 1024
+	ci.MultiThreadChunkSize = 1024
+	ci.MultiThreadSet = true
+
+	const size = 10*1024 + 17
+	contents := []byte(random.String(size))
+	t1 := fstest.Time("2001-02-03T04:05:06.499999999Z")
+	file1 := r.WriteFile("file", string(contents), t1)
+	local, err := r.Flocal.NewObject(ctx, file1.Path)
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		name   string
+		offset int // offset to change or -1 for no change
+	}{
+		{name: "same", offset: -1},
+		{name: "first byte", offset: 0},
+		{name: "chunk boundary", offset: 3 * 1024},
+		{name: "middle", offset: 5*1024 + 100},
+		{name: "last byte", offset: size - 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			modified := bytes.Clone(contents)
+			if test.offset >= 0 {
+				modified[test.offset] ^= 0xFF
+			}
+			r.WriteObject(ctx, "file", string(modified), t1)
+			remote, err := r.Fremote.NewObject(ctx, "file")
+			require.NoError(t, err)
+
+			assert.True(t, doMultiThreadCheck(ctx, remote, local))
+			differ, offset, err := multiThreadCheck(ctx, remote, local)
+			require.NoError(t, err)
+			assert.Equal(t, test.offset >= 0, differ)
+			if differ {
+				assert.Equal(t, int64(test.offset), offset)
+			}
+
+			differ, err = CheckIdenticalDownload(ctx, remote, local)
+			require.NoError(t, err)
+			assert.Equal(t, test.offset >= 0, differ)
+		})
+	}
+
+	// Not used for small files or without streams
+	ci.MultiThreadCutoff = size + 1
+	assert.False(t, doMultiThreadCheck(ctx, local, local))
+	ci.MultiThreadCutoff = 1024
+	ci.MultiThreadStreams = 1
+	assert.False(t, doMultiThreadCheck(ctx, local, local))
+}
+
+func TestCompareReaders(t *testing.T) {
+	a := []byte(random.String(200 * 1024))
+	b := bytes.Clone(a)
+	b[150*1024+3] ^= 1
+	offset, differ, err := compareReaders(bytes.NewReader(a), bytes.NewReader(b))
+	require.NoError(t, err)
+	assert.True(t, differ)
+	assert.Equal(t, int64(150*1024+3), offset)
+
+	offset, differ, err = compareReaders(bytes.NewReader(a), bytes.NewReader(a[:1000]))
+	require.NoError(t, err)
+	assert.True(t, differ)
+	assert.Equal(t, int64(1000), offset)
+
+	_, differ, err = compareReaders(bytes.NewReader(a), bytes.NewReader(a))
+	require.NoError(t, err)
+	assert.False(t, differ)
+}
@@ -330,9 +330,9 @@ func equal(ctx context.Context, src fs.ObjectInfo, dst fs.Object, opt equalOpt)
 			} else if errors.Is(err, fs.ErrorCantSetModTimeWithoutDelete) {
 				logModTimeUpload(dst)
 				fs.Infof(dst, "src and dst identical but can't set mod time without deleting and re-uploading")
-				// Remove the file if BackupDir isn't set.  If BackupDir is set we would rather have the old file
-				// put in the BackupDir than deleted which is what will happen if we don't delete it.
-				if ci.BackupDir == "" {
+				// Remove the file if neither BackupDir nor TrashDir is set.  If either is set we would rather have the old file
+				// put in the BackupDir or TrashDir than deleted which is what will happen if we don't delete it.
+				if ci.BackupDir == "" && ci.TrashDir == "" {
 					err = dst.Remove(ctx)
 					if err != nil {
 						fs.Errorf(dst, "failed to delete before re-upload: %v", err)
@@ -540,8 +540,15 @@ func SuffixName(ctx context.Context, remote string) string {
 // and accumulating stats and errors.
 //
 // If backupDir is set then it moves the file to there instead of
-// deleting
+// deleting. backupDir should come from BackupDir.
 func DeleteFileWithBackupDir(ctx context.Context, dst fs.Object, backupDir fs.Fs) (err error) {
+	return DeleteFileWithBackupDirTrash(ctx, dst, backupDir, useTrashDir(ctx))
+}
+
+// DeleteFileWithBackupDirTrash is like DeleteFileWithBackupDir but if
+// trash is set then backupDir is the --trash-dir and the file is moved
+// into it as a deleted file.
+func DeleteFileWithBackupDirTrash(ctx context.Context, dst fs.Object, backupDir fs.Fs, trash bool) (err error) {
 	tr := accounting.Stats(ctx).NewCheckingTransfer(dst, "deleting")
 	defer func() {
 		tr.Done(ctx, err)
@@ -551,14 +558,18 @@ func DeleteFileWithBackupDir(ctx context.Context, dst fs.Object, backupDir fs.Fs
 		return err
 	}
 	action, actioned := "delete", "Deleted"
-	if backupDir != nil {
+	if backupDir != nil && trash {
+		action, actioned = "move into trash", "Moved into trash"
+	} else if backupDir != nil {
 		action, actioned = "move into backup dir", "Moved into backup dir"
 	}
 	skip := SkipDestructive(ctx, dst, action)
 	if skip {
 		// do nothing
+	} else if backupDir != nil && trash {
+		err = MoveToTrash(ctx, backupDir, dst, TrashReasonDeleted)
 	} else if backupDir != nil {
-		err = MoveBackupDir(ctx, backupDir, dst)
+		err = MoveBackupDirTrash(ctx, backupDir, dst, false)
 	} else {
 		err = dst.Remove(ctx)
 	}
@@ -576,15 +587,21 @@ func DeleteFileWithBackupDir(ctx context.Context, dst fs.Object, backupDir fs.Fs
 // If useBackupDir is set and --backup-dir is in effect then it moves
 // the file to there instead of deleting
 func DeleteFile(ctx context.Context, dst fs.Object) (err error) {
-	return DeleteFileWithBackupDir(ctx, dst, nil)
+	return DeleteFileWithBackupDirTrash(ctx, dst, nil, false)
 }
 
 // DeleteFilesWithBackupDir removes all the files passed in the
 // channel
 //
 // If backupDir is set the files will be placed into that directory
-// instead of being deleted.
+// instead of being deleted. backupDir should come from BackupDir.
 func DeleteFilesWithBackupDir(ctx context.Context, toBeDeleted fs.ObjectsChan, backupDir fs.Fs) error {
+	return DeleteFilesWithBackupDirTrash(ctx, toBeDeleted, backupDir, useTrashDir(ctx))
+}
+
+// DeleteFilesWithBackupDirTrash is like DeleteFilesWithBackupDir but
+// if trash is set then backupDir is the --trash-dir.
+func DeleteFilesWithBackupDirTrash(ctx context.Context, toBeDeleted fs.ObjectsChan, backupDir fs.Fs, trash bool) error {
 	var wg sync.WaitGroup
 	ci := fs.GetConfig(ctx)
 	wg.Add(ci.Checkers)
@@ -595,7 +612,7 @@ func DeleteFilesWithBackupDir(ctx context.Context, toBeDeleted fs.ObjectsChan, b
 		go func() {
 			defer wg.Done()
 			for dst := range toBeDeleted {
-				err := DeleteFileWithBackupDir(ctx, dst, backupDir)
+				err := DeleteFileWithBackupDirTrash(ctx, dst, backupDir, trash)
 				if err != nil {
 					errorCount.Add(1)
 					logger, _ := GetLogger(ctx)
@@ -623,7 +640,7 @@ func DeleteFilesWithBackupDir(ctx context.Context, toBeDeleted fs.ObjectsChan, b
 
 // DeleteFiles removes all the files passed in the channel
 func DeleteFiles(ctx context.Context, toBeDeleted fs.ObjectsChan) error {
-	return DeleteFilesWithBackupDir(ctx, toBeDeleted, nil)
+	return DeleteFilesWithBackupDirTrash(ctx, toBeDeleted, nil, false)
 }
 
 // ReadFile reads the object into memory and accounts it
@@ -1652,7 +1669,7 @@ func GetCopyDest(ctx context.Context, fdst fs.Fs) (CopyDest []fs.Fs, err error)
 // be copied
 //
 // Returns True if src was copied from --copy-dest
-func copyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CopyDest, backupDir fs.Fs) (NoNeedTransfer bool, err error) {
+func copyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CopyDest, backupDir fs.Fs, trash bool) (NoNeedTransfer bool, err error) {
 	var remote string
 	if dst == nil {
 		remote = src.Remote()
@@ -1673,9 +1690,9 @@ func copyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CopyDest, bac
 	if equal(ctx, src, CopyDestFile, opt) {
 		if dst == nil || !Equal(ctx, src, dst) {
 			if dst != nil && backupDir != nil {
-				err = MoveBackupDir(ctx, backupDir, dst)
+				err = MoveBackupDirTrash(ctx, backupDir, dst, trash)
 				if err != nil {
-					return false, fmt.Errorf("moving to --backup-dir failed: %w", err)
+					return false, fmt.Errorf("moving to %s failed: %w", backupDirFlag(trash), err)
 				}
 				// If successful zero out the dstObj as it is no longer there
 				dst = nil
@@ -1695,11 +1712,129 @@ func copyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CopyDest, bac
 	return false, nil
 }
 
-// CompareOrCopyDest checks --compare-dest and --copy-dest to see if src
+// GetLinkDest sets up --link-dest
+func GetLinkDest(ctx context.Context, fdst fs.Fs) (LinkDest []fs.Fs, err error) {
+	ci := fs.GetConfig(ctx)
+	LinkDest, err = cache.GetArr(ctx, ci.LinkDest)
+	if err != nil {
+		return nil, fserrors.FatalError(fmt.Errorf("failed to make fs for --link-dest %q: %w", ci.LinkDest, err))
+	}
+	if !SameConfigArr(fdst, LinkDest) {
+		return nil, fserrors.FatalError(errors.New("parameter to --link-dest has to be on the same remote as destination"))
+	}
+	features := fdst.Features()
+	if features.Link == nil && features.Copy == nil {
+		return nil, fserrors.FatalError(errors.New("can't use --link-dest on a remote which doesn't support hard links or server side copy"))
+	}
+	return LinkDest, nil
+}
+
+// Link src object to dst or f if nil using a server-side hard link,
+// falling back to a server-side copy if the remote can't link the
+// file. If dst is nil then it uses remote as the name of the new
+// object.
+//
+// It returns the destination object if possible.  Note that this may
+// be nil.
+func Link(ctx context.Context, f fs.Fs, dst fs.Object, remote string, src fs.Object) (newDst fs.Object, err error) {
+	doLink := f.Features().Link
+	if doLink == nil || !SameConfig(src.Fs(), f) {
+		return Copy(ctx, f, dst, remote, src)
+	}
+	linkRemote := remote
+	if dst != nil {
+		linkRemote = dst.Remote()
+	}
+	linkRemote = transform.Path(ctx, linkRemote, false)
+	tr := accounting.Stats(ctx).NewTransfer(src, f)
+	defer func() {
+		tr.Done(ctx, err)
+	}()
+	if SkipDestructive(ctx, src, "link") {
+		in := tr.Account(ctx, nil)
+		in.DryRun(src.Size())
+		return newDst, nil
+	}
+	in := tr.Account(ctx, nil)
+	in.ServerSideTransferStart()
+	newDst, err = doLink(ctx, src, linkRemote)
+	if err == nil {
+		in.ServerSideCopyEnd(newDst.Size())
+	}
+	_ = in.Close()
+	if errors.Is(err, fs.ErrorCantLink) {
+		tr.Reset(ctx)
+		if f.Features().Copy == nil {
+			return nil, err
+		}
+		fs.Debugf(src, "Can't hard link - using server-side copy")
+		newDst, err = Copy(ctx, f, dst, remote, src)
+		return newDst, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	fs.Infof(src, "Hard linked")
+	return newDst, nil
+}
+
+// linkDest checks --link-dest to see if src needs to be copied
+//
+// Returns True if src was linked from --link-dest
+func linkDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, LinkDest, backupDir fs.Fs, trash bool) (NoNeedTransfer bool, err error) {
+	var remote string
+	if dst == nil {
+		remote = src.Remote()
+	} else {
+		remote = dst.Remote()
+	}
+	LinkDestFile, err := LinkDest.NewObject(ctx, remote)
+	switch err {
+	case fs.ErrorObjectNotFound:
+		return false, nil
+	case nil:
+		break
+	default:
+		return false, err
+	}
+	opt := defaultEqualOpt(ctx)
+	opt.updateModTime = false
+	if equal(ctx, src, LinkDestFile, opt) {
+		if dst == nil || !Equal(ctx, src, dst) {
+			if dst != nil && backupDir != nil {
+				err = MoveBackupDirTrash(ctx, backupDir, dst, trash)
+				if err != nil {
+					return false, fmt.Errorf("moving to %s failed: %w", backupDirFlag(trash), err)
+				}
+				// If successful zero out the dstObj as it is no longer there
+				dst = nil
+			}
+			_, err := Link(ctx, fdst, dst, remote, LinkDestFile)
+			if err != nil {
+				fs.Errorf(src, "Destination found in --link-dest, error linking: %v", err)
+				return false, nil
+			}
+			fs.Debugf(src, "Destination found in --link-dest, using hard link")
+			return true, nil
+		}
+		fs.Debugf(src, "Unchanged skipping")
+		return true, nil
+	}
+	fs.Debugf(src, "Destination not found in --link-dest")
+	return false, nil
+}
+
+// CompareOrCopyDest checks --compare-dest, --copy-dest and --link-dest to see if src
 // does not need to be copied
 //
 // Returns True if src does not need to be copied
 func CompareOrCopyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CompareOrCopyDest []fs.Fs, backupDir fs.Fs) (NoNeedTransfer bool, err error) {
+	return CompareOrCopyDestTrash(ctx, fdst, dst, src, CompareOrCopyDest, backupDir, useTrashDir(ctx))
+}
+
+// CompareOrCopyDestTrash is like CompareOrCopyDest but if trash is set
+// then backupDir is the --trash-dir.
+func CompareOrCopyDestTrash(ctx context.Context, fdst fs.Fs, dst, src fs.Object, CompareOrCopyDest []fs.Fs, backupDir fs.Fs, trash bool) (NoNeedTransfer bool, err error) {
 	ci := fs.GetConfig(ctx)
 	if len(ci.CompareDest) > 0 {
 		for _, compareF := range CompareOrCopyDest {
@@ -1710,7 +1845,14 @@ func CompareOrCopyDest(ctx context.Context, fdst fs.Fs, dst, src fs.Object, Comp
 		}
 	} else if len(ci.CopyDest) > 0 {
 		for _, copyF := range CompareOrCopyDest {
-			NoNeedTransfer, err := copyDest(ctx, fdst, dst, src, copyF, backupDir)
+			NoNeedTransfer, err := copyDest(ctx, fdst, dst, src, copyF, backupDir, trash)
+			if NoNeedTransfer || err != nil {
+				return NoNeedTransfer, err
+			}
+		}
+	} else if len(ci.LinkDest) > 0 {
+		for _, linkF := range CompareOrCopyDest {
+			NoNeedTransfer, err := linkDest(ctx, fdst, dst, src, linkF, backupDir, trash)
 			if NoNeedTransfer || err != nil {
 				return NoNeedTransfer, err
 			}
@@ -1897,45 +2039,85 @@ func CopyURLToWriter(ctx context.Context, url string, out io.Writer) (err error)
 }
 
 // BackupDir returns the correctly configured --backup-dir
+//
+// If --trash-dir is set it is returned instead.
 func BackupDir(ctx context.Context, fdst fs.Fs, fsrc fs.Fs, srcFileName string) (backupDir fs.Fs, err error) {
+	backupDir, _, err = BackupDirTrash(ctx, fdst, fsrc, srcFileName)
+	return backupDir, err
+}
+
+// useTrashDir returns true if BackupDir returns the --trash-dir
+func useTrashDir(ctx context.Context) bool {
+	return fs.GetConfig(ctx).TrashDir != ""
+}
+
+// backupDirFlag returns the name of the flag the backupDir came from
+func backupDirFlag(trash bool) string {
+	if trash {
+		return "--trash-dir"
+	}
+	return "--backup-dir"
+}
+
+// BackupDirTrash is like BackupDir but also returns whether it
+// returned the --trash-dir. This should be passed to the ...Trash
+// variants of the functions which take the backupDir.
+func BackupDirTrash(ctx context.Context, fdst fs.Fs, fsrc fs.Fs, srcFileName string) (backupDir fs.Fs, trash bool, err error) {
 	ci := fs.GetConfig(ctx)
-	if ci.BackupDir != "" {
-		backupDir, err = cache.Get(ctx, ci.BackupDir)
+	dir, trash := ci.BackupDir, useTrashDir(ctx)
+	if trash {
+		dir = ci.TrashDir
+	}
+	flag := backupDirFlag(trash)
+	if dir != "" {
+		backupDir, err = cache.Get(ctx, dir)
 		if err != nil {
-			return nil, fserrors.FatalError(fmt.Errorf("failed to make fs for --backup-dir %q: %w", ci.BackupDir, err))
+			return nil, false, fserrors.FatalError(fmt.Errorf("failed to make fs for %s %q: %w", flag, dir, err))
 		}
 		if !SameConfig(fdst, backupDir) {
-			return nil, fserrors.FatalError(errors.New("parameter to --backup-dir has to be on the same remote as destination"))
+			return nil, false, fserrors.FatalError(fmt.Errorf("parameter to %s has to be on the same remote as destination", flag))
 		}
 		if srcFileName == "" {
 			if OverlappingFilterCheck(ctx, backupDir, fdst) {
-				return nil, fserrors.FatalError(errors.New("destination and parameter to --backup-dir mustn't overlap"))
+				return nil, false, fserrors.FatalError(fmt.Errorf("destination and parameter to %s mustn't overlap", flag))
 			}
 			if OverlappingFilterCheck(ctx, backupDir, fsrc) {
-				return nil, fserrors.FatalError(errors.New("source and parameter to --backup-dir mustn't overlap"))
+				return nil, false, fserrors.FatalError(fmt.Errorf("source and parameter to %s mustn't overlap", flag))
 			}
 		} else if ci.Suffix == "" {
 			if SameDir(fdst, backupDir) {
-				return nil, fserrors.FatalError(errors.New("destination and parameter to --backup-dir mustn't be the same"))
+				return nil, false, fserrors.FatalError(fmt.Errorf("destination and parameter to %s mustn't be the same", flag))
 			}
 			if SameDir(fsrc, backupDir) {
-				return nil, fserrors.FatalError(errors.New("source and parameter to --backup-dir mustn't be the same"))
+				return nil, false, fserrors.FatalError(fmt.Errorf("source and parameter to %s mustn't be the same", flag))
 			}
 		}
 	} else if ci.Suffix != "" {
 		// --backup-dir is not set but --suffix is - use the destination as the backupDir
 		backupDir = fdst
 	} else {
-		return nil, fserrors.FatalError(errors.New("internal error: BackupDir called when --backup-dir and --suffix both empty"))
+		return nil, false, fserrors.FatalError(errors.New("internal error: BackupDir called when --backup-dir, --trash-dir and --suffix all empty"))
 	}
 	if !CanServerSideMove(backupDir) {
-		return nil, fserrors.FatalError(errors.New("can't use --backup-dir on a remote which doesn't support server-side move or copy"))
+		return nil, false, fserrors.FatalError(fmt.Errorf("can't use %s on a remote which doesn't support server-side move or copy", flag))
 	}
-	return backupDir, nil
+	return backupDir, trash, nil
 }
 
 // MoveBackupDir moves a file to the backup dir
+//
+// backupDir should come from BackupDir.
 func MoveBackupDir(ctx context.Context, backupDir fs.Fs, dst fs.Object) (err error) {
+	return MoveBackupDirTrash(ctx, backupDir, dst, useTrashDir(ctx))
+}
+
+// MoveBackupDirTrash is like MoveBackupDir but if trash is set then
+// backupDir is the --trash-dir and the file is moved into it as an
+// overwritten file.
+func MoveBackupDirTrash(ctx context.Context, backupDir fs.Fs, dst fs.Object, trash bool) (err error) {
+	if trash {
+		return MoveToTrash(ctx, backupDir, dst, TrashReasonOverwritten)
+	}
 	remoteWithSuffix := SuffixName(ctx, dst.Remote())
 	overwritten, _ := backupDir.NewObject(ctx, remoteWithSuffix)
 	_, err = Move(ctx, backupDir, overwritten, remoteWithSuffix, dst)
@@ -2049,11 +2231,12 @@ func moveOrCopyFile(ctx context.Context, fdst fs.Fs, fsrc fs.Fs, dstFileName str
 	}
 
 	var backupDir fs.Fs
+	var trash bool
 	var copyDestDir []fs.Fs
-	if ci.BackupDir != "" || ci.Suffix != "" {
-		backupDir, err = BackupDir(ctx, fdst, fsrc, srcFileName)
+	if ci.BackupDir != "" || ci.TrashDir != "" || ci.Suffix != "" {
+		backupDir, trash, err = BackupDirTrash(ctx, fdst, fsrc, srcFileName)
 		if err != nil {
-			return fmt.Errorf("creating Fs for --backup-dir failed: %w", err)
+			return fmt.Errorf("creating Fs for %s failed: %w", backupDirFlag(useTrashDir(ctx)), err)
 		}
 	}
 	if len(ci.CompareDest) > 0 {
@@ -2066,10 +2249,15 @@ func moveOrCopyFile(ctx context.Context, fdst fs.Fs, fsrc fs.Fs, dstFileName str
 		if err != nil {
 			return err
 		}
+	} else if len(ci.LinkDest) > 0 {
+		copyDestDir, err = GetLinkDest(ctx, fdst)
+		if err != nil {
+			return err
+		}
 	}
 	needTransfer := NeedTransfer(ctx, dstObj, srcObj)
 	if needTransfer {
-		NoNeedTransfer, err := CompareOrCopyDest(ctx, fdst, dstObj, srcObj, copyDestDir, backupDir)
+		NoNeedTransfer, err := CompareOrCopyDestTrash(ctx, fdst, dstObj, srcObj, copyDestDir, backupDir, trash)
 		if err != nil {
 			return err
 		}
@@ -2080,10 +2268,10 @@ func moveOrCopyFile(ctx context.Context, fdst fs.Fs, fsrc fs.Fs, dstFileName str
 	if needTransfer {
 		// If destination already exists, then we must move it into --backup-dir if required
 		if dstObj != nil && backupDir != nil {
-			err = MoveBackupDir(ctx, backupDir, dstObj)
+			err = MoveBackupDirTrash(ctx, backupDir, dstObj, trash)
 			if err != nil {
 				logger(ctx, TransferError, dstObj, nil, err)
-				return fmt.Errorf("moving to --backup-dir failed: %w", err)
+				return fmt.Errorf("moving to %s failed: %w", backupDirFlag(trash), err)
 			}
 			// If successful zero out the dstObj as it is no longer there
 			logger(ctx, MissingOnDst, dstObj, nil, nil)
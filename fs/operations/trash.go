@@ -0,0 +1,226 @@
+package operations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/object"
+	"github.com/rclone/rclone/fs/walk"
+	"github.com/rclone/rclone/lib/random"
+)
+
+// TrashSuffix is the suffix of the metadata files stored alongside
+// each item in a --trash-dir
+const TrashSuffix = ".rclonetrash"
+
+// Reasons an item was put in the trash
+const (
+	TrashReasonDeleted     = "deleted"
+	TrashReasonOverwritten = "overwritten"
+)
+
+// maxTrashMetadataSize is the largest metadata file which will be read
+const maxTrashMetadataSize = 64 * 1024
+
+// TrashItem describes an item in a --trash-dir
+type TrashItem struct {
+	Name    string    `json:"name"`    // name of the file in the trash
+	Root    string    `json:"root"`    // the remote the file was deleted from
+	Path    string    `json:"path"`    // the original path relative to Root
+	Reason  string    `json:"reason"`  // why the file was put in the trash
+	Deleted time.Time `json:"deleted"` // when the file was put in the trash
+	Size    int64     `json:"size"`    // size of the file
+	ModTime time.Time `json:"modTime"` // modification time of the file
+}
+
+// trashName makes the name dst will be stored under in the trash
+func trashName(remote string, t time.Time) string {
+	return remote + "." + t.UTC().Format("20060102T150405Z") + "-" + random.String(6)
+}
+
+// MoveToTrash moves dst into trashDir, writing a metadata file
+// alongside it recording where it came from and why.
+func MoveToTrash(ctx context.Context, trashDir fs.Fs, dst fs.Object, reason string) (err error) {
+	if SkipDestructive(ctx, dst, "move into trash") {
+		return nil
+	}
+	now := time.Now()
+	item := TrashItem{
+		Name:    trashName(dst.Remote(), now),
+		Root:    fs.ConfigString(dst.Fs()),
+		Path:    dst.Remote(),
+		Reason:  reason,
+		Deleted: now,
+		Size:    dst.Size(),
+		ModTime: dst.ModTime(ctx),
+	}
+	data, err := json.MarshalIndent(&item, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to make trash metadata: %w", err)
+	}
+	info := object.NewStaticObjectInfo(item.Name+TrashSuffix, now, int64(len(data)), true, nil, trashDir)
+	metadata, err := trashDir.Put(ctx, bytes.NewReader(data), info)
+	if err != nil {
+		return fmt.Errorf("failed to write trash metadata: %w", err)
+	}
+	_, err = Move(ctx, trashDir, nil, item.Name, dst)
+	if err != nil {
+		if removeErr := metadata.Remove(ctx); removeErr != nil {
+			fs.Errorf(metadata, "Failed to remove trash metadata: %v", removeErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// readTrashItem reads the metadata for a trash item
+func readTrashItem(ctx context.Context, o fs.Object) (item TrashItem, err error) {
+	if o.Size() > maxTrashMetadataSize {
+		return item, errors.New("trash metadata too large")
+	}
+	in, err := o.Open(ctx)
+	if err != nil {
+		return item, err
+	}
+	data, err := io.ReadAll(io.LimitReader(in, maxTrashMetadataSize))
+	closeErr := in.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return item, err
+	}
+	err = json.Unmarshal(data, &item)
+	if err != nil {
+		return item, fmt.Errorf("failed to decode trash metadata: %w", err)
+	}
+	// The name is where the metadata is, wherever it was written
+	item.Name = strings.TrimSuffix(o.Remote(), TrashSuffix)
+	return item, nil
+}
+
+// ListTrash reads the items in trashDir, oldest first
+func ListTrash(ctx context.Context, trashDir fs.Fs) (items []TrashItem, err error) {
+	err = walk.ListR(ctx, trashDir, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		for _, entry := range entries {
+			o, ok := entry.(fs.Object)
+			if !ok || !strings.HasSuffix(o.Remote(), TrashSuffix) {
+				continue
+			}
+			item, err := readTrashItem(ctx, o)
+			if err != nil {
+				fs.Errorf(o, "Ignoring trash item: %v", err)
+				continue
+			}
+			items = append(items, item)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if !items[i].Deleted.Equal(items[j].Deleted) {
+			return items[i].Deleted.Before(items[j].Deleted)
+		}
+		return items[i].Name < items[j].Name
+	})
+	return items, nil
+}
+
+// removeTrashItem removes the file and metadata of item from trashDir
+func removeTrashItem(ctx context.Context, trashDir fs.Fs, item TrashItem) error {
+	o, err := trashDir.NewObject(ctx, item.Name)
+	if err == nil {
+		err = DeleteFile(ctx, o)
+		if err != nil {
+			return err
+		}
+	} else if !errors.Is(err, fs.ErrorObjectNotFound) {
+		return err
+	}
+	metadata, err := trashDir.NewObject(ctx, item.Name+TrashSuffix)
+	if err != nil {
+		return err
+	}
+	if SkipDestructive(ctx, metadata, "remove trash metadata") {
+		return nil
+	}
+	return metadata.Remove(ctx)
+}
+
+// RestoreTrash moves item from trashDir back to where it came from.
+//
+// If a file exists at the original path already it is moved into the
+// trash first so nothing is lost.
+func RestoreTrash(ctx context.Context, trashDir fs.Fs, item TrashItem) error {
+	fdst, err := cache.Get(ctx, item.Root)
+	if err != nil {
+		return fmt.Errorf("failed to make fs for %q: %w", item.Root, err)
+	}
+	o, err := trashDir.NewObject(ctx, item.Name)
+	if err != nil {
+		return fmt.Errorf("failed to find %q in trash: %w", item.Name, err)
+	}
+	if SkipDestructive(ctx, path.Join(item.Root, item.Path), "restore from trash") {
+		return nil
+	}
+	existing, err := fdst.NewObject(ctx, item.Path)
+	if err == nil {
+		err = MoveToTrash(ctx, trashDir, existing, TrashReasonOverwritten)
+		if err != nil {
+			return fmt.Errorf("failed to move existing file into trash: %w", err)
+		}
+	} else if !errors.Is(err, fs.ErrorObjectNotFound) {
+		return err
+	}
+	_, err = Move(ctx, fdst, nil, item.Path, o)
+	if err != nil {
+		return err
+	}
+	metadata, err := trashDir.NewObject(ctx, item.Name+TrashSuffix)
+	if err != nil {
+		return err
+	}
+	return metadata.Remove(ctx)
+}
+
+// ExpireTrash removes the items from trashDir which were put there
+// more than maxAge ago, returning the number removed.
+func ExpireTrash(ctx context.Context, trashDir fs.Fs, maxAge time.Duration) (removed int, err error) {
+	items, err := ListTrash(ctx, trashDir)
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-maxAge)
+	var lastErr error
+	for _, item := range items {
+		if !item.Deleted.Before(cutoff) {
+			break
+		}
+		err = removeTrashItem(ctx, trashDir, item)
+		if err != nil {
+			fs.Errorf(item.Name, "Failed to expire from trash: %v", err)
+			lastErr = fs.CountError(ctx, err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		err = Rmdirs(ctx, trashDir, "", true)
+		if err != nil {
+			lastErr = err
+		}
+	}
+	return removed, lastErr
+}
@@ -0,0 +1,104 @@
+package operations_test
+
+import (
+	"context"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/cache"
+	"github.com/rclone/rclone/fs/operations"
+	"github.com/rclone/rclone/fstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrash(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	if !operations.CanServerSideMove(r.Fremote) {
+		t.Skip("Skipping test as remote does not support server-side move or copy")
+	}
+	fdst, err := cache.Get(ctx, r.FremoteName+"/dst")
+	require.NoError(t, err)
+	ftrash, err := cache.Get(ctx, r.FremoteName+"/trash")
+	require.NoError(t, err)
+
+	file1 := r.WriteObject(ctx, "dst/sub/file1", "file1 contents", t1)
+	r.CheckRemoteItems(t, file1)
+
+	// Move into the trash
+	o, err := fdst.NewObject(ctx, "sub/file1")
+	require.NoError(t, err)
+	start := time.Now()
+	require.NoError(t, operations.MoveToTrash(ctx, ftrash, o, operations.TrashReasonDeleted))
+
+	items, err := operations.ListTrash(ctx, ftrash)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	item := items[0]
+	assert.True(t, strings.HasPrefix(item.Name, "sub/file1."), item.Name)
+	assert.Equal(t, fs.ConfigString(fdst), item.Root)
+	assert.Equal(t, "sub/file1", item.Path)
+	assert.Equal(t, operations.TrashReasonDeleted, item.Reason)
+	assert.Equal(t, file1.Size, item.Size)
+	assert.False(t, item.Deleted.Before(start.Truncate(time.Second)))
+	fstest.AssertTimeEqualWithPrecision(t, item.Name, t1, item.ModTime, fs.GetModifyWindow(ctx, r.Fremote))
+
+	// Restore it over a new file which goes into the trash
+	file2 := r.WriteObject(ctx, "dst/sub/file1", "file1 new contents", t2)
+	require.NoError(t, operations.RestoreTrash(ctx, ftrash, item))
+	o, err = fdst.NewObject(ctx, "sub/file1")
+	require.NoError(t, err)
+	assert.Equal(t, file1.Size, o.Size())
+
+	items, err = operations.ListTrash(ctx, ftrash)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, operations.TrashReasonOverwritten, items[0].Reason)
+	assert.Equal(t, file2.Size, items[0].Size)
+	assert.NotEqual(t, item.Name, items[0].Name)
+
+	// Expiring recent items does nothing
+	removed, err := operations.ExpireTrash(ctx, ftrash, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, 0, removed)
+
+	// Expire everything
+	removed, err = operations.ExpireTrash(ctx, ftrash, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	items, err = operations.ListTrash(ctx, ftrash)
+	require.NoError(t, err)
+	assert.Len(t, items, 0)
+	r.CheckRemoteItems(t, file1)
+}
+
+func TestBackupDirTrash(t *testing.T) {
+	ctx := context.Background()
+	r := fstest.NewRun(t)
+	if !operations.CanServerSideMove(r.Fremote) {
+		t.Skip("Skipping test as remote does not support server-side move or copy")
+	}
+	fdst, err := cache.Get(ctx, r.FremoteName+"/dst")
+	require.NoError(t, err)
+	ctx, ci := fs.AddConfig(ctx)
+
+	ci.BackupDir = r.FremoteName + "/backup"
+	dir, trash, err := operations.BackupDirTrash(ctx, fdst, fdst, "file")
+	require.NoError(t, err)
+	assert.False(t, trash)
+	assert.Equal(t, "backup", path.Base(dir.Root()))
+
+	// --trash-dir takes precedence
+	ci.TrashDir = r.FremoteName + "/trash"
+	dir, trash, err = operations.BackupDirTrash(ctx, fdst, fdst, "file")
+	require.NoError(t, err)
+	assert.True(t, trash)
+	assert.Equal(t, "trash", path.Base(dir.Root()))
+	dir2, err := operations.BackupDir(ctx, fdst, fdst, "file")
+	require.NoError(t, err)
+	assert.Equal(t, dir.Root(), dir2.Root())
+}
@@ -24,9 +24,12 @@ func NewPacer(ctx context.Context, c pacer.Calculator) *Pacer {
 	ci := GetConfig(ctx)
 	retries := max(ci.LowLevelRetries, 1)
 	maxConnections := max(ci.MaxConnections, 0)
+	remote := RemoteName(ctx)
 	p := &Pacer{
 		Pacer: pacer.New(
-			pacer.InvokerOption(pacerInvoker),
+			pacer.InvokerOption(func(try, retries int, f pacer.Paced) (bool, error) {
+				return pacerInvoker(remote, try, retries, f)
+			}),
 			pacer.MaxConnectionsOption(maxConnections),
 			pacer.RetriesOption(retries),
 			pacer.CalculatorOption(c),
@@ -82,10 +85,11 @@ func (p *Pacer) ModifyCalculator(f func(pacer.Calculator)) {
 	})
 }
 
-func pacerInvoker(try, retries int, f pacer.Paced) (retry bool, err error) {
+func pacerInvoker(remote string, try, retries int, f pacer.Paced) (retry bool, err error) {
 	retry, err = f()
 	if retry {
 		Debugf("pacer", "low level retry %d/%d (error %v)", try, retries, err)
+		PacerRetry(remote)
 		err = fserrors.RetryError(err)
 	}
 	return
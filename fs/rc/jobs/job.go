@@ -17,6 +17,7 @@ import (
 	"github.com/rclone/rclone/fs/cache"
 	"github.com/rclone/rclone/fs/filter"
 	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/kv"
 )
 
 // Fill in these to avoid circular dependencies
@@ -40,6 +41,12 @@ type Job struct {
 	Stop      func()    `json:"-"`
 	listeners []*func()
 
+	// These are set if the job is being persisted
+	path     string    // rc path of the call
+	params   rc.Params // input parameters of the call
+	noParams bool      // set if params weren't saved as they may contain secrets
+	db       *kv.DB    // database to save the job to
+
 	// realErr is the Error before printing it as a string, it's used to return
 	// the real error to the upper application layers while still printing the
 	// string error message.
@@ -72,6 +79,7 @@ func (job *Job) finish(out rc.Params, err error) {
 	}
 
 	job.mu.Unlock()
+	job.save()
 	running.kickExpire() // make sure this job gets expired
 }
 
@@ -115,6 +123,7 @@ type Jobs struct {
 	jobs          map[int64]*Job
 	opt           *rc.Options
 	expireRunning bool
+	db            *kv.DB // set if persisting jobs
 }
 
 var (
@@ -158,13 +167,20 @@ func (jobs *Jobs) Expire() {
 	jobs.mu.Lock()
 	defer jobs.mu.Unlock()
 	now := time.Now()
+	var expired []int64
 	for ID, job := range jobs.jobs {
 		job.mu.Lock()
 		if job.Finished && now.Sub(job.EndTime) > time.Duration(jobs.opt.JobExpireDuration) {
 			delete(jobs.jobs, ID)
+			if job.db != nil {
+				expired = append(expired, ID)
+			}
 		}
 		job.mu.Unlock()
 	}
+	if len(expired) > 0 {
+		go jobs.deleteSaved(expired)
+	}
 	if len(jobs.jobs) != 0 {
 		time.AfterFunc(time.Duration(jobs.opt.JobExpireInterval), jobs.Expire)
 		jobs.expireRunning = true
@@ -261,8 +277,33 @@ var jobKey = jobKeyType{}
 
 // NewJob creates a Job and executes it, possibly in the background if _async is set
 func (jobs *Jobs) NewJob(ctx context.Context, fn rc.Func, in rc.Params) (job *Job, out rc.Params, err error) {
-	id := jobID.Add(1)
-	in = in.Copy() // copy input so we can change it
+	return jobs.newJob(ctx, 0, "", fn, in)
+}
+
+// NewCallJob creates a Job for the rc call and executes it, possibly in
+// the background if _async is set.
+//
+// If jobs are being persisted then async jobs started with this are
+// saved so they can be listed and resumed after a restart.
+func (jobs *Jobs) NewCallJob(ctx context.Context, call *rc.Call, in rc.Params) (job *Job, out rc.Params, err error) {
+	path := call.Path
+	if call.NeedsRequest || call.NeedsResponse {
+		// can't save the HTTP request or response
+		path = ""
+	}
+	return jobs.newJob(ctx, 0, path, call.Fn, in)
+}
+
+// newJob creates and executes a Job with the id given, or a new id if 0.
+//
+// If path is set and the job is async it will be saved if jobs are
+// being persisted.
+func (jobs *Jobs) newJob(ctx context.Context, id int64, path string, fn rc.Func, in rc.Params) (job *Job, out rc.Params, err error) {
+	if id == 0 {
+		id = jobID.Add(1)
+	}
+	in = in.Copy()      // copy input so we can change it
+	params := in.Copy() // the parameters to save
 
 	ctx, isAsync, err := getAsync(ctx, in)
 	if err != nil {
@@ -299,7 +340,18 @@ func (jobs *Jobs) NewJob(ctx context.Context, fn rc.Func, in rc.Params) (job *Jo
 
 	jobs.mu.Lock()
 	jobs.jobs[job.ID] = job
+	if isAsync && path != "" && jobs.db != nil {
+		job.path = path
+		if hasSecrets(params) {
+			fs.Debugf(nil, "rc: not saving the parameters of job %d as they may contain secrets", id)
+			job.noParams = true
+		} else {
+			job.params = params
+		}
+		job.db = jobs.db
+	}
 	jobs.mu.Unlock()
+	job.save()
 
 	// Add the job to the context
 	ctx = context.WithValue(ctx, jobKey, job)
@@ -323,6 +375,12 @@ func NewJob(ctx context.Context, fn rc.Func, in rc.Params) (job *Job, out rc.Par
 	return running.NewJob(ctx, fn, in)
 }
 
+// NewCallJob creates a Job for the rc call and executes it on the
+// global job queue, possibly in the background if _async is set
+func NewCallJob(ctx context.Context, call *rc.Call, in rc.Params) (job *Job, out rc.Params, err error) {
+	return running.NewCallJob(ctx, call, in)
+}
+
 // OnFinish adds listener to jobid that will be triggered when job is finished.
 // It returns a function to cancel listening.
 func OnFinish(jobID int64, fn func()) (func(), error) {
@@ -0,0 +1,298 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/fspath"
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// kvFacility is the name of the kv database the jobs are saved in
+const kvFacility = "rcjobs"
+
+// errInterrupted is set as the error of jobs which were running when
+// rclone stopped and weren't resumed
+var errInterrupted = errors.New("job interrupted by rclone restart")
+
+// jobRecord is the state of a Job as saved in the database
+type jobRecord struct {
+	ID        int64     `json:"id"`
+	Group     string    `json:"group"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	Error     string    `json:"error"`
+	Finished  bool      `json:"finished"`
+	Success   bool      `json:"success"`
+	Duration  float64   `json:"duration"`
+	Output    rc.Params `json:"output"`
+	Path      string    `json:"path"`
+	Params    rc.Params `json:"params"`
+	NoParams  bool      `json:"noParams,omitempty"`
+}
+
+// secretWords are parts of parameter names which suggest their values
+// are secrets
+var secretWords = []string{"pass", "secret", "token", "key"}
+
+// isSecretName returns true if a parameter called name may hold a
+// secret
+func isSecretName(name string) bool {
+	lowerName := strings.ToLower(name)
+	for _, word := range secretWords {
+		if strings.Contains(lowerName, word) {
+			return true
+		}
+	}
+	for _, info := range fs.Registry {
+		for _, opt := range info.Options {
+			if (opt.IsPassword || opt.Sensitive) && strings.EqualFold(opt.Name, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasSecrets returns true if v may contain passwords or other secrets
+// so shouldn't be saved in the database.
+//
+// This is the case for parameters named like secrets, for _config as
+// it may set headers with credentials and for remotes with config in
+// their connection strings.
+func hasSecrets(v any) bool {
+	switch x := v.(type) {
+	case rc.Params:
+		return hasSecrets(map[string]any(x))
+	case map[string]any:
+		for name, value := range x {
+			if name == "_config" || isSecretName(name) || hasSecrets(value) {
+				return true
+			}
+		}
+	case []any:
+		for _, value := range x {
+			if hasSecrets(value) {
+				return true
+			}
+		}
+	case []string:
+		for _, value := range x {
+			if hasSecrets(value) {
+				return true
+			}
+		}
+	case string:
+		parsed, err := fspath.Parse(x)
+		return err == nil && len(parsed.Config) > 0
+	}
+	return false
+}
+
+// dbKey makes the database key for the job ID
+func dbKey(ID int64) []byte {
+	return []byte(strconv.FormatInt(ID, 10))
+}
+
+// save the job to the database if it is being persisted
+//
+// The output isn't saved if it may contain secrets.
+func (job *Job) save() {
+	job.mu.Lock()
+	if job.db == nil {
+		job.mu.Unlock()
+		return
+	}
+	db := job.db
+	output := job.Output
+	if hasSecrets(output) {
+		output = nil
+	}
+	data, err := json.Marshal(jobRecord{
+		ID:        job.ID,
+		Group:     job.Group,
+		StartTime: job.StartTime,
+		EndTime:   job.EndTime,
+		Error:     job.Error,
+		Finished:  job.Finished,
+		Success:   job.Success,
+		Duration:  job.Duration,
+		Output:    output,
+		Path:      job.path,
+		Params:    job.params,
+		NoParams:  job.noParams,
+	})
+	job.mu.Unlock()
+	if err != nil {
+		fs.Errorf(nil, "rc: failed to encode job %d for saving: %v", job.ID, err)
+		return
+	}
+	err = db.Do(true, &opPutJob{key: dbKey(job.ID), data: data})
+	if err != nil {
+		fs.Errorf(nil, "rc: failed to save job %d: %v", job.ID, err)
+	}
+}
+
+// deleteSaved removes the jobs with the IDs given from the database
+func (jobs *Jobs) deleteSaved(IDs []int64) {
+	jobs.mu.RLock()
+	db := jobs.db
+	jobs.mu.RUnlock()
+	if db == nil {
+		return
+	}
+	err := db.Do(true, &opDeleteJobs{IDs: IDs})
+	if err != nil {
+		fs.Errorf(nil, "rc: failed to remove expired jobs: %v", err)
+	}
+}
+
+// StartPersist starts saving async jobs to the database so their
+// status survives a restart.
+//
+// Jobs saved by a previous run are loaded. Unfinished jobs are started
+// again if --rc-job-resume is set, otherwise they are marked as failed.
+func StartPersist(ctx context.Context) error {
+	db, err := kv.Start(ctx, kvFacility, nil)
+	if err != nil {
+		return fmt.Errorf("failed to open job database: %w", err)
+	}
+	return running.startPersist(db)
+}
+
+// startPersist loads the jobs in db and saves new jobs to it
+func (jobs *Jobs) startPersist(db *kv.DB) error {
+	op := &opLoadJobs{}
+	err := db.Do(false, op)
+	if err != nil && err != kv.ErrEmpty {
+		return fmt.Errorf("failed to load saved jobs: %w", err)
+	}
+
+	jobs.mu.Lock()
+	jobs.db = db
+	var (
+		maxID  int64
+		resume []*Job
+	)
+	for _, r := range op.records {
+		job := &Job{
+			ID:        r.ID,
+			Group:     r.Group,
+			StartTime: r.StartTime,
+			EndTime:   r.EndTime,
+			Error:     r.Error,
+			Finished:  r.Finished,
+			Success:   r.Success,
+			Duration:  r.Duration,
+			Output:    r.Output,
+			Stop:      func() {},
+			path:      r.Path,
+			params:    r.Params,
+			noParams:  r.NoParams,
+			db:        db,
+		}
+		if job.Error != "" {
+			job.realErr = errors.New(job.Error)
+		}
+		maxID = max(maxID, job.ID)
+		if _, found := jobs.jobs[job.ID]; found {
+			fs.Errorf(nil, "rc: ignoring saved job %d as a job with that ID is already running", job.ID)
+			continue
+		}
+		jobs.jobs[job.ID] = job
+		if !job.Finished {
+			resume = append(resume, job)
+		}
+	}
+	jobs.mu.Unlock()
+
+	// Make sure new jobs don't reuse the IDs of saved jobs
+	for {
+		current := jobID.Load()
+		if current >= maxID || jobID.CompareAndSwap(current, maxID) {
+			break
+		}
+	}
+
+	for _, job := range resume {
+		jobs.resume(job)
+	}
+	if len(op.records) > 0 {
+		fs.Infof(nil, "rc: loaded %d saved jobs, %d unfinished", len(op.records), len(resume))
+		jobs.kickExpire()
+	}
+	return nil
+}
+
+// resume an unfinished saved job or mark it as failed if it can't
+// or shouldn't be resumed.
+func (jobs *Jobs) resume(job *Job) {
+	if !jobs.opt.JobResume {
+		job.finish(nil, errInterrupted)
+		return
+	}
+	if job.noParams {
+		job.finish(nil, fmt.Errorf("%w: can't resume as its parameters may contain secrets so weren't saved", errInterrupted))
+		return
+	}
+	call := rc.Calls.Get(job.path)
+	if call == nil {
+		job.finish(nil, fmt.Errorf("%w: can't resume unknown call %q", errInterrupted, job.path))
+		return
+	}
+	in := job.params.Copy()
+	in["_async"] = true
+	fs.Infof(nil, "rc: resuming job %d: %q", job.ID, job.path)
+	_, _, err := jobs.newJob(context.Background(), job.ID, job.path, call.Fn, in)
+	if err != nil {
+		job.finish(nil, fmt.Errorf("%w: failed to resume: %w", errInterrupted, err))
+	}
+}
+
+// opPutJob saves a single job
+type opPutJob struct {
+	key  []byte
+	data []byte
+}
+
+func (op *opPutJob) Do(ctx context.Context, b kv.Bucket) error {
+	return b.Put(op.key, op.data)
+}
+
+// opDeleteJobs removes jobs
+type opDeleteJobs struct {
+	IDs []int64
+}
+
+func (op *opDeleteJobs) Do(ctx context.Context, b kv.Bucket) error {
+	for _, ID := range op.IDs {
+		if err := b.Delete(dbKey(ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// opLoadJobs reads all the saved jobs
+type opLoadJobs struct {
+	records []jobRecord
+}
+
+func (op *opLoadJobs) Do(ctx context.Context, b kv.Bucket) error {
+	return b.ForEach(func(key, data []byte) error {
+		var r jobRecord
+		if err := json.Unmarshal(data, &r); err != nil {
+			fs.Errorf(nil, "rc: ignoring corrupted saved job %q: %v", key, err)
+			return nil
+		}
+		op.records = append(op.records, r)
+		return nil
+	})
+}
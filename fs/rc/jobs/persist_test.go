@@ -0,0 +1,221 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/fs/rc"
+	"github.com/rclone/rclone/lib/kv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newPersistJobs makes a Jobs persisting to db with resume set as given
+func newPersistJobs(t *testing.T, db *kv.DB, resume bool) *Jobs {
+	jobs := newJobs()
+	opt := rc.Opt
+	opt.JobResume = resume
+	jobs.opt = &opt
+	require.NoError(t, jobs.startPersist(db))
+	return jobs
+}
+
+// waitFinished waits for job to finish
+func waitFinished(t *testing.T, job *Job) {
+	done := make(chan struct{})
+	job.OnFinish(func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for job to finish")
+	}
+}
+
+// putRecord saves r in db
+func putRecord(t *testing.T, db *kv.DB, r jobRecord) {
+	data, err := json.Marshal(r)
+	require.NoError(t, err)
+	require.NoError(t, db.Do(true, &opPutJob{key: dbKey(r.ID), data: data}))
+}
+
+// loadRecords reads the records from db
+func loadRecords(t *testing.T, db *kv.DB) map[int64]jobRecord {
+	op := &opLoadJobs{}
+	require.NoError(t, db.Do(false, op))
+	records := map[int64]jobRecord{}
+	for _, r := range op.records {
+		records[r.ID] = r
+	}
+	return records
+}
+
+func TestPersistJobs(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("kv database not supported")
+	}
+	ctx := context.Background()
+	db, err := kv.Start(ctx, "rcjobs-test", nil)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Stop(true))
+	}()
+	call := rc.Calls.Get("rc/noop")
+	require.NotNil(t, call)
+
+	// Async jobs from calls are saved
+	jobs := newPersistJobs(t, db, false)
+	job, _, err := jobs.NewCallJob(ctx, call, rc.Params{"_async": true, "_group": "mygroup", "potato": "sausage"})
+	require.NoError(t, err)
+	waitFinished(t, job)
+	records := loadRecords(t, db)
+	require.Contains(t, records, job.ID)
+	r := records[job.ID]
+	assert.True(t, r.Finished)
+	assert.True(t, r.Success)
+	assert.Equal(t, "mygroup", r.Group)
+	assert.Equal(t, "rc/noop", r.Path)
+	assert.Equal(t, "sausage", r.Params["potato"])
+	assert.Equal(t, "sausage", r.Output["potato"])
+
+	// Sync jobs and jobs without a call aren't saved
+	syncJob, _, err := jobs.NewCallJob(ctx, call, rc.Params{})
+	require.NoError(t, err)
+	noCallJob, _, err := jobs.NewJob(ctx, noopFn, rc.Params{"_async": true})
+	require.NoError(t, err)
+	waitFinished(t, noCallJob)
+	records = loadRecords(t, db)
+	assert.NotContains(t, records, syncJob.ID)
+	assert.NotContains(t, records, noCallJob.ID)
+
+	// Saved jobs are loaded after a restart
+	unfinishedID := jobID.Load() + 10
+	putRecord(t, db, jobRecord{
+		ID:        unfinishedID,
+		StartTime: time.Now(),
+		Path:      "rc/noop",
+		Params:    rc.Params{"potato": "mash"},
+	})
+	jobs = newPersistJobs(t, db, false)
+	assert.GreaterOrEqual(t, jobID.Load(), unfinishedID)
+	loaded := jobs.Get(job.ID)
+	require.NotNil(t, loaded)
+	assert.True(t, loaded.Finished)
+	assert.True(t, loaded.Success)
+	assert.Equal(t, "sausage", loaded.Output["potato"])
+	loaded.Stop() // check this is safe
+
+	// Unfinished jobs are marked as failed if not resuming
+	interrupted := jobs.Get(unfinishedID)
+	require.NotNil(t, interrupted)
+	waitFinished(t, interrupted)
+	assert.False(t, interrupted.Success)
+	assert.ErrorIs(t, interrupted.realErr, errInterrupted)
+	assert.False(t, loadRecords(t, db)[unfinishedID].Success)
+
+	// Unfinished jobs are run again if resuming
+	putRecord(t, db, jobRecord{
+		ID:        unfinishedID,
+		StartTime: time.Now(),
+		Path:      "rc/noop",
+		Params:    rc.Params{"potato": "mash"},
+	})
+	jobs = newPersistJobs(t, db, true)
+	resumed := jobs.Get(unfinishedID)
+	require.NotNil(t, resumed)
+	waitFinished(t, resumed)
+	assert.True(t, resumed.Success)
+	assert.Equal(t, "mash", resumed.Output["potato"])
+	r = loadRecords(t, db)[unfinishedID]
+	assert.True(t, r.Success)
+	assert.Equal(t, "mash", r.Output["potato"])
+
+	// Expired jobs are removed from the database
+	jobs.opt.JobExpireDuration = 0
+	resumed.mu.Lock()
+	resumed.EndTime = time.Now().Add(-time.Minute)
+	resumed.mu.Unlock()
+	jobs.Expire()
+	assert.Nil(t, jobs.Get(unfinishedID))
+	assert.Eventually(t, func() bool {
+		_, found := loadRecords(t, db)[unfinishedID]
+		return !found
+	}, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestPersistResumeUnknownCall(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("kv database not supported")
+	}
+	ctx := context.Background()
+	db, err := kv.Start(ctx, "rcjobs-test-unknown", nil)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Stop(true))
+	}()
+	ID := jobID.Load() + 1
+	putRecord(t, db, jobRecord{
+		ID:   ID,
+		Path: "not/a/call",
+	})
+	jobs := newPersistJobs(t, db, true)
+	job := jobs.Get(ID)
+	require.NotNil(t, job)
+	waitFinished(t, job)
+	assert.ErrorIs(t, job.realErr, errInterrupted)
+	assert.Contains(t, job.Error, "not/a/call")
+}
+
+func TestHasSecrets(t *testing.T) {
+	for _, test := range []struct {
+		params rc.Params
+		want   bool
+	}{
+		{rc.Params{}, false},
+		{rc.Params{"srcFs": "remote:path", "dstFs": "/tmp/dir", "potato": 1}, false},
+		{rc.Params{"_config": rc.Params{"BwLimit": "1M"}}, true},
+		{rc.Params{"password": "potato"}, true},
+		{rc.Params{"opt": map[string]any{"secret_access_key": "potato"}}, true},
+		{rc.Params{"parameters": map[string]any{"user": "me", "pass": "potato"}}, true},
+		{rc.Params{"srcFs": ":s3,access_key_id=X,secret_access_key=Y:bucket"}, true},
+		{rc.Params{"fs": []any{"remote:", "remote,user=me:"}}, true},
+	} {
+		assert.Equal(t, test.want, hasSecrets(test.params), test.params)
+	}
+}
+
+func TestPersistSecrets(t *testing.T) {
+	if !kv.Supported() {
+		t.Skip("kv database not supported")
+	}
+	ctx := context.Background()
+	db, err := kv.Start(ctx, "rcjobs-test-secrets", nil)
+	require.NoError(t, err)
+	defer func() {
+		assert.NoError(t, db.Stop(true))
+	}()
+	call := rc.Calls.Get("rc/noop")
+	require.NotNil(t, call)
+
+	// The job is saved without its parameters or output
+	jobs := newPersistJobs(t, db, true)
+	job, _, err := jobs.NewCallJob(ctx, call, rc.Params{"_async": true, "pass": "potato"})
+	require.NoError(t, err)
+	waitFinished(t, job)
+	r := loadRecords(t, db)[job.ID]
+	assert.True(t, r.Finished)
+	assert.True(t, r.NoParams)
+	assert.Nil(t, r.Params)
+	assert.Nil(t, r.Output)
+
+	// So it can't be resumed
+	r.Finished = false
+	putRecord(t, db, r)
+	jobs = newPersistJobs(t, db, true)
+	job = jobs.Get(job.ID)
+	require.NotNil(t, job)
+	waitFinished(t, job)
+	assert.ErrorIs(t, job.realErr, errInterrupted)
+	assert.Contains(t, job.Error, "secrets")
+}
@@ -83,6 +83,16 @@ var OptionsInfo = fs.Options{{
 	Default: fs.Duration(10 * time.Second),
 	Help:    "Interval to check for expired async jobs",
 	Groups:  "RC",
+}, {
+	Name:    "rc_job_persist",
+	Default: false,
+	Help:    "Save async jobs to disk so they survive a restart",
+	Groups:  "RC",
+}, {
+	Name:    "rc_job_resume",
+	Default: false,
+	Help:    "Restart unfinished jobs saved with --rc-job-persist on startup",
+	Groups:  "RC",
 }, {
 	Name:    "metrics_addr",
 	Default: []string{},
@@ -122,6 +132,8 @@ type Options struct {
 	MetricsTemplate     libhttp.TemplateConfig `config:"metrics"`
 	JobExpireDuration   fs.Duration            `config:"rc_job_expire_duration"`
 	JobExpireInterval   fs.Duration            `config:"rc_job_expire_interval"`
+	JobPersist          bool                   `config:"rc_job_persist"` // set to save async jobs in the kv database
+	JobResume           bool                   `config:"rc_job_resume"`  // set to restart unfinished persisted jobs
 }
 
 // Opt is the default values used for Options
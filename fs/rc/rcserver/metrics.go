@@ -29,6 +29,12 @@ func init() {
 	}
 	fshttp.DefaultMetrics = m
 
+	am := accounting.NewMetrics("rclone")
+	for _, c := range am.Collectors() {
+		prometheus.MustRegister(c)
+	}
+	accounting.DefaultMetrics = am
+
 	promHandlerFunc = promhttp.Handler().ServeHTTP
 }
 
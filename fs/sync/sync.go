@@ -20,6 +20,7 @@ import (
 	"github.com/rclone/rclone/fs/march"
 	"github.com/rclone/rclone/fs/operations"
 	"github.com/rclone/rclone/lib/errcount"
+	"github.com/rclone/rclone/lib/tracing"
 	"github.com/rclone/rclone/lib/transform"
 	"golang.org/x/sync/errgroup"
 )
@@ -85,6 +86,7 @@ type syncCopyMove struct {
 	renameCheck            []fs.Object            // accumulate files to check for rename here
 	compareCopyDest        []fs.Fs                // place to check for files to server side copy
 	backupDir              fs.Fs                  // place to store overwrites/deletes
+	trashDir               bool                   // set if backupDir is the --trash-dir
 	checkFirst             bool                   // if set run all the checkers before starting transfers
 	maxDurationEndTime     time.Time              // end time if --max-duration is set
 	logger                 operations.LoggerFn    // LoggerFn used to report the results of a sync (or bisync) to an io.Writer
@@ -269,9 +271,9 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 		}
 	}
 	// Make Fs for --backup-dir if required
-	if ci.BackupDir != "" || ci.Suffix != "" {
+	if ci.BackupDir != "" || ci.TrashDir != "" || ci.Suffix != "" {
 		var err error
-		s.backupDir, err = operations.BackupDir(ctx, fdst, fsrc, "")
+		s.backupDir, s.trashDir, err = operations.BackupDirTrash(ctx, fdst, fsrc, "")
 		if err != nil {
 			return nil, err
 		}
@@ -288,6 +290,12 @@ func newSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.Delete
 		if err != nil {
 			return nil, err
 		}
+	} else if len(ci.LinkDest) > 0 {
+		var err error
+		s.compareCopyDest, err = operations.GetLinkDest(ctx, fdst)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return s, nil
 }
@@ -382,7 +390,7 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 		if src.Storable() {
 			needTransfer := operations.NeedTransfer(s.ctx, pair.Dst, pair.Src)
 			if needTransfer {
-				NoNeedTransfer, err := operations.CompareOrCopyDest(s.ctx, s.fdst, pair.Dst, pair.Src, s.compareCopyDest, s.backupDir)
+				NoNeedTransfer, err := operations.CompareOrCopyDestTrash(s.ctx, s.fdst, pair.Dst, pair.Src, s.compareCopyDest, s.backupDir, s.trashDir)
 				if err != nil {
 					s.processError(err)
 					s.logger(s.ctx, operations.TransferError, pair.Src, pair.Dst, err)
@@ -415,7 +423,7 @@ func (s *syncCopyMove) pairChecker(in *pipe, out *pipe, fraction int, wg *sync.W
 					}
 					// If destination already exists, then we must move it into --backup-dir if required
 					if pair.Dst != nil && s.backupDir != nil {
-						err := operations.MoveBackupDir(s.ctx, s.backupDir, pair.Dst)
+						err := operations.MoveBackupDirTrash(s.ctx, s.backupDir, pair.Dst, s.trashDir)
 						if err != nil {
 							s.processError(err)
 							s.logger(s.ctx, operations.TransferError, pair.Src, pair.Dst, err)
@@ -596,7 +604,7 @@ func (s *syncCopyMove) startDeleters() {
 	s.deletersWg.Add(1)
 	go func() {
 		defer s.deletersWg.Done()
-		err := operations.DeleteFilesWithBackupDir(s.ctx, s.deleteFilesCh, s.backupDir)
+		err := operations.DeleteFilesWithBackupDirTrash(s.ctx, s.deleteFilesCh, s.backupDir, s.trashDir)
 		s.processError(err)
 	}()
 }
@@ -653,7 +661,7 @@ func (s *syncCopyMove) deleteFiles(checkSrcMap bool) error {
 		}
 		close(toDelete)
 	}()
-	return operations.DeleteFilesWithBackupDir(s.ctx, toDelete, s.backupDir)
+	return operations.DeleteFilesWithBackupDirTrash(s.ctx, toDelete, s.backupDir, s.trashDir)
 }
 
 // This deletes the empty directories in the slice passed in.  It
@@ -1242,7 +1250,7 @@ func (s *syncCopyMove) SrcOnly(src fs.DirEntry) (recurse bool) {
 			}
 		} else {
 			// Check CompareDest && CopyDest
-			NoNeedTransfer, err := operations.CompareOrCopyDest(s.ctx, s.fdst, nil, x, s.compareCopyDest, s.backupDir)
+			NoNeedTransfer, err := operations.CompareOrCopyDestTrash(s.ctx, s.fdst, nil, x, s.compareCopyDest, s.backupDir, s.trashDir)
 			if err != nil {
 				s.processError(err)
 				s.logger(s.ctx, operations.TransferError, x, nil, err)
@@ -1340,8 +1348,21 @@ func (s *syncCopyMove) Match(ctx context.Context, dst, src fs.DirEntry) (recurse
 // If DoMove is true then files will be moved instead of copied.
 //
 // dir is the start directory, "" for root
-func runSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, deleteEmptySrcDirs bool, copyEmptySrcDirs bool, allowOverlap bool) error {
+func runSyncCopyMove(ctx context.Context, fdst, fsrc fs.Fs, deleteMode fs.DeleteMode, DoMove bool, deleteEmptySrcDirs bool, copyEmptySrcDirs bool, allowOverlap bool) (err error) {
 	ci := fs.GetConfig(ctx)
+	operation := "copy"
+	if DoMove {
+		operation = "move"
+	} else if deleteMode != fs.DeleteModeOff {
+		operation = "sync"
+	}
+	ctx, span := tracing.Start(ctx, operation,
+		tracing.String("rclone.src", fs.ConfigString(fsrc)),
+		tracing.String("rclone.dst", fs.ConfigString(fdst)),
+	)
+	defer func() {
+		span.End(err)
+	}()
 	if deleteMode != fs.DeleteModeOff && DoMove {
 		return fserrors.FatalError(errors.New("can't delete and move at the same time"))
 	}
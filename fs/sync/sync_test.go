@@ -2368,6 +2368,70 @@ func TestSyncCopyDest(t *testing.T) {
 	r.CheckRemoteItems(t, file2, file2dst, file3, file4, file4dst, file6, file7dst)
 }
 
+func TestSyncLinkDest(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	if r.Fremote.Features().Link == nil && r.Fremote.Features().Copy == nil {
+		t.Skip("Skipping test as remote does not support hard links or server-side copy")
+	}
+
+	ci.LinkDest = []string{r.FremoteName + "/LinkDest"}
+
+	fdst, err := fs.NewFs(ctx, r.FremoteName+"/dst")
+	require.NoError(t, err)
+
+	// previous snapshot with one unchanged and one changed file
+	file1 := r.WriteObject(ctx, "LinkDest/one", "one", t1)
+	file2 := r.WriteObject(ctx, "LinkDest/two", "two", t1)
+	file3 := r.WriteFile("one", "one", t1)
+	file4 := r.WriteFile("two", "twot2", t2)
+	file5 := r.WriteFile("three", "three", t2)
+	r.CheckRemoteItems(t, file1, file2)
+	r.CheckLocalItems(t, file3, file4, file5)
+
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, fdst, r.Flocal, false)
+	require.NoError(t, err)
+
+	file1dst := file1
+	file1dst.Path = "dst/one"
+	file4dst := file4
+	file4dst.Path = "dst/two"
+	file5dst := file5
+	file5dst.Path = "dst/three"
+
+	r.CheckRemoteItems(t, file1, file2, file1dst, file4dst, file5dst)
+
+	assert.Equal(t, int64(3), accounting.GlobalStats().GetTransfers())
+
+	// running again makes no changes
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, fdst, r.Flocal, false)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), accounting.GlobalStats().GetTransfers())
+
+	r.CheckRemoteItems(t, file1, file2, file1dst, file4dst, file5dst)
+
+	// check old dest, new link, backup-dir
+	ci.BackupDir = r.FremoteName + "/BackupDir"
+
+	file6 := r.WriteObject(ctx, "dst/two", "twot3", t3)
+	file4b := r.WriteFile("two", "two", t1)
+	r.CheckLocalItems(t, file3, file4b, file5)
+
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, fdst, r.Flocal, false)
+	require.NoError(t, err)
+
+	file2dst := file2
+	file2dst.Path = "dst/two"
+	file6.Path = "BackupDir/two"
+
+	r.CheckRemoteItems(t, file1, file2, file1dst, file2dst, file5dst, file6)
+}
+
 // Test with BackupDir set
 func testSyncBackupDir(t *testing.T, backupDir string, suffix string, suffixKeepExtension bool) {
 	ctx := context.Background()
@@ -2465,6 +2529,54 @@ func TestSyncBackupDirWithSuffixKeepExtension(t *testing.T) {
 	testSyncBackupDir(t, "backup", "-2019-01-01", true)
 }
 
+func TestSyncTrashDir(t *testing.T) {
+	ctx := context.Background()
+	ctx, ci := fs.AddConfig(ctx)
+	r := fstest.NewRun(t)
+
+	if !operations.CanServerSideMove(r.Fremote) {
+		t.Skip("Skipping test as remote does not support server-side move")
+	}
+	r.Mkdir(ctx, r.Fremote)
+	ci.TrashDir = r.FremoteName + "/trash"
+
+	// one is overwritten, two is unchanged and three is deleted
+	r.WriteObject(ctx, "dst/one", "one", t1)
+	r.WriteObject(ctx, "dst/two", "two", t1)
+	r.WriteObject(ctx, "dst/three", "three", t1)
+	r.WriteFile("two", "two", t1)
+	r.WriteFile("one", "oneA", t2)
+
+	fdst, err := fs.NewFs(ctx, r.FremoteName+"/dst")
+	require.NoError(t, err)
+	accounting.GlobalStats().ResetCounters()
+	err = Sync(ctx, fdst, r.Flocal, false)
+	require.NoError(t, err)
+
+	ftrash, err := fs.NewFs(ctx, ci.TrashDir)
+	require.NoError(t, err)
+	items, err := operations.ListTrash(ctx, ftrash)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	reasons := map[string]string{}
+	for _, item := range items {
+		reasons[item.Path] = item.Reason
+		assert.Equal(t, fs.ConfigString(fdst), item.Root)
+	}
+	assert.Equal(t, map[string]string{
+		"one":   operations.TrashReasonOverwritten,
+		"three": operations.TrashReasonDeleted,
+	}, reasons)
+
+	// Restoring puts the old files back
+	for _, item := range items {
+		require.NoError(t, operations.RestoreTrash(ctx, ftrash, item))
+	}
+	o, err := fdst.NewObject(ctx, "three")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), o.Size())
+}
+
 func TestSyncBackupDirSuffixOnly(t *testing.T) {
 	testSyncBackupDir(t, "", ".bak", false)
 }
@@ -43,6 +43,41 @@ Use ` + "`--{{ .Prefix }}realm`" + ` to set the authentication realm.
 
 Use ` + "`--{{ .Prefix }}salt`" + ` to change the password hashing salt from the default.
 
+##### JWT bearer tokens
+
+Use ` + "`--{{ .Prefix }}jwt-jwks /path/to/jwks.json`" + ` to accept JWT bearer tokens, for
+example from an OpenID Connect provider, in the ` + "`Authorization: Bearer`" + `
+header. The file should contain the JSON Web Key Set with the public
+keys the tokens are signed with, as published at the ` + "`jwks_uri`" + ` of the
+provider. RSA, ECDSA and Ed25519 keys are supported and the file is
+read again if it changes while rclone is running.
+
+The token must not have expired and, if set, must have the issuer given
+by ` + "`--{{ .Prefix }}jwt-issuer`" + ` and the audience given by ` + "`--{{ .Prefix }}jwt-audience`" + `.
+The user name is read from the claim set by ` + "`--{{ .Prefix }}jwt-user-claim`" + `
+(default ` + "`sub`" + `) and the user's groups from the claim set by
+` + "`--{{ .Prefix }}jwt-groups-claim`" + ` (default ` + "`groups`" + `).
+
+##### LDAP
+
+Use ` + "`--{{ .Prefix }}ldap-url`" + ` to check basic authentication user names and
+passwords by binding to an LDAP server, eg ` + "`ldaps://ldap.example.com`" + `.
+The DN to bind as is made from ` + "`--{{ .Prefix }}ldap-bind-dn`" + ` by replacing ` + "`{user}`" + `
+with the user name, eg ` + "`uid={user},ou=people,dc=example,dc=com`" + `.
+
+To find the user's groups set ` + "`--{{ .Prefix }}ldap-group-base-dn`" + ` to the DN to
+search under. Groups are found with ` + "`--{{ .Prefix }}ldap-group-filter`" + `, a filter of
+the form ` + "`(attribute=value)`" + ` where ` + "`{dn}`" + ` and ` + "`{user}`" + ` are replaced with the
+user's DN and name (default ` + "`(member={dn})`" + `), and named by their ` + "`cn`" + `.
+
+Successful LDAP logins are cached for 5 minutes, so a changed password
+or a removed user takes up to 5 minutes to be noticed.
+
+If JWT or LDAP authentication is configured it is used instead of the
+htpasswd file or single user. If the auth proxy is in use then the
+user, groups and claims are passed to it to choose the backend for
+each user - see the auth proxy section below.
+
 `
 	tmpl, err := template.New("auth help").Parse(help)
 	if err != nil {
@@ -68,6 +103,20 @@ Use ` + "`--{{ .Prefix }}salt`" + ` to change the password hashing salt from the
 // If a non nil value is returned then it is added to the context under the key
 type CustomAuthFn func(user, pass string) (value any, err error)
 
+// Identity describes a user authenticated by a JWT bearer token or LDAP
+type Identity struct {
+	User   string         `json:"user"`             // user name
+	Groups []string       `json:"groups,omitempty"` // groups the user is a member of
+	Claims map[string]any `json:"claims,omitempty"` // claims from the JWT if used
+}
+
+// IdentityAuthFn if used will be called with the identity of users
+// authenticated by a JWT bearer token or LDAP. If an error is returned
+// then the user is not authenticated.
+//
+// If a non nil value is returned then it is added to the context under the key
+type IdentityAuthFn func(id *Identity) (value any, err error)
+
 // AuthConfigInfo descripts the Options in use
 var AuthConfigInfo = fs.Options{{
 	Name:    "htpasswd",
@@ -93,17 +142,63 @@ var AuthConfigInfo = fs.Options{{
 	Name:    "user_from_header",
 	Default: "",
 	Help:    "User name from a defined HTTP header",
+}, {
+	Name:    "jwt_jwks",
+	Default: "",
+	Help:    "A JWKS file with the keys to validate JWT bearer tokens",
+}, {
+	Name:    "jwt_issuer",
+	Default: "",
+	Help:    "Issuer JWT bearer tokens must have",
+}, {
+	Name:    "jwt_audience",
+	Default: "",
+	Help:    "Audience JWT bearer tokens must have",
+}, {
+	Name:    "jwt_user_claim",
+	Default: "sub",
+	Help:    "JWT claim to use as the user name",
+}, {
+	Name:    "jwt_groups_claim",
+	Default: "groups",
+	Help:    "JWT claim to read the user's groups from",
+}, {
+	Name:    "ldap_url",
+	Default: "",
+	Help:    "URL of an LDAP server to check passwords with",
+}, {
+	Name:    "ldap_bind_dn",
+	Default: "",
+	Help:    "DN to bind to LDAP as - {user} is replaced with the user name",
+}, {
+	Name:    "ldap_group_base_dn",
+	Default: "",
+	Help:    "DN to search under for the user's LDAP groups",
+}, {
+	Name:    "ldap_group_filter",
+	Default: "(member={dn})",
+	Help:    "Filter to find the user's LDAP groups with",
 }}
 
 // AuthConfig contains options for the http authentication
 type AuthConfig struct {
-	HtPasswd       string       `config:"htpasswd"`         // htpasswd file - if not provided no authentication is done
-	Realm          string       `config:"realm"`            // realm for authentication
-	BasicUser      string       `config:"user"`             // single username for basic auth if not using Htpasswd
-	BasicPass      string       `config:"pass"`             // password for BasicUser
-	Salt           string       `config:"salt"`             // password hashing salt
-	UserFromHeader string       `config:"user_from_header"` // retrieve user name from a defined HTTP header
-	CustomAuthFn   CustomAuthFn `json:"-" config:"-"`       // custom Auth (not set by command line flags)
+	HtPasswd        string         `config:"htpasswd"`           // htpasswd file - if not provided no authentication is done
+	Realm           string         `config:"realm"`              // realm for authentication
+	BasicUser       string         `config:"user"`               // single username for basic auth if not using Htpasswd
+	BasicPass       string         `config:"pass"`               // password for BasicUser
+	Salt            string         `config:"salt"`               // password hashing salt
+	UserFromHeader  string         `config:"user_from_header"`   // retrieve user name from a defined HTTP header
+	JWTJWKS         string         `config:"jwt_jwks"`           // JWKS file to validate JWT bearer tokens with
+	JWTIssuer       string         `config:"jwt_issuer"`         // issuer JWT bearer tokens must have
+	JWTAudience     string         `config:"jwt_audience"`       // audience JWT bearer tokens must have
+	JWTUserClaim    string         `config:"jwt_user_claim"`     // JWT claim to use as the user name
+	JWTGroupsClaim  string         `config:"jwt_groups_claim"`   // JWT claim to read the groups from
+	LDAPURL         string         `config:"ldap_url"`           // URL of the LDAP server
+	LDAPBindDN      string         `config:"ldap_bind_dn"`       // DN to bind as with {user} replaced
+	LDAPGroupBaseDN string         `config:"ldap_group_base_dn"` // DN to search for groups under
+	LDAPGroupFilter string         `config:"ldap_group_filter"`  // filter to find groups with
+	CustomAuthFn    CustomAuthFn   `json:"-" config:"-"`         // custom Auth (not set by command line flags)
+	IdentityAuthFn  IdentityAuthFn `json:"-" config:"-"`         // custom Auth for JWT and LDAP users (not set by command line flags)
 }
 
 // AddFlagsPrefix adds flags to the flag set for AuthConfig
@@ -114,6 +209,15 @@ func (cfg *AuthConfig) AddFlagsPrefix(flagSet *pflag.FlagSet, prefix string) {
 	flags.StringVarP(flagSet, &cfg.BasicPass, prefix+"pass", "", cfg.BasicPass, "Password for authentication", prefix)
 	flags.StringVarP(flagSet, &cfg.Salt, prefix+"salt", "", cfg.Salt, "Password hashing salt", prefix)
 	flags.StringVarP(flagSet, &cfg.UserFromHeader, prefix+"user-from-header", "", cfg.UserFromHeader, "Retrieve the username from a specified HTTP header if no other authentication methods are configured (ideal for proxied setups)", prefix)
+	flags.StringVarP(flagSet, &cfg.JWTJWKS, prefix+"jwt-jwks", "", cfg.JWTJWKS, "A JWKS file with the keys to validate JWT bearer tokens", prefix)
+	flags.StringVarP(flagSet, &cfg.JWTIssuer, prefix+"jwt-issuer", "", cfg.JWTIssuer, "Issuer JWT bearer tokens must have", prefix)
+	flags.StringVarP(flagSet, &cfg.JWTAudience, prefix+"jwt-audience", "", cfg.JWTAudience, "Audience JWT bearer tokens must have", prefix)
+	flags.StringVarP(flagSet, &cfg.JWTUserClaim, prefix+"jwt-user-claim", "", cfg.JWTUserClaim, "JWT claim to use as the user name", prefix)
+	flags.StringVarP(flagSet, &cfg.JWTGroupsClaim, prefix+"jwt-groups-claim", "", cfg.JWTGroupsClaim, "JWT claim to read the user's groups from", prefix)
+	flags.StringVarP(flagSet, &cfg.LDAPURL, prefix+"ldap-url", "", cfg.LDAPURL, "URL of an LDAP server to check passwords with", prefix)
+	flags.StringVarP(flagSet, &cfg.LDAPBindDN, prefix+"ldap-bind-dn", "", cfg.LDAPBindDN, "DN to bind to LDAP as - {user} is replaced with the user name", prefix)
+	flags.StringVarP(flagSet, &cfg.LDAPGroupBaseDN, prefix+"ldap-group-base-dn", "", cfg.LDAPGroupBaseDN, "DN to search under for the user's LDAP groups", prefix)
+	flags.StringVarP(flagSet, &cfg.LDAPGroupFilter, prefix+"ldap-group-filter", "", cfg.LDAPGroupFilter, "Filter to find the user's LDAP groups with", prefix)
 }
 
 // AddAuthFlagsPrefix adds flags to the flag set for AuthConfig
@@ -127,6 +231,9 @@ func AddAuthFlagsPrefix(flagSet *pflag.FlagSet, prefix string, cfg *AuthConfig)
 // can be removed when all callers have been converted.
 func DefaultAuthCfg() AuthConfig {
 	return AuthConfig{
-		Salt: "dlPL2MqE",
+		Salt:            "dlPL2MqE",
+		JWTUserClaim:    "sub",
+		JWTGroupsClaim:  "groups",
+		LDAPGroupFilter: "(member={dn})",
 	}
 }
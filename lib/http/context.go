@@ -13,6 +13,7 @@ const (
 	ctxKeyPublicURL
 	ctxKeyUnixSock
 	ctxKeyUser
+	ctxKeyIdentity
 )
 
 // NewBaseContext initializes the context for all requests, adding info for use in middleware and handlers
@@ -53,6 +54,14 @@ func CtxGetUser(ctx context.Context) (string, bool) {
 	return v, ok
 }
 
+// CtxGetIdentity is a wrapper over the private Identity context key
+//
+// This is only set for users authenticated by a JWT bearer token or LDAP.
+func CtxGetIdentity(ctx context.Context) (*Identity, bool) {
+	v, ok := ctx.Value(ctxKeyIdentity).(*Identity)
+	return v, ok
+}
+
 // CtxSetUser is a test helper that injects a User value into context
 func CtxSetUser(ctx context.Context, value string) context.Context {
 	return context.WithValue(ctx, ctxKeyUser, value)
@@ -0,0 +1,265 @@
+package http
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/rclone/rclone/fs"
+)
+
+// jwk is a single key in a JSON Web Key Set as defined in RFC 7517
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// decode a base64url encoded big endian number
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// publicKey returns the public key described by the jwk
+func (k *jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("bad modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("bad exponent: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var ecdhCurve ecdh.Curve
+		switch k.Crv {
+		case "P-256":
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("bad x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("bad y: %w", err)
+		}
+		// Check the point is on the curve
+		size := (curve.Params().BitSize + 7) / 8
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		x.FillBytes(point[1 : 1+size])
+		y.FillBytes(point[1+size:])
+		if _, err := ecdhCurve.NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("invalid key: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("bad x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("bad key length")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// parseJWKS parses a JSON Web Key Set returning the signing keys in it
+// indexed by key ID
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+	err := json.Unmarshal(data, &jwks)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]crypto.PublicKey, len(jwks.Keys))
+	for i := range jwks.Keys {
+		k := &jwks.Keys[i]
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %d %q: %w", i, k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no signing keys found")
+	}
+	return keys, nil
+}
+
+// jwtAuth validates JWT bearer tokens with the keys in a JWKS file
+type jwtAuth struct {
+	path        string
+	issuer      string
+	audience    string
+	userClaim   string
+	groupsClaim string
+	parser      *jwt.Parser
+
+	mu      sync.Mutex
+	modTime time.Time                   // modification time of path when keys were read
+	keys    map[string]crypto.PublicKey // keys indexed by key ID
+}
+
+// newJWTAuth makes a jwtAuth from the config, reading the JWKS file
+func newJWTAuth(cfg *AuthConfig) (*jwtAuth, error) {
+	a := &jwtAuth{
+		path:        cfg.JWTJWKS,
+		issuer:      cfg.JWTIssuer,
+		audience:    cfg.JWTAudience,
+		userClaim:   cfg.JWTUserClaim,
+		groupsClaim: cfg.JWTGroupsClaim,
+		// Only allow asymmetric algorithms as we only have public keys
+		parser: jwt.NewParser(jwt.WithValidMethods([]string{
+			"RS256", "RS384", "RS512",
+			"PS256", "PS384", "PS512",
+			"ES256", "ES384", "ES512",
+			"EdDSA",
+		})),
+	}
+	if a.userClaim == "" {
+		a.userClaim = "sub"
+	}
+	_, err := a.getKeys()
+	if err != nil {
+		return nil, err
+	}
+	fs.Infof(nil, "Using %q to validate JWT bearer tokens", a.path)
+	return a, nil
+}
+
+// getKeys returns the keys, reading the JWKS file again if it has changed
+func (a *jwtAuth) getKeys() (map[string]crypto.PublicKey, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	fi, err := os.Stat(a.path)
+	if err != nil {
+		if a.keys != nil {
+			fs.Errorf(nil, "Failed to read JWKS file - using previous keys: %v", err)
+			return a.keys, nil
+		}
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	if a.keys != nil && fi.ModTime().Equal(a.modTime) {
+		return a.keys, nil
+	}
+	data, err := os.ReadFile(a.path)
+	if err == nil {
+		var keys map[string]crypto.PublicKey
+		keys, err = parseJWKS(data)
+		if err == nil {
+			a.keys = keys
+			a.modTime = fi.ModTime()
+			return a.keys, nil
+		}
+	}
+	if a.keys != nil {
+		fs.Errorf(nil, "Failed to read JWKS file %q - using previous keys: %v", a.path, err)
+		return a.keys, nil
+	}
+	return nil, fmt.Errorf("failed to read JWKS file %q: %w", a.path, err)
+}
+
+// keyFunc finds the key to validate token with
+func (a *jwtAuth) keyFunc(token *jwt.Token) (any, error) {
+	keys, err := a.getKeys()
+	if err != nil {
+		return nil, err
+	}
+	kid, _ := token.Header["kid"].(string)
+	if key, ok := keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("key %q not found", kid)
+}
+
+// authenticate validates the bearer token returning the identity of
+// the user in it
+func (a *jwtAuth) authenticate(tokenString string) (*Identity, error) {
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(tokenString, claims, a.keyFunc)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("token has no expiry")
+	}
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return nil, errors.New("token has wrong issuer")
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return nil, errors.New("token has wrong audience")
+	}
+	user, _ := claims[a.userClaim].(string)
+	if user == "" {
+		return nil, fmt.Errorf("token has no %q claim", a.userClaim)
+	}
+	id := &Identity{
+		User:   user,
+		Claims: claims,
+	}
+	switch groups := claims[a.groupsClaim].(type) {
+	case string:
+		id.Groups = []string{groups}
+	case []any:
+		for _, group := range groups {
+			if group, ok := group.(string); ok {
+				id.Groups = append(id.Groups, group)
+			}
+		}
+	}
+	return id, nil
+}
@@ -0,0 +1,193 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testJWKS holds keys for testing JWT authentication
+type testJWKS struct {
+	path       string
+	rsaKey     *rsa.PrivateKey
+	ecKey      *ecdsa.PrivateKey
+	ed25519Key ed25519.PrivateKey
+}
+
+// newTestJWKS makes keys and writes a JWKS file for them
+func newTestJWKS(t *testing.T) *testJWKS {
+	var k testJWKS
+	var err error
+	k.rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	k.ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, k.ed25519Key, err = ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	x, y := make([]byte, 32), make([]byte, 32)
+	k.ecKey.X.FillBytes(x)
+	k.ecKey.Y.FillBytes(y)
+	jwks := map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "rsa",
+			"use": "sig",
+			"n":   b64(k.rsaKey.N.Bytes()),
+			"e":   b64(big.NewInt(int64(k.rsaKey.E)).Bytes()),
+		}, {
+			"kty": "EC",
+			"kid": "ec",
+			"crv": "P-256",
+			"x":   b64(x),
+			"y":   b64(y),
+		}, {
+			"kty": "OKP",
+			"kid": "ed25519",
+			"crv": "Ed25519",
+			"x":   b64(k.ed25519Key.Public().(ed25519.PublicKey)),
+		}, {
+			"kty": "RSA",
+			"kid": "enc",
+			"use": "enc",
+		}},
+	}
+	data, err := json.Marshal(jwks)
+	require.NoError(t, err)
+	k.path = filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(k.path, data, 0666))
+	return &k
+}
+
+// sign makes a token with claims signed by the key with kid
+func (k *testJWKS) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	var method jwt.SigningMethod
+	var key any
+	switch kid {
+	case "rsa":
+		method, key = jwt.SigningMethodRS256, k.rsaKey
+	case "ec":
+		method, key = jwt.SigningMethodES256, k.ecKey
+	case "ed25519":
+		method, key = jwt.SigningMethodEdDSA, k.ed25519Key
+	case "hmac":
+		method, key = jwt.SigningMethodHS256, []byte("secret")
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	s, err := token.SignedString(key)
+	require.NoError(t, err)
+	return s
+}
+
+func TestParseJWKS(t *testing.T) {
+	for _, test := range []struct {
+		in      string
+		wantErr string
+	}{
+		{`{"keys": []}`, "no signing keys found"},
+		{`{"keys": [{"kty": "oct", "k": "c2VjcmV0"}]}`, `unsupported key type "oct"`},
+		{`{"keys": [{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}]}`, "invalid key"},
+		{`{"keys": [{"kty": "OKP", "crv": "X25519", "x": "AQ"}]}`, `unsupported curve "X25519"`},
+		{`{"keys": [{"kty": "RSA", "n": "!", "e": "AQAB"}]}`, "bad modulus"},
+		{`potato`, "invalid character"},
+	} {
+		_, err := parseJWKS([]byte(test.in))
+		assert.ErrorContains(t, err, test.wantErr, test.in)
+	}
+}
+
+func TestJWTAuth(t *testing.T) {
+	k := newTestJWKS(t)
+	a, err := newJWTAuth(&AuthConfig{
+		JWTJWKS:        k.path,
+		JWTIssuer:      "https://issuer.example.com",
+		JWTAudience:    "rclone",
+		JWTUserClaim:   "email",
+		JWTGroupsClaim: "roles",
+	})
+	require.NoError(t, err)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	good := jwt.MapClaims{
+		"email": "user@example.com",
+		"roles": []string{"staff", "admins"},
+		"iss":   "https://issuer.example.com",
+		"aud":   []string{"other", "rclone"},
+		"exp":   exp,
+	}
+	with := func(key string, value any) jwt.MapClaims {
+		claims := jwt.MapClaims{}
+		for k, v := range good {
+			claims[k] = v
+		}
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	for _, kid := range []string{"rsa", "ec", "ed25519"} {
+		id, err := a.authenticate(k.sign(t, kid, good))
+		require.NoError(t, err, kid)
+		assert.Equal(t, "user@example.com", id.User)
+		assert.Equal(t, []string{"staff", "admins"}, id.Groups)
+		assert.Equal(t, "https://issuer.example.com", id.Claims["iss"])
+	}
+
+	for _, test := range []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"expired", k.sign(t, "rsa", with("exp", time.Now().Add(-time.Minute).Unix())), "expired"},
+		{"no expiry", k.sign(t, "rsa", with("exp", nil)), "no expiry"},
+		{"issuer", k.sign(t, "rsa", with("iss", "https://evil.example.com")), "wrong issuer"},
+		{"audience", k.sign(t, "rsa", with("aud", "other")), "wrong audience"},
+		{"user", k.sign(t, "rsa", with("email", nil)), `no "email" claim`},
+		{"hmac", k.sign(t, "hmac", good), "signing method HS256 is invalid"},
+		{"unknown key", k.sign(t, "ec", good)[:10] + "garbage", "invalid"},
+	} {
+		_, err := a.authenticate(test.token)
+		assert.ErrorContains(t, err, test.wantErr, test.name)
+	}
+
+	// A token signed by one key with the kid of another fails
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, good)
+	token.Header["kid"] = "ec"
+	s, err := token.SignedString(k.rsaKey)
+	require.NoError(t, err)
+	_, err = a.authenticate(s)
+	assert.Error(t, err)
+
+	// The keys are read again if the file changes
+	k2 := newTestJWKS(t)
+	data, err := os.ReadFile(k2.path)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(k.path, data, 0666))
+	require.NoError(t, os.Chtimes(k.path, time.Now(), time.Now().Add(time.Minute)))
+	_, err = a.authenticate(k.sign(t, "rsa", good))
+	assert.Error(t, err)
+	_, err = a.authenticate(k2.sign(t, "rsa", good))
+	assert.NoError(t, err)
+
+	// Missing file
+	_, err = newJWTAuth(&AuthConfig{JWTJWKS: filepath.Join(t.TempDir(), "missing.json")})
+	assert.ErrorContains(t, err, "failed to read JWKS file")
+}
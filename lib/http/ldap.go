@@ -0,0 +1,453 @@
+package http
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	libcache "github.com/rclone/rclone/lib/cache"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// LDAP protocol op tags from RFC 4511
+const (
+	ldapBindRequest    = 0x60
+	ldapBindResponse   = 0x61
+	ldapUnbindRequest  = 0x42
+	ldapSearchRequest  = 0x63
+	ldapSearchEntry    = 0x64
+	ldapSearchDone     = 0x65
+	ldapSearchRef      = 0x73
+	ldapMaxMessageSize = 16 * 1024 * 1024
+	ldapTimeout        = 30 * time.Second
+	ldapCacheTime      = 5 * time.Minute // how long a login is cached for
+)
+
+var (
+	errBER             = errors.New("ldap: malformed BER in response")
+	ldapGroupFilterRe  = regexp.MustCompile(`^\(([A-Za-z][\w.;-]*)=([^()]*)\)$`)
+	errLDAPNoPassword  = errors.New("ldap: empty password")
+	errLDAPInvalidUser = errors.New("ldap: invalid user name")
+)
+
+// ldapAuth checks user names and passwords by binding to an LDAP server
+type ldapAuth struct {
+	url         *url.URL
+	bindDN      string // DN to bind as with {user} in
+	groupBaseDN string // DN to search for groups under, if set
+	groupAttr   string // attribute to match groups with
+	groupValue  string // value to match with {dn} and {user} in
+	cache       *libcache.Cache
+}
+
+// ldapCacheEntry is stored in the cache of successful logins
+//
+// The cache expires entries which haven't been used recently so the
+// time of the login is stored too, otherwise a password which is in
+// use would never be checked with the server again.
+type ldapCacheEntry struct {
+	id     *Identity
+	pwHash [sha256.Size]byte
+	when   time.Time // when the login was checked with the server
+}
+
+// newLDAPAuth makes an ldapAuth from the config
+func newLDAPAuth(cfg *AuthConfig) (*ldapAuth, error) {
+	u, err := url.Parse(cfg.LDAPURL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: bad URL: %w", err)
+	}
+	if u.Scheme != "ldap" && u.Scheme != "ldaps" {
+		return nil, fmt.Errorf("ldap: URL scheme must be ldap or ldaps not %q", u.Scheme)
+	}
+	if u.Scheme == "ldap" {
+		fs.Logf(nil, "Warning: LDAP passwords will be sent unencrypted to %q - use ldaps:// to encrypt them", u.Host)
+	}
+	if !strings.Contains(cfg.LDAPBindDN, "{user}") {
+		return nil, errors.New("ldap: bind DN must contain {user}")
+	}
+	a := &ldapAuth{
+		url:         u,
+		bindDN:      cfg.LDAPBindDN,
+		groupBaseDN: cfg.LDAPGroupBaseDN,
+		cache:       libcache.New(),
+	}
+	if a.groupBaseDN != "" {
+		filter := cfg.LDAPGroupFilter
+		if filter == "" {
+			filter = "(member={dn})"
+		}
+		match := ldapGroupFilterRe.FindStringSubmatch(filter)
+		if match == nil {
+			return nil, fmt.Errorf("ldap: group filter must be of the form (attribute=value) not %q", filter)
+		}
+		a.groupAttr, a.groupValue = match[1], match[2]
+	}
+	fs.Infof(nil, "Using LDAP server %q for authentication", u.Host)
+	return a, nil
+}
+
+// escape a value for use in a DN as described in RFC 4514
+func escapeDN(s string) string {
+	var out strings.Builder
+	for i, c := range s {
+		switch {
+		case strings.ContainsRune(`,+"\<>;=`, c),
+			(c == ' ' || c == '#') && i == 0,
+			c == ' ' && i == len(s)-1:
+			out.WriteByte('\\')
+		case c == 0:
+			out.WriteString(`\00`)
+			continue
+		}
+		out.WriteRune(c)
+	}
+	return out.String()
+}
+
+// authenticate checks user and pass with the LDAP server returning the
+// identity of the user
+func (a *ldapAuth) authenticate(user, pass string) (*Identity, error) {
+	if !validUsernameRegexp.MatchString(user) {
+		return nil, errLDAPInvalidUser
+	}
+	// An empty password does an unauthenticated bind which succeeds
+	if pass == "" {
+		return nil, errLDAPNoPassword
+	}
+	pwHash := sha256.Sum256([]byte(pass))
+	if value, ok := a.cache.GetMaybe(user); ok {
+		entry := value.(ldapCacheEntry)
+		if time.Since(entry.when) < ldapCacheTime && subtle.ConstantTimeCompare(pwHash[:], entry.pwHash[:]) == 1 {
+			return entry.id, nil
+		}
+	}
+	c, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer c.close()
+	dn := strings.ReplaceAll(a.bindDN, "{user}", escapeDN(user))
+	err = c.bind(dn, pass)
+	if err != nil {
+		return nil, err
+	}
+	id := &Identity{User: user}
+	if a.groupBaseDN != "" {
+		value := strings.ReplaceAll(a.groupValue, "{dn}", dn)
+		value = strings.ReplaceAll(value, "{user}", user)
+		id.Groups, err = c.searchGroups(a.groupBaseDN, a.groupAttr, value)
+		if err != nil {
+			return nil, err
+		}
+	}
+	a.cache.Put(user, ldapCacheEntry{id: id, pwHash: pwHash, when: time.Now()})
+	return id, nil
+}
+
+// ldapConn is a connection to an LDAP server
+type ldapConn struct {
+	conn  net.Conn
+	r     *bufio.Reader
+	msgID int64
+}
+
+// dial the LDAP server
+func (a *ldapAuth) dial() (*ldapConn, error) {
+	host := a.url.Host
+	if a.url.Port() == "" {
+		if a.url.Scheme == "ldaps" {
+			host = net.JoinHostPort(a.url.Hostname(), "636")
+		} else {
+			host = net.JoinHostPort(a.url.Hostname(), "389")
+		}
+	}
+	dialer := &net.Dialer{Timeout: ldapTimeout}
+	var conn net.Conn
+	var err error
+	if a.url.Scheme == "ldaps" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: a.url.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ldap: failed to connect: %w", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(ldapTimeout))
+	return &ldapConn{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// close the connection, unbinding first
+func (c *ldapConn) close() {
+	_ = c.send(func(b *cryptobyte.Builder) {
+		b.AddASN1(asn1.Tag(ldapUnbindRequest), func(b *cryptobyte.Builder) {})
+	})
+	_ = c.conn.Close()
+}
+
+// send an LDAP message with the protocol op added by op
+func (c *ldapConn) send(op func(b *cryptobyte.Builder)) error {
+	c.msgID++
+	var b cryptobyte.Builder
+	b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Int64(c.msgID)
+		op(b)
+	})
+	data, err := b.Bytes()
+	if err != nil {
+		return fmt.Errorf("ldap: failed to encode message: %w", err)
+	}
+	_, err = c.conn.Write(data)
+	if err != nil {
+		return fmt.Errorf("ldap: failed to send message: %w", err)
+	}
+	return nil
+}
+
+// receive an LDAP message for the last request sent returning the tag
+// and contents of its protocol op
+func (c *ldapConn) receive() (tag byte, contents []byte, err error) {
+	for {
+		message, err := readBER(c.r)
+		if err != nil {
+			return 0, nil, err
+		}
+		tag, contents, rest, err := berNext(message)
+		if err != nil || tag != 0x30 || len(rest) != 0 {
+			return 0, nil, errBER
+		}
+		tag, id, rest, err := berNext(contents)
+		if err != nil || tag != 0x02 {
+			return 0, nil, errBER
+		}
+		tag, contents, _, err = berNext(rest)
+		if err != nil {
+			return 0, nil, err
+		}
+		// Ignore unsolicited notifications and replies to other messages
+		if berInt(id) != c.msgID {
+			continue
+		}
+		return tag, contents, nil
+	}
+}
+
+// check the LDAPResult in contents
+func ldapResult(contents []byte) error {
+	tag, code, rest, err := berNext(contents)
+	if err != nil || tag != 0x0a {
+		return errBER
+	}
+	_, _, rest, err = berNext(rest) // matchedDN
+	if err != nil {
+		return err
+	}
+	_, message, _, err := berNext(rest)
+	if err != nil {
+		return err
+	}
+	switch resultCode := berInt(code); resultCode {
+	case 0:
+		return nil
+	case 49:
+		return errors.New("ldap: invalid credentials")
+	default:
+		return fmt.Errorf("ldap: error %d: %s", resultCode, message)
+	}
+}
+
+// bind as dn with password pass
+func (c *ldapConn) bind(dn, pass string) error {
+	err := c.send(func(b *cryptobyte.Builder) {
+		b.AddASN1(asn1.Tag(ldapBindRequest), func(b *cryptobyte.Builder) {
+			b.AddASN1Int64(3) // version
+			b.AddASN1OctetString([]byte(dn))
+			b.AddASN1(asn1.Tag(0).ContextSpecific(), func(b *cryptobyte.Builder) {
+				b.AddBytes([]byte(pass))
+			})
+		})
+	})
+	if err != nil {
+		return err
+	}
+	tag, contents, err := c.receive()
+	if err != nil {
+		return err
+	}
+	if tag != ldapBindResponse {
+		return fmt.Errorf("ldap: unexpected response 0x%02x to bind", tag)
+	}
+	return ldapResult(contents)
+}
+
+// searchGroups returns the cn of the groups under base where attr is value
+func (c *ldapConn) searchGroups(base, attr, value string) (groups []string, err error) {
+	err = c.send(func(b *cryptobyte.Builder) {
+		b.AddASN1(asn1.Tag(ldapSearchRequest), func(b *cryptobyte.Builder) {
+			b.AddASN1OctetString([]byte(base))
+			b.AddASN1Enum(2) // scope: wholeSubtree
+			b.AddASN1Enum(0) // derefAliases: neverDerefAliases
+			b.AddASN1Int64(0)
+			b.AddASN1Int64(int64(ldapTimeout / time.Second))
+			b.AddASN1Boolean(false)
+			b.AddASN1(asn1.Tag(3).Constructed().ContextSpecific(), func(b *cryptobyte.Builder) {
+				b.AddASN1OctetString([]byte(attr))
+				b.AddASN1OctetString([]byte(value))
+			})
+			b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+				b.AddASN1OctetString([]byte("cn"))
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tag, contents, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case ldapSearchEntry:
+			cn, err := ldapEntryValues(contents, "cn")
+			if err != nil {
+				return nil, err
+			}
+			groups = append(groups, cn...)
+		case ldapSearchRef:
+		case ldapSearchDone:
+			return groups, ldapResult(contents)
+		default:
+			return nil, fmt.Errorf("ldap: unexpected response 0x%02x to search", tag)
+		}
+	}
+}
+
+// ldapEntryValues returns the values of attribute attr in the
+// SearchResultEntry in contents
+func ldapEntryValues(contents []byte, attr string) (values []string, err error) {
+	_, _, rest, err := berNext(contents) // objectName
+	if err != nil {
+		return nil, err
+	}
+	_, attributes, _, err := berNext(rest)
+	if err != nil {
+		return nil, err
+	}
+	for len(attributes) > 0 {
+		var attribute, name, vals []byte
+		_, attribute, attributes, err = berNext(attributes)
+		if err != nil {
+			return nil, err
+		}
+		_, name, rest, err = berNext(attribute)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(string(name), attr) {
+			continue
+		}
+		_, vals, _, err = berNext(rest)
+		if err != nil {
+			return nil, err
+		}
+		for len(vals) > 0 {
+			var val []byte
+			_, val, vals, err = berNext(vals)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, string(val))
+		}
+	}
+	return values, nil
+}
+
+// berLength decodes the BER length at the start of data returning it
+// and the number of bytes it used
+func berLength(data []byte) (length, n int, err error) {
+	if len(data) == 0 {
+		return 0, 0, errBER
+	}
+	if data[0] < 0x80 {
+		return int(data[0]), 1, nil
+	}
+	// Long form - LDAP only allows definite lengths
+	k := int(data[0] & 0x7f)
+	if k == 0 || k > 4 || len(data) < 1+k {
+		return 0, 0, errBER
+	}
+	for _, c := range data[1 : 1+k] {
+		length = length<<8 | int(c)
+	}
+	return length, 1 + k, nil
+}
+
+// berNext splits the first BER element off data returning its tag,
+// contents and the data after it
+func berNext(data []byte) (tag byte, contents, rest []byte, err error) {
+	if len(data) < 2 || data[0]&0x1f == 0x1f {
+		return 0, nil, nil, errBER
+	}
+	length, n, err := berLength(data[1:])
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	start := 1 + n
+	if length > len(data)-start {
+		return 0, nil, nil, errBER
+	}
+	return data[0], data[start : start+length], data[start+length:], nil
+}
+
+// berInt decodes a BER encoded integer
+func berInt(data []byte) int64 {
+	var i int64
+	for j, c := range data {
+		if j == 0 && c&0x80 != 0 {
+			i = -1
+		}
+		i = i<<8 | int64(c)
+	}
+	return i
+}
+
+// readBER reads a single BER element from r
+func readBER(r *bufio.Reader) ([]byte, error) {
+	header, err := r.Peek(2)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: failed to read response: %w", err)
+	}
+	headerLen := 2
+	if header[1] >= 0x80 {
+		headerLen += int(header[1] & 0x7f)
+	}
+	header, err = r.Peek(headerLen)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: failed to read response: %w", err)
+	}
+	length, _, err := berLength(header[1:])
+	if err != nil {
+		return nil, err
+	}
+	if length > ldapMaxMessageSize {
+		return nil, errors.New("ldap: response too large")
+	}
+	data := make([]byte, headerLen+length)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: failed to read response: %w", err)
+	}
+	return data, nil
+}
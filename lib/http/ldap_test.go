@@ -0,0 +1,243 @@
+package http
+
+import (
+	"bufio"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
+)
+
+// testLDAPServer is a minimal LDAP server for testing
+type testLDAPServer struct {
+	listener net.Listener
+	binds    atomic.Int32
+	users    map[string]string   // passwords indexed by DN
+	groups   map[string][]string // members indexed by group cn
+}
+
+// newTestLDAPServer starts a test LDAP server returning its URL
+func newTestLDAPServer(t *testing.T) (*testLDAPServer, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &testLDAPServer{
+		listener: listener,
+		users: map[string]string{
+			`uid=alice,ou=people,dc=example,dc=com`:    "alicepass",
+			`uid=carol,ou=people,dc=example,dc=com`:    "carolpass",
+			`uid=unknown,ou=people,dc=example,dc=com`:  "",
+			`uid=nogroups,ou=people,dc=example,dc=com`: "nogroupspass",
+		},
+		groups: map[string][]string{
+			"staff":  {"uid=alice,ou=people,dc=example,dc=com", "uid=carol,ou=people,dc=example,dc=com"},
+			"admins": {"uid=alice,ou=people,dc=example,dc=com"},
+		},
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	return s, "ldap://" + listener.Addr().String()
+}
+
+// reply sends a message with id and the protocol op with tag and contents
+func (s *testLDAPServer) reply(conn net.Conn, id int64, tag byte, contents func(b *cryptobyte.Builder)) {
+	var b cryptobyte.Builder
+	b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1Int64(id)
+		b.AddASN1(asn1.Tag(tag), contents)
+	})
+	_, _ = conn.Write(b.BytesOrPanic())
+}
+
+// result adds an LDAPResult with code
+func result(code int64) func(b *cryptobyte.Builder) {
+	return func(b *cryptobyte.Builder) {
+		b.AddASN1Enum(code)
+		b.AddASN1OctetString(nil)
+		b.AddASN1OctetString([]byte("test message"))
+	}
+}
+
+// serve a single connection
+func (s *testLDAPServer) serve(conn net.Conn) {
+	defer func() {
+		_ = conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	for {
+		message, err := readBER(r)
+		if err != nil {
+			return
+		}
+		_, contents, _, _ := berNext(message)
+		_, idBytes, rest, _ := berNext(contents)
+		id := berInt(idBytes)
+		tag, op, _, _ := berNext(rest)
+		switch tag {
+		case ldapBindRequest:
+			s.binds.Add(1)
+			_, _, rest, _ := berNext(op) // version
+			_, dn, rest, _ := berNext(rest)
+			_, pass, _, _ := berNext(rest)
+			code := int64(49)
+			if want, ok := s.users[string(dn)]; ok && want == string(pass) {
+				code = 0
+			}
+			s.reply(conn, id, ldapBindResponse, result(code))
+		case ldapSearchRequest:
+			var filter []byte
+			rest := op
+			for range 7 {
+				_, filter, rest, _ = berNext(rest)
+			}
+			_, attr, rest, _ := berNext(filter)
+			_, value, _, _ := berNext(rest)
+			for cn, members := range s.groups {
+				for _, member := range members {
+					if string(attr) == "member" && member == string(value) {
+						s.reply(conn, id, ldapSearchEntry, func(b *cryptobyte.Builder) {
+							b.AddASN1OctetString([]byte("cn=" + cn + ",ou=groups,dc=example,dc=com"))
+							b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+								b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+									b.AddASN1OctetString([]byte("objectClass"))
+									b.AddASN1(asn1.SET, func(b *cryptobyte.Builder) {
+										b.AddASN1OctetString([]byte("groupOfNames"))
+									})
+								})
+								b.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+									b.AddASN1OctetString([]byte("CN"))
+									b.AddASN1(asn1.SET, func(b *cryptobyte.Builder) {
+										b.AddASN1OctetString([]byte(cn))
+									})
+								})
+							})
+						})
+					}
+				}
+			}
+			s.reply(conn, id, ldapSearchDone, result(0))
+		case ldapUnbindRequest:
+			return
+		}
+	}
+}
+
+func TestEscapeDN(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want string
+	}{
+		{"alice", "alice"},
+		{"bob,jr", `bob\,jr`},
+		{`a+b"c\d<e>f;g=h`, `a\+b\"c\\d\<e\>f\;g\=h`},
+		{" #lead", `\ #lead`},
+		{"#hash", `\#hash`},
+		{"trail ", `trail\ `},
+		{"nul\x00", `nul\00`},
+	} {
+		assert.Equal(t, test.want, escapeDN(test.in), test.in)
+	}
+}
+
+func TestBER(t *testing.T) {
+	// Long form lengths which aren't minimal are accepted
+	tag, contents, rest, err := berNext([]byte{0x04, 0x84, 0, 0, 0, 2, 'h', 'i', 0xff})
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x04), tag)
+	assert.Equal(t, "hi", string(contents))
+	assert.Equal(t, []byte{0xff}, rest)
+
+	for _, in := range [][]byte{
+		{0x04},
+		{0x04, 0x05, 'h'},
+		{0x04, 0x80},
+		{0x04, 0x85, 0, 0, 0, 0, 1},
+		{0x1f, 0x01, 0x00},
+	} {
+		_, _, _, err = berNext(in)
+		assert.Error(t, err, in)
+	}
+
+	assert.Equal(t, int64(0), berInt(nil))
+	assert.Equal(t, int64(300), berInt([]byte{0x01, 0x2c}))
+	assert.Equal(t, int64(-1), berInt([]byte{0xff}))
+}
+
+func TestLDAPAuth(t *testing.T) {
+	s, url := newTestLDAPServer(t)
+	cfg := AuthConfig{
+		LDAPURL:         url,
+		LDAPBindDN:      "uid={user},ou=people,dc=example,dc=com",
+		LDAPGroupBaseDN: "ou=groups,dc=example,dc=com",
+		LDAPGroupFilter: "(member={dn})",
+	}
+	a, err := newLDAPAuth(&cfg)
+	require.NoError(t, err)
+
+	id, err := a.authenticate("alice", "alicepass")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", id.User)
+	assert.ElementsMatch(t, []string{"staff", "admins"}, id.Groups)
+	assert.Equal(t, int32(1), s.binds.Load())
+
+	// Successful logins are cached
+	_, err = a.authenticate("alice", "alicepass")
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), s.binds.Load())
+
+	// But not for longer than ldapCacheTime
+	value, ok := a.cache.GetMaybe("alice")
+	require.True(t, ok)
+	entry := value.(ldapCacheEntry)
+	entry.when = time.Now().Add(-ldapCacheTime)
+	a.cache.Put("alice", entry)
+	_, err = a.authenticate("alice", "alicepass")
+	require.NoError(t, err)
+	assert.Equal(t, int32(2), s.binds.Load())
+
+	// Or with the wrong password
+	_, err = a.authenticate("alice", "wrong")
+	assert.ErrorContains(t, err, "invalid credentials")
+	assert.Equal(t, int32(3), s.binds.Load())
+
+	id, err = a.authenticate("nogroups", "nogroupspass")
+	require.NoError(t, err)
+	assert.Nil(t, id.Groups)
+
+	// User names which could change the DN are rejected
+	_, err = a.authenticate("bob,ou=admins", "bobpass")
+	assert.Equal(t, errLDAPInvalidUser, err)
+
+	// Empty passwords are rejected without asking the server
+	binds := s.binds.Load()
+	_, err = a.authenticate("unknown", "")
+	assert.Equal(t, errLDAPNoPassword, err)
+	assert.Equal(t, binds, s.binds.Load())
+
+	// Bad config
+	for _, test := range []struct {
+		cfg     AuthConfig
+		wantErr string
+	}{
+		{AuthConfig{LDAPURL: "http://example.com", LDAPBindDN: "uid={user}"}, "scheme must be ldap or ldaps"},
+		{AuthConfig{LDAPURL: url, LDAPBindDN: "uid=fixed"}, "must contain {user}"},
+		{AuthConfig{LDAPURL: url, LDAPBindDN: "uid={user}", LDAPGroupBaseDN: "dc=example", LDAPGroupFilter: "(&(a=b)(c=d))"}, "group filter must be"},
+	} {
+		_, err := newLDAPAuth(&test.cfg)
+		assert.ErrorContains(t, err, test.wantErr)
+	}
+}
@@ -3,6 +3,7 @@ package http
 import (
 	"context"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
@@ -154,6 +155,82 @@ func MiddlewareAuthCustom(fn CustomAuthFn, realm string, userFromContext bool) M
 	}
 }
 
+// MiddlewareAuthIdentity instantiates middleware that authenticates users with JWT bearer
+// tokens and/or by binding to an LDAP server as set in cfg
+func MiddlewareAuthIdentity(cfg AuthConfig) (Middleware, error) {
+	var (
+		jwtAuthenticator  *jwtAuth
+		ldapAuthenticator *ldapAuth
+		err               error
+	)
+	if cfg.JWTJWKS != "" {
+		jwtAuthenticator, err = newJWTAuth(&cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if cfg.LDAPURL != "" {
+		ldapAuthenticator, err = newLDAPAuth(&cfg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// skip auth for CORS preflight
+			if r.Method == "OPTIONS" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			var (
+				id    *Identity
+				user  string
+				value any
+				err   = errors.New("no credentials")
+			)
+			scheme, credentials, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+			switch {
+			case jwtAuthenticator != nil && strings.EqualFold(scheme, "Bearer"):
+				id, err = jwtAuthenticator.authenticate(strings.TrimSpace(credentials))
+			case ldapAuthenticator != nil && scheme == "Basic":
+				var pass string
+				var ok bool
+				user, pass, ok = parseAuthorization(r)
+				if ok {
+					id, err = ldapAuthenticator.authenticate(user, pass)
+				}
+			}
+			if err == nil && cfg.IdentityAuthFn != nil {
+				value, err = cfg.IdentityAuthFn(id)
+			}
+
+			if err != nil {
+				if scheme != "" {
+					fs.Infof(r.URL.Path, "%s: Auth failed from %s: %v", r.RemoteAddr, user, err)
+				}
+				code := http.StatusUnauthorized
+				w.Header().Set("Content-Type", "text/plain")
+				if ldapAuthenticator != nil {
+					w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Basic realm=%q, charset="UTF-8"`, cfg.Realm))
+				}
+				if jwtAuthenticator != nil {
+					w.Header().Add("WWW-Authenticate", fmt.Sprintf(`Bearer realm=%q`, cfg.Realm))
+				}
+				http.Error(w, http.StatusText(code), code)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ctxKeyUser, id.User)
+			ctx = context.WithValue(ctx, ctxKeyIdentity, id)
+			if value != nil {
+				ctx = context.WithValue(ctx, ctxKeyAuth, value)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}, nil
+}
+
 var validUsernameRegexp = regexp.MustCompile(`^[\p{L}\d@._-]+$`)
 
 // MiddlewareAuthGetUserFromHeader middleware that bypasses authentication and extracts the user via a specified HTTP header(ideal for proxied setups).
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -208,6 +209,80 @@ func TestMiddlewareAuth(t *testing.T) {
 	}
 }
 
+func TestMiddlewareAuthIdentity(t *testing.T) {
+	k := newTestJWKS(t)
+	_, ldapURL := newTestLDAPServer(t)
+	auth := DefaultAuthCfg()
+	auth.Realm = "test"
+	auth.JWTJWKS = k.path
+	auth.LDAPURL = ldapURL
+	auth.LDAPBindDN = "uid={user},ou=people,dc=example,dc=com"
+	auth.LDAPGroupBaseDN = "ou=groups,dc=example,dc=com"
+	// Also set to check they are ignored
+	auth.HtPasswd = "./testdata/.htpasswd"
+	auth.CustomAuthFn = func(user, pass string) (value any, err error) {
+		return nil, errors.New("should not be called")
+	}
+	auth.IdentityAuthFn = func(id *Identity) (value any, err error) {
+		if id.User == "carol" {
+			return nil, errors.New("carol is banned")
+		}
+		return len(id.Groups), nil
+	}
+	s, err := NewServer(context.Background(), WithConfig(Config{ListenAddr: []string{"127.0.0.1:0"}}), WithAuth(auth))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, s.Shutdown())
+	}()
+	require.True(t, s.UsingAuth())
+	s.Router().Mount("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := CtxGetUser(r.Context())
+		id, ok := CtxGetIdentity(r.Context())
+		require.True(t, ok)
+		require.Equal(t, user, id.User)
+		_, _ = fmt.Fprintf(w, "%s:%v", user, CtxGetAuth(r.Context()))
+	}))
+	s.Serve()
+	url := testGetServerURL(t, s)
+
+	token := k.sign(t, "ec", map[string]any{
+		"sub":    "jwtuser",
+		"groups": []string{"a", "b"},
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	})
+	for _, test := range []struct {
+		name     string
+		setAuth  func(req *http.Request)
+		wantCode int
+		wantBody string
+	}{
+		{"None", func(req *http.Request) {}, http.StatusUnauthorized, ""},
+		{"Bearer", func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }, http.StatusOK, "jwtuser:2"},
+		{"BadBearer", func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token+"x") }, http.StatusUnauthorized, ""},
+		{"LDAP", func(req *http.Request) { req.SetBasicAuth("alice", "alicepass") }, http.StatusOK, "alice:2"},
+		{"BadLDAP", func(req *http.Request) { req.SetBasicAuth("alice", "wrong") }, http.StatusUnauthorized, ""},
+		{"Htpasswd", func(req *http.Request) { req.SetBasicAuth("md5", "md5") }, http.StatusUnauthorized, ""},
+		{"Rejected", func(req *http.Request) { req.SetBasicAuth("carol", "carolpass") }, http.StatusUnauthorized, ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", url, nil)
+			require.NoError(t, err)
+			test.setAuth(req)
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer func() {
+				_ = resp.Body.Close()
+			}()
+			require.Equal(t, test.wantCode, resp.StatusCode)
+			if test.wantCode == http.StatusOK {
+				testExpectRespBody(t, resp, []byte(test.wantBody))
+			} else {
+				require.Equal(t, []string{`Basic realm="test", charset="UTF-8"`, `Bearer realm="test"`}, resp.Header.Values("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
 func TestMiddlewareAuthCertificateUser(t *testing.T) {
 	serverCertBytes := testReadTestdataFile(t, "local.crt")
 	serverKeyBytes := testReadTestdataFile(t, "local.key")
@@ -330,7 +330,10 @@ func NewServer(ctx context.Context, options ...Option) (*Server, error) {
 
 	s.mux.Use(MiddlewareCORS(s.cfg.AllowOrigin))
 
-	s.initAuth()
+	err = s.initAuth()
+	if err != nil {
+		return nil, err
+	}
 
 	// (Only) listen on FDs provided by the service manager, if any.
 	sdListeners, err := sdActivation.ListenersWithNames()
@@ -391,8 +394,19 @@ func NewServer(ctx context.Context, options ...Option) (*Server, error) {
 	return s, nil
 }
 
-func (s *Server) initAuth() {
+func (s *Server) initAuth() error {
 	s.usingAuth = false
+
+	if s.auth.JWTJWKS != "" || s.auth.LDAPURL != "" {
+		s.usingAuth = true
+		authMiddleware, err := MiddlewareAuthIdentity(s.auth)
+		if err != nil {
+			return fmt.Errorf("failed to init auth: %w", err)
+		}
+		s.mux.Use(authMiddleware)
+		return nil
+	}
+
 	altUsernameEnabled := s.auth.HtPasswd == "" && s.auth.BasicUser == ""
 
 	if altUsernameEnabled {
@@ -410,20 +424,21 @@ func (s *Server) initAuth() {
 	if s.auth.CustomAuthFn != nil {
 		s.usingAuth = true
 		s.mux.Use(MiddlewareAuthCustom(s.auth.CustomAuthFn, s.auth.Realm, altUsernameEnabled))
-		return
+		return nil
 	}
 
 	if s.auth.HtPasswd != "" {
 		s.usingAuth = true
 		s.mux.Use(MiddlewareAuthHtpasswd(s.auth.HtPasswd, s.auth.Realm))
-		return
+		return nil
 	}
 
 	if s.auth.BasicUser != "" {
 		s.usingAuth = true
 		s.mux.Use(MiddlewareAuthBasic(s.auth.BasicUser, s.auth.BasicPass, s.auth.Realm, s.auth.Salt))
-		return
+		return nil
 	}
+	return nil
 }
 
 func (s *Server) initTemplate() error {
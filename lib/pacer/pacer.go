@@ -2,12 +2,14 @@
 package pacer
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	liberrors "github.com/rclone/rclone/lib/errors"
+	"github.com/rclone/rclone/lib/tracing"
 )
 
 // State represents the public Pacer state that will be passed to the
@@ -191,17 +193,36 @@ func (p *Pacer) endCall(retry bool, err error) {
 	p.mu.Unlock()
 }
 
+// minTracedSleep is the shortest pacer sleep which is traced
+const minTracedSleep = time.Millisecond
+
 // call implements Call but with settable retries
 func (p *Pacer) call(fn Paced, retries int) (err error) {
-	var retry bool
-	for i := 1; i <= retries; i++ {
+	var (
+		retry bool
+		tries int
+		slept time.Duration
+		start = time.Now()
+	)
+	for tries = 1; tries <= retries; tries++ {
+		sleepStart := time.Now()
 		p.beginCall()
-		retry, err = p.invoker(i, retries, fn)
+		slept += time.Since(sleepStart)
+		retry, err = p.invoker(tries, retries, fn)
 		p.endCall(retry, err)
 		if !retry {
 			break
 		}
 	}
+	// Trace calls which were paced or retried. There is no
+	// context here so these are traces of their own.
+	tries = min(tries, retries)
+	if tries > 1 || slept >= minTracedSleep {
+		tracing.Record(context.Background(), "pacer", start, err,
+			tracing.Int("pacer.retries", tries-1),
+			tracing.Duration("pacer.sleep", slept),
+		)
+	}
 	return err
 }
 
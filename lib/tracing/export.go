@@ -0,0 +1,346 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	batchSize     = 512              // export when this many spans are queued
+	maxQueued     = 64 * 1024        // drop spans when this many are queued
+	flushInterval = 5 * time.Second  // export queued spans this often
+	httpTimeout   = 30 * time.Second // timeout for sending spans to a collector
+)
+
+// Exporter sends encoded spans somewhere
+type Exporter interface {
+	// Export sends data which is an OTLP ExportTraceServiceRequest
+	// encoded as JSON
+	Export(ctx context.Context, data []byte) error
+	// Close the Exporter
+	Close() error
+}
+
+// NewExporter returns an Exporter for target which is either the
+// http or https URL of an OTLP collector or the path of a file.
+func NewExporter(target string) (Exporter, error) {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		return NewHTTPExporter(target), nil
+	}
+	return NewFileExporter(target)
+}
+
+// fileExporter writes spans to a file as JSON lines
+type fileExporter struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewFileExporter returns an Exporter which appends a line of OTLP
+// JSON to the file at path for each batch of spans.
+func NewFileExporter(path string) (Exporter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open trace file: %w", err)
+	}
+	return &fileExporter{f: f}, nil
+}
+
+// Export writes data as a line to the file
+func (e *fileExporter) Export(ctx context.Context, data []byte) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, err := e.f.Write(append(data, '\n'))
+	return err
+}
+
+// Close the file
+func (e *fileExporter) Close() error {
+	return e.f.Close()
+}
+
+// httpExporter posts spans to an OTLP collector
+type httpExporter struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPExporter returns an Exporter which posts spans to the OTLP
+// collector at url, eg http://localhost:4318/v1/traces
+func NewHTTPExporter(url string) Exporter {
+	return &httpExporter{
+		url: url,
+		// Don't use the rclone transport or the requests would be traced
+		client: &http.Client{Timeout: httpTimeout},
+	}
+}
+
+// Export posts data to the collector
+func (e *httpExporter) Export(ctx context.Context, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", e.url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Close does nothing
+func (e *httpExporter) Close() error {
+	return nil
+}
+
+// tracer queues finished spans and exports them in batches
+type tracer struct {
+	exporter Exporter
+	errorFn  func(error)
+	resource []Attribute
+	mu       sync.Mutex
+	spans    []*Span
+	dropped  int
+	flush    chan struct{}
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Enable starts recording spans and exporting them with exporter.
+//
+// errorFn is called with any errors exporting the spans. resource
+// describes the program making the spans, eg its service.name.
+func Enable(exporter Exporter, errorFn func(error), resource ...Attribute) {
+	t := &tracer{
+		exporter: exporter,
+		errorFn:  errorFn,
+		resource: resource,
+		flush:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	t.wg.Add(1)
+	go t.run()
+	if old := running.Swap(t); old != nil {
+		_ = old.shutdown(context.Background())
+	}
+}
+
+// Shutdown stops recording spans, exports any queued spans and
+// closes the Exporter.
+func Shutdown(ctx context.Context) error {
+	t := running.Swap(nil)
+	if t == nil {
+		return nil
+	}
+	return t.shutdown(ctx)
+}
+
+// add a finished span to the queue
+func (t *tracer) add(s *Span) {
+	t.mu.Lock()
+	if len(t.spans) >= maxQueued {
+		t.dropped++
+	} else {
+		t.spans = append(t.spans, s)
+	}
+	full := len(t.spans) >= batchSize
+	t.mu.Unlock()
+	if full {
+		select {
+		case t.flush <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// run exports the spans in the background until done is closed
+func (t *tracer) run() {
+	defer t.wg.Done()
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+		case <-t.flush:
+		}
+		if err := t.export(context.Background()); err != nil && t.errorFn != nil {
+			t.errorFn(err)
+		}
+	}
+}
+
+// export the queued spans
+func (t *tracer) export(ctx context.Context) error {
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	dropped := t.dropped
+	t.dropped = 0
+	t.mu.Unlock()
+	var errs []error
+	if dropped > 0 {
+		errs = append(errs, fmt.Errorf("dropped %d spans as too many were queued", dropped))
+	}
+	for len(spans) > 0 {
+		n := min(len(spans), batchSize)
+		data, err := encode(t.resource, spans[:n])
+		if err == nil {
+			err = t.exporter.Export(ctx, data)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to export %d spans: %w", n, err))
+		}
+		spans = spans[n:]
+	}
+	return errors.Join(errs...)
+}
+
+// shutdown the tracer
+func (t *tracer) shutdown(ctx context.Context) error {
+	close(t.done)
+	t.wg.Wait()
+	err := t.export(ctx)
+	closeErr := t.exporter.Close()
+	return errors.Join(err, closeErr)
+}
+
+// OTLP JSON encoding - see
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              Kind            `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+// status code for errors
+const otlpStatusError = 2
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+// encodeAttributes converts attrs into OTLP
+func encodeAttributes(attrs []Attribute) []otlpAttribute {
+	out := make([]otlpAttribute, 0, len(attrs))
+	for _, attr := range attrs {
+		var v otlpValue
+		switch x := attr.Value.(type) {
+		case string:
+			v.StringValue = &x
+		case bool:
+			v.BoolValue = &x
+		case int64:
+			s := strconv.FormatInt(x, 10)
+			v.IntValue = &s
+		case float64:
+			v.DoubleValue = &x
+		default:
+			s := fmt.Sprint(x)
+			v.StringValue = &s
+		}
+		out = append(out, otlpAttribute{Key: attr.Key, Value: v})
+	}
+	return out
+}
+
+// unixNano formats t for OTLP
+func unixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// encode spans as an OTLP ExportTraceServiceRequest
+func encode(resource []Attribute, spans []*Span) ([]byte, error) {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           hex.EncodeToString(s.traceID[:]),
+			SpanID:            hex.EncodeToString(s.spanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: unixNano(s.start),
+			EndTimeUnixNano:   unixNano(s.end),
+			Attributes:        encodeAttributes(s.attrs),
+		}
+		if s.parentID != (SpanID{}) {
+			span.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != nil {
+			span.Status = &otlpStatus{Code: otlpStatusError, Message: s.err.Error()}
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+	return json.Marshal(otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{Attributes: encodeAttributes(resource)},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/rclone/rclone"},
+				Spans: out,
+			}},
+		}},
+	})
+}
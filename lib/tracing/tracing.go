@@ -0,0 +1,181 @@
+// Package tracing records spans for the operations rclone does so
+// they can be exported as OpenTelemetry (OTLP) traces.
+//
+// Tracing is off until Enable is called. When it is off Start returns
+// a nil *Span whose methods do nothing so instrumented code doesn't
+// need to check.
+package tracing
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Attribute is a key value pair describing a Span
+type Attribute struct {
+	Key   string
+	Value any // string, bool, int64 or float64
+}
+
+// String makes a string Attribute
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int64 makes an integer Attribute
+func Int64(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int makes an integer Attribute
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+// Bool makes a boolean Attribute
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Float64 makes a floating point Attribute
+func Float64(key string, value float64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Duration makes an Attribute holding d in seconds
+func Duration(key string, d time.Duration) Attribute {
+	return Attribute{Key: key, Value: d.Seconds()}
+}
+
+// Kind is the kind of a Span
+type Kind int
+
+// Kinds of Span - these are the values OTLP uses
+const (
+	KindInternal Kind = 1
+	KindClient   Kind = 3
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span in a trace
+type SpanID [8]byte
+
+// Span is a timed operation in a trace
+type Span struct {
+	tracer   *tracer
+	traceID  TraceID
+	spanID   SpanID
+	parentID SpanID
+	name     string
+	kind     Kind
+	start    time.Time
+
+	mu    sync.Mutex
+	attrs []Attribute
+	end   time.Time
+	err   error
+	ended bool
+}
+
+// the running tracer or nil if tracing is off
+var running atomic.Pointer[tracer]
+
+// Enabled returns true if spans are being recorded
+func Enabled() bool {
+	return running.Load() != nil
+}
+
+type spanKey struct{}
+
+// FromContext returns the Span in ctx or nil if there isn't one
+func FromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey{}).(*Span)
+	return s
+}
+
+// Start starts a Span called name which is a child of the Span in
+// ctx if any, returning a context with the new Span in.
+//
+// The Span must be finished with End. If tracing is off it returns
+// ctx and a nil Span.
+func Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	return StartKind(ctx, name, KindInternal, attrs...)
+}
+
+// StartKind starts a Span as Start does with the kind passed in
+func StartKind(ctx context.Context, name string, kind Kind, attrs ...Attribute) (context.Context, *Span) {
+	t := running.Load()
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{
+		tracer: t,
+		name:   name,
+		kind:   kind,
+		start:  time.Now(),
+		attrs:  append([]Attribute(nil), attrs...),
+	}
+	if parent := FromContext(ctx); parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		randomID(s.traceID[:])
+	}
+	randomID(s.spanID[:])
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// randomID fills id with random non zero bytes
+func randomID(id []byte) {
+	for i := range id {
+		id[i] = byte(rand.IntN(255) + 1)
+	}
+}
+
+// SetAttributes adds attrs to the Span
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, attrs...)
+	s.mu.Unlock()
+}
+
+// End finishes the Span recording err if it isn't nil
+//
+// Only the first call to End has any effect.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.err = err
+	s.mu.Unlock()
+	s.tracer.add(s)
+}
+
+// Record records a finished Span called name which is a child of the
+// Span in ctx, running from start to now and ending with err.
+//
+// Use this for operations which have already happened such as
+// waiting.
+func Record(ctx context.Context, name string, start time.Time, err error, attrs ...Attribute) {
+	_, s := Start(ctx, name, attrs...)
+	if s == nil {
+		return
+	}
+	s.start = start
+	s.End(err)
+}
@@ -0,0 +1,195 @@
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memExporter collects the exported requests
+type memExporter struct {
+	mu       sync.Mutex
+	requests []otlpRequest
+	closed   bool
+}
+
+func (e *memExporter) Export(ctx context.Context, data []byte) error {
+	var req otlpRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.requests = append(e.requests, req)
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *memExporter) Close() error {
+	e.closed = true
+	return nil
+}
+
+// spans returns all the spans exported
+func (e *memExporter) spans() (spans []otlpSpan) {
+	for _, req := range e.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				spans = append(spans, ss.Spans...)
+			}
+		}
+	}
+	return spans
+}
+
+// attribute finds the attribute with key
+func attribute(attrs []otlpAttribute, key string) *otlpValue {
+	for i := range attrs {
+		if attrs[i].Key == key {
+			return &attrs[i].Value
+		}
+	}
+	return nil
+}
+
+func TestDisabled(t *testing.T) {
+	assert.False(t, Enabled())
+	ctx := context.Background()
+	newCtx, span := Start(ctx, "potato", String("a", "b"))
+	assert.Nil(t, span)
+	assert.Equal(t, ctx, newCtx)
+	// These should do nothing
+	span.SetAttributes(Int("n", 1))
+	span.End(nil)
+	Record(ctx, "potato", time.Now(), nil)
+	assert.NoError(t, Shutdown(ctx))
+}
+
+func TestSpans(t *testing.T) {
+	e := &memExporter{}
+	var exportErrs []error
+	Enable(e, func(err error) {
+		exportErrs = append(exportErrs, err)
+	}, String("service.name", "test"))
+	require.True(t, Enabled())
+
+	ctx := context.Background()
+	parentCtx, parent := Start(ctx, "parent", String("s", "hello"), Int64("i", 42))
+	assert.Equal(t, parent, FromContext(parentCtx))
+	_, child := StartKind(parentCtx, "child", KindClient, Bool("b", true))
+	child.SetAttributes(Float64("f", 1.5), Duration("d", 2*time.Second))
+	child.End(errors.New("child failed"))
+	child.End(nil) // ignored
+	Record(parentCtx, "waited", time.Now().Add(-time.Second), nil)
+	parent.End(nil)
+
+	require.NoError(t, Shutdown(ctx))
+	assert.False(t, Enabled())
+	assert.True(t, e.closed)
+	assert.Empty(t, exportErrs)
+
+	require.Len(t, e.requests, 1)
+	resource := e.requests[0].ResourceSpans[0].Resource.Attributes
+	assert.Equal(t, "test", *attribute(resource, "service.name").StringValue)
+
+	spans := e.spans()
+	require.Len(t, spans, 3)
+	c, w, p := spans[0], spans[1], spans[2]
+	assert.Equal(t, "child", c.Name)
+	assert.Equal(t, "waited", w.Name)
+	assert.Equal(t, "parent", p.Name)
+
+	// Check the tree
+	assert.Len(t, p.TraceID, 32)
+	assert.Len(t, p.SpanID, 16)
+	assert.Equal(t, "", p.ParentSpanID)
+	assert.Equal(t, p.TraceID, c.TraceID)
+	assert.Equal(t, p.SpanID, c.ParentSpanID)
+	assert.Equal(t, p.SpanID, w.ParentSpanID)
+	assert.NotEqual(t, p.SpanID, c.SpanID)
+
+	// Check the details
+	assert.Equal(t, KindInternal, p.Kind)
+	assert.Equal(t, KindClient, c.Kind)
+	assert.Equal(t, "hello", *attribute(p.Attributes, "s").StringValue)
+	assert.Equal(t, "42", *attribute(p.Attributes, "i").IntValue)
+	assert.Equal(t, true, *attribute(c.Attributes, "b").BoolValue)
+	assert.Equal(t, 1.5, *attribute(c.Attributes, "f").DoubleValue)
+	assert.Equal(t, 2.0, *attribute(c.Attributes, "d").DoubleValue)
+	assert.Nil(t, p.Status)
+	require.NotNil(t, c.Status)
+	assert.Equal(t, otlpStatusError, c.Status.Code)
+	assert.Equal(t, "child failed", c.Status.Message)
+	assert.Less(t, w.StartTimeUnixNano, p.StartTimeUnixNano)
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+	e, err := NewExporter(path)
+	require.NoError(t, err)
+	Enable(e, nil)
+	for range 2 {
+		_, span := Start(context.Background(), "span")
+		span.End(nil)
+	}
+	require.NoError(t, Shutdown(context.Background()))
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, f.Close())
+	}()
+	scanner := bufio.NewScanner(f)
+	lines := 0
+	for scanner.Scan() {
+		var req otlpRequest
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &req))
+		assert.Len(t, req.ResourceSpans[0].ScopeSpans[0].Spans, 2)
+		lines++
+	}
+	require.NoError(t, scanner.Err())
+	assert.Equal(t, 1, lines)
+}
+
+func TestHTTPExporter(t *testing.T) {
+	var got otlpRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		data, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(data, &got))
+		if len(got.ResourceSpans[0].ScopeSpans[0].Spans) > 1 {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	e, err := NewExporter(ts.URL + "/v1/traces")
+	require.NoError(t, err)
+	Enable(e, nil)
+	_, span := Start(context.Background(), "span")
+	span.End(nil)
+	require.NoError(t, Shutdown(context.Background()))
+	assert.Equal(t, "span", got.ResourceSpans[0].ScopeSpans[0].Spans[0].Name)
+
+	// Check errors are returned
+	Enable(e, nil)
+	for range 2 {
+		_, span := Start(context.Background(), "span")
+		span.End(nil)
+	}
+	err = Shutdown(context.Background())
+	assert.ErrorContains(t, err, "400 Bad Request")
+}
@@ -1055,6 +1055,9 @@ func (d *Dir) Create(name string, flags int) (*File, error) {
 	if d.vfs.Opt.ReadOnly {
 		return nil, EROFS
 	}
+	if err = d.vfs.checkOperation(OpWrite); err != nil {
+		return nil, err
+	}
 	if err = d.SetModTime(time.Now()); err != nil {
 		fs.Errorf(d, "Dir.Create failed to set modtime on parent dir: %v", err)
 		return nil, err
@@ -1065,10 +1068,21 @@ func (d *Dir) Create(name string, flags int) (*File, error) {
 
 // Mkdir creates a new directory
 func (d *Dir) Mkdir(name string) (*Dir, error) {
+	return d.mkdirContext(context.TODO(), name)
+}
+
+// mkdirContext creates a new directory using the locks held in ctx
+func (d *Dir) mkdirContext(ctx context.Context, name string) (*Dir, error) {
 	if d.vfs.Opt.ReadOnly {
 		return nil, EROFS
 	}
+	if err := d.vfs.checkOperation(OpMkdir); err != nil {
+		return nil, err
+	}
 	path := path.Join(d.path, name)
+	if err := d.vfs.checkLocked(ctx, path, false); err != nil {
+		return nil, err
+	}
 	node, err := d.stat(name)
 	switch err {
 	case ENOENT:
@@ -1103,9 +1117,20 @@ func (d *Dir) Mkdir(name string) (*Dir, error) {
 
 // Remove the directory
 func (d *Dir) Remove() error {
+	return d.removeContext(context.TODO())
+}
+
+// removeContext removes the directory using the locks held in ctx
+func (d *Dir) removeContext(ctx context.Context) error {
 	if d.vfs.Opt.ReadOnly {
 		return EROFS
 	}
+	if err := d.vfs.checkOperation(OpDelete); err != nil {
+		return err
+	}
+	if err := d.vfs.checkLocked(ctx, d.path, true); err != nil {
+		return err
+	}
 	// Check directory is empty first
 	empty, err := d.isEmpty()
 	if err != nil {
@@ -1131,9 +1156,22 @@ func (d *Dir) Remove() error {
 
 // RemoveAll removes the directory and any contents recursively
 func (d *Dir) RemoveAll() error {
+	return d.removeAllContext(context.TODO())
+}
+
+// removeAllContext removes the directory and any contents recursively
+// using the locks held in ctx
+func (d *Dir) removeAllContext(ctx context.Context) error {
 	if d.vfs.Opt.ReadOnly {
 		return EROFS
 	}
+	if err := d.vfs.checkOperation(OpDelete); err != nil {
+		return err
+	}
+	// Check for locks first so nothing is removed if any are found
+	if err := d.vfs.checkLocked(ctx, d.path, true); err != nil {
+		return err
+	}
 	// Remove contents of the directory
 	nodes, err := d.ReadDirAll()
 	if err != nil {
@@ -1141,13 +1179,13 @@ func (d *Dir) RemoveAll() error {
 		return err
 	}
 	for _, node := range nodes {
-		err = node.RemoveAll()
+		err = removeAllContext(ctx, node)
 		if err != nil {
 			fs.Errorf(node.Path(), "Dir.RemoveAll failed to remove: %v", err)
 			return err
 		}
 	}
-	return d.Remove()
+	return d.removeContext(ctx)
 }
 
 // DirEntry returns the underlying fs.DirEntry
@@ -1177,12 +1215,25 @@ func (d *Dir) RemoveName(name string) error {
 
 // Rename the file
 func (d *Dir) Rename(oldName, newName string, destDir *Dir) error {
+	return d.renameContext(context.TODO(), oldName, newName, destDir)
+}
+
+// renameContext renames the file using the locks held in ctx
+func (d *Dir) renameContext(ctx context.Context, oldName, newName string, destDir *Dir) error {
 	// fs.Debugf(d, "BEFORE\n%s", d.dump())
 	if d.vfs.Opt.ReadOnly {
 		return EROFS
 	}
+	if err := d.vfs.checkOperation(OpRename); err != nil {
+		return err
+	}
 	oldPath := path.Join(d.path, oldName)
 	newPath := path.Join(destDir.path, newName)
+	for _, p := range []string{oldPath, newPath} {
+		if err := d.vfs.checkLocked(ctx, p, true); err != nil {
+			return err
+		}
+	}
 	// fs.Debugf(oldPath, "Dir.Rename to %q", newPath)
 	oldNode, err := d.stat(oldName)
 	if err != nil {
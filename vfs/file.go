@@ -462,6 +462,9 @@ func (f *File) SetModTime(modTime time.Time) error {
 	if f.d.vfs.Opt.ReadOnly {
 		return EROFS
 	}
+	if err := f.d.vfs.checkOperation(OpWrite); err != nil {
+		return err
+	}
 
 	f.pendingModTime = modTime
 
@@ -664,6 +667,11 @@ func (f *File) Sync() error {
 
 // Remove the file
 func (f *File) Remove() (err error) {
+	return f.removeContext(context.TODO())
+}
+
+// removeContext removes the file using the locks held in ctx
+func (f *File) removeContext(ctx context.Context) (err error) {
 	defer log.Trace(f.Path(), "")("err=%v", &err)
 	f.mu.RLock()
 	d := f.d
@@ -672,6 +680,13 @@ func (f *File) Remove() (err error) {
 	if d.vfs.Opt.ReadOnly {
 		return EROFS
 	}
+	if err = d.vfs.checkOperation(OpDelete); err != nil {
+		return err
+	}
+	if err = d.vfs.checkLocked(ctx, f.Path(), false); err != nil {
+		return err
+	}
+	size := f.Size()
 
 	// Remove the object from the cache
 	wasWriting := false
@@ -700,6 +715,7 @@ func (f *File) Remove() (err error) {
 	// called with File.mu released when there is no error removing the underlying file
 	if err == nil {
 		d.delObject(f.Name())
+		_ = d.vfs.quotaAdd(ctx, -size)
 	}
 	return err
 }
@@ -830,6 +846,11 @@ const o_SYMLINK = 0x4000_0000 //nolint:revive
 //
 // We ignore O_SYNC and O_EXCL
 func (f *File) Open(flags int) (fd Handle, err error) {
+	return f.openContext(context.TODO(), flags)
+}
+
+// openContext opens the file using the locks held in ctx
+func (f *File) openContext(ctx context.Context, flags int) (fd Handle, err error) {
 	defer log.Trace(f.Path(), "flags=%s", decodeOpenFlags(flags))("fd=%v, err=%v", &fd, &err)
 	var (
 		write    bool // if set need write support
@@ -890,6 +911,19 @@ func (f *File) Open(flags int) (fd Handle, err error) {
 	f.mu.RLock()
 	d := f.d
 	f.mu.RUnlock()
+	if rdwrMode != os.O_WRONLY {
+		if err = d.vfs.checkOperation(OpRead); err != nil {
+			return nil, err
+		}
+	}
+	if write {
+		if err = d.vfs.checkOperation(OpWrite); err != nil {
+			return nil, err
+		}
+		if err = d.vfs.checkLocked(ctx, f.Path(), false); err != nil {
+			return nil, err
+		}
+	}
 	CacheMode := d.vfs.Opt.CacheMode
 	if CacheMode >= vfscommon.CacheModeMinimal && (d.vfs.cache.InUse(f.CachePath()) || d.vfs.cache.Exists(f.CachePath())) {
 		fd, err = f.openRW(flags)
@@ -928,6 +962,12 @@ func (f *File) Open(flags int) (fd Handle, err error) {
 
 // Truncate changes the size of the named file.
 func (f *File) Truncate(size int64) (err error) {
+	if err = f.VFS().checkOperation(OpWrite); err != nil {
+		return err
+	}
+	if err = f.VFS().checkLocked(context.TODO(), f.Path(), false); err != nil {
+		return err
+	}
 	// make a copy of fh.writers with the lock held then unlock so
 	// we can call other file methods.
 	f.mu.Lock()
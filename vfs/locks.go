@@ -0,0 +1,542 @@
+package vfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/lib/kv"
+)
+
+// locksFacility is the name of the kv database the locks are kept in
+const locksFacility = "vfslocks"
+
+// Lock errors
+var (
+	ErrLocked            = errors.New("vfs: locked")
+	ErrNoSuchLock        = errors.New("vfs: no such lock")
+	ErrLockNotConfirmed  = errors.New("vfs: lock confirmation failed")
+	errLockRecordCorrupt = errors.New("vfs: corrupt lock record")
+)
+
+// Lock describes an exclusive write lock on a path in the VFS, as
+// used by WebDAV.
+type Lock struct {
+	Token     string        // unique identifier for the lock
+	Root      string        // path of the locked file or directory
+	Owner     string        // description of the owner of the lock
+	ZeroDepth bool          // if set the lock only covers Root not its contents
+	Duration  time.Duration // how long the lock lasts, negative for ever
+	Expires   time.Time     // when the lock expires, zero if it doesn't
+}
+
+// lockRecord is a Lock as stored in the database
+//
+// The Path is relative to the root of the remote rather than the VFS
+// so VFSes on different parts of a remote can see each other's locks.
+type lockRecord struct {
+	Token     string        `json:"token"`
+	Path      string        `json:"path"`
+	Owner     string        `json:"owner,omitempty"`
+	ZeroDepth bool          `json:"zeroDepth,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	Expires   time.Time     `json:"expires"`
+}
+
+// expired returns true if the lock has timed out at now
+func (r *lockRecord) expired(now time.Time) bool {
+	return r.Duration >= 0 && !now.Before(r.Expires)
+}
+
+// setDuration sets the duration and expiry time of the lock
+func (r *lockRecord) setDuration(now time.Time, duration time.Duration) {
+	r.Duration = duration
+	r.Expires = time.Time{}
+	if duration >= 0 {
+		r.Expires = now.Add(duration)
+	}
+}
+
+// isParent returns true if dir is a parent directory of p
+func isParent(dir, p string) bool {
+	if dir == "" {
+		return p != ""
+	}
+	return strings.HasPrefix(p, dir+"/")
+}
+
+// covers returns true if the lock applies to p
+func (r *lockRecord) covers(p string) bool {
+	return r.Path == p || (!r.ZeroDepth && isParent(r.Path, p))
+}
+
+// lockOp adapts a function to a kv.Op
+type lockOp func(b kv.Bucket) error
+
+// Do the operation
+func (op lockOp) Do(ctx context.Context, b kv.Bucket) error {
+	return op(b)
+}
+
+// Locks manages the WebDAV style locks on a VFS.
+//
+// Locks are normally persisted in a kv database shared between all
+// the VFSes on the same remote, including those in other rclone
+// processes, so they survive restarts. Temporary locks which only
+// last for the duration of a request are kept in memory.
+//
+// If --vfs-locks is set the VFS refuses to modify any locked path
+// unless the caller passes a context with a LockHolder which holds the
+// lock with Confirm.
+type Locks struct {
+	mu     sync.Mutex
+	prefix string                // root of the VFS relative to the root of the remote
+	db     *kv.DB                // database the locks are persisted in - may be nil
+	mem    map[string]lockRecord // locks kept in memory by token
+	held   map[string]struct{}   // tokens of locks held by Confirm
+}
+
+// LockHolder records the locks held by a single user of the VFS, for
+// example a WebDAV request.
+//
+// Only operations done with a context carrying the LockHolder, see
+// WithLockHolder, may modify the paths covered by the locks it holds.
+type LockHolder struct {
+	mu     sync.Mutex
+	tokens map[string]struct{}
+}
+
+// NewLockHolder makes a new LockHolder which holds no locks
+func NewLockHolder() *LockHolder {
+	return &LockHolder{
+		tokens: make(map[string]struct{}),
+	}
+}
+
+// holds returns true if h holds the lock with token
+//
+// h may be nil
+func (h *LockHolder) holds(token string) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, found := h.tokens[token]
+	return found
+}
+
+// set adds the tokens to h if hold is set or removes them otherwise
+//
+// h may be nil
+func (h *LockHolder) set(hold bool, tokens []string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, token := range tokens {
+		if hold {
+			h.tokens[token] = struct{}{}
+		} else {
+			delete(h.tokens, token)
+		}
+	}
+}
+
+type lockHolderKey struct{}
+
+// WithLockHolder returns a copy of ctx carrying h so VFS operations
+// done with it may modify paths covered by the locks h holds.
+func WithLockHolder(ctx context.Context, h *LockHolder) context.Context {
+	return context.WithValue(ctx, lockHolderKey{}, h)
+}
+
+// getLockHolder returns the LockHolder in ctx or nil if there isn't one
+func getLockHolder(ctx context.Context) *LockHolder {
+	h, _ := ctx.Value(lockHolderKey{}).(*LockHolder)
+	return h
+}
+
+// newLocks starts the lock manager for f
+func newLocks(f fs.Fs) *Locks {
+	l := &Locks{
+		prefix: strings.Trim(f.Root(), "/"),
+		mem:    make(map[string]lockRecord),
+		held:   make(map[string]struct{}),
+	}
+	if !kv.Supported() {
+		fs.Logf(f, "Persistent locks are not supported on this platform - keeping them in memory")
+		return l
+	}
+	db, err := kv.Start(context.Background(), locksFacility, f)
+	if err != nil {
+		fs.Errorf(f, "Failed to open lock database - keeping locks in memory: %v", err)
+		return l
+	}
+	l.db = db
+	return l
+}
+
+// stop the lock manager
+func (l *Locks) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.db != nil {
+		if err := l.db.Stop(false); err != nil {
+			fs.Debugf(nil, "Failed to close lock database: %v", err)
+		}
+		l.db = nil
+	}
+}
+
+// abs converts a VFS path into a path relative to the root of the remote
+func (l *Locks) abs(name string) string {
+	return strings.Trim(path.Join(l.prefix, strings.Trim(name, "/")), "/")
+}
+
+// rel converts a path relative to the root of the remote into a VFS
+// path if possible
+func (l *Locks) rel(p string) string {
+	if l.prefix == "" {
+		return p
+	}
+	if p == l.prefix {
+		return ""
+	}
+	if isParent(l.prefix, p) {
+		return p[len(l.prefix)+1:]
+	}
+	return p
+}
+
+// toLock converts a lockRecord into a Lock
+func (l *Locks) toLock(r lockRecord) Lock {
+	return Lock{
+		Token:     r.Token,
+		Root:      l.rel(r.Path),
+		Owner:     r.Owner,
+		ZeroDepth: r.ZeroDepth,
+		Duration:  r.Duration,
+		Expires:   r.Expires,
+	}
+}
+
+// _isHeld returns true if the lock with token is held
+//
+// Call with the lock held
+func (l *Locks) _isHeld(token string) bool {
+	_, found := l.held[token]
+	return found
+}
+
+// Run fn with the bucket from the lock database, or nil if locks
+// aren't being persisted or the database is empty.
+//
+// Call with the lock held
+func (l *Locks) _do(write bool, fn func(b kv.Bucket) error) error {
+	if l.db == nil {
+		return fn(nil)
+	}
+	err := l.db.Do(write, lockOp(fn))
+	if err == kv.ErrEmpty {
+		return fn(nil)
+	}
+	return err
+}
+
+// Read the unexpired locks from b and memory. Held locks don't
+// expire until they are released.
+//
+// If prune is set the expired locks are removed, which needs b to be
+// writable.
+//
+// Call with the lock held
+func (l *Locks) _records(b kv.Bucket, now time.Time, prune bool) (records []lockRecord, err error) {
+	for token, r := range l.mem {
+		if r.expired(now) && !l._isHeld(token) {
+			if prune {
+				delete(l.mem, token)
+			}
+			continue
+		}
+		records = append(records, r)
+	}
+	if b == nil {
+		return records, nil
+	}
+	var expired [][]byte
+	err = b.ForEach(func(key, data []byte) error {
+		var r lockRecord
+		if err := json.Unmarshal(data, &r); err != nil {
+			fs.Errorf(nil, "Ignoring lock %q: %v: %v", key, errLockRecordCorrupt, err)
+			return nil
+		}
+		if r.expired(now) && !l._isHeld(r.Token) {
+			expired = append(expired, append([]byte(nil), key...))
+			return nil
+		}
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if prune {
+		for _, key := range expired {
+			if err := b.Delete(key); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return records, nil
+}
+
+// Find the lock with token in b or memory
+//
+// Call with the lock held
+func (l *Locks) _find(b kv.Bucket, now time.Time, token string) (r lockRecord, persisted bool, err error) {
+	if r, found := l.mem[token]; found && (!r.expired(now) || l._isHeld(token)) {
+		return r, false, nil
+	}
+	if b != nil {
+		if data := b.Get([]byte(token)); data != nil {
+			if err := json.Unmarshal(data, &r); err != nil {
+				return r, true, fmt.Errorf("%w: %v", errLockRecordCorrupt, err)
+			}
+			if !r.expired(now) || l._isHeld(token) {
+				return r, true, nil
+			}
+		}
+	}
+	return r, false, ErrNoSuchLock
+}
+
+// Save r to b if persisted or memory otherwise
+func (l *Locks) _save(b kv.Bucket, r lockRecord, persisted bool) error {
+	if !persisted {
+		l.mem[r.Token] = r
+		return nil
+	}
+	data, err := json.Marshal(&r)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(r.Token), data)
+}
+
+// Create a new lock on lock.Root returning its token.
+//
+// Only lock.Root, lock.Owner, lock.ZeroDepth and lock.Duration are
+// used. If persist is set the lock is saved in the lock database,
+// otherwise it is kept in memory only.
+//
+// It returns ErrLocked if the lock conflicts with an existing lock.
+func (l *Locks) Create(now time.Time, lock Lock, persist bool) (token string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r := lockRecord{
+		Token:     "opaquelocktoken:" + uuid.New().String(),
+		Path:      l.abs(lock.Root),
+		Owner:     lock.Owner,
+		ZeroDepth: lock.ZeroDepth,
+	}
+	r.setDuration(now, lock.Duration)
+	err = l._do(true, func(b kv.Bucket) error {
+		records, err := l._records(b, now, true)
+		if err != nil {
+			return err
+		}
+		for _, existing := range records {
+			if existing.covers(r.Path) || (!r.ZeroDepth && isParent(r.Path, existing.Path)) {
+				return ErrLocked
+			}
+		}
+		return l._save(b, r, persist && b != nil)
+	})
+	if err != nil {
+		return "", err
+	}
+	return r.Token, nil
+}
+
+// Refresh the lock with token to last for duration from now.
+//
+// It returns ErrNoSuchLock if the lock doesn't exist or ErrLocked if
+// it is held.
+func (l *Locks) Refresh(now time.Time, token string, duration time.Duration) (lock Lock, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l._isHeld(token) {
+		return lock, ErrLocked
+	}
+	err = l._do(true, func(b kv.Bucket) error {
+		r, persisted, err := l._find(b, now, token)
+		if err != nil {
+			return err
+		}
+		r.setDuration(now, duration)
+		lock = l.toLock(r)
+		return l._save(b, r, persisted)
+	})
+	return lock, err
+}
+
+// Unlock removes the lock with token.
+//
+// It returns ErrNoSuchLock if the lock doesn't exist or ErrLocked if
+// it is held.
+func (l *Locks) Unlock(now time.Time, token string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l._isHeld(token) {
+		return ErrLocked
+	}
+	return l._do(true, func(b kv.Bucket) error {
+		_, persisted, err := l._find(b, now, token)
+		if err != nil {
+			return err
+		}
+		if !persisted {
+			delete(l.mem, token)
+			return nil
+		}
+		return b.Delete([]byte(token))
+	})
+}
+
+// Confirm checks that the locks with the tokens given cover the paths
+// name0 and name1, ignoring empty names, and holds the locks for h
+// until release is called. While held the locks can't expire, be
+// refreshed or be unlocked and the VFS allows operations done with h
+// to modify the paths they cover.
+//
+// It returns ErrLockNotConfirmed if no lock in tokens which isn't
+// already held covers one of the names.
+func (l *Locks) Confirm(now time.Time, h *LockHolder, name0, name1 string, tokens ...string) (release func(), err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var hold []string
+	err = l._do(false, func(b kv.Bucket) error {
+		records, err := l._records(b, now, false)
+		if err != nil {
+			return err
+		}
+		for _, name := range []string{name0, name1} {
+			if name == "" {
+				continue
+			}
+			p := l.abs(name)
+			found := ""
+			for _, r := range records {
+				if !l._isHeld(r.Token) && r.covers(p) && slices.Contains(tokens, r.Token) {
+					found = r.Token
+					break
+				}
+			}
+			if found == "" {
+				return ErrLockNotConfirmed
+			}
+			if !slices.Contains(hold, found) {
+				hold = append(hold, found)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range hold {
+		l.held[token] = struct{}{}
+	}
+	h.set(true, hold)
+	return func() {
+		h.set(false, hold)
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, token := range hold {
+			delete(l.held, token)
+		}
+	}, nil
+}
+
+// List returns the current locks
+func (l *Locks) List(now time.Time) (locks []Lock, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	err = l._do(false, func(b kv.Bucket) error {
+		records, err := l._records(b, now, false)
+		for _, r := range records {
+			locks = append(locks, l.toLock(r))
+		}
+		return err
+	})
+	return locks, err
+}
+
+// locked returns the lock which stops name being modified by h if any.
+//
+// If recursive is set then locks on anything within name count too.
+func (l *Locks) locked(now time.Time, h *LockHolder, name string, recursive bool) (lock *Lock, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p := l.abs(name)
+	err = l._do(false, func(b kv.Bucket) error {
+		records, err := l._records(b, now, false)
+		if err != nil {
+			return err
+		}
+		for _, r := range records {
+			if h.holds(r.Token) {
+				continue
+			}
+			if r.covers(p) || (recursive && isParent(p, r.Path)) {
+				found := l.toLock(r)
+				lock = &found
+				return nil
+			}
+		}
+		return nil
+	})
+	return lock, err
+}
+
+// Locks returns the lock manager for the VFS, starting it if
+// necessary.
+//
+// The VFS only refuses to modify locked paths if --vfs-locks is set.
+func (vfs *VFS) Locks() *Locks {
+	vfs.locksMu.Lock()
+	defer vfs.locksMu.Unlock()
+	if vfs.locks == nil {
+		vfs.locks = newLocks(vfs.f)
+	}
+	return vfs.locks
+}
+
+// checkLocked returns EPERM if --vfs-locks is set and name is locked
+// by a lock which isn't held by the LockHolder in ctx. If recursive is
+// set then locks within name are checked too.
+func (vfs *VFS) checkLocked(ctx context.Context, name string, recursive bool) error {
+	if !vfs.Opt.Locks {
+		return nil
+	}
+	lock, err := vfs.Locks().locked(time.Now(), getLockHolder(ctx), name, recursive)
+	if err != nil {
+		fs.Errorf(name, "Failed to read locks: %v", err)
+		return err
+	}
+	if lock != nil {
+		fs.Infof(name, "Can't modify as locked by %q on %q", lock.Token, lock.Root)
+		return EPERM
+	}
+	return nil
+}
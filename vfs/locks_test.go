@@ -0,0 +1,163 @@
+package vfs
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocks(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.Locks = true
+	r, vfs := newTestVFSOpt(t, &opt)
+	ctx := context.Background()
+	r.WriteObject(ctx, "dir/file1", "file1 contents", t1)
+	r.WriteObject(ctx, "dir/sub/file2", "file2 contents", t1)
+	locks := vfs.Locks()
+	now := time.Now()
+
+	// Lock a file
+	token, err := locks.Create(now, Lock{Root: "/dir/file1", Owner: "me", Duration: -1}, true)
+	require.NoError(t, err)
+	assert.Contains(t, token, "opaquelocktoken:")
+
+	list, err := locks.List(now)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, Lock{Token: token, Root: "dir/file1", Owner: "me", Duration: -1}, list[0])
+
+	// Conflicting locks
+	_, err = locks.Create(now, Lock{Root: "dir/file1", ZeroDepth: true, Duration: -1}, false)
+	assert.Equal(t, ErrLocked, err)
+	_, err = locks.Create(now, Lock{Root: "dir", Duration: -1}, false)
+	assert.Equal(t, ErrLocked, err)
+
+	// A zero depth lock on the parent doesn't conflict
+	dirToken, err := locks.Create(now, Lock{Root: "dir", ZeroDepth: true, Duration: -1}, false)
+	require.NoError(t, err)
+	require.NoError(t, locks.Unlock(now, dirToken))
+
+	// The file can't be modified
+	_, err = vfs.OpenFile("dir/file1", os.O_WRONLY|os.O_TRUNC, 0666)
+	assert.Equal(t, EPERM, err)
+	assert.Equal(t, EPERM, vfs.Remove("dir/file1"))
+	assert.Equal(t, EPERM, vfs.Rename("dir/file1", "dir/file3"))
+	assert.Equal(t, EPERM, vfs.Rename("dir/sub/file2", "dir/file1"))
+	node, err := vfs.Stat("dir")
+	require.NoError(t, err)
+	assert.Equal(t, EPERM, node.RemoveAll())
+
+	// But can be read and other files modified
+	data, err := vfs.ReadFile("dir/file1")
+	require.NoError(t, err)
+	assert.Equal(t, "file1 contents", string(data))
+	require.NoError(t, vfs.WriteFile("dir/sub/file2", []byte("new"), 0666))
+
+	// Another VFS on the same remote sees the lock
+	opt.NoModTime = true // so New doesn't reuse vfs
+	vfs2 := New(r.Fremote, &opt)
+	defer vfs2.Shutdown()
+	require.NotEqual(t, vfs, vfs2)
+	assert.Equal(t, EPERM, vfs2.Remove("dir/file1"))
+
+	// Confirm
+	holder := NewLockHolder()
+	_, err = locks.Confirm(now, holder, "dir/file1", "", "potato")
+	assert.Equal(t, ErrLockNotConfirmed, err)
+	release, err := locks.Confirm(now, holder, "dir/file1", "", token)
+	require.NoError(t, err)
+
+	// Can't confirm, refresh or unlock a held lock
+	_, err = locks.Confirm(now, NewLockHolder(), "dir/file1", "", token)
+	assert.Equal(t, ErrLockNotConfirmed, err)
+	_, err = locks.Refresh(now, token, time.Hour)
+	assert.Equal(t, ErrLocked, err)
+	assert.Equal(t, ErrLocked, locks.Unlock(now, token))
+
+	// Only the holder can write the file
+	holderCtx := WithLockHolder(ctx, holder)
+	assert.Equal(t, EPERM, vfs.WriteFile("dir/file1", []byte("not held"), 0666))
+	_, err = vfs.OpenFileContext(WithLockHolder(ctx, NewLockHolder()), "dir/file1", os.O_WRONLY|os.O_TRUNC, 0666)
+	assert.Equal(t, EPERM, err)
+	fd, err := vfs.OpenFileContext(holderCtx, "dir/file1", os.O_WRONLY|os.O_TRUNC, 0666)
+	require.NoError(t, err)
+	_, err = fd.Write([]byte("locked"))
+	require.NoError(t, err)
+	require.NoError(t, fd.Close())
+	release()
+	_, err = vfs.OpenFileContext(holderCtx, "dir/file1", os.O_WRONLY|os.O_TRUNC, 0666)
+	assert.Equal(t, EPERM, err)
+
+	// Refresh
+	lock, err := locks.Refresh(now, token, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "dir/file1", lock.Root)
+	assert.Equal(t, time.Minute, lock.Duration)
+	assert.Equal(t, now.Add(time.Minute), lock.Expires)
+
+	// Locks expire
+	assert.Equal(t, EPERM, vfs.Remove("dir/file1"))
+	_, err = locks.Refresh(now, token, time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+	_, err = locks.Refresh(time.Now(), token, time.Minute)
+	assert.Equal(t, ErrNoSuchLock, err)
+	list, err = locks.List(time.Now())
+	require.NoError(t, err)
+	assert.Len(t, list, 0)
+
+	// Unlock
+	now = time.Now()
+	token, err = locks.Create(now, Lock{Root: "dir", Duration: time.Hour}, true)
+	require.NoError(t, err)
+	assert.Equal(t, EPERM, vfs.WriteFile("dir/sub/file2", []byte("new"), 0666))
+	assert.Equal(t, EPERM, vfs.Mkdir("dir/newdir", 0777))
+	require.NoError(t, locks.Unlock(now, token))
+	assert.Equal(t, ErrNoSuchLock, locks.Unlock(now, token))
+	require.NoError(t, vfs.WriteFile("dir/sub/file2", []byte("new"), 0666))
+	require.NoError(t, vfs.Remove("dir/file1"))
+}
+
+func TestLocksHolderRemoveAll(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.Locks = true
+	r, vfs := newTestVFSOpt(t, &opt)
+	ctx := context.Background()
+	r.WriteObject(ctx, "dir/sub/file", "contents", t1)
+	locks := vfs.Locks()
+	now := time.Now()
+
+	token, err := locks.Create(now, Lock{Root: "dir", Duration: -1}, false)
+	require.NoError(t, err)
+	assert.Equal(t, EPERM, vfs.RemoveAllContext(ctx, "dir"))
+	assert.Equal(t, EPERM, vfs.MkdirContext(ctx, "dir/new", 0777))
+	assert.Equal(t, EPERM, vfs.RenameContext(ctx, "dir/sub/file", "dir/sub/file2"))
+
+	// The holder can modify anything within the lock
+	holder := NewLockHolder()
+	release, err := locks.Confirm(now, holder, "dir", "", token)
+	require.NoError(t, err)
+	defer release()
+	holderCtx := WithLockHolder(ctx, holder)
+	require.NoError(t, vfs.MkdirContext(holderCtx, "dir/new", 0777))
+	require.NoError(t, vfs.RenameContext(holderCtx, "dir/sub/file", "dir/sub/file2"))
+	require.NoError(t, vfs.RemoveAllContext(holderCtx, "dir"))
+	_, err = vfs.Stat("dir")
+	assert.Equal(t, ENOENT, err)
+}
+
+func TestLocksNotEnforced(t *testing.T) {
+	_, vfs := newTestVFS(t)
+	assert.NoError(t, vfs.checkLocked(context.Background(), "file", true))
+	assert.Nil(t, vfs.locks)
+
+	// Without --vfs-locks the VFS doesn't check locks
+	_, err := vfs.Locks().Create(time.Now(), Lock{Root: "file", Duration: -1}, false)
+	require.NoError(t, err)
+	assert.NoError(t, vfs.checkLocked(context.Background(), "file", true))
+}
@@ -0,0 +1,130 @@
+package vfs
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rclone/rclone/fs"
+	"github.com/rclone/rclone/fs/walk"
+)
+
+// Operations which can be allowed with --vfs-operations
+const (
+	OpRead   = "read"   // read files
+	OpWrite  = "write"  // create and modify files
+	OpMkdir  = "mkdir"  // create directories
+	OpDelete = "delete" // remove files and directories
+	OpRename = "rename" // rename files and directories
+)
+
+// Operations is all the operations which can be allowed with --vfs-operations
+var Operations = []string{OpRead, OpWrite, OpMkdir, OpDelete, OpRename}
+
+// parseOperations parses the comma separated list of operations in
+// s returning nil if all operations are allowed
+func parseOperations(f fs.Fs, s string) (operations []string) {
+	if s == "" {
+		return nil
+	}
+	operations = []string{}
+	for op := range strings.SplitSeq(s, ",") {
+		op = strings.ToLower(strings.TrimSpace(op))
+		if op == "" {
+			continue
+		}
+		if !slices.Contains(Operations, op) {
+			fs.Errorf(f, "Ignoring unknown VFS operation %q - expecting one of %s", op, strings.Join(Operations, ","))
+			continue
+		}
+		operations = append(operations, op)
+	}
+	return operations
+}
+
+// checkOperation returns EPERM if op isn't allowed
+func (vfs *VFS) checkOperation(op string) error {
+	if vfs.operations == nil || slices.Contains(vfs.operations, op) {
+		return nil
+	}
+	fs.Infof(vfs.f, "Refusing %s operation as it isn't allowed by --vfs-operations", op)
+	return EPERM
+}
+
+// _quotaCount counts the bytes used in the VFS unless they have been
+// counted within --dir-cache-time. The bytes in the cache waiting to
+// be uploaded are counted too.
+//
+// quotaMu isn't held while counting so writes aren't held up.
+//
+// Call with quotaBusy held
+func (vfs *VFS) _quotaCount(ctx context.Context) int64 {
+	vfs.quotaMu.Lock()
+	if !vfs.quotaTime.IsZero() && time.Since(vfs.quotaTime) < time.Duration(vfs.Opt.DirCacheTime) {
+		used := vfs.quotaUsed
+		vfs.quotaMu.Unlock()
+		return used
+	}
+	vfs.quotaMu.Unlock()
+
+	// Algorithm from `rclone size`
+	var used int64
+	err := walk.ListR(ctx, vfs.f, "", true, -1, walk.ListObjects, func(entries fs.DirEntries) error {
+		entries.ForObject(func(o fs.Object) {
+			used += max(o.Size(), 0)
+		})
+		return nil
+	})
+	if err == nil && vfs.cache != nil {
+		used += vfs.cache.PendingBytes()
+	}
+
+	vfs.quotaMu.Lock()
+	defer vfs.quotaMu.Unlock()
+	if err != nil {
+		// quotaTime isn't updated so we count again next time
+		fs.Errorf(vfs.f, "Failed to count space used for quota: %v", err)
+		return vfs.quotaUsed
+	}
+	vfs.quotaUsed = max(used, 0)
+	vfs.quotaTime = time.Now()
+	return vfs.quotaUsed
+}
+
+// quotaUsage returns the bytes used in the VFS for the quota, counting
+// them again if they haven't been counted for --dir-cache-time
+//
+// If they are already being counted the previous count is used if
+// there is one.
+func (vfs *VFS) quotaUsage(ctx context.Context) int64 {
+	vfs.quotaMu.Lock()
+	used, counted := vfs.quotaUsed, !vfs.quotaTime.IsZero()
+	vfs.quotaMu.Unlock()
+	if !vfs.quotaBusy.TryLock() {
+		if counted {
+			return used
+		}
+		vfs.quotaBusy.Lock()
+	}
+	defer vfs.quotaBusy.Unlock()
+	return vfs._quotaCount(ctx)
+}
+
+// quotaAdd adds delta bytes to the space used, returning ENOSPC if
+// that would take it over the quota
+func (vfs *VFS) quotaAdd(ctx context.Context, delta int64) error {
+	if vfs.Opt.Quota < 0 || delta == 0 {
+		return nil
+	}
+	vfs.quotaUsage(ctx)
+	vfs.quotaMu.Lock()
+	defer vfs.quotaMu.Unlock()
+	used := vfs.quotaUsed
+	if delta > 0 && used+delta > int64(vfs.Opt.Quota) {
+		fs.Infof(vfs.f, "Refusing to write %d bytes as it would exceed the quota of %v", delta, vfs.Opt.Quota)
+		return ENOSPC
+	}
+	vfs.quotaUsed = max(used+delta, 0)
+	return nil
+}
@@ -0,0 +1,125 @@
+package vfs
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rclone/rclone/vfs/vfscommon"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQuota(t *testing.T) {
+	for _, cacheMode := range []vfscommon.CacheMode{vfscommon.CacheModeOff, vfscommon.CacheModeWrites} {
+		t.Run(cacheMode.String(), func(t *testing.T) {
+			opt := vfscommon.Opt
+			opt.CacheMode = cacheMode
+			opt.Quota = 100
+			r, vfs := newTestVFSOpt(t, &opt)
+			r.WriteObject(context.Background(), "existing", "0123456789", t1)
+
+			total, used, free := vfs.Statfs()
+			assert.Equal(t, int64(100), total)
+			assert.Equal(t, int64(10), used)
+			assert.Equal(t, int64(90), free)
+
+			// Writes within the quota succeed
+			require.NoError(t, vfs.WriteFile("file1", make([]byte, 50), 0666))
+			_, used, free = vfs.Statfs()
+			assert.Equal(t, int64(60), used)
+			assert.Equal(t, int64(40), free)
+
+			// Writes over the quota fail
+			err := vfs.WriteFile("file2", make([]byte, 50), 0666)
+			assert.Equal(t, ENOSPC, err)
+
+			// Replacing a file releases its space
+			require.NoError(t, vfs.WriteFile("file1", make([]byte, 80), 0666))
+			_, used, _ = vfs.Statfs()
+			assert.Equal(t, int64(90), used)
+
+			// As does removing it
+			require.NoError(t, vfs.Remove("file1"))
+			_, used, free = vfs.Statfs()
+			assert.Equal(t, int64(10), used)
+			assert.Equal(t, int64(90), free)
+		})
+	}
+}
+
+func TestQuotaTruncate(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.CacheMode = vfscommon.CacheModeWrites
+	opt.Quota = 100
+	_, vfs := newTestVFSOpt(t, &opt)
+
+	require.NoError(t, vfs.WriteFile("file", make([]byte, 50), 0666))
+	fh, err := vfs.OpenFile("file", os.O_RDWR, 0666)
+	require.NoError(t, err)
+	assert.Equal(t, ENOSPC, fh.Truncate(101))
+	require.NoError(t, fh.Truncate(10))
+	require.NoError(t, fh.Truncate(100))
+	require.NoError(t, fh.Close())
+
+	_, used, _ := vfs.Statfs()
+	assert.Equal(t, int64(100), used)
+}
+
+func TestQuotaPendingUploads(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.CacheMode = vfscommon.CacheModeWrites
+	opt.WriteBack = writeBackDelay
+	opt.Quota = 100
+	r, vfs := newTestVFSOpt(t, &opt)
+	r.WriteObject(context.Background(), "existing", "0123456789", t1)
+
+	// Keep the file open so it isn't uploaded
+	fh, err := vfs.OpenFile("file", os.O_RDWR|os.O_CREATE, 0666)
+	require.NoError(t, err)
+	_, err = fh.Write(make([]byte, 50))
+	require.NoError(t, err)
+	assert.Equal(t, int64(50), vfs.cache.PendingBytes())
+
+	// Counting again keeps the bytes waiting to be uploaded
+	vfs.quotaMu.Lock()
+	vfs.quotaTime = time.Time{}
+	vfs.quotaMu.Unlock()
+	_, used, _ := vfs.Statfs()
+	assert.Equal(t, int64(60), used)
+	assert.Equal(t, ENOSPC, vfs.WriteFile("file2", make([]byte, 50), 0666))
+	require.NoError(t, fh.Close())
+}
+
+func TestOperations(t *testing.T) {
+	opt := vfscommon.Opt
+	opt.Operations = "read, mkdir,potato"
+	r, vfs := newTestVFSOpt(t, &opt)
+	r.WriteObject(context.Background(), "file", "contents", t1)
+	assert.Equal(t, []string{OpRead, OpMkdir}, vfs.operations)
+
+	// Allowed operations
+	data, err := vfs.ReadFile("file")
+	require.NoError(t, err)
+	assert.Equal(t, "contents", string(data))
+	require.NoError(t, vfs.Mkdir("dir", 0777))
+
+	// Refused operations
+	assert.Equal(t, EPERM, vfs.WriteFile("file", []byte("new"), 0666))
+	assert.Equal(t, EPERM, vfs.WriteFile("newfile", []byte("new"), 0666))
+	assert.Equal(t, EPERM, vfs.Remove("file"))
+	assert.Equal(t, EPERM, vfs.Remove("dir"))
+	assert.Equal(t, EPERM, vfs.Rename("file", "file2"))
+
+	// Write only
+	opt.Operations = "write"
+	r2, vfs2 := newTestVFSOpt(t, &opt)
+	r2.WriteObject(context.Background(), "file", "contents", t1)
+	_, err = vfs2.ReadFile("file")
+	assert.Equal(t, EPERM, err)
+	require.NoError(t, vfs2.WriteFile("newfile", []byte("new"), 0666))
+
+	// All operations are allowed by default
+	assert.Nil(t, parseOperations(nil, ""))
+}
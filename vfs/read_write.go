@@ -1,6 +1,7 @@
 package vfs
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -344,6 +345,11 @@ func (fh *RWFileHandle) _writeAt(b []byte, off int64, release bool) (n int, err
 		fh.offset = size
 		off = fh.offset
 	}
+	if end := off + int64(len(b)); end > fh._size() {
+		if err = fh.d.vfs.quotaAdd(context.TODO(), end-fh._size()); err != nil {
+			return n, err
+		}
+	}
 	fh.writeCalled = true
 	if release {
 		// Do the writing with fh.mu unlocked
@@ -393,6 +399,9 @@ func (fh *RWFileHandle) _truncate(size int64) (err error) {
 	if size == fh._size() {
 		return nil
 	}
+	if err = fh.d.vfs.quotaAdd(context.TODO(), size-fh._size()); err != nil {
+		return err
+	}
 	fh.file.setSize(size)
 	return fh.item.Truncate(size)
 }
@@ -185,6 +185,13 @@ type VFS struct {
 	usage       *fs.Usage
 	pollChan    chan time.Duration
 	inUse       atomic.Int32 // count of number of opens
+	locksMu     sync.Mutex
+	locks       *Locks // lock manager - nil until started
+	quotaMu     sync.Mutex
+	quotaTime   time.Time  // time quotaUsed was last counted
+	quotaUsed   int64      // bytes used for Opt.Quota
+	quotaBusy   sync.Mutex // held while quotaUsed is being counted
+	operations  []string   // operations allowed if Opt.Operations is set
 }
 
 // Keep track of active VFS keyed on fs.ConfigString(f)
@@ -249,6 +256,9 @@ func New(f fs.Fs, opt *vfscommon.Options) *VFS {
 		fs.Logf(f, "Symlinks support enabled")
 	}
 
+	// Check the allowed operations
+	vfs.operations = parseOperations(f, vfs.Opt.Operations)
+
 	// Pin the Fs into the cache so that when we use cache.NewFs
 	// with the same remote string we get this one. The Pin is
 	// removed when the vfs is finalized
@@ -368,6 +378,13 @@ func (vfs *VFS) Shutdown() {
 
 	vfs.shutdownCache()
 
+	vfs.locksMu.Lock()
+	if vfs.locks != nil {
+		vfs.locks.stop()
+		vfs.locks = nil
+	}
+	vfs.locksMu.Unlock()
+
 	if vfs.pollChan != nil {
 		close(vfs.pollChan)
 		vfs.pollChan = nil
@@ -518,6 +535,12 @@ func decodeOpenFlags(flags int) string {
 
 // OpenFile a file according to the flags and perm provided
 func (vfs *VFS) OpenFile(name string, flags int, perm os.FileMode) (fd Handle, err error) {
+	return vfs.OpenFileContext(context.TODO(), name, flags, perm)
+}
+
+// OpenFileContext opens a file like OpenFile using the locks held by
+// the LockHolder in ctx, if any.
+func (vfs *VFS) OpenFileContext(ctx context.Context, name string, flags int, perm os.FileMode) (fd Handle, err error) {
 	defer log.Trace(name, "flags=%s, perm=%v", decodeOpenFlags(flags), perm)("fd=%v, err=%v", &fd, &err)
 
 	// http://pubs.opengroup.org/onlinepubs/7908799/xsh/open.html
@@ -542,6 +565,9 @@ func (vfs *VFS) OpenFile(name string, flags int, perm os.FileMode) (fd Handle, e
 			return nil, err
 		}
 	}
+	if f, ok := node.(*File); ok {
+		return f.openContext(ctx, flags)
+	}
 	return node.Open(flags)
 }
 
@@ -562,6 +588,12 @@ func (vfs *VFS) Create(name string) (Handle, error) {
 
 // Rename oldName to newName
 func (vfs *VFS) Rename(oldName, newName string) error {
+	return vfs.RenameContext(context.TODO(), oldName, newName)
+}
+
+// RenameContext renames oldName to newName like Rename using the locks
+// held by the LockHolder in ctx, if any.
+func (vfs *VFS) RenameContext(ctx context.Context, oldName, newName string) error {
 	// find the parent directories
 	oldDir, oldLeaf, err := vfs.StatParent(oldName)
 	if err != nil {
@@ -571,7 +603,7 @@ func (vfs *VFS) Rename(oldName, newName string) error {
 	if err != nil {
 		return err
 	}
-	err = oldDir.Rename(oldLeaf, newLeaf, newDir)
+	err = oldDir.renameContext(ctx, oldLeaf, newLeaf, newDir)
 	if err != nil {
 		return err
 	}
@@ -666,6 +698,13 @@ func (vfs *VFS) Statfs() (total, used, free int64) {
 		total = int64(vfs.Opt.DiskSpaceTotalSize)
 	}
 
+	// Report the quota if set
+	if vfs.Opt.Quota >= 0 {
+		total = int64(vfs.Opt.Quota)
+		used = vfs.quotaUsage(context.TODO())
+		free = max(total-used, 0)
+	}
+
 	total, used, free = fillInMissingSizes(total, used, free, unknownFreeBytes)
 	return
 }
@@ -683,6 +722,28 @@ func (vfs *VFS) Remove(name string) error {
 	return nil
 }
 
+// removeAllContext removes node and any contents using the locks held
+// in ctx
+func removeAllContext(ctx context.Context, node Node) error {
+	switch x := node.(type) {
+	case *Dir:
+		return x.removeAllContext(ctx)
+	case *File:
+		return x.removeContext(ctx)
+	}
+	return node.RemoveAll()
+}
+
+// RemoveAllContext removes the named file or directory and any
+// contents using the locks held by the LockHolder in ctx, if any.
+func (vfs *VFS) RemoveAllContext(ctx context.Context, name string) error {
+	node, err := vfs.Stat(name)
+	if err != nil {
+		return err
+	}
+	return removeAllContext(ctx, node)
+}
+
 // Chtimes changes the access and modification times of the named file, similar
 // to the Unix utime() or utimes() functions.
 //
@@ -717,6 +778,17 @@ func (vfs *VFS) Mkdir(name string, perm os.FileMode) error {
 	return err
 }
 
+// MkdirContext creates a new directory like Mkdir using the locks held
+// by the LockHolder in ctx, if any.
+func (vfs *VFS) MkdirContext(ctx context.Context, name string, perm os.FileMode) error {
+	dir, leaf, err := vfs.StatParent(name)
+	if err != nil {
+		return err
+	}
+	_, err = dir.mkdirContext(ctx, leaf)
+	return err
+}
+
 // mkdirAll creates a new directory with the specified name and
 // permission bits (before umask) and all of its parent directories up
 // to the root.
@@ -77,6 +77,8 @@ type AddVirtualFn func(remote string, size int64, isDir bool) error
 // This starts background goroutines which can be cancelled with the
 // context passed in.
 func New(ctx context.Context, fremote fs.Fs, opt *vfscommon.Options, avFn AddVirtualFn) (*Cache, error) {
+	registerMetrics()
+
 	// Get cache root path.
 	// We need it in two variants: OS path as an absolute path with UNC prefix,
 	// OS-specific path separators, and encoded with OS-specific encoder. Standard path
@@ -594,6 +596,11 @@ func (c *Cache) removeNotInUse(item *Item, maxAge time.Duration, emptyOnly bool)
 	// The item will not be removed or reset the cache data is dirty (DataDirty)
 	c.used -= spaceFreed
 	if removed {
+		reason := evictAge
+		if maxAge == 0 {
+			reason = evictQuota
+		}
+		DefaultMetrics.onEvict(c, reason, spaceFreed)
 		fs.Infof(c.fremote, "vfs cache RemoveNotInUse (maxAge=%d, emptyOnly=%v): item %s was removed, freed %d bytes", maxAge, emptyOnly, item.GetName(), spaceFreed)
 		// Remove the entry
 		delete(c.item, item.name)
@@ -655,6 +662,9 @@ func (c *Cache) purgeClean() {
 		// The item space might be freed even if we get an error after the cache file is removed
 		// The item will not be removed or reset if the cache data is dirty (DataDirty)
 		c.used -= spaceFreed
+		if spaceFreed > 0 {
+			DefaultMetrics.onEvict(c, evictSpace, spaceFreed)
+		}
 		fs.Infof(c.fremote, "vfs cache purgeClean item.Reset %s: %s, freed %d bytes", item.GetName(), resetResult.String(), spaceFreed)
 		if resetResult == RemovedNotInUse {
 			delete(c.item, item.name)
@@ -875,6 +885,18 @@ func (c *Cache) TotalInUse() (n int) {
 	return n
 }
 
+// PendingBytes returns the number of bytes the dirty items in the
+// cache will add to the remote once they have been uploaded. This may
+// be negative if files have been truncated.
+func (c *Cache) PendingBytes() (n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, item := range c.item {
+		n += item.pendingSize()
+	}
+	return n
+}
+
 // Dump the cache into a string for debugging purposes
 func (c *Cache) Dump() string {
 	if c == nil {
@@ -122,6 +122,7 @@ func TestCacheNew(t *testing.T) {
 	assert.Contains(t, c.root, "vfs")
 	assert.Contains(t, c.fcache.Root(), filepath.Base(r.Fremote.Root()))
 	assert.Equal(t, []string(nil), itemAsString(c))
+	assert.NotNil(t, DefaultMetrics, "metrics registered")
 
 	// createItemDir
 	p, err := c.createItemDir("potato")
@@ -460,6 +460,21 @@ func (item *Item) IsDirty() bool {
 	return item.info.Dirty
 }
 
+// pendingSize returns the bytes the item will add to the remote when
+// it has been uploaded, or 0 if it isn't dirty
+func (item *Item) pendingSize() int64 {
+	item.mu.Lock()
+	defer item.mu.Unlock()
+	if !item.info.Dirty {
+		return 0
+	}
+	size := item.info.Size
+	if item.o != nil {
+		size -= max(item.o.Size(), 0)
+	}
+	return size
+}
+
 // Create the cache file and store the metadata on disk
 // Called with item.mu locked
 func (item *Item) _createFile(osPath string) (err error) {
@@ -1145,6 +1160,7 @@ func (item *Item) _ensure(offset, size int64) (err error) {
 		return errors.New("no space left on device")
 	} */
 	fs.Debugf(nil, "vfs cache: looking for range=%+v in %+v - present %v", r, item.info.Rs, present)
+	DefaultMetrics.onRead(item.c, present)
 	item.mu.Unlock()
 	defer item.mu.Lock()
 	if present {
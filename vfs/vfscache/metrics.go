@@ -0,0 +1,117 @@
+package vfscache
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rclone/rclone/fs"
+)
+
+// Metrics provide VFS cache metrics.
+type Metrics struct {
+	Hits         *prometheus.CounterVec
+	Misses       *prometheus.CounterVec
+	Evictions    *prometheus.CounterVec
+	EvictedBytes *prometheus.CounterVec
+}
+
+// NewMetrics creates a new metrics instance, the instance shall be assigned to
+// DefaultMetrics before any processing takes place.
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		Hits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "vfs_cache",
+			Name:      "hits_total",
+			Help:      "Number of reads from the VFS cache which found the data cached",
+		}, []string{"remote"}),
+		Misses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "vfs_cache",
+			Name:      "misses_total",
+			Help:      "Number of reads from the VFS cache which had to download the data",
+		}, []string{"remote"}),
+		Evictions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "vfs_cache",
+			Name:      "evictions_total",
+			Help:      "Number of files removed or emptied from the VFS cache by reason",
+		}, []string{"remote", "reason"}),
+		EvictedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "vfs_cache",
+			Name:      "evicted_bytes_total",
+			Help:      "Bytes freed by removing or emptying files in the VFS cache",
+		}, []string{"remote", "reason"}),
+	}
+}
+
+// DefaultMetrics are the metrics updated by the VFS cache.
+//
+// They are registered when the first Cache is made unless they have
+// been set already.
+var DefaultMetrics = (*Metrics)(nil)
+
+var registerMetricsOnce sync.Once
+
+// registerMetrics makes and registers DefaultMetrics if not set
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		if DefaultMetrics != nil {
+			return
+		}
+		m := NewMetrics("rclone")
+		for _, c := range m.Collectors() {
+			prometheus.MustRegister(c)
+		}
+		DefaultMetrics = m
+	})
+}
+
+// Collectors returns all prometheus metrics as collectors for registration.
+func (m *Metrics) Collectors() []prometheus.Collector {
+	if m == nil {
+		return nil
+	}
+	return []prometheus.Collector{
+		m.Hits,
+		m.Misses,
+		m.Evictions,
+		m.EvictedBytes,
+	}
+}
+
+// Reasons for evicting items from the cache
+const (
+	evictAge   = "age"   // older than --vfs-cache-max-age
+	evictQuota = "quota" // over --vfs-cache-max-size or --vfs-cache-min-free-space
+	evictSpace = "space" // emptied as the disk ran out of space
+)
+
+// remoteLabel returns the label for the remote of c
+func (c *Cache) remoteLabel() string {
+	return fs.LimitName(c.fremote.Name())
+}
+
+// onRead records a read from the cache which found the data present
+// or not
+func (m *Metrics) onRead(c *Cache, present bool) {
+	if m == nil {
+		return
+	}
+	if present {
+		m.Hits.WithLabelValues(c.remoteLabel()).Inc()
+	} else {
+		m.Misses.WithLabelValues(c.remoteLabel()).Inc()
+	}
+}
+
+// onEvict records an item being evicted from the cache
+func (m *Metrics) onEvict(c *Cache, reason string, spaceFreed int64) {
+	if m == nil {
+		return
+	}
+	label := c.remoteLabel()
+	m.Evictions.WithLabelValues(label, reason).Inc()
+	m.EvictedBytes.WithLabelValues(label, reason).Add(float64(spaceFreed))
+}
@@ -170,6 +170,21 @@ var OptionsInfo = fs.Options{{
 	Default: "",
 	Help:    "Set the extension to read metadata from.",
 	Groups:  "VFS",
+}, {
+	Name:    "vfs_locks",
+	Default: false,
+	Help:    "Refuse to modify files locked by rclone serve webdav",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_quota",
+	Default: fs.SizeSuffix(-1),
+	Help:    "Maximum space the files in the VFS may use",
+	Groups:  "VFS",
+}, {
+	Name:    "vfs_operations",
+	Default: "",
+	Help:    "Comma separated operations to allow from read,write,mkdir,delete,rename (default all)",
+	Groups:  "VFS",
 }}
 
 func init() {
@@ -210,6 +225,9 @@ type Options struct {
 	FastFingerprint    bool          `config:"vfs_fast_fingerprint"` // if set use fast fingerprints
 	DiskSpaceTotalSize fs.SizeSuffix `config:"vfs_disk_space_total_size"`
 	MetadataExtension  string        `config:"vfs_metadata_extension"` // if set respond to files with this extension with metadata
+	Locks              bool          `config:"vfs_locks"`              // if set enforce the persistent locks
+	Quota              fs.SizeSuffix `config:"vfs_quota"`              // if >= 0 the maximum bytes the VFS may use
+	Operations         string        `config:"vfs_operations"`         // if set the operations allowed
 }
 
 // Opt is the default options modified by the environment variables and command line flags
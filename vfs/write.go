@@ -80,6 +80,8 @@ func (fh *WriteFileHandle) openPending() (err error) {
 		fh.o = o
 		fh.result <- err
 	}()
+	// The file is replaced so no longer counts towards the quota
+	_ = fh.file.VFS().quotaAdd(context.TODO(), -fh.file.Size())
 	fh.file.setSize(0)
 	fh.truncated = true
 	fh.file.Dir().addObject(fh.file) // make sure the directory has this object in it now
@@ -142,6 +144,9 @@ func (fh *WriteFileHandle) writeAt(p []byte, off int64) (n int, err error) {
 	if err = fh.openPending(); err != nil {
 		return 0, err
 	}
+	if err = fh.file.VFS().quotaAdd(context.TODO(), int64(len(p))); err != nil {
+		return 0, err
+	}
 	fh.writeCalled = true
 	n, err = fh.pipeWriter.Write(p)
 	fh.offset += int64(n)